@@ -56,6 +56,10 @@ type Config struct {
 	// TSIG secrets, [name]key.
 	TsigSecret map[string]string
 
+	// Updates is set by plugins that handle dynamic updates (RFC 2136) for a zone, only then are UPDATE
+	// messages accepted.
+	Updates bool
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
@@ -44,6 +44,7 @@ type Server struct {
 	debug        bool                 // disable recover()
 	stacktrace   bool                 // enable stacktrace in recover error log
 	classChaos   bool                 // allow non-INET class queries
+	updates      bool                 // accept dynamic updates
 
 	tsigSecret map[string]string
 }
@@ -77,6 +78,9 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 			log.D.Set()
 		}
 		s.stacktrace = site.Stacktrace
+		if site.Updates {
+			s.updates = true
+		}
 
 		// append the config to the zone's configs
 		s.zones[site.Zone] = append(s.zones[site.Zone], site)
@@ -134,7 +138,7 @@ func (s *Server) Serve(l net.Listener) error {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
-	}), TsigSecret: s.tsigSecret}
+	}), TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAcceptFunc}
 	s.m.Unlock()
 
 	return s.server[tcp].ActivateAndServe()
@@ -148,7 +152,7 @@ func (s *Server) ServePacket(p net.PacketConn) error {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
-	}), TsigSecret: s.tsigSecret}
+	}), TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAcceptFunc}
 	s.m.Unlock()
 
 	return s.server[udp].ActivateAndServe()
@@ -250,6 +254,13 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		return
 	}
 
+	// Dynamic updates only reach the plugins if a zone of the server handles them, other plugins, like forward,
+	// shouldn't pass them on.
+	if r.Opcode == dns.OpcodeUpdate && !s.updates {
+		errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+		return
+	}
+
 	if m, err := edns.Version(r); err != nil { // Wrong EDNS version, return at once.
 		w.WriteMsg(m)
 		return
@@ -401,6 +412,20 @@ func errorAndMetricsFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int
 	w.WriteMsg(answer)
 }
 
+// msgAcceptFunc is dns.DefaultMsgAcceptFunc that also accepts dynamic updates (RFC 2136), which may have any
+// number of records in the prerequisite, update and additional sections, if a zone of the server handles them.
+func (s *Server) msgAcceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	opcode := int(dh.Bits>>11) & 0xF
+	if dh.Bits&qr != 0 || opcode != dns.OpcodeUpdate || !s.updates {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+	if dh.Qdcount != 1 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
 const (
 	tcp = 0
 	udp = 1
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/test"
 
@@ -115,3 +116,34 @@ func BenchmarkCoreServeDNS(b *testing.B) {
 		s.ServeDNS(ctx, w, m)
 	}
 }
+
+func TestUpdates(t *testing.T) {
+	update := dns.Header{Bits: dns.OpcodeUpdate << 11, Qdcount: 1}
+
+	configNoUpdates, configUpdates := testConfig("dns", testPlugin{}), testConfig("dns", testPlugin{})
+	configUpdates.Updates = true
+
+	s1, err := NewServer("127.0.0.1:53", []*Config{configUpdates, configNoUpdates})
+	if err != nil {
+		t.Errorf("Expected no error for NewServer, got %s", err)
+	}
+	if a := s1.msgAcceptFunc(update); a != dns.MsgAccept {
+		t.Errorf("Expected updates to be accepted for server s1, got %d", a)
+	}
+
+	s2, err := NewServer("127.0.0.1:53", []*Config{configNoUpdates})
+	if err != nil {
+		t.Errorf("Expected no error for NewServer, got %s", err)
+	}
+	if a := s2.msgAcceptFunc(update); a != dns.MsgRejectNotImplemented {
+		t.Errorf("Expected updates to be rejected for server s2, got %d", a)
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	s2.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeNotImplemented {
+		t.Errorf("Expected NOTIMP for an update to server s2, got %v", rec.Msg)
+	}
+}
@@ -31,11 +31,15 @@ var Directives = []string{
 	"local",
 	"dns64",
 	"acl",
+	"blocklist",
+	"rpz",
+	"ratelimit",
 	"any",
 	"chaos",
 	"loadbalance",
 	"tsig",
 	"cache",
+	"validator",
 	"rewrite",
 	"header",
 	"dnssec",
@@ -55,6 +59,7 @@ var Directives = []string{
 	"etcd",
 	"loop",
 	"forward",
+	"recursive",
 	"grpc",
 	"erratic",
 	"whoami",
@@ -24,6 +24,7 @@ type (
 
 		metrics  *metrics.Metrics
 		transfer *transfer.Transfer
+		watcher  *watcher // Nil if changes are only picked up by scanning the directory.
 		loader
 	}
 
@@ -34,6 +35,9 @@ type (
 
 		ReloadInterval time.Duration
 		upstream       *upstream.Upstream // Upstream for looking up names during the resolution process.
+		updates        *file.Updates      // Configuration for dynamic updates, the journal of each zone is next to its file.
+		catalog        string             // Name of the catalog zone that lists the zones, empty if there is none.
+		sidecar        string             // Suffix of the sidecar files with the options of each zone, empty if not used.
 	}
 )
 
@@ -67,6 +71,13 @@ func (a Auto) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeRefused, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		m := new(dns.Msg)
+		m.SetRcode(r, z.ApplyUpdate(ctx, state))
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+
 	answer, ns, extra, result := z.Lookup(ctx, state, qname)
 
 	m := new(dns.Msg)
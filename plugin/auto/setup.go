@@ -5,15 +5,19 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/metrics"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
 )
 
 var log = clog.NewWithPlugin("auto")
@@ -25,6 +29,9 @@ func setup(c *caddy.Controller) error {
 	if err != nil {
 		return plugin.Error("auto", err)
 	}
+	if a.loader.updates != nil {
+		dnsserver.GetConfig(c).Updates = true
+	}
 
 	c.OnStartup(func() error {
 		m := dnsserver.GetConfig(c).Handler("prometheus")
@@ -41,6 +48,13 @@ func setup(c *caddy.Controller) error {
 	walkChan := make(chan bool)
 
 	c.OnStartup(func() error {
+		if a.loader.ReloadInterval != 0 {
+			w, err := newWatcher()
+			if err != nil {
+				log.Warningf("Not watching %s for changes, only scanning it: %s", a.loader.directory, err)
+			}
+			(&a).watcher = w
+		}
 		err := a.Walk()
 		if err != nil {
 			return err
@@ -51,12 +65,27 @@ func setup(c *caddy.Controller) error {
 		go func() {
 			ticker := time.NewTicker(a.loader.ReloadInterval)
 			defer ticker.Stop()
+			var changed <-chan struct{}
+			if a.watcher != nil {
+				changed = a.watcher.C
+				defer a.watcher.close()
+			}
+			// Changes come in bursts, while files are written, so they are handled after they settle.
+			var settled <-chan time.Time
 			for {
 				select {
 				case <-walkChan:
 					return
 				case <-ticker.C:
 					a.Walk()
+				case <-changed:
+					if settled == nil {
+						settled = time.After(settleTime)
+					}
+				case <-settled:
+					settled = nil
+					a.Walk()
+					a.reload(a.watcher.changes())
 				}
 			}
 		}()
@@ -148,6 +177,49 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 				}
 				a.loader.ReloadInterval = d
 
+			case "update":
+				if a.loader.updates == nil {
+					a.loader.updates = &file.Updates{Writeback: 15 * time.Minute}
+				}
+				for _, k := range c.RemainingArgs() {
+					a.loader.updates.Keys = append(a.loader.updates.Keys, dns.Fqdn(strings.ToLower(k)))
+				}
+
+			case "writeback":
+				if a.loader.updates == nil {
+					return a, c.Err("writeback needs update")
+				}
+				t := c.RemainingArgs()
+				if len(t) != 1 {
+					return a, c.ArgErr()
+				}
+				d, err := time.ParseDuration(t[0])
+				if d < 0 {
+					err = errors.New("invalid duration")
+				}
+				if err != nil {
+					return a, plugin.Error("auto", err)
+				}
+				a.loader.updates.Writeback = d
+
+			case "catalog":
+				if !c.NextArg() {
+					return a, c.ArgErr()
+				}
+				a.loader.catalog = dns.Fqdn(strings.ToLower(c.Val()))
+				if c.NextArg() {
+					return a, c.ArgErr()
+				}
+
+			case "sidecar":
+				a.loader.sidecar = ".conf"
+				if c.NextArg() {
+					a.loader.sidecar = c.Val()
+				}
+				if c.NextArg() {
+					return a, c.ArgErr()
+				}
+
 			case "upstream":
 				// remove soon
 				c.RemainingArgs() // eat remaining args
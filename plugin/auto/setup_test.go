@@ -100,6 +100,21 @@ func TestAutoParse(t *testing.T) {
 			}`,
 			true, "/tmp", "${1}", ``, 60 * time.Second,
 		},
+		{
+			`auto example.org {
+				directory /tmp
+				catalog catalog.example.org
+			}`,
+			false, "/tmp", "${1}", `db\.(.*)`, 60 * time.Second,
+		},
+		// catalog without a zone.
+		{
+			`auto example.org {
+				directory /tmp
+				catalog
+			}`,
+			true, "/tmp", "${1}", `db\.(.*)`, 60 * time.Second,
+		},
 	}
 
 	for i, test := range tests {
@@ -165,6 +180,47 @@ func TestSetupReload(t *testing.T) {
 			}`,
 			wantErr: true,
 		},
+		{
+			name: "update",
+			config: `auto {
+				directory .
+				update dhcp.key.
+				writeback 1m
+			}`,
+			wantErr: false,
+		},
+		{
+			name: "sidecar",
+			config: `auto {
+				directory .
+				sidecar
+			}`,
+			wantErr: false,
+		},
+		{
+			name: "sidecar suffix",
+			config: `auto {
+				directory .
+				sidecar .options
+			}`,
+			wantErr: false,
+		},
+		{
+			name: "sidecar too many arguments",
+			config: `auto {
+				directory .
+				sidecar .options .conf
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "writeback without update",
+			config: `auto {
+				directory .
+				writeback 1m
+			}`,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,111 @@
+package auto
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
+)
+
+// options holds the options of a zone: the ones of the loader, overridden by the ones in the sidecar file of
+// the zone.
+type options struct {
+	reload  time.Duration
+	updates *file.Updates
+	to      []string // Addresses for the transfer plugin, the configured ones if empty.
+
+	sidecar string // Contents of the sidecar file, to see when it changes.
+}
+
+// options returns the options for the zone in the file path. Without a sidecar file, these are the options of l.
+func (l loader) options(path string) (options, error) {
+	o := options{reload: l.ReloadInterval}
+	if l.updates != nil {
+		u := *l.updates
+		o.updates = &u
+	}
+	if l.sidecar == "" {
+		return o, nil
+	}
+
+	buf, err := os.ReadFile(filepath.Clean(path + l.sidecar))
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return o, err
+	}
+	o.sidecar = string(buf)
+
+	// The sidecar file has a directive and its arguments on each line, lines starting with # are comments.
+	s := bufio.NewScanner(strings.NewReader(o.sidecar))
+	for i := 1; s.Scan(); i++ {
+		args := strings.Fields(s.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if err := o.parse(args[0], args[1:]); err != nil {
+			return o, fmt.Errorf("%s:%d: %s", path+l.sidecar, i, err)
+		}
+	}
+	return o, s.Err()
+}
+
+func (o *options) parse(directive string, args []string) error {
+	switch directive {
+	case "reload": // reload DURATION
+		if len(args) != 1 {
+			return errors.New("reload duration value is expected")
+		}
+		d, err := time.ParseDuration(args[0])
+		if d < 0 {
+			err = errors.New("invalid duration")
+		}
+		if err != nil {
+			return err
+		}
+		o.reload = d
+
+	case "transfer": // transfer to ADDRESS...
+		if len(args) < 2 || args[0] != "to" {
+			return errors.New("transfer to addresses are expected")
+		}
+		o.to = append(o.to, args[1:]...)
+
+	case "update": // update [KEY...]
+		if o.updates == nil {
+			o.updates = &file.Updates{Writeback: 15 * time.Minute}
+		}
+		o.updates.Keys = nil
+		for _, k := range args {
+			o.updates.Keys = append(o.updates.Keys, dns.Fqdn(strings.ToLower(k)))
+		}
+
+	case "writeback": // writeback DURATION
+		if o.updates == nil {
+			return errors.New("writeback needs update")
+		}
+		if len(args) != 1 {
+			return errors.New("writeback duration value is expected")
+		}
+		d, err := time.ParseDuration(args[0])
+		if d < 0 {
+			err = errors.New("invalid duration")
+		}
+		if err != nil {
+			return err
+		}
+		o.updates.Writeback = d
+
+	default:
+		return fmt.Errorf("unknown property '%s'", directive)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package auto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+)
+
+func TestOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.example.org")
+	l := loader{ReloadInterval: time.Minute, sidecar: ".conf", updates: &file.Updates{Keys: []string{"key."}, Writeback: time.Hour}}
+
+	tests := []struct {
+		sidecar   string
+		shouldErr bool
+		reload    time.Duration
+		to        int
+		keys      int
+		writeback time.Duration
+	}{
+		{"", false, time.Minute, 0, 1, time.Hour},
+		{"# nothing\n\n", false, time.Minute, 0, 1, time.Hour},
+		{"reload 0", false, 0, 0, 1, time.Hour},
+		{"transfer to 10.0.0.1 10.0.0.2\ntransfer to *", false, time.Minute, 3, 1, time.Hour},
+		{"update a. b.\nwriteback 0", false, time.Minute, 0, 2, 0},
+		{"update", false, time.Minute, 0, 0, time.Hour},
+		// errors
+		{"reload", true, 0, 0, 0, 0},
+		{"reload -1s", true, 0, 0, 0, 0},
+		{"transfer 10.0.0.1", true, 0, 0, 0, 0},
+		{"writeback", true, 0, 0, 0, 0},
+		{"upstream", true, 0, 0, 0, 0},
+	}
+	for i, test := range tests {
+		if err := os.WriteFile(path+".conf", []byte(test.sidecar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		o, err := l.options(path)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d expected errors, but got no error", i)
+			continue
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d expected no errors, but got '%v'", i, err)
+			continue
+		} else if test.shouldErr {
+			continue
+		}
+		if o.reload != test.reload {
+			t.Errorf("Test %d expected reload %s, got %s", i, test.reload, o.reload)
+		}
+		if len(o.to) != test.to {
+			t.Errorf("Test %d expected %d transfer addresses, got %v", i, test.to, o.to)
+		}
+		if len(o.updates.Keys) != test.keys {
+			t.Errorf("Test %d expected %d keys, got %v", i, test.keys, o.updates.Keys)
+		}
+		if o.updates.Writeback != test.writeback {
+			t.Errorf("Test %d expected writeback %s, got %s", i, test.writeback, o.updates.Writeback)
+		}
+	}
+	// The options of the loader aren't changed by the sidecar files.
+	if len(l.updates.Keys) != 1 || l.updates.Writeback != time.Hour {
+		t.Errorf("Expected the updates of the loader to be unchanged, got %+v", l.updates)
+	}
+
+	// Without a sidecar file the zone has the options of the loader.
+	os.Remove(path + ".conf")
+	if o, err := l.options(path); err != nil || o.reload != time.Minute || o.sidecar != "" {
+		t.Errorf("Expected the options of the loader, got %+v, %v", o, err)
+	}
+}
@@ -4,23 +4,44 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin/file"
 
 	"github.com/miekg/dns"
 )
 
-// Walk will recursively walk of the file under l.directory and adds the one that match l.re.
+// Walk will recursively walk of the file under l.directory and adds the one that match l.re. A zone is loaded
+// again when its sidecar file changed.
 func (a Auto) Walk() error {
 	// TODO(miek): should add something so that we don't stomp on each other.
 
 	toDelete := make(map[string]bool)
 	for _, n := range a.Zones.Names() {
+		if n == a.loader.catalog {
+			continue
+		}
 		toDelete[n] = true
 	}
 
+	found := make(map[string]string) // The files the zones are loaded from.
+
 	filepath.Walk(a.loader.directory, func(path string, info os.FileInfo, _ error) error {
-		if info == nil || info.IsDir() {
+		if info == nil {
+			return nil
+		}
+		if info.IsDir() {
+			if err := a.watcher.add(path); err != nil {
+				log.Warningf("Watching %s failed: %s", path, err)
+			}
+			return nil
+		}
+		// Skip the journals, and the temporary files used when writing zones back.
+		if strings.HasSuffix(info.Name(), ".jnl") || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		if a.loader.sidecar != "" && strings.HasSuffix(info.Name(), a.loader.sidecar) {
 			return nil
 		}
 
@@ -28,17 +49,42 @@ func (a Auto) Walk() error {
 		if !match {
 			return nil
 		}
+		if origin == a.loader.catalog {
+			log.Warningf("Skipping %s, `%s' is the catalog zone", path, origin)
+			return nil
+		}
+
+		// Zones are in (nested) directories, the same zone in another one is skipped.
+		if f, ok := found[origin]; ok {
+			log.Warningf("Skipping %s, zone `%s' is loaded from: %s", path, origin, f)
+			return nil
+		}
+		found[origin] = path
+
+		z, ok := a.Zones.Z[origin]
+		keep := func() {
+			if ok {
+				toDelete[origin] = false
+				z.SetFile(path)
+			}
+		}
 
-		if z, ok := a.Zones.Z[origin]; ok {
+		opts, err := a.loader.options(path)
+		if err != nil {
+			log.Warningf("Options of zone `%s': %v", origin, err)
+			keep()
+			return nil
+		}
+		if ok && opts.sidecar == a.Zones.sidecar(origin) {
 			// we already have this zone
-			toDelete[origin] = false
-			z.SetFile(path)
+			keep()
 			return nil
 		}
 
 		reader, err := os.Open(filepath.Clean(path))
 		if err != nil {
 			log.Warningf("Opening %s failed: %s", path, err)
+			keep()
 			return nil
 		}
 		defer reader.Close()
@@ -47,13 +93,32 @@ func (a Auto) Walk() error {
 		zo, err := file.Parse(reader, origin, path, 0)
 		if err != nil {
 			log.Warningf("Parse zone `%s': %v", origin, err)
+			keep()
+			return nil
+		}
+		if err := a.transfer.SetTo(origin, opts.to); err != nil {
+			log.Warningf("Options of zone `%s': %v", origin, err)
+			keep()
 			return nil
 		}
+		if ok {
+			// The options changed, replace the zone with one that has the new options.
+			a.Zones.Remove(origin)
+			log.Infof("Options of zone `%s' changed", origin)
+		}
 
-		zo.ReloadInterval = a.loader.ReloadInterval
+		zo.ReloadInterval = opts.reload
 		zo.Upstream = a.loader.upstream
+		if opts.updates != nil {
+			opts.updates.Journal = path + ".jnl"
+			zo.Updates = opts.updates
+			if err := zo.Replay(); err != nil {
+				log.Warningf("Replaying journal of zone `%s': %v", origin, err)
+			}
+		}
 
 		a.Zones.Add(zo, origin, a.transfer)
+		a.Zones.setSidecar(origin, opts.sidecar)
 
 		if a.metrics != nil {
 			a.metrics.AddZone(origin)
@@ -78,13 +143,42 @@ func (a Auto) Walk() error {
 		}
 
 		a.Zones.Remove(origin)
+		a.transfer.SetTo(origin, nil)
 
 		log.Infof("Deleting zone `%s'", origin)
 	}
 
+	if a.loader.catalog != "" {
+		a.updateCatalog()
+	}
+
 	return nil
 }
 
+// updateCatalog lists the zones in the catalog zone, and notifies the secondaries when they changed.
+func (a Auto) updateCatalog() {
+	members := []string{}
+	for _, n := range a.Zones.Names() {
+		if n != a.loader.catalog {
+			members = append(members, n)
+		}
+	}
+
+	z := a.Zones.Zones(a.loader.catalog)
+	if z == nil {
+		z = file.NewZone(a.loader.catalog, "")
+		z.SetCatalog(members)
+		a.Zones.Add(z, a.loader.catalog, a.transfer)
+		a.transfer.Notify(a.loader.catalog)
+		log.Infof("Inserting catalog zone `%s' with %d zones", a.loader.catalog, len(members))
+		return
+	}
+	if z.SetCatalog(members) {
+		a.transfer.Notify(a.loader.catalog)
+		log.Infof("Updated catalog zone `%s' with %d zones", a.loader.catalog, len(members))
+	}
+}
+
 // matches re to filename, if it is a match, the subexpression will be used to expand
 // template to an origin. When match is true that origin is returned. Origin is fully qualified.
 func matches(re *regexp.Regexp, filename, template string) (match bool, origin string) {
@@ -104,3 +198,16 @@ func matches(re *regexp.Regexp, filename, template string) (match bool, origin s
 
 	return true, origin
 }
+
+// settleTime is how long changes to the files are collected, before they are picked up.
+const settleTime = 250 * time.Millisecond
+
+// reload reloads the zones that are loaded from the files in changed.
+func (a Auto) reload(changed map[string]bool) {
+	for _, n := range a.Zones.Names() {
+		z := a.Zones.Zones(n)
+		if z != nil && changed[z.File()] {
+			z.ReloadFile()
+		}
+	}
+}
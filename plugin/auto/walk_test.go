@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
 )
 
 var dbFiles = []string{"db.example.org", "aa.example.org"}
@@ -65,6 +68,216 @@ func TestWalkNonExistent(t *testing.T) {
 	a.Walk()
 }
 
+func TestWalkUpdates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org"), []byte(zoneContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	journal := `example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082534 7200 3600 1209600 3600
+example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082535 7200 3600 1209600 3600
+new.example.org. 300 IN A 127.0.0.2
+`
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org.jnl"), []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auto{
+		loader: loader{
+			directory: dir,
+			re:        regexp.MustCompile(`db\.(.*)`),
+			template:  `${1}`,
+			updates:   &file.Updates{},
+		},
+		Zones: &Zones{},
+	}
+	a.Walk()
+
+	if names := a.Zones.Names(); len(names) != 1 {
+		t.Fatalf("Expected only example.org. to be loaded, got %v", names)
+	}
+	z := a.Zones.Z["example.org."]
+	if z.Updates == nil || z.Updates.Journal != filepath.Join(dir, "db.example.org.jnl") {
+		t.Fatalf("Expected updates with the journal next to the zone file, got %+v", z.Updates)
+	}
+	if serial := z.SOASerialIfDefined(); serial != 2016082535 {
+		t.Errorf("Expected the journal to be replayed to serial 2016082535, got %d", serial)
+	}
+}
+
+func TestWalkSidecarUpdates(t *testing.T) {
+	dir := t.TempDir()
+	journal := `example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082534 7200 3600 1209600 3600
+example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082535 7200 3600 1209600 3600
+new.example.org. 300 IN A 127.0.0.2
+`
+	// Only the sidecar file allows updates; the journal and a temporary file of a write back are skipped still.
+	for name, content := range map[string]string{
+		"db.example.org":      zoneContent,
+		"db.example.org.conf": "update key.",
+		"db.example.org.jnl":  journal,
+		".db.example.net.tmp": zoneContent,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := Auto{
+		loader: loader{
+			directory: dir,
+			re:        regexp.MustCompile(`db\.(.*)`),
+			template:  `${1}`,
+			sidecar:   ".conf",
+		},
+		Zones: &Zones{},
+	}
+	a.Walk()
+
+	if names := a.Zones.Names(); len(names) != 1 {
+		t.Fatalf("Expected only example.org. to be loaded, got %v", names)
+	}
+	if serial := a.Zones.Z["example.org."].SOASerialIfDefined(); serial != 2016082535 {
+		t.Errorf("Expected the journal to be replayed to serial 2016082535, got %d", serial)
+	}
+}
+
+func TestWalkCatalog(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"db.example.org", "db.example.net", "db.catalog.invalid"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(zoneContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := Auto{
+		loader: loader{
+			directory: dir,
+			re:        regexp.MustCompile(`db\.(.*)`),
+			template:  `${1}`,
+			catalog:   "catalog.invalid.",
+		},
+		Zones: &Zones{},
+	}
+	a.Walk()
+
+	z := a.Zones.Zones("catalog.invalid.")
+	if z == nil {
+		t.Fatal("Expected the catalog zone to be added")
+	}
+	members, err := z.Members()
+	if err != nil {
+		t.Fatalf("Expected no error when reading the catalog, got %q", err)
+	}
+	// db.catalog.invalid is not loaded, because that's the catalog.
+	if len(members) != 2 || members["example.org."] == "" || members["example.net."] == "" {
+		t.Errorf("Expected example.org. and example.net. in the catalog, got %v", members)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "db.example.net")); err != nil {
+		t.Fatal(err)
+	}
+	a.Walk()
+	if members, _ := z.Members(); len(members) != 1 || members["example.org."] == "" {
+		t.Errorf("Expected only example.org. in the catalog, got %v", members)
+	}
+	if len(a.Zones.Names()) != 2 {
+		t.Errorf("Expected example.org. and the catalog zone, got %v", a.Zones.Names())
+	}
+}
+
+func TestWalkNested(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"customer1/db.example.org", "customer2/eu/db.example.net", "customer3/db.example.org"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(zoneContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := Auto{
+		loader: loader{
+			directory: dir,
+			re:        regexp.MustCompile(`db\.(.*)`),
+			template:  `${1}`,
+		},
+		Zones: &Zones{},
+	}
+	a.Walk()
+
+	if len(a.Zones.Names()) != 2 {
+		t.Fatalf("Expected example.org. and example.net., got %v", a.Zones.Names())
+	}
+	if f := a.Zones.Z["example.net."].File(); f != filepath.Join(dir, "customer2/eu/db.example.net") {
+		t.Errorf("Expected example.net. from the nested directory, got %s", f)
+	}
+	// The same zone in another directory doesn't replace the first one.
+	a.Walk()
+	if f := a.Zones.Z["example.org."].File(); f != filepath.Join(dir, "customer1/db.example.org") {
+		t.Errorf("Expected example.org. from the first directory, got %s", f)
+	}
+}
+
+func TestWalkSidecar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.example.org")
+	if err := os.WriteFile(path, []byte(zoneContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".conf", []byte("# example.org\nreload 10s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auto{
+		loader: loader{
+			directory:      dir,
+			re:             regexp.MustCompile(`db\.(.*)`),
+			template:       `${1}`,
+			ReloadInterval: time.Minute,
+			sidecar:        ".conf",
+		},
+		Zones: &Zones{},
+	}
+	a.Walk()
+	defer func() {
+		for _, n := range a.Zones.Names() {
+			a.Zones.Remove(n)
+		}
+	}()
+
+	if names := a.Zones.Names(); len(names) != 1 {
+		t.Fatalf("Expected only example.org. to be loaded, got %v", names)
+	}
+	z := a.Zones.Z["example.org."]
+	if z.ReloadInterval != 10*time.Second {
+		t.Errorf("Expected reload interval from the sidecar file, got %s", z.ReloadInterval)
+	}
+
+	// A changed sidecar file loads the zone again, with the new options.
+	if err := os.WriteFile(path+".conf", []byte("update\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.Walk()
+	z = a.Zones.Z["example.org."]
+	if z.ReloadInterval != time.Minute {
+		t.Errorf("Expected the reload interval of the loader, got %s", z.ReloadInterval)
+	}
+	if z.Updates == nil || z.Updates.Journal != path+".jnl" {
+		t.Errorf("Expected updates with the journal next to the zone file, got %+v", z.Updates)
+	}
+
+	// A broken sidecar file keeps the zone as it is.
+	if err := os.WriteFile(path+".conf", []byte("reload\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.Walk()
+	if a.Zones.Z["example.org."] != z {
+		t.Errorf("Expected the zone to be kept")
+	}
+}
+
 func createFiles() (string, error) {
 	dir, err := os.MkdirTemp(os.TempDir(), "coredns")
 	if err != nil {
@@ -0,0 +1,100 @@
+//go:build linux
+
+package auto
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watcher watches directories with inotify, and collects the files that changed in them.
+type watcher struct {
+	fd int
+	f  *os.File      // Wraps fd for reading, fd itself is used for adding watches: f.Fd() would make reads block.
+	C  chan struct{} // Receives a value when files changed.
+
+	sync.Mutex
+	dirs    map[int32]string // The watched directories.
+	changed map[string]bool
+}
+
+const watchEvents = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+func newWatcher() (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// A non-blocking file is read with the runtime poller, so close unblocks the read in run.
+	w := &watcher{
+		fd:      fd,
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		C:       make(chan struct{}, 1),
+		dirs:    make(map[int32]string),
+		changed: make(map[string]bool),
+	}
+	go w.run()
+	return w, nil
+}
+
+// add watches the directory dir. Adding a directory again does nothing.
+func (w *watcher) add(dir string) error {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchEvents)
+	if err != nil {
+		return err
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+// changes returns the files that changed since the last call.
+func (w *watcher) changes() map[string]bool {
+	w.Lock()
+	defer w.Unlock()
+	changed := w.changed
+	w.changed = make(map[string]bool)
+	return changed
+}
+
+func (w *watcher) close() error { return w.f.Close() }
+
+func (w *watcher) run() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			return
+		}
+		w.Lock()
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[off:off+int(ev.Len)]), "\x00")
+			off += int(ev.Len)
+
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, ev.Wd)
+				continue
+			}
+			if dir, ok := w.dirs[ev.Wd]; ok && name != "" {
+				w.changed[filepath.Join(dir, name)] = true
+			}
+		}
+		w.Unlock()
+
+		select {
+		case w.C <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package auto
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestInotify(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	a := Auto{
+		loader: loader{
+			directory: dir,
+			re:        regexp.MustCompile(`db\.(.*)`),
+			template:  `${1}`,
+		},
+		Zones:   &Zones{},
+		watcher: w,
+	}
+	a.Walk()
+
+	// A new directory is watched after a walk.
+	nested := filepath.Join(dir, "customer1")
+	if err := os.Mkdir(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, w)
+	if changed := w.changes(); !changed[nested] {
+		t.Fatalf("Expected %s to be changed, got %v", nested, changed)
+	}
+	a.Walk()
+
+	path := filepath.Join(nested, "db.example.org")
+	if err := os.WriteFile(path, []byte(zoneContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, w)
+	if changed := w.changes(); !changed[path] {
+		t.Fatalf("Expected %s to be changed, got %v", path, changed)
+	}
+	a.Walk()
+	if _, ok := a.Zones.Z["example.org."]; !ok {
+		t.Errorf("Expected example.org. to be added")
+	}
+}
+
+func wait(t *testing.T, w *watcher) {
+	select {
+	case <-w.C:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change")
+	}
+}
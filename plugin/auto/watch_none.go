@@ -0,0 +1,18 @@
+//go:build !linux
+
+package auto
+
+import "errors"
+
+// watcher is not available on this platform, changes are picked up by scanning the directory.
+type watcher struct {
+	C chan struct{}
+}
+
+func newWatcher() (*watcher, error) { return nil, errors.New("not supported on this platform") }
+
+func (w *watcher) add(dir string) error { return nil }
+
+func (w *watcher) changes() map[string]bool { return nil }
+
+func (w *watcher) close() error { return nil }
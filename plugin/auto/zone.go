@@ -16,6 +16,8 @@ type Zones struct {
 
 	origins []string // Any origins from the server block.
 
+	sidecars map[string]string // Contents of the sidecar file of each zone that has one.
+
 	sync.RWMutex
 }
 
@@ -57,6 +59,28 @@ func (z *Zones) Add(zo *file.Zone, name string, t *transfer.Transfer) {
 	z.Unlock()
 }
 
+// sidecar returns the contents of the sidecar file the zone named name was loaded with.
+func (z *Zones) sidecar(name string) string {
+	z.RLock()
+	s := z.sidecars[name]
+	z.RUnlock()
+	return s
+}
+
+// setSidecar sets the contents of the sidecar file the zone named name was loaded with.
+func (z *Zones) setSidecar(name, s string) {
+	z.Lock()
+	defer z.Unlock()
+	if s == "" {
+		delete(z.sidecars, name)
+		return
+	}
+	if z.sidecars == nil {
+		z.sidecars = make(map[string]string)
+	}
+	z.sidecars[name] = s
+}
+
 // Remove removes the zone named name from z. It also stops the zone's reload goroutine.
 func (z *Zones) Remove(name string) {
 	z.Lock()
@@ -66,6 +90,7 @@ func (z *Zones) Remove(name string) {
 	}
 
 	delete(z.Z, name)
+	delete(z.sidecars, name)
 
 	// TODO(miek): just regenerate Names (might be bad if you have a lot of zones...)
 	z.names = []string{}
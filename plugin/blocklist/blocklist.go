@@ -0,0 +1,81 @@
+// Package blocklist implements a plugin that blocks queries for the names on block lists.
+package blocklist
+
+import (
+	"context"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("blocklist")
+
+// Blocklist answers the queries for the names on its block lists, and the names below them.
+type Blocklist struct {
+	Next  plugin.Handler
+	Zones []string
+
+	lists  *lists
+	answer answer
+}
+
+// answer is the way a query for a blocked name is answered.
+type answer int
+
+const (
+	// answerNXDomain answers with NXDOMAIN.
+	answerNXDomain answer = iota
+	// answerNull answers with the unspecified address 0.0.0.0 or ::.
+	answerNull
+	// answerRefused answers with REFUSED.
+	answerRefused
+)
+
+// nullTTL is the TTL of the records in answerNull answers.
+const nullTTL = 60
+
+// ServeDNS implements the plugin.Handler interface.
+func (b *Blocklist) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(b.Zones).Matches(state.Name())
+	if zone == "" || !b.lists.blocked(state.Name()) {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+
+	m := new(dns.Msg)
+	switch b.answer {
+	case answerNull:
+		m.SetReply(r)
+		hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: nullTTL}
+		switch state.QType() {
+		case dns.TypeA:
+			m.Answer = []dns.RR{&dns.A{Hdr: hdr, A: net.IPv4zero}}
+		case dns.TypeAAAA:
+			m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.IPv6zero}}
+		}
+	case answerRefused:
+		m.SetRcode(r, dns.RcodeRefused)
+	default:
+		m.SetRcode(r, dns.RcodeNameError)
+	}
+	m.Authoritative = b.answer != answerRefused
+
+	if opt := r.IsEdns0(); opt != nil {
+		m.SetEdns0(uint16(state.Size()), opt.Do())
+		ede := dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked}
+		m.IsEdns0().Option = append(m.IsEdns0().Option, &ede)
+	}
+	w.WriteMsg(m)
+
+	BlockCount.WithLabelValues(metrics.WithServer(ctx), zone, metrics.WithView(ctx)).Inc()
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (b *Blocklist) Name() string { return "blocklist" }
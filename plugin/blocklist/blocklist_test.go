@@ -0,0 +1,94 @@
+package blocklist
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestBlocklist(t *testing.T) {
+	block := newTrie()
+	parseList(strings.NewReader("ads.example.org\n"), block, newTrie())
+
+	tests := []struct {
+		answer answer
+		qname  string
+		qtype  uint16
+		edns   bool
+		rcode  int
+		ip     net.IP
+	}{
+		{answerNXDomain, "ads.example.org.", dns.TypeA, true, dns.RcodeNameError, nil},
+		{answerNXDomain, "www.ads.example.org.", dns.TypeA, false, dns.RcodeNameError, nil},
+		{answerNull, "ads.example.org.", dns.TypeA, true, dns.RcodeSuccess, net.IPv4zero},
+		{answerNull, "ads.example.org.", dns.TypeAAAA, true, dns.RcodeSuccess, net.IPv6zero},
+		{answerNull, "ads.example.org.", dns.TypeMX, true, dns.RcodeSuccess, nil},
+		{answerRefused, "ads.example.org.", dns.TypeA, true, dns.RcodeRefused, nil},
+		// Not blocked, the next plugin answers.
+		{answerNXDomain, "example.org.", dns.TypeA, true, dns.RcodeServerFailure, nil},
+	}
+
+	for i, tc := range tests {
+		b := &Blocklist{
+			Zones:  []string{"."},
+			lists:  &lists{block: block, allow: newTrie()},
+			answer: tc.answer,
+			Next:   test.ErrorHandler(),
+		}
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, tc.qtype)
+		if tc.edns {
+			r.SetEdns0(4096, false)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		b.ServeDNS(context.TODO(), rec, r)
+
+		if rec.Msg == nil {
+			t.Fatalf("Test %d: expected a response", i)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if tc.rcode == dns.RcodeServerFailure {
+			continue
+		}
+
+		switch {
+		case tc.ip == nil && len(rec.Msg.Answer) != 0:
+			t.Errorf("Test %d: expected no answer, got %v", i, rec.Msg.Answer)
+		case tc.ip != nil && len(rec.Msg.Answer) != 1:
+			t.Errorf("Test %d: expected 1 answer, got %d", i, len(rec.Msg.Answer))
+		case tc.ip != nil:
+			var ip net.IP
+			switch rr := rec.Msg.Answer[0].(type) {
+			case *dns.A:
+				ip = rr.A
+			case *dns.AAAA:
+				ip = rr.AAAA
+			}
+			if !ip.Equal(tc.ip) {
+				t.Errorf("Test %d: expected %s, got %s", i, tc.ip, ip)
+			}
+		}
+
+		opt := rec.Msg.IsEdns0()
+		if !tc.edns {
+			if opt != nil {
+				t.Errorf("Test %d: expected no OPT record", i)
+			}
+			continue
+		}
+		if opt == nil || len(opt.Option) != 1 {
+			t.Fatalf("Test %d: expected an EDE option", i)
+		}
+		if ede, ok := opt.Option[0].(*dns.EDNS0_EDE); !ok || ede.InfoCode != dns.ExtendedErrorCodeBlocked {
+			t.Errorf("Test %d: expected EDE blocked, got %v", i, opt.Option[0])
+		}
+	}
+}
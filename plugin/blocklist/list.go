@@ -0,0 +1,195 @@
+package blocklist
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// source is a list file.
+type source struct {
+	path  string
+	allow bool // an allow list, all names in it are exceptions
+
+	// mtime and size are protected by the readMu of the lists
+	mtime time.Time
+	size  int64
+}
+
+// lists holds the names from all list files, and the inline allowed names.
+type lists struct {
+	sync.RWMutex
+	block *trie
+	allow *trie
+
+	readMu  sync.Mutex // serializes read
+	sources []*source
+	inline  []string // allowed names from the Corefile
+	loaded  bool
+}
+
+func newLists() *lists {
+	return &lists{block: newTrie(), allow: newTrie()}
+}
+
+// blocked returns true if name is blocked. An allowed name overrides a blocked one, unless the blocked name
+// is more specific: with example.org blocked and ads.example.org allowed, only ads.example.org is allowed.
+func (l *lists) blocked(name string) bool {
+	name = strings.ToLower(name)
+	l.RLock()
+	defer l.RUnlock()
+	b := l.block.match(name)
+	return b > 0 && b > l.allow.match(name)
+}
+
+// read reads the list files if any of them changed since they were last read.
+func (l *lists) read() {
+	l.readMu.Lock()
+	defer l.readMu.Unlock()
+
+	changed := !l.loaded
+	for _, s := range l.sources {
+		stat, err := os.Stat(s.path)
+		if err != nil {
+			if !s.mtime.IsZero() || s.size != 0 {
+				changed = true
+			}
+			continue
+		}
+		if !s.mtime.Equal(stat.ModTime()) || s.size != stat.Size() {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	l.loaded = true
+
+	block, allow := newTrie(), newTrie()
+	for _, name := range l.inline {
+		allow.insert(name)
+	}
+	blocked, allowed := 0, len(l.inline)
+	for _, s := range l.sources {
+		file, err := os.Open(s.path)
+		if err != nil {
+			log.Warningf("Failed to read list %q: %s", s.path, err)
+			s.mtime, s.size = time.Time{}, 0
+			continue
+		}
+		if stat, err := file.Stat(); err == nil {
+			s.mtime, s.size = stat.ModTime(), stat.Size()
+		}
+		var n, exceptions int
+		if s.allow {
+			n, exceptions = parseList(file, allow, allow)
+			allowed += n + exceptions
+		} else {
+			n, exceptions = parseList(file, block, allow)
+			blocked += n
+			allowed += exceptions
+		}
+		file.Close()
+		log.Debugf("Parsed list %q into %d entries", s.path, n+exceptions)
+	}
+
+	l.Lock()
+	l.block, l.allow = block, allow
+	l.Unlock()
+
+	listEntries.WithLabelValues("block").Set(float64(blocked))
+	listEntries.WithLabelValues("allow").Set(float64(allowed))
+}
+
+// parseList adds the names in the list r to t, and returns the number of names added. Each line holds names
+// in hosts file format, a single name, or an AdBlock style rule (||name^). The names of AdBlock exception rules
+// (@@||name^) are added to exceptions, their number is returned as well. Other lines are ignored.
+func parseList(r io.Reader, t, exceptions *trie) (n, e int) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+		// A comment starts after white space, e.g. example.org##.ad is an AdBlock element hiding rule.
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, "\t#"); i >= 0 {
+			line = line[:i]
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@||"):
+			if name, ok := adblockName(line[2:]); ok && exceptions.insert(name) {
+				e++
+			}
+		case strings.HasPrefix(line, "||"):
+			if name, ok := adblockName(line); ok && t.insert(name) {
+				n++
+			}
+		default:
+			fields := strings.Fields(line)
+			if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+				fields = fields[1:]
+			} else if len(fields) != 1 {
+				continue
+			}
+			for _, f := range fields {
+				if name, ok := validName(f); ok && t.insert(name) {
+					n++
+				}
+			}
+		}
+	}
+	return n, e
+}
+
+// adblockName returns the name of the AdBlock rule ||name^, rule options ($...) are ignored. Rules that match
+// anything but an entire domain are not supported.
+func adblockName(rule string) (string, bool) {
+	rule = strings.TrimPrefix(rule, "||")
+	if i := strings.IndexByte(rule, '$'); i >= 0 {
+		rule = rule[:i]
+	}
+	if !strings.HasSuffix(rule, "^") {
+		return "", false
+	}
+	return validName(strings.TrimSuffix(rule, "^"))
+}
+
+// validName returns name as a fully qualified name, if it is a valid host name and not a local one.
+func validName(name string) (string, bool) {
+	if strings.ContainsAny(name, "#*/:") || net.ParseIP(name) != nil {
+		return "", false
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if _, ok := localNames[name]; ok {
+		return "", false
+	}
+	if _, ok := dns.IsDomainName(name); !ok || name == "" {
+		return "", false
+	}
+	return dns.Fqdn(name), true
+}
+
+// localNames are the names in hosts files that are not blocked.
+var localNames = map[string]struct{}{
+	"localhost":             {},
+	"localhost.localdomain": {},
+	"local":                 {},
+	"broadcasthost":         {},
+	"ip6-localhost":         {},
+	"ip6-loopback":          {},
+	"ip6-localnet":          {},
+	"ip6-mcastprefix":       {},
+	"ip6-allnodes":          {},
+	"ip6-allrouters":        {},
+	"ip6-allhosts":          {},
+}
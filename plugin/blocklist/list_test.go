@@ -0,0 +1,94 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testList = `# hosts format
+0.0.0.0 ads.example.org tracker.example.org # inline comment
+127.0.0.1 localhost
+::1 ip6-localhost
+0.0.0.0 0.0.0.0
+
+# plain names
+malware.example.net
+Upper.Example.NET.
+
+! AdBlock format
+[Adblock Plus 2.0]
+||adblock.example.com^
+||options.example.com^$important
+@@||good.adblock.example.com^
+||example.com/path^
+/banner/*
+example.org##.ad
+`
+
+func TestParseList(t *testing.T) {
+	block, allow := newTrie(), newTrie()
+	n, e := parseList(strings.NewReader(testList), block, allow)
+	if n != 6 || e != 1 {
+		t.Errorf("Expected 6 names and 1 exception, got %d and %d", n, e)
+	}
+
+	for _, name := range []string{"ads.example.org.", "tracker.example.org.", "malware.example.net.", "upper.example.net.",
+		"adblock.example.com.", "x.adblock.example.com.", "options.example.com."} {
+		if block.match(name) == 0 {
+			t.Errorf("Expected %s to be on the list", name)
+		}
+	}
+	for _, name := range []string{"localhost.", "ip6-localhost.", "example.org.", "example.com."} {
+		if block.match(name) != 0 {
+			t.Errorf("Expected %s not to be on the list", name)
+		}
+	}
+	if allow.match("good.adblock.example.com.") == 0 {
+		t.Error("Expected good.adblock.example.com. to be an exception")
+	}
+}
+
+func TestListsBlocked(t *testing.T) {
+	dir := t.TempDir()
+	blockFile := filepath.Join(dir, "block.txt")
+	allowFile := filepath.Join(dir, "allow.txt")
+	os.WriteFile(blockFile, []byte("example.org\n||adblock.example.com^\n@@||good.adblock.example.com^\nbad.allowed.example.org\n"), 0644)
+	os.WriteFile(allowFile, []byte("allowed.example.org\n"), 0644)
+
+	l := newLists()
+	l.sources = []*source{{path: blockFile}, {path: allowFile, allow: true}}
+	l.inline = []string{"inline.example.org."}
+	l.read()
+
+	tests := []struct {
+		name    string
+		blocked bool
+	}{
+		{"example.org.", true},
+		{"www.Example.org.", true},
+		{"allowed.example.org.", false},
+		{"www.allowed.example.org.", false},
+		{"bad.allowed.example.org.", true},
+		{"inline.example.org.", false},
+		{"adblock.example.com.", true},
+		{"good.adblock.example.com.", false},
+		{"example.net.", false},
+	}
+	for _, tc := range tests {
+		if x := l.blocked(tc.name); x != tc.blocked {
+			t.Errorf("Expected %s blocked to be %t, got %t", tc.name, tc.blocked, x)
+		}
+	}
+
+	// A changed file is read again.
+	os.WriteFile(blockFile, []byte("example.net\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(blockFile, later, later)
+	l.read()
+	if !l.blocked("example.net.") || l.blocked("example.org.") {
+		t.Error("Expected the changed list to be read")
+	}
+}
@@ -0,0 +1,145 @@
+package blocklist
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+const pluginName = "blocklist"
+
+func init() { plugin.Register(pluginName, setup) }
+
+// defaultReload is how often the list files are checked for changes.
+const defaultReload = time.Minute
+
+func periodicListUpdate(l *lists, reload time.Duration) chan bool {
+	parseChan := make(chan bool)
+
+	if reload == 0 {
+		return parseChan
+	}
+
+	go func() {
+		ticker := time.NewTicker(reload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-parseChan:
+				return
+			case <-ticker.C:
+				l.read()
+			}
+		}
+	}()
+	return parseChan
+}
+
+func setup(c *caddy.Controller) error {
+	b, reload, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	parseChan := periodicListUpdate(b.lists, reload)
+
+	c.OnStartup(func() error {
+		b.lists.read()
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		close(parseChan)
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		b.Next = next
+		return b
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Blocklist, time.Duration, error) {
+	config := dnsserver.GetConfig(c)
+	b := &Blocklist{lists: newLists()}
+	reload := defaultReload
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, 0, plugin.ErrOnce
+		}
+		i++
+
+		b.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "list", "allowlist":
+				allow := c.Val() == "allowlist"
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, 0, c.ArgErr()
+				}
+				for _, path := range args {
+					if !filepath.IsAbs(path) && config.Root != "" {
+						path = filepath.Join(config.Root, path)
+					}
+					b.lists.sources = append(b.lists.sources, &source{path: path, allow: allow})
+				}
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, 0, c.ArgErr()
+				}
+				for _, a := range args {
+					name, ok := validName(a)
+					if !ok {
+						return nil, 0, c.Errf("invalid name %q", a)
+					}
+					b.lists.inline = append(b.lists.inline, name)
+				}
+			case "answer":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, 0, c.ArgErr()
+				}
+				switch args[0] {
+				case "nxdomain":
+					b.answer = answerNXDomain
+				case "null":
+					b.answer = answerNull
+				case "refused":
+					b.answer = answerRefused
+				default:
+					return nil, 0, c.Errf("unknown answer %q; expect 'nxdomain', 'null' or 'refused'", args[0])
+				}
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, 0, c.Errf("reload needs a duration (zero seconds to disable)")
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, 0, c.Errf("invalid duration for reload '%s'", args[0])
+				}
+				if d < 0 {
+					return nil, 0, c.Errf("invalid negative duration for reload '%s'", args[0])
+				}
+				reload = d
+			default:
+				return nil, 0, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(b.lists.sources) == 0 {
+		return nil, 0, c.Errf("no list files")
+	}
+	return b, reload, nil
+}
@@ -0,0 +1,51 @@
+package blocklist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		config  string
+		wantErr bool
+		sources int
+		answer  answer
+		reload  time.Duration
+	}{
+		{"blocklist {\nlist hosts.txt\n}", false, 1, answerNXDomain, defaultReload},
+		{"blocklist example.org {\nlist a.txt b.txt\nallowlist c.txt\nallow good.example.org\nanswer null\nreload 0\n}", false, 3, answerNull, 0},
+		{"blocklist {\nlist a.txt\nanswer refused\nreload 10s\n}", false, 1, answerRefused, 10 * time.Second},
+		{"blocklist", true, 0, 0, 0},
+		{"blocklist {\nlist\n}", true, 0, 0, 0},
+		{"blocklist {\nlist a.txt\nanswer foo\n}", true, 0, 0, 0},
+		{"blocklist {\nlist a.txt\nreload -1s\n}", true, 0, 0, 0},
+		{"blocklist {\nlist a.txt\nallow *.example.org\n}", true, 0, 0, 0},
+		{"blocklist {\nlist a.txt\nfoo\n}", true, 0, 0, 0},
+		{"blocklist {\nlist a.txt\n}\nblocklist {\nlist b.txt\n}", true, 0, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		b, reload, err := parse(c)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if x := len(b.lists.sources); x != tc.sources {
+			t.Errorf("Test %d: expected %d lists, got %d", i, tc.sources, x)
+		}
+		if b.answer != tc.answer {
+			t.Errorf("Test %d: expected answer %d, got %d", i, tc.answer, b.answer)
+		}
+		if reload != tc.reload {
+			t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, reload)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package blocklist
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// trie is a suffix trie of domain names: the labels of a name are stored from the root down, so all names
+// below a name share its path.
+type trie struct {
+	children map[string]*trie
+	end      bool // a name ends here
+}
+
+func newTrie() *trie { return &trie{} }
+
+// insert adds name to t. It returns false if name was already in t.
+func (t *trie) insert(name string) bool {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	n := t
+	for i := len(labels) - 1; i >= 0; i-- {
+		if n.children == nil {
+			n.children = make(map[string]*trie)
+		}
+		child, ok := n.children[labels[i]]
+		if !ok {
+			child = &trie{}
+			n.children[labels[i]] = child
+		}
+		n = child
+	}
+	if n.end {
+		return false
+	}
+	n.end = true
+	return true
+}
+
+// match returns the number of labels of the longest name in t that name is equal to or below, or 0 if there
+// is none. Name must be lower case.
+func (t *trie) match(name string) int {
+	idx := dns.Split(name)
+	n, longest := t, 0
+	end := len(name)
+	if end > 0 && name[end-1] == '.' {
+		end--
+	}
+	for i := len(idx) - 1; i >= 0; i-- {
+		child, ok := n.children[name[idx[i]:end]]
+		if !ok {
+			break
+		}
+		n = child
+		if n.end {
+			longest = len(idx) - i
+		}
+		end = idx[i] - 1
+	}
+	return longest
+}
@@ -0,0 +1,36 @@
+package blocklist
+
+import "testing"
+
+func TestTrie(t *testing.T) {
+	tr := newTrie()
+	for _, name := range []string{"example.org.", "ads.example.net.", "Tracker.Example.COM."} {
+		if !tr.insert(name) {
+			t.Errorf("Expected %s to be new", name)
+		}
+	}
+	if tr.insert("example.org.") {
+		t.Error("Expected example.org. not to be new")
+	}
+
+	tests := []struct {
+		name  string
+		match int
+	}{
+		{"example.org.", 2},
+		{"www.example.org.", 2},
+		{"a.b.example.org.", 2},
+		{"org.", 0},
+		{"example.net.", 0},
+		{"ads.example.net.", 3},
+		{"x.ads.example.net.", 3},
+		{"xads.example.net.", 0},
+		{"tracker.example.com.", 3},
+		{".", 0},
+	}
+	for _, tc := range tests {
+		if x := tr.match(tc.name); x != tc.match {
+			t.Errorf("Expected %s to match %d labels, got %d", tc.name, tc.match, x)
+		}
+	}
+}
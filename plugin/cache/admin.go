@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// admin is an HTTP endpoint to inspect and purge the contents of a cache.
+type admin struct {
+	Addr string
+	c    *Cache
+
+	ln      net.Listener
+	nlSetup bool
+	mux     *http.ServeMux
+}
+
+// adminItem describes a single cached item in the admin API.
+type adminItem struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Cache string `json:"cache"`
+	Rcode string `json:"rcode"`
+	TTL   int    `json:"ttl"`
+}
+
+// adminShards describes the shard occupancy of the caches in the admin API.
+type adminShards struct {
+	Success []int                  `json:"success"`
+	Denial  []int                  `json:"denial"`
+	Quotas  map[string]adminShards `json:"quotas,omitempty"` // The caches of each quota zone.
+}
+
+// adminPurged is the reply to a purge in the admin API.
+type adminPurged struct {
+	Purged int `json:"purged"`
+}
+
+func (a *admin) OnStartup() error {
+	// Not reuseport: two caches with the same admin address would then both get requests, at random.
+	ln, err := net.Listen("tcp", a.Addr)
+	if err != nil {
+		return err
+	}
+
+	a.ln = ln
+	a.mux = http.NewServeMux()
+	a.nlSetup = true
+
+	a.mux.HandleFunc("/cache", a.items)
+	a.mux.HandleFunc("/cache/shards", a.shards)
+
+	go func() { http.Serve(a.ln, a.mux) }()
+	return nil
+}
+
+func (a *admin) OnShutdown() error {
+	if !a.nlSetup {
+		return nil
+	}
+
+	a.ln.Close()
+	a.nlSetup = false
+	return nil
+}
+
+// items lists (GET) or purges (DELETE) cache items. The items can be selected with the "name" (exact match) or "zone"
+// (the name and everything below it) query parameters. Purging everything requires the "all" parameter. A purge also
+// removes the NSEC and NSEC3 records of the aggressive cache that could deny the purged names.
+func (a *admin) items(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name, zone := q.Get("name"), q.Get("zone")
+	if name != "" {
+		name = plugin.Name(name).Normalize()
+	}
+	if zone != "" {
+		zone = plugin.Name(zone).Normalize()
+	}
+	match := func(i *item) bool {
+		switch {
+		case name != "":
+			return name == plugin.Name(i.Name).Normalize()
+		case zone != "":
+			return plugin.Name(zone).Matches(plugin.Name(i.Name).Normalize())
+		}
+		return true
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		now := a.c.now()
+		items := []adminItem{}
+		walk := func(ca *cache.Cache, typ string) {
+			ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+				if i, ok := m[key].(*item); ok && match(i) {
+					items = append(items, adminItem{Name: i.Name, Type: dns.Type(i.QType).String(), Cache: typ, Rcode: dns.RcodeToString[i.Rcode], TTL: i.ttl(now)})
+				}
+				return true
+			})
+		}
+		for _, ca := range a.c.successCaches() {
+			walk(ca, Success)
+		}
+		for _, ca := range a.c.denialCaches() {
+			walk(ca, Denial)
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].Name == items[j].Name {
+				return items[i].Type < items[j].Type
+			}
+			return items[i].Name < items[j].Name
+		})
+		writeJSON(w, items)
+
+	case http.MethodDelete:
+		if name == "" && zone == "" && q.Get("all") == "" {
+			http.Error(w, "one of name, zone or all must be given", http.StatusBadRequest)
+			return
+		}
+		n := 0
+		for _, ca := range append(a.c.successCaches(), a.c.denialCaches()...) {
+			n += purge(ca, match)
+		}
+		// Names below zone, or name, can also be denied by the NSEC and NSEC3 records of an enclosing zone.
+		if a.c.nsec != nil {
+			if name == "" {
+				name = zone
+			}
+			n += a.c.nsec.purge(name)
+		}
+		log.Infof("Purged %d items (name=%q zone=%q)", n, name, zone)
+		writeJSON(w, adminPurged{Purged: n})
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// shards reports the number of items in each shard of the caches.
+func (a *admin) shards(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	shards := adminShards{Success: a.c.pcache.ShardLens(), Denial: a.c.ncache.ShardLens()}
+	if len(a.c.quotaZones) > 0 {
+		shards.Quotas = make(map[string]adminShards, len(a.c.quotaZones))
+		for _, z := range a.c.quotaZones {
+			q := a.c.quotas[z]
+			shards.Quotas[z] = adminShards{Success: q.pcache.ShardLens(), Denial: q.ncache.ShardLens()}
+		}
+	}
+	writeJSON(w, shards)
+}
+
+// purge removes the items for which match returns true from ca and returns how many were removed.
+func purge(ca *cache.Cache, match func(*item) bool) int {
+	n := 0
+	ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+		if i, ok := m[key].(*item); ok && match(i) {
+			delete(m, key)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warningf("Failed to write admin reply: %s", err)
+	}
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestAdmin(t *testing.T) {
+	c := New()
+	c.Next = BackendHandler()
+	for _, name := range []string{"example.org.", "www.example.org.", "example.net."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+	}
+	a := &admin{c: c}
+
+	get := func(url string) []adminItem {
+		rec := httptest.NewRecorder()
+		a.items(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for GET %s, got %d", url, rec.Code)
+		}
+		items := []adminItem{}
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+	del := func(url string, code int) int {
+		rec := httptest.NewRecorder()
+		a.items(rec, httptest.NewRequest(http.MethodDelete, url, nil))
+		if rec.Code != code {
+			t.Fatalf("Expected status %d for DELETE %s, got %d", code, url, rec.Code)
+		}
+		if code != http.StatusOK {
+			return 0
+		}
+		p := adminPurged{}
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		return p.Purged
+	}
+
+	items := get("/cache")
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+	if x := items[0]; x.Name != "example.net." || x.Type != "A" || x.Cache != Success || x.Rcode != "NOERROR" || x.TTL != 303 {
+		t.Errorf("Unexpected first item: %+v", x)
+	}
+	if items := get("/cache?zone=example.org"); len(items) != 2 {
+		t.Errorf("Expected 2 items in example.org, got %d", len(items))
+	}
+
+	del("/cache", http.StatusBadRequest)
+	if n := del("/cache?name=WWW.example.org", http.StatusOK); n != 1 {
+		t.Errorf("Expected 1 purged item, got %d", n)
+	}
+	if n := del("/cache?zone=example.org.", http.StatusOK); n != 1 {
+		t.Errorf("Expected 1 purged item, got %d", n)
+	}
+	if n := del("/cache?all=true", http.StatusOK); n != 1 {
+		t.Errorf("Expected 1 purged item, got %d", n)
+	}
+	if c.pcache.Len() != 0 {
+		t.Errorf("Expected empty cache, got %d items", c.pcache.Len())
+	}
+
+	rec := httptest.NewRecorder()
+	a.items(rec, httptest.NewRequest(http.MethodPost, "/cache", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	a.shards(rec, httptest.NewRequest(http.MethodGet, "/cache/shards", nil))
+	shards := adminShards{}
+	if err := json.NewDecoder(rec.Body).Decode(&shards); err != nil {
+		t.Fatal(err)
+	}
+	if len(shards.Success) != 256 || len(shards.Denial) != 256 {
+		t.Errorf("Expected 256 shards per cache, got %d and %d", len(shards.Success), len(shards.Denial))
+	}
+	if shards.Quotas != nil {
+		t.Errorf("Expected no quota caches, got %v", shards.Quotas)
+	}
+}
+
+func TestAdminShardsQuota(t *testing.T) {
+	c := New()
+	c.quotas = map[string]*quota{"example.org.": {cap: 256}}
+	c.quotaZones = []string{"example.org."}
+	for _, q := range c.quotas {
+		q.pcache, q.ncache = c.newCaches(q.cap, q.cap, 0)
+	}
+	c.Next = BackendHandler()
+	a := &admin{c: c}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.org.", dns.TypeA)
+	c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+
+	rec := httptest.NewRecorder()
+	a.shards(rec, httptest.NewRequest(http.MethodGet, "/cache/shards", nil))
+	shards := adminShards{}
+	if err := json.NewDecoder(rec.Body).Decode(&shards); err != nil {
+		t.Fatal(err)
+	}
+	q, ok := shards.Quotas["example.org."]
+	if !ok || len(q.Success) != 256 || len(q.Denial) != 256 {
+		t.Fatalf("Expected 256 shards per cache of the quota for example.org., got %v", shards.Quotas)
+	}
+	if n := sum(q.Success); n != 1 {
+		t.Errorf("Expected 1 item in the success cache of the quota, got %d", n)
+	}
+	if n := sum(shards.Success); n != 0 {
+		t.Errorf("Expected 0 items in the success cache, got %d", n)
+	}
+}
+
+func sum(lens []int) int {
+	n := 0
+	for _, l := range lens {
+		n += l
+	}
+	return n
+}
+
+func TestAdminPurgeNSEC(t *testing.T) {
+	c := New()
+	c.nsec = newNsecCache(c.ncap)
+	denial := nsecDenial("b.example.org.", dns.TypeA, dns.RcodeNameError,
+		test.NSEC("example.org. 3600 IN NSEC a.example.org. SOA NS RRSIG NSEC DNSKEY"),
+		test.NSEC("a.example.org. 3600 IN NSEC c.example.org. A RRSIG NSEC"),
+	)
+	a := &admin{c: c}
+
+	for _, url := range []string{"/cache?name=b.example.org", "/cache?zone=org", "/cache?all=true"} {
+		c.nsec.add(denial, "", c.now(), maxNTTL)
+		rec := httptest.NewRecorder()
+		a.items(rec, httptest.NewRequest(http.MethodDelete, url, nil))
+		p := adminPurged{}
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Purged != 2 {
+			t.Errorf("Expected 2 purged NSEC records for %s, got %d", url, p.Purged)
+		}
+		if m := c.nsec.synthesize(nsecQuery("b.example.org.", dns.TypeA), []string{""}, c.now(), true, false); m != nil {
+			t.Errorf("Expected no synthesized response after purging %s, got %s", url, m)
+		}
+	}
+
+	// Other zones are kept.
+	c.nsec.add(denial, "", c.now(), maxNTTL)
+	rec := httptest.NewRecorder()
+	a.items(rec, httptest.NewRequest(http.MethodDelete, "/cache?zone=example.net", nil))
+	if m := c.nsec.synthesize(nsecQuery("b.example.org.", dns.TypeA), []string{""}, c.now(), true, false); m == nil {
+		t.Errorf("Expected a synthesized response after purging example.net")
+	}
+}
+
+func TestSetupAdmin(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		addr      string
+	}{
+		{"admin localhost:9154", false, "localhost:9154"},
+		// fails
+		{"admin", true, ""},
+		{"admin localhost", true, ""},
+		{"admin localhost:9154 localhost:9155", true, ""},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", "cache {\n"+test.input+"\n}")
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.adminAddr != test.addr {
+			t.Errorf("Test %v: Expected address %q but found: %q", i, test.addr, ca.adminAddr)
+		}
+	}
+}
+
+func TestAdminSameAddress(t *testing.T) {
+	a := &admin{Addr: "127.0.0.1:0", c: New()}
+	if err := a.OnStartup(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.OnShutdown()
+
+	b := &admin{Addr: a.ln.Addr().String(), c: New()}
+	if err := b.OnStartup(); err == nil {
+		b.OnShutdown()
+		t.Fatal("Expected an error for a second cache with the same admin address")
+	}
+}
@@ -0,0 +1,464 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/nsec"
+	"github.com/coredns/coredns/plugin/validator"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// nsecCache holds the NSEC and NSEC3 records from DNSSEC validated denial of existence responses. It is used to
+// synthesize NXDOMAIN and NODATA responses for names covered by these records (RFC 8198), without asking the
+// upstream.
+type nsecCache struct {
+	sync.RWMutex
+	zones map[nsecKey]*nsecZone
+	size  int // number of NSEC and NSEC3 records in all zones
+	cap   int
+}
+
+// nsecKey identifies the records of a zone. Like other cache items, they are kept apart per view: the additional
+// cache key data of the response they came from, see keyData.
+type nsecKey struct {
+	view string
+	zone string
+}
+
+// nsecZone holds the denial of existence records of a single zone.
+type nsecZone struct {
+	soa       []dns.RR // SOA record and its signatures
+	soaExpire time.Time
+
+	nsec  []*nsecRecord // sorted in canonical order of the owner names
+	nsec3 []*nsecRecord // sorted on the owner name hashes
+
+	// NSEC3 parameters of the zone, taken from the most recently added NSEC3 record.
+	hash       uint8
+	iterations uint16
+	salt       string
+}
+
+// nsecRecord is a single NSEC or NSEC3 record together with its signatures.
+type nsecRecord struct {
+	key    string   // lowercased owner name for NSEC, the hash of the owner name for NSEC3
+	rrs    []dns.RR // the NSEC or NSEC3 record followed by its RRSIGs
+	expire time.Time
+}
+
+func newNsecCache(cap int) *nsecCache {
+	return &nsecCache{zones: make(map[nsecKey]*nsecZone), cap: cap}
+}
+
+// add stores the NSEC and NSEC3 records, and the SOA, from the authority section of the validated negative
+// response m in view. The records are kept at most until the negative TTL of the zone or maxTTL expires.
+func (n *nsecCache) add(m *dns.Msg, view string, now time.Time, maxTTL time.Duration) {
+	var soa *dns.SOA
+	for _, rr := range m.Ns {
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		return
+	}
+	zone := strings.ToLower(soa.Hdr.Name)
+
+	// RFC 9077: the negative TTL is the minimum of the SOA TTL and the SOA MINIMUM field.
+	negTTL := time.Duration(min32(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+	if negTTL > maxTTL {
+		negTTL = maxTTL
+	}
+	if negTTL <= 0 {
+		return
+	}
+
+	var records []*nsecRecord
+	for _, rr := range m.Ns {
+		var key string
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			key = strings.ToLower(x.Hdr.Name)
+		case *dns.NSEC3:
+			if x.Iterations > nsec.MaxIterations {
+				// RFC 9276, section 3.2: too expensive to hash names with.
+				continue
+			}
+			key = nsec3Hash(x)
+		default:
+			continue
+		}
+		if !dns.IsSubDomain(zone, strings.ToLower(rr.Header().Name)) {
+			continue
+		}
+		sigs := signatures(m.Ns, rr.Header().Name, rr.Header().Rrtype)
+		if len(sigs) == 0 {
+			continue
+		}
+		ttl := time.Duration(rr.Header().Ttl) * time.Second
+		if ttl > negTTL {
+			ttl = negTTL
+		}
+		records = append(records, &nsecRecord{key: key, rrs: append([]dns.RR{rr}, sigs...), expire: now.Add(ttl)})
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	k := nsecKey{view: view, zone: zone}
+	z, ok := n.zones[k]
+	if !ok {
+		z = &nsecZone{}
+		n.zones[k] = z
+	}
+	z.soa = append([]dns.RR{soa}, signatures(m.Ns, soa.Hdr.Name, dns.TypeSOA)...)
+	z.soaExpire = now.Add(negTTL)
+
+	for _, r := range records {
+		if n.size >= n.cap {
+			n.expire(now)
+			if n.size >= n.cap {
+				return
+			}
+		}
+		if nsec3, ok := r.rrs[0].(*dns.NSEC3); ok {
+			z.hash, z.iterations, z.salt = nsec3.Hash, nsec3.Iterations, nsec3.Salt
+			z.nsec3, ok = insert(z.nsec3, r, strings.Compare)
+		} else {
+			z.nsec, ok = insert(z.nsec, r, nsec.Compare)
+		}
+		if ok {
+			n.size++
+		}
+	}
+}
+
+// expire removes all expired records. The lock must be held by the caller.
+func (n *nsecCache) expire(now time.Time) {
+	for k, z := range n.zones {
+		before := len(z.nsec) + len(z.nsec3)
+		z.nsec = unexpired(z.nsec, now)
+		z.nsec3 = unexpired(z.nsec3, now)
+		n.size -= before - len(z.nsec) - len(z.nsec3)
+		if len(z.nsec)+len(z.nsec3) == 0 {
+			delete(n.zones, k)
+		}
+	}
+}
+
+// purge removes the zones whose records can deny name or names below it, all zones when name is empty. It returns
+// the number of removed records.
+func (n *nsecCache) purge(name string) int {
+	n.Lock()
+	defer n.Unlock()
+	removed := 0
+	for k, z := range n.zones {
+		if name == "" || dns.IsSubDomain(k.zone, name) || dns.IsSubDomain(name, k.zone) {
+			removed += len(z.nsec) + len(z.nsec3)
+			delete(n.zones, k)
+		}
+	}
+	n.size -= removed
+	return removed
+}
+
+// synthesize returns a NXDOMAIN or NODATA response for the request in state when that can be derived from
+// the records in n, in the first of views that has them. If not, nil is returned.
+func (n *nsecCache) synthesize(state request.Request, views []string, now time.Time, do, ad bool) *dns.Msg {
+	if state.QClass() != dns.ClassINET {
+		return nil
+	}
+	qname, qtype := state.Name(), state.QType()
+
+	n.RLock()
+	defer n.RUnlock()
+
+	for _, view := range views {
+		if m := n.synthesizeView(state, view, qname, qtype, now, do, ad); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// synthesizeView is synthesize for a single view. The lock must be held by the caller.
+func (n *nsecCache) synthesizeView(state request.Request, view, qname string, qtype uint16, now time.Time, do, ad bool) *dns.Msg {
+	var z *nsecZone
+	for off, end := 0, false; !end; off, end = dns.NextLabel(qname, off) {
+		if z = n.zones[nsecKey{view: view, zone: qname[off:]}]; z != nil {
+			break
+		}
+	}
+	if z == nil || !z.soaExpire.After(now) {
+		return nil
+	}
+
+	rcode, proof := z.denyNSEC(qname, qtype, now)
+	if proof == nil {
+		rcode, proof = z.denyNSEC3(qname, qtype, now)
+	}
+	if proof == nil {
+		return nil
+	}
+
+	ttl := z.soaExpire.Sub(now)
+	for _, r := range proof {
+		if d := r.expire.Sub(now); d < ttl {
+			ttl = d
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true // see item.toMsg
+	m.RecursionAvailable = true
+	m.AuthenticatedData = do || ad
+	m.Rcode = rcode
+
+	if !do {
+		m.Ns = filterRRSlice(z.soa[:1], uint32(ttl.Seconds()), true)
+		return m
+	}
+	ns := append([]dns.RR{}, z.soa...)
+	for _, r := range proof {
+		ns = append(ns, r.rrs...)
+	}
+	m.Ns = filterRRSlice(ns, uint32(ttl.Seconds()), true)
+	return m
+}
+
+// denyNSEC returns the rcode and the NSEC records that prove qname or qtype doesn't exist. The proof is nil when
+// this can't be proven with the cached records.
+func (z *nsecZone) denyNSEC(qname string, qtype uint16, now time.Time) (int, []*nsecRecord) {
+	r, match := find(z.nsec, qname, nsec.Compare, now, nsecCovers)
+	if r == nil {
+		return 0, nil
+	}
+	n := r.rrs[0].(*dns.NSEC)
+
+	if match {
+		if !nsec.NoData(n.TypeBitMap, qtype) {
+			return 0, nil
+		}
+		return dns.RcodeSuccess, []*nsecRecord{r}
+	}
+
+	// Names below a delegation or a DNAME are not covered by the NSEC of that name.
+	owner := strings.ToLower(n.Hdr.Name)
+	if dns.IsSubDomain(owner, qname) && nsec.Cut(n.TypeBitMap) {
+		return 0, nil
+	}
+
+	// A next name below qname means qname is an empty non-terminal, which does exist.
+	next := strings.ToLower(n.NextDomain)
+	if dns.IsSubDomain(qname, next) {
+		return 0, nil
+	}
+
+	// The closest encloser is the longest ancestor qname shares with the owner or the next name of the NSEC.
+	labels := len(dns.SplitDomainName(qname))
+	common := dns.CompareDomainName(qname, owner)
+	if c := dns.CompareDomainName(qname, next); c > common {
+		common = c
+	}
+	ce := "."
+	if common > 0 {
+		idx := dns.Split(qname)
+		ce = qname[idx[labels-common]:]
+	}
+
+	w, match := find(z.nsec, "*."+ce, nsec.Compare, now, nsecCovers)
+	if w == nil || match {
+		return 0, nil
+	}
+	if w == r {
+		return dns.RcodeNameError, []*nsecRecord{r}
+	}
+	return dns.RcodeNameError, []*nsecRecord{r, w}
+}
+
+// denyNSEC3 returns the rcode and the NSEC3 records that prove qname or qtype doesn't exist. The proof is nil when
+// this can't be proven with the cached records.
+func (z *nsecZone) denyNSEC3(qname string, qtype uint16, now time.Time) (int, []*nsecRecord) {
+	if len(z.nsec3) == 0 {
+		return 0, nil
+	}
+	hash := func(name string) string { return dns.HashName(name, z.hash, z.iterations, z.salt) }
+
+	r, match := find(z.nsec3, hash(qname), strings.Compare, now, nsec3Covers)
+	if match {
+		if !nsec.NoData(r.rrs[0].(*dns.NSEC3).TypeBitMap, qtype) {
+			return 0, nil
+		}
+		return dns.RcodeSuccess, []*nsecRecord{r}
+	}
+
+	// Find the closest encloser, the next closer name is the name one label below it.
+	var ce *nsecRecord
+	cename, nc := "", qname
+	for name := qname; ; {
+		off, end := dns.NextLabel(name, 0)
+		if end {
+			return 0, nil
+		}
+		parent := name[off:]
+		if r, match := find(z.nsec3, hash(parent), strings.Compare, now, nsec3Covers); match {
+			ce, cename, nc = r, parent, name
+			break
+		}
+		name = parent
+	}
+	if nsec.Cut(ce.rrs[0].(*dns.NSEC3).TypeBitMap) {
+		return 0, nil
+	}
+
+	next, match := find(z.nsec3, hash(nc), strings.Compare, now, nsec3Covers)
+	if next == nil || match {
+		return 0, nil
+	}
+	// With opt-out there may be an insecure delegation for the next closer name.
+	if next.rrs[0].(*dns.NSEC3).Flags&1 == 1 {
+		return 0, nil
+	}
+	w, match := find(z.nsec3, hash("*."+cename), strings.Compare, now, nsec3Covers)
+	if w == nil || match {
+		return 0, nil
+	}
+
+	proof := []*nsecRecord{ce}
+	for _, r := range []*nsecRecord{next, w} {
+		if r != proof[len(proof)-1] && r != proof[0] {
+			proof = append(proof, r)
+		}
+	}
+	return dns.RcodeNameError, proof
+}
+
+// find looks up key in the sorted records. It returns the record matching key and true, or the record covering key
+// and false. If there is no such (unexpired) record, nil is returned.
+func find(records []*nsecRecord, key string, compare func(a, b string) int, now time.Time, covers func(*nsecRecord, string) bool) (*nsecRecord, bool) {
+	if len(records) == 0 {
+		return nil, false
+	}
+	i := sort.Search(len(records), func(i int) bool { return compare(records[i].key, key) >= 0 })
+	if i < len(records) && compare(records[i].key, key) == 0 {
+		if !records[i].expire.After(now) {
+			return nil, false
+		}
+		return records[i], true
+	}
+	// Key sorts before all owners, this can only be covered by the last record which wraps around.
+	if i == 0 {
+		i = len(records)
+	}
+	r := records[i-1]
+	if !r.expire.After(now) || !covers(r, key) {
+		return nil, false
+	}
+	return r, false
+}
+
+// nsecCovers returns true if name falls between the owner and next name of the NSEC record in r.
+func nsecCovers(r *nsecRecord, name string) bool {
+	return nsec.Covers(r.key, r.rrs[0].(*dns.NSEC).NextDomain, name)
+}
+
+// nsec3Covers returns true if hash falls between the owner and next hash of the NSEC3 record in r.
+func nsec3Covers(r *nsecRecord, hash string) bool {
+	next := strings.ToUpper(r.rrs[0].(*dns.NSEC3).NextDomain)
+	return between(r.key, hash, next, strings.Compare)
+}
+
+// between returns true if owner < x < next, taking into account the last record of a chain wraps around.
+func between(owner, x, next string, compare func(a, b string) int) bool {
+	if compare(owner, next) < 0 {
+		return compare(owner, x) < 0 && compare(x, next) < 0
+	}
+	return compare(owner, x) < 0 || compare(x, next) < 0
+}
+
+// insert adds r to the sorted records, replacing a record with the same key. It returns true if the
+// number of records grew.
+func insert(records []*nsecRecord, r *nsecRecord, compare func(a, b string) int) ([]*nsecRecord, bool) {
+	i := sort.Search(len(records), func(i int) bool { return compare(records[i].key, r.key) >= 0 })
+	if i < len(records) && compare(records[i].key, r.key) == 0 {
+		records[i] = r
+		return records, false
+	}
+	records = append(records, nil)
+	copy(records[i+1:], records[i:])
+	records[i] = r
+	return records, true
+}
+
+func unexpired(records []*nsecRecord, now time.Time) []*nsecRecord {
+	keep := records[:0]
+	for _, r := range records {
+		if r.expire.After(now) {
+			keep = append(keep, r)
+		}
+	}
+	for i := len(keep); i < len(records); i++ {
+		records[i] = nil
+	}
+	return keep
+}
+
+// signatures returns the RRSIGs in rrs for the RRset with the given owner name and type.
+func signatures(rrs []dns.RR, name string, t uint16) []dns.RR {
+	var sigs []dns.RR
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == t && strings.EqualFold(sig.Hdr.Name, name) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// nsec3Hash returns the (uppercased) hash in the owner name of the NSEC3 record.
+func nsec3Hash(rr *dns.NSEC3) string {
+	owner := rr.Hdr.Name
+	if i := strings.IndexByte(owner, '.'); i > 0 {
+		owner = owner[:i]
+	}
+	return strings.ToUpper(owner)
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// withDenial returns a copy of ctx in which the validator plugin hands the denial of existence it validated to w.
+// The validator removes the DNSSEC records from the response for a client that didn't set the DO bit, this way the
+// aggressive cache still gets them.
+func (w *ResponseWriter) withDenial(ctx context.Context) context.Context {
+	if w.nsec == nil || w.nsecTrustAD {
+		return ctx
+	}
+	return validator.WithDenial(ctx, func(m *dns.Msg) { w.denial = m })
+}
+
+// validated returns the validated denial of existence for the response m to be used by the aggressive cache, or
+// nil if there is none: the response the validator handed over, or m when the AD bit set by the upstream is trusted.
+func (w *ResponseWriter) validated(m *dns.Msg) *dns.Msg {
+	if w.nsecTrustAD {
+		if m.AuthenticatedData {
+			return m
+		}
+		return nil
+	}
+	return w.denial
+}
@@ -0,0 +1,329 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func sig(name string, covered string) dns.RR {
+	return test.RRSIG(name + " 3600 IN RRSIG " + covered + " 8 2 3600 20300101000000 20200101000000 12345 example.org. AAAA")
+}
+
+// nsecDenial returns a validated negative response for example.org with the given NSEC or NSEC3 records.
+func nsecDenial(qname string, qtype uint16, rcode int, rrs ...dns.RR) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.Response, m.AuthenticatedData, m.Rcode = true, true, rcode
+	m.Ns = []dns.RR{
+		test.SOA("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300"),
+		sig("example.org.", "SOA"),
+	}
+	for _, rr := range rrs {
+		m.Ns = append(m.Ns, rr, sig(rr.Header().Name, dns.TypeToString[rr.Header().Rrtype]))
+	}
+	return m
+}
+
+func mustRR(s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+func nsecQuery(qname string, qtype uint16) request.Request {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.SetEdns0(4096, true)
+	return request.Request{W: &test.ResponseWriter{}, Req: m}
+}
+
+func TestAggressiveNSEC(t *testing.T) {
+	now := time.Now()
+	n := newNsecCache(100)
+	n.add(nsecDenial("b.example.org.", dns.TypeA, dns.RcodeNameError,
+		test.NSEC("example.org. 3600 IN NSEC a.example.org. SOA NS RRSIG NSEC DNSKEY"),
+		test.NSEC("a.example.org. 3600 IN NSEC c.example.org. A RRSIG NSEC"),
+	), "", now, maxNTTL)
+	n.add(nsecDenial("d.example.org.", dns.TypeA, dns.RcodeNameError,
+		test.NSEC("c.example.org. 3600 IN NSEC x.e.example.org. A RRSIG NSEC"),
+		test.NSEC("example.org. 3600 IN NSEC a.example.org. SOA NS RRSIG NSEC DNSKEY"),
+	), "", now, maxNTTL)
+	n.add(nsecDenial("sub.example.org.", dns.TypeDS, dns.RcodeSuccess,
+		test.NSEC("sub.example.org. 3600 IN NSEC z.example.org. NS RRSIG NSEC"),
+	), "", now, maxNTTL)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int // -1 means no synthesized response
+	}{
+		{"b.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"bb.example.org.", dns.TypeMX, dns.RcodeNameError},
+		{"d.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"a.example.org.", dns.TypeAAAA, dns.RcodeSuccess},
+		{"a.example.org.", dns.TypeA, -1}, // exists
+		{"x.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"e.example.org.", dns.TypeA, -1},  // empty non-terminal
+		{"zz.example.org.", dns.TypeA, -1}, // no covering NSEC cached
+		{"example.org.", dns.TypeDS, -1},   // apex NSEC can't deny DS
+		{"sub.example.org.", dns.TypeDS, dns.RcodeSuccess},
+		{"sub.example.org.", dns.TypeA, -1},     // delegation
+		{"www.sub.example.org.", dns.TypeA, -1}, // below delegation
+		{"b.example.net.", dns.TypeA, -1},       // other zone
+	}
+	for i, tc := range tests {
+		m := n.synthesize(nsecQuery(tc.qname, tc.qtype), []string{""}, now.Add(time.Minute), true, false)
+		if m == nil {
+			if tc.rcode != -1 {
+				t.Errorf("Test %d: expected rcode %d for %s, got no response", i, tc.rcode, tc.qname)
+			}
+			continue
+		}
+		if tc.rcode == -1 {
+			t.Errorf("Test %d: expected no response for %s, got %s", i, tc.qname, m)
+			continue
+		}
+		if m.Rcode != tc.rcode || !m.AuthenticatedData {
+			t.Errorf("Test %d: expected rcode %d with AD for %s, got %d", i, tc.rcode, tc.qname, m.Rcode)
+		}
+		if _, ok := m.Ns[0].(*dns.SOA); !ok {
+			t.Errorf("Test %d: expected SOA in authority section, got %s", i, m.Ns[0])
+		}
+		// SOA negative TTL is 300, a minute has passed.
+		if ttl := m.Ns[0].Header().Ttl; ttl != 240 {
+			t.Errorf("Test %d: expected TTL 240, got %d", i, ttl)
+		}
+	}
+
+	// Expired records are not used.
+	if m := n.synthesize(nsecQuery("b.example.org.", dns.TypeA), []string{""}, now.Add(301*time.Second), true, false); m != nil {
+		t.Errorf("Expected no response after expiry, got %s", m)
+	}
+}
+
+func TestAggressiveNSECBlackLies(t *testing.T) {
+	now := time.Now()
+	n := newNsecCache(100)
+	// The NODATA response of a server that uses black lies: the next name is the first possible name below the owner.
+	n.add(nsecDenial("www.example.org.", dns.TypeAAAA, dns.RcodeSuccess,
+		test.NSEC("www.example.org. 3600 IN NSEC \\000.www.example.org. A RRSIG NSEC"),
+	), "", now, maxNTTL)
+
+	if m := n.synthesize(nsecQuery("www.example.org.", dns.TypeAAAA), []string{""}, now, true, false); m == nil || m.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NODATA for www.example.org. AAAA, got %v", m)
+	}
+	// These names sort after \000.www.example.org., they are not covered.
+	for _, qname := range []string{"2.www.example.org.", "-.www.example.org.", "*.www.example.org.", "\\000.www.example.org."} {
+		if m := n.synthesize(nsecQuery(qname, dns.TypeA), []string{""}, now, true, false); m != nil {
+			t.Errorf("Expected no response for %s, got %s", qname, m)
+		}
+	}
+}
+
+func TestAggressiveNSEC3(t *testing.T) {
+	hash := func(name string) string { return dns.HashName(name, dns.SHA1, 0, "") }
+	h0, h1 := hash("example.org."), hash("a.example.org.")
+	if h1 < h0 {
+		h0, h1 = h1, h0
+	}
+	apex := hash("example.org.")
+	bitmap := func(h string) string {
+		if h == apex {
+			return "SOA NS RRSIG DNSKEY NSEC3PARAM"
+		}
+		return "A RRSIG"
+	}
+
+	now := time.Now()
+	n := newNsecCache(100)
+	n.add(nsecDenial("b.example.org.", dns.TypeA, dns.RcodeNameError,
+		mustRR(h0+".example.org. 3600 IN NSEC3 1 0 0 - "+h1+" "+bitmap(h0)),
+		mustRR(h1+".example.org. 3600 IN NSEC3 1 0 0 - "+h0+" "+bitmap(h1)),
+	), "", now, maxNTTL)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+	}{
+		{"b.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"x.y.example.org.", dns.TypeA, dns.RcodeNameError},
+		{"a.example.org.", dns.TypeAAAA, dns.RcodeSuccess},
+		{"a.example.org.", dns.TypeA, -1},
+	}
+	for i, tc := range tests {
+		m := n.synthesize(nsecQuery(tc.qname, tc.qtype), []string{""}, now, true, false)
+		if m == nil {
+			if tc.rcode != -1 {
+				t.Errorf("Test %d: expected rcode %d for %s, got no response", i, tc.rcode, tc.qname)
+			}
+			continue
+		}
+		if tc.rcode == -1 || m.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d for %s, got %d", i, tc.rcode, tc.qname, m.Rcode)
+		}
+	}
+}
+
+func TestAggressiveNSEC3Iterations(t *testing.T) {
+	iterations := uint16(101)
+	hash := func(name string) string { return dns.HashName(name, dns.SHA1, iterations, "") }
+	h0, h1 := hash("example.org."), hash("a.example.org.")
+	if h1 < h0 {
+		h0, h1 = h1, h0
+	}
+
+	now := time.Now()
+	n := newNsecCache(100)
+	n.add(nsecDenial("b.example.org.", dns.TypeA, dns.RcodeNameError,
+		mustRR(h0+".example.org. 3600 IN NSEC3 1 0 101 - "+h1+" A RRSIG"),
+		mustRR(h1+".example.org. 3600 IN NSEC3 1 0 101 - "+h0+" A RRSIG"),
+	), "", now, maxNTTL)
+
+	if m := n.synthesize(nsecQuery("b.example.org.", dns.TypeA), []string{""}, now, true, false); m != nil {
+		t.Errorf("Expected no response from NSEC3 records with %d iterations, got %s", iterations, m)
+	}
+}
+
+func TestAggressiveNSECServeDNS(t *testing.T) {
+	calls := 0
+	c := New()
+	c.nsec = newNsecCache(c.ncap)
+	c.Next = nsecBackend(&calls, true)
+
+	// The client doesn't set the DO bit, the validator hands the proof over to the cache.
+	for i, qname := range []string{"b.example.org.", "bb.example.org.", "b.b.example.org."} {
+		req := new(dns.Msg)
+		req.SetQuestion(qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, req)
+		if rec.Msg.Rcode != dns.RcodeNameError {
+			t.Errorf("Test %d: expected NXDOMAIN, got %d", i, rec.Msg.Rcode)
+		}
+		// Without the DO bit the proof isn't included in the responses.
+		if len(rec.Msg.Ns) != 1 {
+			t.Errorf("Test %d: expected only the SOA in the authority section, got %d records", i, len(rec.Msg.Ns))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 backend call, got %d", calls)
+	}
+}
+
+// nsecBackend answers every query with an NXDOMAIN response for example.org. with the AD bit set. When validated
+// is true it acts like the validator plugin: it hands the response over to the cache, and removes the DNSSEC records
+// and the AD bit if the request doesn't have the DO bit set.
+func nsecBackend(calls *int, validated bool) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*calls++
+		m := nsecDenial(r.Question[0].Name, r.Question[0].Qtype, dns.RcodeNameError,
+			test.NSEC("example.org. 3600 IN NSEC a.example.org. SOA NS RRSIG NSEC DNSKEY"),
+			test.NSEC("a.example.org. 3600 IN NSEC c.example.org. A RRSIG NSEC"),
+		)
+		m.Id = r.Id
+		if validated {
+			w.(*ResponseWriter).denial = m.Copy()
+			if opt := r.IsEdns0(); opt == nil || !opt.Do() {
+				m.Ns, m.AuthenticatedData = m.Ns[:1], false
+			}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeNameError, nil
+	})
+}
+
+func TestAggressiveNSECValidated(t *testing.T) {
+	tests := []struct {
+		validated bool
+		trustAD   bool
+		do        bool
+		calls     int
+	}{
+		{false, false, true, 2}, // not validated, the AD bit of the upstream isn't trusted
+		{true, false, true, 1},  // validated
+		{true, false, false, 1}, // validated, the client doesn't set the DO bit
+		{false, true, true, 1},  // trust_upstream_ad
+	}
+	for i, tc := range tests {
+		calls := 0
+		c := New()
+		c.nsec = newNsecCache(c.ncap)
+		c.nsecTrustAD = tc.trustAD
+		c.Next = nsecBackend(&calls, tc.validated)
+		for _, qname := range []string{"b.example.org.", "bb.example.org."} {
+			req := new(dns.Msg)
+			req.SetQuestion(qname, dns.TypeA)
+			if tc.do {
+				req.SetEdns0(4096, true)
+			}
+			c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+		}
+		if calls != tc.calls {
+			t.Errorf("Test %d: expected %d backend calls, got %d", i, tc.calls, calls)
+		}
+	}
+}
+
+func TestAggressiveNSECViews(t *testing.T) {
+	calls := 0
+	c := New()
+	c.nsec = newNsecCache(c.ncap)
+	c.nsecTrustAD = true
+	c.keyMetadata = []string{"view/name"}
+	c.Next = nsecBackend(&calls, false)
+
+	for i, tc := range []struct {
+		view, qname string
+		calls       int
+	}{
+		{"internal", "b.example.org.", 1},
+		{"internal", "bb.example.org.", 1}, // synthesized
+		{"external", "bb.example.org.", 2}, // not from the records of another view
+	} {
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		metadata.SetValueFunc(ctx, "view/name", func() string { return tc.view })
+		req := new(dns.Msg)
+		req.SetQuestion(tc.qname, dns.TypeA)
+		c.ServeDNS(ctx, &test.ResponseWriter{}, req)
+		if calls != tc.calls {
+			t.Errorf("Test %d: expected %d backend calls, got %d", i, tc.calls, calls)
+		}
+	}
+}
+
+func TestSetupAggressiveNSEC(t *testing.T) {
+	c := caddy.NewTestController("dns", "cache {\n aggressive_nsec\n}")
+	ca, err := cacheParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if ca.nsec == nil {
+		t.Errorf("Expected aggressive_nsec to be enabled")
+	}
+
+	if ca.nsecTrustAD {
+		t.Errorf("Expected the AD bit of the upstream not to be trusted")
+	}
+
+	c = caddy.NewTestController("dns", "cache {\n aggressive_nsec trust_upstream_ad\n}")
+	if ca, err = cacheParse(c); err != nil || !ca.nsecTrustAD {
+		t.Errorf("Expected the AD bit of the upstream to be trusted, got error %v", err)
+	}
+
+	c = caddy.NewTestController("dns", "cache {\n aggressive_nsec yes\n}")
+	if _, err := cacheParse(c); err == nil {
+		t.Errorf("Expected error for aggressive_nsec with arguments")
+	}
+}
@@ -48,6 +48,32 @@ type Cache struct {
 	pexcept []string
 	nexcept []string
 
+	// Persistence of the cache contents across restarts and reloads.
+	persistPath     string
+	persistInterval time.Duration
+
+	// Address of the admin HTTP endpoint.
+	adminAddr string
+
+	// Additional cache key data.
+	ecs         bool
+	ecsV4Prefix uint8
+	ecsV6Prefix uint8
+	scopes      scopeSet
+	keyMetadata []string
+
+	// Eviction policy, memory limit and per-zone quotas.
+	eviction   cache.Policy
+	maxBytes   int
+	quotas     map[string]*quota
+	quotaZones []string
+
+	// Aggressive use of DNSSEC validated denial of existence records, nil when disabled. The records are only
+	// used from the responses the validator plugin hands over, or from any response with the AD bit set when
+	// nsecTrustAD is true.
+	nsec        *nsecCache
+	nsecTrustAD bool
+
 	// Testing.
 	now func() time.Time
 }
@@ -56,27 +82,29 @@ type Cache struct {
 // caller to set the Next handler.
 func New() *Cache {
 	return &Cache{
-		Zones:      []string{"."},
-		pcap:       defaultCap,
-		pcache:     cache.New(defaultCap),
-		pttl:       maxTTL,
-		minpttl:    minTTL,
-		ncap:       defaultCap,
-		ncache:     cache.New(defaultCap),
-		nttl:       maxNTTL,
-		minnttl:    minNTTL,
-		failttl:    minNTTL,
-		prefetch:   0,
-		duration:   1 * time.Minute,
-		percentage: 10,
-		now:        time.Now,
+		Zones:       []string{"."},
+		pcap:        defaultCap,
+		pcache:      cache.New(defaultCap),
+		pttl:        maxTTL,
+		minpttl:     minTTL,
+		ncap:        defaultCap,
+		ncache:      cache.New(defaultCap),
+		nttl:        maxNTTL,
+		minnttl:     minNTTL,
+		failttl:     minNTTL,
+		prefetch:    0,
+		duration:    1 * time.Minute,
+		percentage:  10,
+		ecsV4Prefix: defaultECSv4Prefix,
+		ecsV6Prefix: defaultECSv6Prefix,
+		now:         time.Now,
 	}
 }
 
 // key returns key under which we store the item, -1 will be returned if we don't store the message.
 // Currently we do not cache Truncated, errors zone transfers or dynamic update messages.
 // qname holds the already lowercased qname.
-func key(qname string, m *dns.Msg, t response.Type, do bool) (bool, uint64) {
+func key(qname string, m *dns.Msg, t response.Type, do bool, extra ...[]byte) (bool, uint64) {
 	// We don't store truncated responses.
 	if m.Truncated {
 		return false, 0
@@ -86,13 +114,14 @@ func key(qname string, m *dns.Msg, t response.Type, do bool) (bool, uint64) {
 		return false, 0
 	}
 
-	return true, hash(qname, m.Question[0].Qtype, do)
+	return true, hash(qname, m.Question[0].Qtype, do, extra...)
 }
 
 var one = []byte("1")
 var zero = []byte("0")
 
-func hash(qname string, qtype uint16, do bool) uint64 {
+// hash returns the hash of qname, qtype and the DO bit, followed by the extra data, if any.
+func hash(qname string, qtype uint16, do bool, extra ...[]byte) uint64 {
 	h := fnv.New64()
 
 	if do {
@@ -104,6 +133,9 @@ func hash(qname string, qtype uint16, do bool) uint64 {
 	h.Write([]byte{byte(qtype >> 8)})
 	h.Write([]byte{byte(qtype)})
 	h.Write([]byte(qname))
+	for _, e := range extra {
+		h.Write(e)
+	}
 	return h.Sum64()
 }
 
@@ -131,6 +163,8 @@ type ResponseWriter struct {
 	remoteAddr net.Addr
 
 	wildcardFunc func() string // function to retrieve wildcard name that synthesized the result.
+	kd           keyData       // additional data for the cache key.
+	denial       *dns.Msg      // the validated denial of existence of the response, see withDenial.
 
 	pexcept []string // positive zone exceptions
 	nexcept []string // negative zone exceptions
@@ -174,7 +208,7 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	mt, _ := response.Typify(res, w.now().UTC())
 
 	// key returns empty string for anything we don't want to cache.
-	hasKey, key := key(w.state.Name(), res, mt, w.do)
+	hasKey, key := key(w.state.Name(), res, mt, w.do, w.kd.extra(res)...)
 
 	msgTTL := dnsutil.MinimalTTL(res, mt)
 	var duration time.Duration
@@ -189,8 +223,12 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	if hasKey && duration > 0 {
 		if w.state.Match(res) {
 			w.set(res, key, mt, duration)
-			cacheSize.WithLabelValues(w.server, Success, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(w.pcache.Len()))
-			cacheSize.WithLabelValues(w.server, Denial, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(w.ncache.Len()))
+			pn, pb := sizes(w.successCaches())
+			nn, nb := sizes(w.denialCaches())
+			cacheSize.WithLabelValues(w.server, Success, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(pn))
+			cacheSize.WithLabelValues(w.server, Denial, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(nn))
+			cacheBytes.WithLabelValues(w.server, Success, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(pb))
+			cacheBytes.WithLabelValues(w.server, Denial, w.zonesMetricLabel, w.viewMetricLabel).Set(float64(nb))
 		} else {
 			// Don't log it, but increment counter
 			cacheDrops.WithLabelValues(w.server, w.zonesMetricLabel, w.viewMetricLabel).Inc()
@@ -229,12 +267,12 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 		if w.wildcardFunc != nil {
 			i.wildcard = w.wildcardFunc()
 		}
-		if w.pcache.Add(key, i) {
+		if w.successCache(m.Question[0].Name).Add(key, i) {
 			evictions.WithLabelValues(w.server, Success, w.zonesMetricLabel, w.viewMetricLabel).Inc()
 		}
 		// when pre-fetching, remove the negative cache entry if it exists
 		if w.prefetch {
-			w.ncache.Remove(key)
+			w.denialCache(m.Question[0].Name).Remove(key)
 		}
 
 	case response.NameError, response.NoData, response.ServerError:
@@ -246,9 +284,14 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 		if w.wildcardFunc != nil {
 			i.wildcard = w.wildcardFunc()
 		}
-		if w.ncache.Add(key, i) {
+		if w.denialCache(m.Question[0].Name).Add(key, i) {
 			evictions.WithLabelValues(w.server, Denial, w.zonesMetricLabel, w.viewMetricLabel).Inc()
 		}
+		if w.nsec != nil && mt != response.ServerError {
+			if d := w.validated(m); d != nil {
+				w.nsec.add(d, view(w.kd.extra(m)), w.now(), w.nttl)
+			}
+		}
 
 	case response.OtherError:
 		// don't cache these
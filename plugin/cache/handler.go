@@ -8,6 +8,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -33,18 +34,27 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	// in which upstream doesn't support DNSSEC, the two cache items will effectively be the same. Regardless, any
 	// DNSSEC RRs in the response are written to cache with the response.
 
+	kd := c.newKeyData(ctx, state)
+
 	ttl := 0
-	i := c.getIgnoreTTL(now, state, server)
+	i := c.getIgnoreTTL(now, state, server, kd)
 	if i == nil {
+		if c.nsec != nil && plugin.Zones(c.nexcept).Matches(state.Name()) == "" {
+			if m := c.nsec.synthesize(state, kd.views(), now, do, ad); m != nil {
+				aggressiveHits.WithLabelValues(server, c.zonesMetricLabel, c.viewMetricLabel).Inc()
+				w.WriteMsg(m)
+				return dns.RcodeSuccess, nil
+			}
+		}
 		crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do, ad: ad,
-			nexcept: c.nexcept, pexcept: c.pexcept, wildcardFunc: wildcardFunc(ctx)}
+			nexcept: c.nexcept, pexcept: c.pexcept, wildcardFunc: wildcardFunc(ctx), kd: kd}
 		return c.doRefresh(ctx, state, crr)
 	}
 	ttl = i.ttl(now)
 	if ttl < 0 {
 		// serve stale behavior
 		if c.verifyStale {
-			crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do}
+			crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do, kd: kd}
 			cw := newVerifyStaleResponseWriter(crr)
 			ret, err := c.doRefresh(ctx, state, cw)
 			if cw.refreshed {
@@ -56,12 +66,17 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		now = now.Add(time.Duration(ttl) * time.Second)
 		if !c.verifyStale {
 			cw := newPrefetchResponseWriter(server, state, c)
+			cw.kd = kd
 			go c.doPrefetch(ctx, state, cw, i, now)
 		}
 		servedStale.WithLabelValues(server, c.zonesMetricLabel, c.viewMetricLabel).Inc()
 	} else if c.shouldPrefetch(i, now) {
 		cw := newPrefetchResponseWriter(server, state, c)
+		cw.kd = kd
 		go c.doPrefetch(ctx, state, cw, i, now)
+	} else if c.prefetch <= 0 && c.eviction != cache.Random {
+		// Keep track of the usage for the eviction policy, shouldPrefetch does this when prefetching is enabled.
+		i.Freq.Update(c.duration, now)
 	}
 
 	if i.wildcard != "" {
@@ -93,12 +108,17 @@ func (c *Cache) doPrefetch(ctx context.Context, state request.Request, cw *Respo
 	// When prefetching we loose the item i, and with it the frequency
 	// that we've gathered sofar. See we copy the frequencies info back
 	// into the new item that was stored in the cache.
-	if i1 := c.exists(state); i1 != nil {
+	if i1 := c.exists(state, cw.kd); i1 != nil {
 		i1.Freq.Reset(now, i.Freq.Hits())
 	}
 }
 
 func (c *Cache) doRefresh(ctx context.Context, state request.Request, cw dns.ResponseWriter) (int, error) {
+	if w, ok := cw.(interface {
+		withDenial(context.Context) context.Context
+	}); ok {
+		ctx = w.withDenial(ctx)
+	}
 	return plugin.NextOrFailure(c.Name(), c.Next, ctx, cw, state.Req)
 }
 
@@ -115,37 +135,42 @@ func (c *Cache) shouldPrefetch(i *item, now time.Time) bool {
 func (c *Cache) Name() string { return "cache" }
 
 // getIgnoreTTL unconditionally returns an item if it exists in the cache.
-func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string) *item {
-	k := hash(state.Name(), state.QType(), state.Do())
+func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string, kd keyData) *item {
 	cacheRequests.WithLabelValues(server, c.zonesMetricLabel, c.viewMetricLabel).Inc()
 
-	if i, ok := c.ncache.Get(k); ok {
-		itm := i.(*item)
-		ttl := itm.ttl(now)
-		if itm.matches(state) && (ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds()))) {
-			cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel, c.viewMetricLabel).Inc()
-			return i.(*item)
+	for _, extra := range kd.lookups() {
+		k := hash(state.Name(), state.QType(), state.Do(), extra...)
+
+		if i, ok := c.denialCache(state.Name()).Get(k); ok {
+			itm := i.(*item)
+			ttl := itm.ttl(now)
+			if itm.matches(state) && (ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds()))) {
+				cacheHits.WithLabelValues(server, Denial, c.zonesMetricLabel, c.viewMetricLabel).Inc()
+				return i.(*item)
+			}
 		}
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		itm := i.(*item)
-		ttl := itm.ttl(now)
-		if itm.matches(state) && (ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds()))) {
-			cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel, c.viewMetricLabel).Inc()
-			return i.(*item)
+		if i, ok := c.successCache(state.Name()).Get(k); ok {
+			itm := i.(*item)
+			ttl := itm.ttl(now)
+			if itm.matches(state) && (ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds()))) {
+				cacheHits.WithLabelValues(server, Success, c.zonesMetricLabel, c.viewMetricLabel).Inc()
+				return i.(*item)
+			}
 		}
 	}
 	cacheMisses.WithLabelValues(server, c.zonesMetricLabel, c.viewMetricLabel).Inc()
 	return nil
 }
 
-func (c *Cache) exists(state request.Request) *item {
-	k := hash(state.Name(), state.QType(), state.Do())
-	if i, ok := c.ncache.Get(k); ok {
-		return i.(*item)
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		return i.(*item)
+func (c *Cache) exists(state request.Request, kd keyData) *item {
+	for _, extra := range kd.lookups() {
+		k := hash(state.Name(), state.QType(), state.Do(), extra...)
+		if i, ok := c.denialCache(state.Name()).Get(k); ok {
+			return i.(*item)
+		}
+		if i, ok := c.successCache(state.Name()).Get(k); ok {
+			return i.(*item)
+		}
 	}
 	return nil
 }
@@ -23,6 +23,7 @@ type item struct {
 
 	origTTL uint32
 	stored  time.Time
+	size    int // size of the message in bytes, used for the memory limit of the cache
 
 	*freq.Freq
 }
@@ -53,11 +54,19 @@ func newItem(m *dns.Msg, now time.Time, d time.Duration) *item {
 	i.origTTL = uint32(d.Seconds())
 	i.stored = now.UTC()
 
-	i.Freq = new(freq.Freq)
+	i.size = m.Len()
+
+	i.Freq = freq.New(i.stored)
 
 	return i
 }
 
+// Size implements the cache.Sizer interface.
+func (i *item) Size() int { return i.size }
+
+// LastUsed implements the cache.Usage interface, together with the Hits method of freq.Freq.
+func (i *item) LastUsed() time.Time { return i.Freq.Last() }
+
 // toMsg turns i into a message, it tailors the reply to m.
 // The Authoritative bit should be set to 0, but some client stub resolver implementations, most notably,
 // on some legacy systems(e.g. ubuntu 14.04 with glib version 2.20), low-level glibc function `getaddrinfo`
@@ -94,6 +103,20 @@ func (i *item) toMsg(m *dns.Msg, now time.Time, do bool, ad bool) *dns.Msg {
 	return m1
 }
 
+// toWire returns the message held in i in wire format, with the TTLs as received.
+func (i *item) toWire() ([]byte, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(i.Name, i.QType)
+	m.Response = true
+	m.Rcode = i.Rcode
+	m.AuthenticatedData = i.AuthenticatedData
+	m.RecursionAvailable = i.RecursionAvailable
+	m.Answer = i.Answer
+	m.Ns = i.Ns
+	m.Extra = i.Extra
+	return m.Pack()
+}
+
 func (i *item) ttl(now time.Time) int {
 	ttl := int(i.origTTL) - int(now.UTC().Sub(i.stored).Seconds())
 	return ttl
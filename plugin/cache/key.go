@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// keyData holds the request data, beyond the qname, qtype and DO bit, that becomes part of the cache key.
+type keyData struct {
+	meta   []byte    // values of the metadata labels configured with key_metadata
+	ecs    *subnet   // client subnet of the request, when ecs is enabled
+	scopes *scopeSet // scope prefix lengths of the cached responses, when ecs is enabled
+}
+
+// newKeyData returns the key data for the request in state.
+func (c *Cache) newKeyData(ctx context.Context, state request.Request) keyData {
+	kd := keyData{}
+	for _, label := range c.keyMetadata {
+		v := ""
+		if f := metadata.ValueFunc(ctx, label); f != nil {
+			v = f()
+		}
+		// Prefix each value with its length to keep the concatenation unambiguous.
+		kd.meta = append(kd.meta, byte(len(v)>>8), byte(len(v)))
+		kd.meta = append(kd.meta, v...)
+	}
+	if c.ecs {
+		kd.ecs = c.clientSubnet(state)
+		kd.scopes = &c.scopes
+	}
+	return kd
+}
+
+// subnet is a client subnet (RFC 7871): the address family, the source prefix length and the address truncated
+// to that length. A family of 0 is a subnet that isn't valid.
+type subnet struct {
+	family uint16
+	source uint8
+	ip     net.IP
+}
+
+// clientSubnet returns the client subnet of the request. When the request has no ECS option the client's address
+// is used, truncated to the configured prefix length.
+func (c *Cache) clientSubnet(state request.Request) *subnet {
+	family, source := uint16(0), uint8(0)
+	var ip net.IP
+	if opt := state.Req.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+				family, source, ip = e.Family, e.SourceNetmask, e.Address
+				break
+			}
+		}
+	}
+	if family == 0 {
+		ip = net.ParseIP(state.IP())
+		family, source = 1, c.ecsV4Prefix
+		if ip.To4() == nil {
+			family, source = 2, c.ecsV6Prefix
+		}
+	}
+
+	switch family {
+	case 1:
+		ip = ip.To4()
+	case 2:
+		ip = ip.To16()
+	default:
+		ip = nil
+	}
+	sn := &subnet{family: family, source: source, ip: ip}
+	if ip == nil || int(source) > sn.bits() {
+		return &subnet{}
+	}
+	sn.ip = ip.Mask(net.CIDRMask(int(source), sn.bits()))
+	return sn
+}
+
+func (sn *subnet) bits() int {
+	if sn.family == 2 {
+		return 128
+	}
+	return 32
+}
+
+// key returns the key data for the subnet truncated to prefix length scope, which must not be longer than the
+// source prefix length.
+func (sn *subnet) key(scope uint8) []byte {
+	if sn.family == 0 {
+		return []byte{0}
+	}
+	ip := sn.ip.Mask(net.CIDRMask(int(scope), sn.bits()))
+	return append([]byte{byte(sn.family >> 8), byte(sn.family), scope}, ip...)
+}
+
+// extra returns the key data to use for storing res. When res has an ECS option with a non-zero scope prefix
+// length, the answer is for the client subnet truncated to that scope (RFC 7871, section 7.3). A zero scope means
+// the answer is valid for all clients. A scope longer than the source prefix length is capped to it, because the
+// subnet isn't known any better.
+func (kd keyData) extra(res *dns.Msg) [][]byte {
+	scope := scopeOf(res)
+	if kd.ecs == nil || scope == 0 {
+		return [][]byte{kd.meta}
+	}
+	if kd.ecs.family == 0 {
+		return [][]byte{kd.meta, kd.ecs.key(0)}
+	}
+	if scope > kd.ecs.source {
+		scope = kd.ecs.source
+	}
+	if scope == 0 {
+		return [][]byte{kd.meta}
+	}
+	kd.scopes.add(kd.ecs.family, scope)
+	return [][]byte{kd.meta, kd.ecs.key(scope)}
+}
+
+// lookups returns the key data to use for retrieving an item, in order of preference: the client subnet truncated
+// to each scope that responses were cached with, longest first, and then the key data for all clients.
+func (kd keyData) lookups() [][][]byte {
+	if kd.ecs == nil {
+		return [][][]byte{{kd.meta}}
+	}
+	if kd.ecs.family == 0 {
+		return [][][]byte{{kd.meta, kd.ecs.key(0)}, {kd.meta}}
+	}
+	lookups := [][][]byte{}
+	for scope := kd.ecs.source; scope > 0; scope-- {
+		if kd.scopes.has(kd.ecs.family, scope) {
+			lookups = append(lookups, [][]byte{kd.meta, kd.ecs.key(scope)})
+		}
+	}
+	return append(lookups, [][]byte{kd.meta})
+}
+
+// views returns the lookups as strings, see nsecKey.
+func (kd keyData) views() []string {
+	lookups := kd.lookups()
+	views := make([]string, len(lookups))
+	for i, extra := range lookups {
+		views[i] = view(extra)
+	}
+	return views
+}
+
+// view returns the key data in extra, as returned by keyData.extra or keyData.lookups, as a string.
+func view(extra [][]byte) string {
+	var b []byte
+	for _, e := range extra {
+		// Prefix each part with its length to keep the concatenation unambiguous.
+		b = append(b, byte(len(e)>>8), byte(len(e)))
+		b = append(b, e...)
+	}
+	return string(b)
+}
+
+// scopeOf returns the scope prefix length of the ECS option in m, 0 if there is none.
+func scopeOf(m *dns.Msg) uint8 {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return 0
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return e.SourceScope
+		}
+	}
+	return 0
+}
+
+// scopeSet is the set of scope prefix lengths responses were cached with, for IPv4 and IPv6. It keeps the number of
+// lookups down to the scopes that are actually used.
+type scopeSet struct {
+	bits [2][3]uint64 // prefix lengths 0 to 128
+}
+
+func (s *scopeSet) add(family uint16, scope uint8) {
+	w, bit := &s.bits[family-1][scope/64], uint64(1)<<(scope%64)
+	for {
+		old := atomic.LoadUint64(w)
+		if old&bit != 0 || atomic.CompareAndSwapUint64(w, old, old|bit) {
+			return
+		}
+	}
+}
+
+// load returns the prefix lengths in s as bit sets.
+func (s *scopeSet) load() [2][3]uint64 {
+	var bits [2][3]uint64
+	for f := range bits {
+		for i := range bits[f] {
+			bits[f][i] = atomic.LoadUint64(&s.bits[f][i])
+		}
+	}
+	return bits
+}
+
+// merge adds the prefix lengths in the bit sets, as returned by load, to s.
+func (s *scopeSet) merge(bits [2][3]uint64) {
+	for f := range bits {
+		for scope := 0; scope <= 128; scope++ {
+			if bits[f][scope/64]&(uint64(1)<<(scope%64)) != 0 {
+				s.add(uint16(f+1), uint8(scope))
+			}
+		}
+	}
+}
+
+func (s *scopeSet) has(family uint16, scope uint8) bool {
+	return atomic.LoadUint64(&s.bits[family-1][scope/64])&(uint64(1)<<(scope%64)) != 0
+}
+
+const (
+	defaultECSv4Prefix = 24
+	defaultECSv6Prefix = 56
+)
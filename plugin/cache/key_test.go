@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ecsBackend answers with the client's subnet in a TXT record and echoes the ECS option with the given scope.
+func ecsBackend(scope uint8, calls *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*calls++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Response, m.RecursionAvailable = true, true
+
+		txt := "none"
+		if opt := r.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+					txt = e.Address.String()
+					m.SetEdns0(4096, false)
+					e1 := *e
+					e1.SourceScope = scope
+					m.IsEdns0().Option = append(m.IsEdns0().Option, &e1)
+				}
+			}
+		}
+		m.Answer = []dns.RR{test.TXT("example.org. 300 IN TXT " + txt)}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func ecsQuery(addr string, source uint8) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeTXT)
+	m.SetEdns0(4096, false)
+	ip := net.ParseIP(addr)
+	family := uint16(1)
+	if ip.To4() == nil {
+		family = 2
+	}
+	m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: family, SourceNetmask: source, Address: ip})
+	return m
+}
+
+func TestCacheECS(t *testing.T) {
+	c := New()
+	c.ecs = true
+	calls := 0
+	c.Next = ecsBackend(24, &calls)
+
+	tests := []struct {
+		addr     string
+		expected string
+		calls    int
+	}{
+		{"192.0.2.1", "192.0.2.1", 1},
+		{"192.0.2.1", "192.0.2.1", 1},   // cached
+		{"192.0.2.200", "192.0.2.1", 1}, // same /24, cached
+		{"198.51.100.1", "198.51.100.1", 2},
+	}
+	for i, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, ecsQuery(tc.addr, 24))
+		if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != tc.expected {
+			t.Errorf("Test %d: expected answer %s, got %s", i, tc.expected, x)
+		}
+		if calls != tc.calls {
+			t.Errorf("Test %d: expected %d backend calls, got %d", i, tc.calls, calls)
+		}
+	}
+}
+
+func TestCacheECSScopeZero(t *testing.T) {
+	c := New()
+	c.ecs = true
+	calls := 0
+	c.Next = ecsBackend(0, &calls)
+
+	for _, addr := range []string{"192.0.2.1", "198.51.100.1"} {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, ecsQuery(addr, 24))
+		if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != "192.0.2.1" {
+			t.Errorf("Expected the globally cached answer, got %s", x)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 backend call, got %d", calls)
+	}
+}
+
+func TestCacheECSScope(t *testing.T) {
+	c := New()
+	c.ecs = true
+	calls := 0
+	c.Next = ecsBackend(16, &calls)
+
+	tests := []struct {
+		addr     string
+		source   uint8
+		expected string
+		calls    int
+	}{
+		{"192.0.2.1", 24, "192.0.2.1", 1},
+		{"192.0.200.1", 24, "192.0.2.1", 1}, // same /16, the scope of the response
+		{"192.0.2.1", 32, "192.0.2.1", 1},   // longer source prefix, same /16
+		{"192.1.2.1", 24, "192.1.2.1", 2},
+		{"192.0.2.1", 8, "192.0.2.1", 3}, // scope is capped to the shorter source prefix
+		{"192.10.2.1", 8, "192.0.2.1", 3},
+	}
+	for i, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, ecsQuery(tc.addr, tc.source))
+		if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != tc.expected {
+			t.Errorf("Test %d: expected answer %s, got %s", i, tc.expected, x)
+		}
+		if calls != tc.calls {
+			t.Errorf("Test %d: expected %d backend calls, got %d", i, tc.calls, calls)
+		}
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	c := New()
+	c.ecs = true
+
+	// Without an ECS option the client address truncated to the default prefix length is used.
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: req} // test.ResponseWriter's remote is 10.240.0.1
+	if x, y := c.clientSubnet(state), c.clientSubnet(request.Request{W: &test.ResponseWriter{}, Req: ecsQuery("10.240.0.0", 24)}); string(x.key(x.source)) != string(y.key(y.source)) {
+		t.Errorf("Expected client subnet %v, got %v", y, x)
+	}
+
+	state = request.Request{W: &test.ResponseWriter6{}, Req: req}
+	if x, y := c.clientSubnet(state), c.clientSubnet(request.Request{W: &test.ResponseWriter{}, Req: ecsQuery("fe80::", 56)}); string(x.key(x.source)) != string(y.key(y.source)) {
+		t.Errorf("Expected client subnet %v, got %v", y, x)
+	}
+}
+
+func TestCacheKeyMetadata(t *testing.T) {
+	c := New()
+	c.keyMetadata = []string{"view/name"}
+	calls := 0
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		calls++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{test.TXT("example.org. 300 IN TXT " + metadata.ValueFunc(ctx, "view/name")())}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	for i, view := range []string{"internal", "external", "internal"} {
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		metadata.SetValueFunc(ctx, "view/name", func() string { return view })
+
+		req := new(dns.Msg)
+		req.SetQuestion("example.org.", dns.TypeTXT)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(ctx, rec, req)
+		if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != view {
+			t.Errorf("Test %d: expected answer for view %s, got %s", i, view, x)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 backend calls, got %d", calls)
+	}
+}
+
+func TestSetupKeys(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		ecs       bool
+		v4, v6    uint8
+		meta      int
+	}{
+		{"ecs", false, true, 24, 56, 0},
+		{"ecs 16", false, true, 16, 56, 0},
+		{"ecs 16 48", false, true, 16, 48, 0},
+		{"key_metadata view/name geoip/country/code", false, false, 24, 56, 2},
+		// fails
+		{"ecs 33", true, false, 0, 0, 0},
+		{"ecs 24 129", true, false, 0, 0, 0},
+		{"ecs 24 56 64", true, false, 0, 0, 0},
+		{"ecs aa", true, false, 0, 0, 0},
+		{"key_metadata", true, false, 0, 0, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", "cache {\n"+test.input+"\n}")
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.ecs != test.ecs || ca.ecsV4Prefix != test.v4 || ca.ecsV6Prefix != test.v6 {
+			t.Errorf("Test %v: Expected ecs %t %d %d, got %t %d %d", i, test.ecs, test.v4, test.v6, ca.ecs, ca.ecsV4Prefix, ca.ecsV6Prefix)
+		}
+		if len(ca.keyMetadata) != test.meta {
+			t.Errorf("Test %v: Expected %d metadata labels, got %d", i, test.meta, len(ca.keyMetadata))
+		}
+	}
+}
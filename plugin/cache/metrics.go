@@ -15,6 +15,13 @@ var (
 		Name:      "entries",
 		Help:      "The number of elements in the cache.",
 	}, []string{"server", "type", "zones", "view"})
+	// cacheBytes is the total size of the elements in the cache by cache type.
+	cacheBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "size_bytes",
+		Help:      "The size of the elements in the cache in bytes.",
+	}, []string{"server", "type", "zones", "view"})
 	// cacheRequests is a counter of all requests through the cache.
 	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
@@ -64,4 +71,11 @@ var (
 		Name:      "evictions_total",
 		Help:      "The count of cache evictions.",
 	}, []string{"server", "type", "zones", "view"})
+	// aggressiveHits is the counter of responses synthesized from cached NSEC and NSEC3 records.
+	aggressiveHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "aggressive_nsec_hits_total",
+		Help:      "The count of negative responses synthesized from cached NSEC and NSEC3 records.",
+	}, []string{"server", "zones", "view"})
 )
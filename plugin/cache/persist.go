@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// snapshot is the on-disk format of the cache contents.
+type snapshot struct {
+	Version int
+	Items   []snapshotItem
+	Scopes  [2][3]uint64 // the scopeSet of the cache, so the items cached per client subnet are found
+}
+
+// snapshotItem is a single cache item in a snapshot. The message is stored in wire format.
+type snapshotItem struct {
+	Denial   bool // item is from the denial cache
+	Key      uint64
+	Msg      []byte
+	OrigTTL  uint32
+	Stored   time.Time
+	Wildcard string
+}
+
+const snapshotVersion = 1
+
+// persistSave writes the contents of the cache to c.persistPath. The file is replaced atomically.
+func (c *Cache) persistSave() error {
+	s := snapshot{Version: snapshotVersion, Scopes: c.scopes.load()}
+	for _, ca := range c.successCaches() {
+		s.Items = appendSnapshotItems(s.Items, ca, false)
+	}
+	for _, ca := range c.denialCaches() {
+		s.Items = appendSnapshotItems(s.Items, ca, true)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.persistPath), filepath.Base(c.persistPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // noop after a successful rename
+
+	if err := gob.NewEncoder(tmp).Encode(s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.persistPath); err != nil {
+		return err
+	}
+	log.Debugf("Saved %d items to %q", len(s.Items), c.persistPath)
+	return nil
+}
+
+func appendSnapshotItems(items []snapshotItem, ca *cache.Cache, denial bool) []snapshotItem {
+	ca.Walk(func(m map[uint64]interface{}, key uint64) bool {
+		i, ok := m[key].(*item)
+		if !ok {
+			return true
+		}
+		buf, err := i.toWire()
+		if err != nil {
+			return true
+		}
+		items = append(items, snapshotItem{Denial: denial, Key: key, Msg: buf, OrigTTL: i.origTTL, Stored: i.stored, Wildcard: i.wildcard})
+		return true
+	})
+	return items
+}
+
+// persistLoad reads the snapshot in c.persistPath and adds the items that haven't expired (taking serve_stale
+// into account) to the cache. A missing snapshot is not an error.
+func (c *Cache) persistLoad() error {
+	f, err := os.Open(c.persistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := c.restore(f)
+	if err != nil {
+		return fmt.Errorf("failed to restore cache from %q: %s", c.persistPath, err)
+	}
+	log.Infof("Restored %d items from %q", n, c.persistPath)
+	return nil
+}
+
+// restore adds the items in the snapshot read from r to the cache and returns how many it added.
+func (c *Cache) restore(r io.Reader) (int, error) {
+	s := snapshot{}
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return 0, err
+	}
+	if s.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+
+	c.scopes.merge(s.Scopes)
+
+	now := c.now()
+	n := 0
+	for _, si := range s.Items {
+		m := new(dns.Msg)
+		if err := m.Unpack(si.Msg); err != nil {
+			continue
+		}
+		i := newItem(m, si.Stored, time.Duration(si.OrigTTL)*time.Second)
+		i.wildcard = si.Wildcard
+		if ttl := i.ttl(now); ttl <= 0 && -ttl >= int(c.staleUpTo.Seconds()) {
+			continue
+		}
+		if si.Denial {
+			c.denialCache(i.Name).Add(si.Key, i)
+		} else {
+			c.successCache(i.Name).Add(si.Key, i)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// persistLoop saves the cache every c.persistInterval until stop is closed.
+func (c *Cache) persistLoop(stop chan struct{}) {
+	tick := time.NewTicker(c.persistInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			if err := c.persistSave(); err != nil {
+				log.Errorf("Failed to save cache to %q: %s", c.persistPath, err)
+			}
+		}
+	}
+}
+
+const defaultPersistInterval = 5 * time.Minute
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c := New()
+	c.persistPath = path
+	c.Next = BackendHandler()
+
+	for _, name := range []string{"example.org.", "example.net."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+	}
+	c.Next = nxDomainBackend(60)
+	req := new(dns.Msg)
+	req.SetQuestion("nx.example.org.", dns.TypeA)
+	c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+
+	if err := c.persistSave(); err != nil {
+		t.Fatalf("Expected no error saving the cache, got: %s", err)
+	}
+
+	c1 := New()
+	c1.persistPath = path
+	c1.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		t.Errorf("Unexpected cache miss for %s", r.Question[0].Name)
+		return dns.RcodeServerFailure, nil
+	})
+	if err := c1.persistLoad(); err != nil {
+		t.Fatalf("Expected no error loading the cache, got: %s", err)
+	}
+	if c1.pcache.Len() != 2 || c1.ncache.Len() != 1 {
+		t.Fatalf("Expected 2 positive and 1 negative item, got %d and %d", c1.pcache.Len(), c1.ncache.Len())
+	}
+
+	req = new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c1.ServeDNS(context.TODO(), rec, req)
+	if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].(*dns.A).A.String() != "127.0.0.53" {
+		t.Errorf("Expected restored answer, got %v", rec.Msg.Answer)
+	}
+
+	// Items that expired while CoreDNS was down are not restored.
+	c2 := New()
+	c2.persistPath = path
+	c2.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if err := c2.persistLoad(); err != nil {
+		t.Fatalf("Expected no error loading the cache, got: %s", err)
+	}
+	if c2.pcache.Len() != 0 || c2.ncache.Len() != 0 {
+		t.Errorf("Expected no items to be restored, got %d and %d", c2.pcache.Len(), c2.ncache.Len())
+	}
+
+	// Unless they can be served stale.
+	c2.staleUpTo = 2 * time.Hour
+	if err := c2.persistLoad(); err != nil {
+		t.Fatalf("Expected no error loading the cache, got: %s", err)
+	}
+	if c2.pcache.Len() != 2 || c2.ncache.Len() != 1 {
+		t.Errorf("Expected 2 positive and 1 negative stale item, got %d and %d", c2.pcache.Len(), c2.ncache.Len())
+	}
+}
+
+func TestPersistECS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c := New()
+	c.ecs, c.persistPath = true, path
+	calls := 0
+	c.Next = ecsBackend(16, &calls)
+	c.ServeDNS(context.TODO(), &test.ResponseWriter{}, ecsQuery("192.0.2.1", 24))
+	if err := c.persistSave(); err != nil {
+		t.Fatalf("Expected no error saving the cache, got: %s", err)
+	}
+
+	c1 := New()
+	c1.ecs, c1.persistPath = true, path
+	c1.Next = ecsBackend(16, &calls)
+	if err := c1.persistLoad(); err != nil {
+		t.Fatalf("Expected no error loading the cache, got: %s", err)
+	}
+	// The restored item is found for another client in the same scope.
+	c1.ServeDNS(context.TODO(), &test.ResponseWriter{}, ecsQuery("192.0.200.1", 24))
+	if calls != 1 {
+		t.Errorf("Expected the restored item to be used, got %d backend calls", calls)
+	}
+}
+
+func TestPersistMissingFile(t *testing.T) {
+	c := New()
+	c.persistPath = filepath.Join(t.TempDir(), "does-not-exist")
+	if err := c.persistLoad(); err != nil {
+		t.Errorf("Expected no error for a missing snapshot, got: %s", err)
+	}
+}
+
+func TestSetupPersist(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		path      string
+		interval  time.Duration
+	}{
+		{"persist /var/lib/coredns/cache", false, "/var/lib/coredns/cache", defaultPersistInterval},
+		{"persist /var/lib/coredns/cache 30s", false, "/var/lib/coredns/cache", 30 * time.Second},
+		// fails
+		{"persist", true, "", 0},
+		{"persist /var/lib/coredns/cache 0s", true, "", 0},
+		{"persist /var/lib/coredns/cache aa", true, "", 0},
+		{"persist /var/lib/coredns/cache 1m invalid", true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", "cache {\n"+test.input+"\n}")
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.persistPath != test.path {
+			t.Errorf("Test %v: Expected path %q but found: %q", i, test.path, ca.persistPath)
+		}
+		if ca.persistInterval != test.interval {
+			t.Errorf("Test %v: Expected interval %v but found: %v", i, test.interval, ca.persistInterval)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+)
+
+// quota holds the success and denial caches of a zone with a quota. Names in the zone are only stored
+// in these caches, so they can't crowd out the responses for other names.
+type quota struct {
+	cap    int
+	bytes  int // memory limit, 0 means no limit
+	pcache *cache.Cache
+	ncache *cache.Cache
+}
+
+// quotaFor returns the quota of the zone with the longest match for name, or nil if there is none.
+func (c *Cache) quotaFor(name string) *quota {
+	if len(c.quotas) == 0 {
+		return nil
+	}
+	return c.quotas[plugin.Zones(c.quotaZones).Matches(name)]
+}
+
+// successCache returns the success cache to use for name.
+func (c *Cache) successCache(name string) *cache.Cache {
+	if q := c.quotaFor(name); q != nil {
+		return q.pcache
+	}
+	return c.pcache
+}
+
+// denialCache returns the denial cache to use for name.
+func (c *Cache) denialCache(name string) *cache.Cache {
+	if q := c.quotaFor(name); q != nil {
+		return q.ncache
+	}
+	return c.ncache
+}
+
+// successCaches returns all success caches.
+func (c *Cache) successCaches() []*cache.Cache {
+	caches := []*cache.Cache{c.pcache}
+	for _, z := range c.quotaZones {
+		caches = append(caches, c.quotas[z].pcache)
+	}
+	return caches
+}
+
+// denialCaches returns all denial caches.
+func (c *Cache) denialCaches() []*cache.Cache {
+	caches := []*cache.Cache{c.ncache}
+	for _, z := range c.quotaZones {
+		caches = append(caches, c.quotas[z].ncache)
+	}
+	return caches
+}
+
+// newCaches creates the success and denial caches with capacities pcap and ncap, and divides the memory limit
+// maxBytes between them in proportion to their capacity.
+func (c *Cache) newCaches(pcap, ncap, maxBytes int) (*cache.Cache, *cache.Cache) {
+	pcache, ncache := cache.New(pcap), cache.New(ncap)
+	pcache.SetPolicy(c.eviction)
+	ncache.SetPolicy(c.eviction)
+	if maxBytes > 0 && pcap+ncap > 0 {
+		pbytes := int(int64(maxBytes) * int64(pcap) / int64(pcap+ncap))
+		pcache.SetMaxBytes(pbytes)
+		ncache.SetMaxBytes(maxBytes - pbytes)
+	}
+	return pcache, ncache
+}
+
+// sizes returns the number of items and their size in bytes in caches.
+func sizes(caches []*cache.Cache) (int, int) {
+	n, b := 0, 0
+	for _, ca := range caches {
+		n += ca.Len()
+		b += ca.Bytes()
+	}
+	return n, b
+}
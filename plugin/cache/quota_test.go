@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetupEviction(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		eviction  cache.Policy
+		maxBytes  int
+		quotas    int
+	}{
+		{`cache`, false, cache.Random, 0, 0},
+		{"cache {\n eviction lfu\n max_memory 64M\n}", false, cache.LFU, 64 << 20, 0},
+		{"cache {\n eviction lru\n max_memory 1024\n}", false, cache.LRU, 1024, 0},
+		{"cache {\n quota example.org 2048\n quota example.net 2048 1MB\n}", false, cache.Random, 0, 2},
+		// fails
+		{"cache {\n eviction fifo\n}", true, cache.Random, 0, 0},
+		{"cache {\n max_memory 12X\n}", true, cache.Random, 0, 0},
+		{"cache {\n max_memory -1\n}", true, cache.Random, 0, 0},
+		{"cache {\n quota example.org\n}", true, cache.Random, 0, 0},
+		{"cache {\n quota example.org 0\n}", true, cache.Random, 0, 0},
+		{"cache {\n quota example.org 10\n quota example.org 20\n}", true, cache.Random, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		ca, err := cacheParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if ca.eviction != tc.eviction {
+			t.Errorf("Test %d: expected eviction %d, got %d", i, tc.eviction, ca.eviction)
+		}
+		if ca.maxBytes != tc.maxBytes {
+			t.Errorf("Test %d: expected max memory %d, got %d", i, tc.maxBytes, ca.maxBytes)
+		}
+		if len(ca.quotas) != tc.quotas {
+			t.Errorf("Test %d: expected %d quotas, got %d", i, tc.quotas, len(ca.quotas))
+		}
+	}
+}
+
+func TestCacheQuota(t *testing.T) {
+	c := New()
+	c.quotas = map[string]*quota{"noisy.example.org.": {cap: 1}}
+	c.quotaZones = []string{"noisy.example.org."}
+	c.pcache, c.ncache = c.newCaches(c.pcap, c.ncap, 0)
+	for _, q := range c.quotas {
+		q.pcache, q.ncache = c.newCaches(q.cap, q.cap, 0)
+	}
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 127.0.0.1")}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	query := func(name string) {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+
+	for i := 0; i < 100; i++ {
+		query(fmt.Sprintf("%d.example.org.", i))
+	}
+	for i := 0; i < 5000; i++ {
+		query(fmt.Sprintf("%d.noisy.example.org.", i))
+	}
+
+	if n := c.pcache.Len(); n != 100 {
+		t.Errorf("Expected 100 items outside of the quota zone, got %d", n)
+	}
+	// The minimum capacity of a cache is 4 items per shard.
+	if n := c.quotas["noisy.example.org."].pcache.Len(); n > 1024 {
+		t.Errorf("Expected at most 1024 items in the quota zone, got %d", n)
+	}
+	if n, _ := sizes(c.successCaches()); n != 100+c.quotas["noisy.example.org."].pcache.Len() {
+		t.Errorf("Expected success caches to hold all items, got %d", n)
+	}
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +14,8 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/cache"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/validator"
 )
 
 var log = clog.NewWithPlugin("cache")
@@ -29,6 +33,48 @@ func setup(c *caddy.Controller) error {
 		return nil
 	})
 
+	if ca.nsec != nil && !ca.nsecTrustAD {
+		c.OnStartup(func() error {
+			if _, ok := dnsserver.GetConfig(c).Handler("validator").(*validator.Validator); !ok {
+				return plugin.Error("cache", errors.New("aggressive_nsec needs the validator plugin, or trust_upstream_ad"))
+			}
+			return nil
+		})
+	}
+
+	if ca.adminAddr != "" {
+		a := &admin{Addr: ca.adminAddr, c: ca}
+		c.OnStartup(a.OnStartup)
+		c.OnRestart(a.OnShutdown)
+		c.OnFinalShutdown(a.OnShutdown)
+		c.OnRestartFailed(a.OnStartup)
+	}
+
+	if ca.persistPath != "" {
+		stop := make(chan struct{})
+		c.OnStartup(func() error {
+			if err := ca.persistLoad(); err != nil {
+				log.Warning(err)
+			}
+			go ca.persistLoop(stop)
+			return nil
+		})
+		// On reload the old instance runs its OnRestart callbacks before the new instance is started, so
+		// the cache is saved here, and loaded again by the OnStartup of the new instance.
+		c.OnRestart(func() error {
+			close(stop)
+			return ca.persistSave()
+		})
+		c.OnRestartFailed(func() error {
+			stop = make(chan struct{})
+			go ca.persistLoop(stop)
+			return nil
+		})
+		c.OnFinalShutdown(func() error {
+			return ca.persistSave()
+		})
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		ca.Next = next
 		return ca
@@ -39,6 +85,7 @@ func setup(c *caddy.Controller) error {
 
 func cacheParse(c *caddy.Controller) (*Cache, error) {
 	ca := New()
+	aggressive := false
 
 	j := 0
 	for c.Next() {
@@ -240,6 +287,128 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 				default:
 					return nil, fmt.Errorf("cache type for disable must be %q or %q", Success, Denial)
 				}
+			case "ecs":
+				args := c.RemainingArgs()
+				if len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.ecs = true
+				for i, max := range []int{32, 128} {
+					if len(args) <= i {
+						break
+					}
+					n, err := strconv.Atoi(args[i])
+					if err != nil {
+						return nil, err
+					}
+					if n < 0 || n > max {
+						return nil, fmt.Errorf("ecs prefix length should be in range [0, %d]: %d", max, n)
+					}
+					if i == 0 {
+						ca.ecsV4Prefix = uint8(n)
+					} else {
+						ca.ecsV6Prefix = uint8(n)
+					}
+				}
+			case "key_metadata":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				ca.keyMetadata = append(ca.keyMetadata, args...)
+			case "max_memory":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				b, err := parse.Size(args[0])
+				if err != nil {
+					return nil, err
+				}
+				ca.maxBytes = int(b)
+			case "eviction":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "random":
+					ca.eviction = cache.Random
+				case "lru":
+					ca.eviction = cache.LRU
+				case "lfu":
+					ca.eviction = cache.LFU
+				default:
+					return nil, fmt.Errorf("unknown eviction policy: %q", args[0])
+				}
+			case "quota":
+				args := c.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				zone := plugin.Host(args[0]).NormalizeExact()
+				if len(zone) == 0 {
+					return nil, fmt.Errorf("invalid quota zone: %q", args[0])
+				}
+				n, err := strconv.Atoi(args[1])
+				if err != nil {
+					return nil, err
+				}
+				if n <= 0 {
+					return nil, fmt.Errorf("quota capacity must be positive: %d", n)
+				}
+				q := &quota{cap: n}
+				if len(args) > 2 {
+					b, err := parse.Size(args[2])
+					if err != nil {
+						return nil, err
+					}
+					q.bytes = int(b)
+				}
+				if ca.quotas == nil {
+					ca.quotas = make(map[string]*quota)
+				}
+				if _, ok := ca.quotas[zone[0]]; ok {
+					return nil, fmt.Errorf("duplicate quota for zone %q", zone[0])
+				}
+				ca.quotas[zone[0]] = q
+				ca.quotaZones = append(ca.quotaZones, zone[0])
+			case "aggressive_nsec":
+				args := c.RemainingArgs()
+				if len(args) > 1 || len(args) == 1 && args[0] != "trust_upstream_ad" {
+					return nil, c.ArgErr()
+				}
+				aggressive = true
+				ca.nsecTrustAD = len(args) == 1
+			case "admin":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if _, _, err := net.SplitHostPort(args[0]); err != nil {
+					return nil, err
+				}
+				ca.adminAddr = args[0]
+			case "persist":
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.persistPath = args[0]
+				if !filepath.IsAbs(ca.persistPath) && dnsserver.GetConfig(c).Root != "" {
+					ca.persistPath = filepath.Join(dnsserver.GetConfig(c).Root, ca.persistPath)
+				}
+				ca.persistInterval = defaultPersistInterval
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d <= 0 {
+						return nil, errors.New("persist interval must be positive")
+					}
+					ca.persistInterval = d
+				}
 			default:
 				return nil, c.ArgErr()
 			}
@@ -247,8 +416,13 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 
 		ca.Zones = origins
 		ca.zonesMetricLabel = strings.Join(origins, ",")
-		ca.pcache = cache.New(ca.pcap)
-		ca.ncache = cache.New(ca.ncap)
+		ca.pcache, ca.ncache = ca.newCaches(ca.pcap, ca.ncap, ca.maxBytes)
+		for _, q := range ca.quotas {
+			q.pcache, q.ncache = ca.newCaches(q.cap, q.cap, q.bytes)
+		}
+		if aggressive {
+			ca.nsec = newNsecCache(ca.ncap)
+		}
 	}
 
 	return ca, nil
@@ -1,8 +1,9 @@
 // Package dnssec implements a plugin that signs responses on-the-fly using
-// NSEC black lies.
+// NSEC black lies or NSEC3 white lies.
 package dnssec
 
 import (
+	"context"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -21,6 +22,8 @@ type Dnssec struct {
 	zones     []string
 	keys      []*DNSKEY
 	splitkeys bool
+	nsec3     bool   // use NSEC3 white lies instead of NSEC black lies
+	origTTL   uint32 // original TTL of the signatures, 0 means the TTL of the RRset is used
 	inflight  *singleflight.Group
 	cache     *cache.Cache
 }
@@ -37,11 +40,17 @@ func New(zones []string, keys []*DNSKEY, splitkeys bool, next plugin.Handler, c
 }
 
 // Sign signs the message in state. it takes care of negative or nodata responses. It
-// uses NSEC black lies for authenticated denial of existence. For delegations it
-// will insert DS records and sign those.
+// uses NSEC black lies, or NSEC3 white lies, for authenticated denial of existence. For
+// delegations it will insert DS records and sign those.
 // Signatures will be cached for a short while. By default we sign for 8 days,
 // starting 3 hours ago.
 func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.Msg {
+	return d.signMsg(context.TODO(), state, now, server)
+}
+
+// signMsg signs the message in state, see Sign. The context is used for the queries to the next plugin that find
+// the closest encloser of a name that doesn't exist, when NSEC3 white lies are used.
+func (d Dnssec) signMsg(ctx context.Context, state request.Request, now time.Time, server string) *dns.Msg {
 	req := state.Req
 
 	incep, expir := incepExpir(now)
@@ -61,6 +70,16 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 		if sigs, err := d.sign(req.Ns, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
+		if d.nsec3 {
+			ce := ""
+			if mt == response.NameError {
+				ce = d.closestEncloser(ctx, state)
+			}
+			if rrs, err := d.whiteLies(state, mt, ce, ttl, incep, expir, server); err == nil {
+				req.Ns = append(req.Ns, rrs...)
+			}
+			return req
+		}
 		if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
 		}
@@ -100,6 +119,10 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 
 	sigs, err := d.inflight.Do(k, func() (interface{}, error) {
 		var sigs []dns.RR
+		orig := d.origTTL
+		if orig == 0 && len(rrs) > 0 {
+			orig = rrs[0].Header().Ttl
+		}
 		for _, k := range d.keys {
 			if d.splitkeys {
 				if len(rrs) > 0 && rrs[0].Header().Rrtype == dns.TypeDNSKEY {
@@ -114,7 +137,7 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 					}
 				}
 			}
-			sig := k.newRRSIG(signerName, ttl, incep, expir)
+			sig := k.newRRSIG(signerName, ttl, orig, incep, expir)
 			if e := sig.Sign(k.s, rrs); e != nil {
 				return sigs, e
 			}
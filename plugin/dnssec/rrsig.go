@@ -3,7 +3,7 @@ package dnssec
 import "github.com/miekg/dns"
 
 // newRRSIG returns a new RRSIG, with all fields filled out, except the signed data.
-func (k *DNSKEY) newRRSIG(signerName string, ttl, incep, expir uint32) *dns.RRSIG {
+func (k *DNSKEY) newRRSIG(signerName string, ttl, orig, incep, expir uint32) *dns.RRSIG {
 	sig := new(dns.RRSIG)
 
 	sig.Hdr.Rrtype = dns.TypeRRSIG
@@ -11,7 +11,7 @@ func (k *DNSKEY) newRRSIG(signerName string, ttl, incep, expir uint32) *dns.RRSI
 	sig.KeyTag = k.tag
 	sig.SignerName = signerName
 	sig.Hdr.Ttl = ttl
-	sig.OrigTtl = origTTL
+	sig.OrigTtl = orig
 
 	sig.Inception = incep
 	sig.Expiration = expir
@@ -49,5 +49,3 @@ func rrSets(rrs []dns.RR) map[rrset][]dns.RR {
 	}
 	return nil
 }
-
-const origTTL = 3600
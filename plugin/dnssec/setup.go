@@ -18,7 +18,7 @@ var log = clog.NewWithPlugin("dnssec")
 func init() { plugin.Register("dnssec", setup) }
 
 func setup(c *caddy.Controller) error {
-	zones, keys, capacity, splitkeys, err := dnssecParse(c)
+	zones, keys, capacity, splitkeys, opts, err := dnssecParse(c)
 	if err != nil {
 		return plugin.Error("dnssec", err)
 	}
@@ -36,21 +36,31 @@ func setup(c *caddy.Controller) error {
 	})
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return New(zones, keys, splitkeys, next, ca)
+		d := New(zones, keys, splitkeys, next, ca)
+		d.nsec3 = opts.nsec3
+		d.origTTL = opts.origTTL
+		return d
 	})
 
 	return nil
 }
 
-func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
+// options are the settings of the plugin that don't concern the keys.
+type options struct {
+	nsec3   bool
+	origTTL uint32
+}
+
+func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, options, error) {
 	zones := []string{}
 	keys := []*DNSKEY{}
 	capacity := defaultCap
+	opts := options{}
 
 	i := 0
 	for c.Next() {
 		if i > 0 {
-			return nil, nil, 0, false, plugin.ErrOnce
+			return nil, nil, 0, false, options{}, plugin.ErrOnce
 		}
 		i++
 
@@ -62,21 +72,43 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			case "key":
 				k, e := keyParse(c)
 				if e != nil {
-					return nil, nil, 0, false, e
+					return nil, nil, 0, false, options{}, e
 				}
 				keys = append(keys, k...)
 			case "cache_capacity":
 				if !c.NextArg() {
-					return nil, nil, 0, false, c.ArgErr()
+					return nil, nil, 0, false, options{}, c.ArgErr()
 				}
 				value := c.Val()
 				cacheCap, err := strconv.Atoi(value)
 				if err != nil {
-					return nil, nil, 0, false, err
+					return nil, nil, 0, false, options{}, err
 				}
 				capacity = cacheCap
+			case "nsec3":
+				if c.NextArg() {
+					return nil, nil, 0, false, options{}, c.ArgErr()
+				}
+				opts.nsec3 = true
+			case "signature_ttl":
+				if !c.NextArg() {
+					return nil, nil, 0, false, options{}, c.ArgErr()
+				}
+				value := c.Val()
+				if c.NextArg() {
+					return nil, nil, 0, false, options{}, c.ArgErr()
+				}
+				if value == "original" {
+					opts.origTTL = 0
+					continue
+				}
+				ttl, err := strconv.ParseUint(value, 10, 32)
+				if err != nil || ttl == 0 {
+					return nil, nil, 0, false, options{}, c.Errf("invalid signature TTL '%s'", value)
+				}
+				opts.origTTL = uint32(ttl)
 			default:
-				return nil, nil, 0, false, c.Errf("unknown property '%s'", x)
+				return nil, nil, 0, false, options{}, c.Errf("unknown property '%s'", x)
 			}
 		}
 	}
@@ -102,11 +134,11 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			}
 		}
 		if !ok {
-			return zones, keys, capacity, splitkeys, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
+			return zones, keys, capacity, splitkeys, opts, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
 		}
 	}
 
-	return zones, keys, capacity, splitkeys, nil
+	return zones, keys, capacity, splitkeys, opts, nil
 }
 
 func keyParse(c *caddy.Controller) ([]*DNSKEY, error) {
@@ -81,7 +81,7 @@ func TestSetupDnssec(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.input)
-		zones, keys, capacity, splitkeys, err := dnssecParse(c)
+		zones, keys, capacity, splitkeys, _, err := dnssecParse(c)
 
 		if test.shouldErr && err == nil {
 			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
@@ -117,6 +117,61 @@ func TestSetupDnssec(t *testing.T) {
 	}
 }
 
+func TestSetupDnssecOptions(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedNSEC3   bool
+		expectedOrigTTL uint32
+	}{
+		{`dnssec`, false, false, 0},
+		{`dnssec {
+			nsec3
+		}`, false, true, 0},
+		{`dnssec {
+			signature_ttl original
+		}`, false, false, 0},
+		{`dnssec {
+			nsec3
+			signature_ttl 300
+		}`, false, true, 300},
+		// fails
+		{`dnssec {
+			nsec3 white
+		}`, true, false, 0},
+		{`dnssec {
+			signature_ttl
+		}`, true, false, 0},
+		{`dnssec {
+			signature_ttl 0
+		}`, true, false, 0},
+		{`dnssec {
+			signature_ttl 1h
+		}`, true, false, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, _, _, _, opts, err := dnssecParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			continue
+		}
+		if opts.nsec3 != test.expectedNSEC3 {
+			t.Errorf("Test %d: Expected nsec3 %t, got %t", i, test.expectedNSEC3, opts.nsec3)
+		}
+		if opts.origTTL != test.expectedOrigTTL {
+			t.Errorf("Test %d: Expected signature TTL %d, got %d", i, test.expectedOrigTTL, opts.origTTL)
+		}
+	}
+}
+
 const keypub = `; This is a zone-signing key, keyid 45330, for cluster.local.
 ; Created: 20170901060531 (Fri Sep  1 08:05:31 2017)
 ; Publish: 20170901060531 (Fri Sep  1 08:05:31 2017)
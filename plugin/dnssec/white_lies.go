@@ -0,0 +1,156 @@
+package dnssec
+
+import (
+	"context"
+	"encoding/base32"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// whiteLies returns the NSEC3 records, and their signatures, for NXDOMAIN and NODATA responses. These are white lies
+// (RFC 7129, appendix B): every record is made on the fly and only matches, or covers, the single name it is
+// needed for. The NSEC3 records use no extra hash iterations and no salt (RFC 9276).
+//
+// A NODATA response gets the NSEC3 record matching the query name. A NXDOMAIN response gets the closest encloser
+// proof: the NSEC3 record matching the closest encloser ce, and the ones covering the next closer name and the
+// wildcard at the closest encloser.
+func (d Dnssec) whiteLies(state request.Request, mt response.Type, ce string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	var nsec3s []*dns.NSEC3
+	switch mt {
+	case response.NoData:
+		nsec3s = append(nsec3s, matchNSEC3(state.Name(), state.Zone, ttl, nsec3Bitmap(state.Name(), state.Zone, state.QType(), mt)))
+	case response.NameError:
+		nsec3s = append(nsec3s, matchNSEC3(ce, state.Zone, ttl, nsec3Bitmap(ce, state.Zone, 0, mt)))
+		nsec3s = append(nsec3s, coverNSEC3(nextCloser(state.Name(), ce), state.Zone, ttl))
+		nsec3s = append(nsec3s, coverNSEC3("*."+ce, state.Zone, ttl))
+	}
+
+	rrs := []dns.RR{}
+	for _, nsec3 := range nsec3s {
+		sigs, err := d.sign([]dns.RR{nsec3}, state.Zone, ttl, incep, expir, server)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, nsec3)
+		rrs = append(rrs, sigs...)
+	}
+	return rrs, nil
+}
+
+// closestEncloser returns the closest encloser of the name in state, by asking the next plugin for the names
+// above it until one exists. The zone apex always exists.
+func (d Dnssec) closestEncloser(ctx context.Context, state request.Request) string {
+	if d.Next == nil {
+		return state.Zone
+	}
+	name := state.Name()
+	for {
+		off, end := dns.NextLabel(name, 0)
+		if end {
+			return state.Zone
+		}
+		name = name[off:]
+		if !dns.IsSubDomain(state.Zone, name) || name == state.Zone {
+			return state.Zone
+		}
+
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		nw := nonwriter.New(state.W)
+		rcode, err := d.Next.ServeDNS(ctx, nw, m)
+		if err != nil {
+			// Claiming name exists is the lesser lie, it doesn't deny the existence of names that do.
+			return name
+		}
+		if nw.Msg != nil {
+			rcode = nw.Msg.Rcode
+		}
+		if rcode != dns.RcodeNameError {
+			return name
+		}
+	}
+}
+
+// nextCloser returns the name one label longer than ce on the way to qname.
+func nextCloser(qname, ce string) string {
+	labels := dns.CountLabel(ce) + 1
+	idx := dns.Split(qname)
+	return qname[idx[len(idx)-labels]:]
+}
+
+// matchNSEC3 returns an NSEC3 record that matches name.
+func matchNSEC3(name, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	h := hashName(name)
+	return newNSEC3(h, increment(h), zone, ttl, bitmap)
+}
+
+// coverNSEC3 returns an NSEC3 record that covers name, and only name: the owner is the hash of name minus one and
+// the next hashed owner name the hash plus one.
+func coverNSEC3(name, zone string, ttl uint32) *dns.NSEC3 {
+	h := hashName(name)
+	return newNSEC3(decrement(h), increment(h), zone, ttl, nil)
+}
+
+func newNSEC3(owner, next []byte, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(b32.EncodeToString(owner)) + "." + zone, Ttl: ttl, Class: dns.ClassINET, Rrtype: dns.TypeNSEC3},
+		Hash:       dns.SHA1,
+		HashLength: uint8(len(next)),
+		NextDomain: b32.EncodeToString(next),
+		TypeBitMap: bitmap,
+	}
+}
+
+// nsec3Bitmap returns the type bit map for name, like the NSEC black lies do, without the NSEC type.
+func nsec3Bitmap(name, zone string, qtype uint16, mt response.Type) []uint16 {
+	var bitmap []uint16
+	if name == zone {
+		bitmap = filter18(qtype, apexBitmap, mt)
+	} else {
+		bitmap = filter14(qtype, zoneBitmap, mt)
+	}
+	nsec3 := make([]uint16, 0, len(bitmap))
+	for _, t := range bitmap {
+		if t != dns.TypeNSEC {
+			nsec3 = append(nsec3, t)
+		}
+	}
+	return nsec3
+}
+
+var b32 = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// hashName returns the NSEC3 hash of name, without extra iterations and salt.
+func hashName(name string) []byte {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, 0, ""))
+	return h
+}
+
+// increment returns h plus one, wrapping around at the largest hash.
+func increment(h []byte) []byte {
+	n := append([]byte{}, h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// decrement returns h minus one, wrapping around at the smallest hash.
+func decrement(h []byte) []byte {
+	n := append([]byte{}, h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]--
+		if n[i] != 0xff {
+			break
+		}
+	}
+	return n
+}
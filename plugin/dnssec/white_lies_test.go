@@ -0,0 +1,152 @@
+package dnssec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestWhiteLies(t *testing.T) {
+	zone, err := file.Parse(strings.NewReader(dbMiekNL), "miek.nl.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{"miek.nl.": zone}, Names: []string{"miek.nl."}}}
+	dnskey, rm1, rm2 := newKey(t)
+	defer rm1()
+	defer rm2()
+	dh := New([]string{"miek.nl."}, []*DNSKEY{dnskey}, false, fm, cache.New(defaultCap))
+	dh.nsec3 = true
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+		match string   // name that must have a matching NSEC3 record
+		cover []string // names that must have a covering NSEC3 record
+	}{
+		{"wwwww.miek.nl.", dns.TypeAAAA, dns.RcodeNameError, "miek.nl.", []string{"wwwww.miek.nl.", "*.miek.nl."}},
+		{"x.y.a.miek.nl.", dns.TypeAAAA, dns.RcodeNameError, "a.miek.nl.", []string{"y.a.miek.nl.", "*.a.miek.nl."}},
+		{"miek.nl.", dns.TypeHINFO, dns.RcodeSuccess, "miek.nl.", nil},
+		{"a.miek.nl.", dns.TypeMX, dns.RcodeSuccess, "a.miek.nl.", nil},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dh.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, resp.Rcode)
+		}
+
+		nsec3s := []*dns.NSEC3{}
+		for _, rr := range resp.Ns {
+			switch x := rr.(type) {
+			case *dns.NSEC:
+				t.Errorf("Test %d: expected no NSEC records, got %s", i, x)
+			case *dns.NSEC3:
+				nsec3s = append(nsec3s, x)
+				if !verify(resp.Ns, x, dnskey.K) {
+					t.Errorf("Test %d: expected a valid signature for %s", i, x)
+				}
+			}
+		}
+		if len(nsec3s) != 1+len(tc.cover) {
+			t.Errorf("Test %d: expected %d NSEC3 records, got %d", i, 1+len(tc.cover), len(nsec3s))
+		}
+
+		match := false
+		for _, n := range nsec3s {
+			if n.Match(tc.match) {
+				match = true
+				for _, typ := range n.TypeBitMap {
+					if typ == tc.qtype && tc.rcode == dns.RcodeSuccess {
+						t.Errorf("Test %d: expected the bitmap not to have the qtype, got %v", i, n.TypeBitMap)
+					}
+				}
+			}
+			// White lies only cover the name they are made for, Cover is also true for a matching record.
+			for _, name := range []string{"miek.nl.", "a.miek.nl.", "www.miek.nl."} {
+				if n.Cover(name) && !n.Match(name) {
+					t.Errorf("Test %d: expected %s not to cover %s", i, n, name)
+				}
+			}
+		}
+		if !match {
+			t.Errorf("Test %d: expected an NSEC3 record matching %s", i, tc.match)
+		}
+		for _, name := range tc.cover {
+			cover := false
+			for _, n := range nsec3s {
+				cover = cover || n.Cover(name)
+			}
+			if !cover {
+				t.Errorf("Test %d: expected an NSEC3 record covering %s", i, name)
+			}
+		}
+	}
+}
+
+// verify returns true if one of the RRSIGs in rrs is a valid signature by key for rr.
+func verify(rrs []dns.RR, rr dns.RR, key *dns.DNSKEY) bool {
+	for _, r := range rrs {
+		sig, ok := r.(*dns.RRSIG)
+		if !ok || sig.TypeCovered != rr.Header().Rrtype || sig.Header().Name != rr.Header().Name {
+			continue
+		}
+		if sig.Verify(key, []dns.RR{rr}) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSignatureTTLOriginal(t *testing.T) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	defer rm1()
+	defer rm2()
+
+	sigs, err := d.sign([]dns.RR{test.MX("miek.nl.	1703	IN	MX	1 aspmx.l.google.com.")}, "miek.nl.", 1703, 0, 0, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := sigs[0].(*dns.RRSIG).OrigTtl; x != 1703 {
+		t.Errorf("Expected original TTL %d, got %d", 1703, x)
+	}
+
+	d.origTTL = 3600
+	sigs, err = d.sign([]dns.RR{test.MX("miek.nl.	1800	IN	MX	1 aspmx.l.google.com.")}, "miek.nl.", 1800, 0, 0, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := sigs[0].(*dns.RRSIG).OrigTtl; x != 3600 {
+		t.Errorf("Expected original TTL %d, got %d", 3600, x)
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	if x := increment([]byte{0x01, 0xff}); x[0] != 0x02 || x[1] != 0x00 {
+		t.Errorf("Expected 0x0200, got %x", x)
+	}
+	if x := increment([]byte{0xff, 0xff}); x[0] != 0x00 || x[1] != 0x00 {
+		t.Errorf("Expected 0x0000, got %x", x)
+	}
+	if x := decrement([]byte{0x02, 0x00}); x[0] != 0x01 || x[1] != 0xff {
+		t.Errorf("Expected 0x01ff, got %x", x)
+	}
+	if x := decrement([]byte{0x00, 0x00}); x[0] != 0xff || x[1] != 0xff {
+		t.Errorf("Expected 0xffff, got %x", x)
+	}
+}
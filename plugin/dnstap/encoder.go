@@ -14,10 +14,12 @@ type encoder struct {
 	fs *fs.Encoder
 }
 
-func newEncoder(w io.Writer, timeout time.Duration) (*encoder, error) {
+// newEncoder returns an encoder writing to w. A bidirectional encoder does the handshake with the reader
+// on the other side of w, a unidirectional one (for files) only writes.
+func newEncoder(w io.Writer, bidirectional bool, timeout time.Duration) (*encoder, error) {
 	fs, err := fs.NewEncoder(w, &fs.EncoderOptions{
 		ContentType:   []byte("protobuf:dnstap.Dnstap"),
-		Bidirectional: true,
+		Bidirectional: bidirectional,
 		Timeout:       timeout,
 	})
 	if err != nil {
@@ -0,0 +1,175 @@
+package dnstap
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/logfile"
+
+	tap "github.com/dnstap/golang-dnstap"
+)
+
+// fio writes dnstap messages to a file as a frame stream, the same format the dnstap command line tool
+// writes with -w. It implements the sink interface.
+type fio struct {
+	cfg          logfile.Config
+	enc          *encoder
+	file         *os.File
+	size         int64     // bytes written to file
+	opened       time.Time // when file was created
+	queue        chan *tap.Dnstap
+	dropped      uint32
+	quit         chan struct{}
+	done         chan struct{}
+	flushTimeout time.Duration
+	now          func() time.Time
+}
+
+// newFileIO returns a new and initialized pointer to a fio.
+func newFileIO(cfg logfile.Config) *fio {
+	return &fio{
+		cfg:          cfg,
+		queue:        make(chan *tap.Dnstap, queueSize),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+		flushTimeout: flushTimeout,
+		now:          time.Now,
+	}
+}
+
+// open creates the file and starts a new frame stream. A frame stream can't be appended to, so an existing
+// file that isn't empty is rotated first.
+func (f *fio) open() error {
+	if fi, err := os.Stat(f.cfg.Path); err == nil && fi.Size() > 0 {
+		rotated := logfile.RotatedName(f.cfg.Path, f.now())
+		if err := os.Rename(f.cfg.Path, rotated); err != nil {
+			return err
+		}
+		logfile.Cleanup(f.cfg, rotated)
+	}
+
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	f.file, f.opened = file, f.now()
+	if f.enc, err = newEncoder(f, false, 0); err != nil {
+		file.Close()
+		f.file = nil
+		return err
+	}
+	// Only count the messages, so a new file isn't due for rotation right away.
+	f.size = 0
+	return nil
+}
+
+// Write writes b to the file, counting the bytes written. The encoder writes through this method.
+func (f *fio) Write(b []byte) (int, error) {
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// closeFile ends the frame stream and closes the file.
+func (f *fio) closeFile() {
+	if f.enc == nil {
+		return
+	}
+	f.enc.close()
+	f.file.Close()
+	f.enc, f.file = nil, nil
+}
+
+// due returns true if the file should be rotated.
+func (f *fio) due() bool {
+	if f.cfg.MaxSize > 0 && f.size >= f.cfg.MaxSize {
+		return true
+	}
+	return f.cfg.MaxAge > 0 && f.now().Sub(f.opened) >= f.cfg.MaxAge
+}
+
+// connect opens the file.
+func (f *fio) connect() error {
+	err := f.open()
+	go f.serve()
+	return err
+}
+
+// Dnstap enqueues the payload for log.
+func (f *fio) Dnstap(payload *tap.Dnstap) {
+	select {
+	case f.queue <- payload:
+	default:
+		atomic.AddUint32(&f.dropped, 1)
+	}
+}
+
+// close waits until the file has been closed to return.
+func (f *fio) close() {
+	close(f.quit)
+	<-f.done
+}
+
+func (f *fio) write(payload *tap.Dnstap) error {
+	if f.enc != nil && f.due() {
+		f.closeFile()
+		if err := f.open(); err != nil {
+			atomic.AddUint32(&f.dropped, 1)
+			return err
+		}
+	}
+	if f.enc == nil {
+		atomic.AddUint32(&f.dropped, 1)
+		return nil
+	}
+	if err := f.enc.writeMsg(payload); err != nil {
+		atomic.AddUint32(&f.dropped, 1)
+		return err
+	}
+	return nil
+}
+
+// drain writes the messages that are still queued.
+func (f *fio) drain() {
+	for {
+		select {
+		case payload := <-f.queue:
+			if err := f.write(payload); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (f *fio) serve() {
+	defer close(f.done)
+	timeout := time.NewTimer(f.flushTimeout)
+	defer timeout.Stop()
+	for {
+		timeout.Reset(f.flushTimeout)
+		select {
+		case <-f.quit:
+			f.drain()
+			f.closeFile()
+			return
+		case payload := <-f.queue:
+			if err := f.write(payload); err != nil {
+				log.Errorf("Failed to write dnstap file %q: %s", f.cfg.Path, err)
+				// Start over with a new file on the next timeout.
+				f.closeFile()
+			}
+		case <-timeout.C:
+			if dropped := atomic.SwapUint32(&f.dropped, 0); dropped > 0 {
+				log.Warningf("Dropped dnstap messages: %d", dropped)
+			}
+			if f.enc == nil {
+				f.open()
+			} else {
+				f.enc.flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package dnstap
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/logfile"
+
+	fs "github.com/farsightsec/golang-framestream"
+)
+
+// frames returns the number of frames in the frame stream in path.
+func frames(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec, err := fs.NewDecoder(f, &fs.DecoderOptions{ContentType: []byte("protobuf:dnstap.Dnstap")})
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %s", path, err)
+	}
+	n := 0
+	for {
+		if _, err := dec.Decode(); err != nil {
+			if err != io.EOF {
+				t.Errorf("Failed to decode %s: %s", path, err)
+			}
+			return n
+		}
+		n++
+	}
+}
+
+func TestFileIO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.log")
+	f := newFileIO(logfile.Config{Path: path})
+	f.flushTimeout = 10 * time.Millisecond
+	if err := f.connect(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		f.Dnstap(&tmsg)
+	}
+	f.close()
+
+	if n := frames(t, path); n != 3 {
+		t.Errorf("Expected 3 messages, got %d", n)
+	}
+
+	// A restart starts a new file, and keeps the old one.
+	f = newFileIO(logfile.Config{Path: path})
+	if err := f.connect(); err != nil {
+		t.Fatal(err)
+	}
+	f.Dnstap(&tmsg)
+	f.close()
+
+	if n := frames(t, path); n != 1 {
+		t.Errorf("Expected 1 message, got %d", n)
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %d", len(rotated))
+	}
+	if n := frames(t, rotated[0]); n != 3 {
+		t.Errorf("Expected 3 messages in rotated file, got %d", n)
+	}
+}
+
+func TestFileIORotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.log")
+	f := newFileIO(logfile.Config{Path: path, MaxSize: 1})
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	// Write synchronously, so the files are rotated in a known order.
+	for i := 0; i < 3; i++ {
+		if err := f.write(&tmsg); err != nil {
+			t.Fatal(err)
+		}
+		f.enc.flush()
+	}
+	f.closeFile()
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated files, got %d", len(rotated))
+	}
+	sort.Strings(rotated)
+	for _, p := range append(rotated, path) {
+		if n := frames(t, p); n != 1 {
+			t.Errorf("Expected 1 message in %s, got %d", p, n)
+		}
+	}
+}
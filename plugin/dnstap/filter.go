@@ -0,0 +1,130 @@
+package dnstap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+// filter selects the messages that are tapped. Each set criterion must match. A nil filter selects all messages.
+type filter struct {
+	names   plugin.Zones // only names in these zones
+	exclude plugin.Zones // no names in these zones
+	qtypes  map[uint16]struct{}
+	rcodes  map[int]struct{} // only responses with these rcodes
+	types   map[tap.Message_Type]struct{}
+}
+
+// match returns true if the message m, for the query in state with the response reply, should be tapped.
+// Reply is nil for query messages; these never match when rcodes are set.
+func (f *filter) match(m *tap.Message, state request.Request, reply *dns.Msg) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.types) > 0 && m.Type != nil {
+		if _, ok := f.types[*m.Type]; !ok {
+			return false
+		}
+	}
+	if len(f.names) > 0 && f.names.Matches(state.Name()) == "" {
+		return false
+	}
+	if len(f.exclude) > 0 && f.exclude.Matches(state.Name()) != "" {
+		return false
+	}
+	if len(f.qtypes) > 0 {
+		if _, ok := f.qtypes[state.QType()]; !ok {
+			return false
+		}
+	}
+	if len(f.rcodes) > 0 {
+		if reply == nil {
+			return false
+		}
+		if _, ok := f.rcodes[reply.Rcode]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// messageTypes are the message types that can be filtered on, these are the ones CoreDNS taps.
+var messageTypes = map[string]tap.Message_Type{
+	"client_query":       tap.Message_CLIENT_QUERY,
+	"client_response":    tap.Message_CLIENT_RESPONSE,
+	"forwarder_query":    tap.Message_FORWARDER_QUERY,
+	"forwarder_response": tap.Message_FORWARDER_RESPONSE,
+}
+
+// option parses the filter option in c.Val() into f. It returns false if c.Val() isn't a filter option.
+func (f *filter) option(c *caddy.Controller) (bool, error) {
+	opt := c.Val()
+	switch opt {
+	case "name", "exclude_name", "qtype", "rcode", "message":
+	default:
+		return false, nil
+	}
+
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return true, c.ArgErr()
+	}
+
+	switch opt {
+	case "name", "exclude_name":
+		var zones []string
+		for _, a := range args {
+			zones = append(zones, plugin.Host(a).NormalizeExact()...)
+		}
+		if opt == "name" {
+			f.names = append(f.names, zones...)
+		} else {
+			f.exclude = append(f.exclude, zones...)
+		}
+	case "qtype":
+		if f.qtypes == nil {
+			f.qtypes = make(map[uint16]struct{})
+		}
+		for _, a := range args {
+			qtype, ok := dns.StringToType[strings.ToUpper(a)]
+			if !ok {
+				return true, fmt.Errorf("invalid query type: %q", a)
+			}
+			f.qtypes[qtype] = struct{}{}
+		}
+	case "rcode":
+		if f.rcodes == nil {
+			f.rcodes = make(map[int]struct{})
+		}
+		for _, a := range args {
+			rcode, ok := dns.StringToRcode[strings.ToUpper(a)]
+			if !ok {
+				n, err := strconv.ParseUint(a, 10, 12)
+				if err != nil {
+					return true, fmt.Errorf("invalid rcode: %q", a)
+				}
+				rcode = int(n)
+			}
+			f.rcodes[rcode] = struct{}{}
+		}
+	case "message":
+		if f.types == nil {
+			f.types = make(map[tap.Message_Type]struct{})
+		}
+		for _, a := range args {
+			t, ok := messageTypes[strings.ToLower(a)]
+			if !ok {
+				return true, fmt.Errorf("invalid message type: %q", a)
+			}
+			f.types[t] = struct{}{}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package dnstap
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	tap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		name   string
+		qtype  uint16
+		typ    tap.Message_Type
+		rcode  int // -1 for a query message
+		match  bool
+	}{
+		{"", "example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, true},
+		{"name example.org", "a.example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, true},
+		{"name example.org", "example.net.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, false},
+		{"name example.org example.net", "example.net.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, true},
+		{"exclude_name internal.example.org", "a.internal.example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, false},
+		{"exclude_name internal.example.org", "example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, true},
+		{"qtype AAAA mx", "example.org.", dns.TypeMX, tap.Message_CLIENT_QUERY, -1, true},
+		{"qtype AAAA mx", "example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, false},
+		{"rcode SERVFAIL 5", "example.org.", dns.TypeA, tap.Message_CLIENT_RESPONSE, dns.RcodeRefused, true},
+		{"rcode SERVFAIL 5", "example.org.", dns.TypeA, tap.Message_CLIENT_RESPONSE, dns.RcodeSuccess, false},
+		{"rcode SERVFAIL", "example.org.", dns.TypeA, tap.Message_CLIENT_QUERY, -1, false},
+		{"message forwarder_response", "example.org.", dns.TypeA, tap.Message_FORWARDER_RESPONSE, dns.RcodeSuccess, true},
+		{"message forwarder_response", "example.org.", dns.TypeA, tap.Message_CLIENT_RESPONSE, dns.RcodeSuccess, false},
+	}
+
+	for i, tc := range tests {
+		var f *filter
+		if tc.filter != "" {
+			f = &filter{}
+			c := caddy.NewTestController("dns", tc.filter)
+			c.Next()
+			if ok, err := f.option(c); !ok || err != nil {
+				t.Fatalf("Test %d: failed to parse %q: %t, %v", i, tc.filter, ok, err)
+			}
+		}
+
+		req := new(dns.Msg)
+		req.SetQuestion(tc.name, tc.qtype)
+		state := request.Request{W: &test.ResponseWriter{}, Req: req}
+		var reply *dns.Msg
+		if tc.rcode >= 0 {
+			reply = new(dns.Msg)
+			reply.SetRcode(req, tc.rcode)
+		}
+		m := &tap.Message{Type: &tc.typ}
+
+		if x := f.match(m, state, reply); x != tc.match {
+			t.Errorf("Test %d: expected match %t for %q, got %t", i, tc.match, tc.filter, x)
+		}
+	}
+}
+
+func TestFilterOption(t *testing.T) {
+	for _, in := range []string{"name", "qtype FOO", "rcode FOO", "rcode 5000", "message resolver_query"} {
+		f := &filter{}
+		c := caddy.NewTestController("dns", in)
+		c.Next()
+		if ok, err := f.option(c); !ok || err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/dnstap/msg"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/replacer"
+	"github.com/coredns/coredns/request"
 
 	tap "github.com/dnstap/golang-dnstap"
 	"github.com/miekg/dns"
@@ -20,6 +23,12 @@ type Dnstap struct {
 	IncludeRawMessage bool
 	Identity          []byte
 	Version           []byte
+	// ExtraFormat is the format of the extra field of the dnstap messages, it may contain metadata
+	// place holders, e.g. {/view/name}. When empty the extra field isn't set.
+	ExtraFormat string
+
+	filter *filter
+	repl   replacer.Replacer
 }
 
 // TapMessage sends the message m to the dnstap interface.
@@ -28,7 +37,26 @@ func (h Dnstap) TapMessage(m *tap.Message) {
 	h.io.Dnstap(&tap.Dnstap{Type: &t, Message: m, Identity: h.Identity, Version: h.Version})
 }
 
-func (h Dnstap) tapQuery(w dns.ResponseWriter, query *dns.Msg, queryTime time.Time) {
+// TapMessageWithMetadata sends the message m to the dnstap interface if it passes the filters, and sets its
+// extra field from the metadata in ctx. State is the query the message is about and reply its response,
+// which is nil for query messages.
+func (h Dnstap) TapMessageWithMetadata(ctx context.Context, m *tap.Message, state request.Request, reply *dns.Msg) {
+	if !h.filter.match(m, state, reply) {
+		return
+	}
+	t := tap.Dnstap_MESSAGE
+	d := &tap.Dnstap{Type: &t, Message: m, Identity: h.Identity, Version: h.Version}
+	if h.ExtraFormat != "" {
+		var rr *dnstest.Recorder
+		if reply != nil {
+			rr = &dnstest.Recorder{Rcode: reply.Rcode, Len: reply.Len(), Msg: reply}
+		}
+		d.Extra = []byte(h.repl.Replace(ctx, state, rr, h.ExtraFormat))
+	}
+	h.io.Dnstap(d)
+}
+
+func (h Dnstap) tapQuery(ctx context.Context, w dns.ResponseWriter, query *dns.Msg, queryTime time.Time) {
 	q := new(tap.Message)
 	msg.SetQueryTime(q, queryTime)
 	msg.SetQueryAddress(q, w.RemoteAddr())
@@ -38,7 +66,7 @@ func (h Dnstap) tapQuery(w dns.ResponseWriter, query *dns.Msg, queryTime time.Ti
 		q.QueryMessage = buf
 	}
 	msg.SetType(q, tap.Message_CLIENT_QUERY)
-	h.TapMessage(q)
+	h.TapMessageWithMetadata(ctx, q, request.Request{W: w, Req: query}, nil)
 }
 
 // ServeDNS logs the client query and response to dnstap and passes the dnstap Context.
@@ -46,13 +74,14 @@ func (h Dnstap) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	rw := &ResponseWriter{
 		ResponseWriter: w,
 		Dnstap:         h,
+		ctx:            ctx,
 		query:          r,
 		queryTime:      time.Now(),
 	}
 
 	// The query tap message should be sent before sending the query to the
 	// forwarder. Otherwise, the tap messages will come out out of order.
-	h.tapQuery(w, r, rw.queryTime)
+	h.tapQuery(ctx, w, r, rw.queryTime)
 
 	return plugin.NextOrFailure(h.Name(), h.Next, ctx, rw, r)
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/coredns/coredns/plugin/dnstap/msg"
+	"github.com/coredns/coredns/plugin/metadata"
 	test "github.com/coredns/coredns/plugin/test"
 
 	tap "github.com/dnstap/golang-dnstap"
@@ -82,3 +83,42 @@ func testMessage() *tap.Message {
 		QueryPort:      &port,
 	}
 }
+
+type recorder struct {
+	msgs []*tap.Dnstap
+}
+
+func (r *recorder) Dnstap(e *tap.Dnstap) { r.msgs = append(r.msgs, e) }
+
+func TestDnstapFilterExtra(t *testing.T) {
+	q := test.Case{Qname: "example.org.", Qtype: dns.TypeA}.Msg()
+	r := new(dns.Msg)
+	r.SetRcode(q, dns.RcodeServerFailure)
+
+	rec := &recorder{}
+	h := Dnstap{
+		Next: test.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, _ *dns.Msg) (int, error) {
+			return 0, w.WriteMsg(r)
+		}),
+		io:          rec,
+		ExtraFormat: "view={/view/name} rcode={rcode}",
+		filter:      &filter{rcodes: map[int]struct{}{dns.RcodeServerFailure: {}}},
+	}
+
+	ctx := metadata.ContextWithMetadata(context.TODO())
+	metadata.SetValueFunc(ctx, "view/name", func() string { return "internal" })
+	if _, err := h.ServeDNS(ctx, &test.ResponseWriter{}, q); err != nil {
+		t.Fatal(err)
+	}
+
+	// The query doesn't have an rcode, so only the response is tapped.
+	if len(rec.msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(rec.msgs))
+	}
+	if x := rec.msgs[0].Message.GetType(); x != tap.Message_CLIENT_RESPONSE {
+		t.Errorf("Expected client response, got %s", x)
+	}
+	if x := string(rec.msgs[0].Extra); x != "view=internal rcode=SERVFAIL" {
+		t.Errorf("Expected extra %q, got %q", "view=internal rcode=SERVFAIL", x)
+	}
+}
@@ -21,6 +21,13 @@ type tapper interface {
 	Dnstap(*tap.Dnstap)
 }
 
+// sink is a tapper that writes to an endpoint, it is connected on startup and closed on shutdown.
+type sink interface {
+	tapper
+	connect() error
+	close()
+}
+
 // dio implements the Tapper interface.
 type dio struct {
 	endpoint     string
@@ -55,7 +62,7 @@ func (d *dio) dial() error {
 		tcpConn.SetNoDelay(false)
 	}
 
-	d.enc, err = newEncoder(conn, d.tcpTimeout)
+	d.enc, err = newEncoder(conn, true, d.tcpTimeout)
 	return err
 }
 
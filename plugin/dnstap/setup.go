@@ -1,14 +1,18 @@
 package dnstap
 
 import (
+	"errors"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
+	"github.com/coredns/coredns/plugin/pkg/replacer"
 )
 
 var log = clog.NewWithPlugin("dnstap")
@@ -29,8 +33,18 @@ func parseConfig(c *caddy.Controller) ([]*Dnstap, error) {
 		}
 
 		endpoint = args[0]
+		file := logfile.Config{}
 
-		if strings.HasPrefix(endpoint, "tcp://") {
+		switch {
+		case strings.HasPrefix(endpoint, "file://"):
+			file.Path = strings.TrimPrefix(endpoint, "file://")
+			if file.Path == "" {
+				return nil, c.ArgErr()
+			}
+			if !filepath.IsAbs(file.Path) && dnsserver.GetConfig(c).Root != "" {
+				file.Path = filepath.Join(dnsserver.GetConfig(c).Root, file.Path)
+			}
+		case strings.HasPrefix(endpoint, "tcp://"):
 			// remote network endpoint
 			endpointURL, err := url.Parse(endpoint)
 			if err != nil {
@@ -38,7 +52,7 @@ func parseConfig(c *caddy.Controller) ([]*Dnstap, error) {
 			}
 			dio := newIO("tcp", endpointURL.Host)
 			d = Dnstap{io: dio}
-		} else {
+		default:
 			endpoint = strings.TrimPrefix(endpoint, "unix://")
 			dio := newIO("unix", endpoint)
 			d = Dnstap{io: dio}
@@ -49,6 +63,9 @@ func parseConfig(c *caddy.Controller) ([]*Dnstap, error) {
 		hostname, _ := os.Hostname()
 		d.Identity = []byte(hostname)
 		d.Version = []byte(caddy.AppName + "-" + caddy.AppVersion)
+		d.repl = replacer.New()
+		f := &filter{}
+		filtered := false
 
 		for c.NextBlock() {
 			switch c.Val() {
@@ -66,8 +83,40 @@ func parseConfig(c *caddy.Controller) ([]*Dnstap, error) {
 					}
 					d.Version = []byte(c.Val())
 				}
+			case "extra":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d.ExtraFormat = c.Val()
+			case "output", "buffer":
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			default:
+				ok, err := f.option(c)
+				if ok {
+					if err != nil {
+						return nil, err
+					}
+					filtered = true
+					continue
+				}
+				if ok, err = file.Option(c); ok {
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
+
+		if file.Path != "" {
+			d.io = newFileIO(file)
+		} else if file != (logfile.Config{}) {
+			return nil, errors.New("rotate options need a file:// endpoint")
+		}
+		if filtered {
+			d.filter = f
+		}
 		dnstaps = append(dnstaps, &d)
 	}
 	return dnstaps, nil
@@ -82,19 +131,19 @@ func setup(c *caddy.Controller) error {
 	for i := range dnstaps {
 		dnstap := dnstaps[i]
 		c.OnStartup(func() error {
-			if err := dnstap.io.(*dio).connect(); err != nil {
+			if err := dnstap.io.(sink).connect(); err != nil {
 				log.Errorf("No connection to dnstap endpoint: %s", err)
 			}
 			return nil
 		})
 
 		c.OnRestart(func() error {
-			dnstap.io.(*dio).close()
+			dnstap.io.(sink).close()
 			return nil
 		})
 
 		c.OnFinalShutdown(func() error {
-			dnstap.io.(*dio).close()
+			dnstap.io.(sink).close()
 			return nil
 		})
 
@@ -124,3 +124,61 @@ func TestMultiDnstap(t *testing.T) {
 		t.Error("expected third plugin to be last, but Next is not nil")
 	}
 }
+
+func TestConfigFile(t *testing.T) {
+	tests := []struct {
+		in      string
+		fail    bool
+		path    string
+		maxSize int64
+		keep    int
+		extra   string
+		filter  bool
+	}{
+		{"dnstap file:///var/log/dnstap.log", false, "/var/log/dnstap.log", 0, 0, "", false},
+		{"dnstap file:///var/log/dnstap.log full {\nrotate_size 10M\nrotate_keep 5\nrotate_compress\n}", false, "/var/log/dnstap.log", 10 << 20, 5, "", false},
+		{"dnstap file:///var/log/dnstap.log {\nname example.org\nrcode SERVFAIL\nextra {/view/name}\n}", false, "/var/log/dnstap.log", 0, 0, "{/view/name}", true},
+		{"dnstap dnstap.sock {\nqtype A\nmessage client_response\n}", false, "", 0, 0, "", true},
+		{"dnstap file://", true, "", 0, 0, "", false},
+		{"dnstap dnstap.sock {\nrotate_size 10M\n}", true, "", 0, 0, "", false},
+		{"dnstap file:///var/log/dnstap.log {\noutput /tmp/x\n}", true, "", 0, 0, "", false},
+		{"dnstap file:///var/log/dnstap.log {\nqtype FOO\n}", true, "", 0, 0, "", false},
+		{"dnstap file:///var/log/dnstap.log {\nextra\n}", true, "", 0, 0, "", false},
+		{"dnstap file:///var/log/dnstap.log {\nfoo\n}", true, "", 0, 0, "", false},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.in)
+		taps, err := parseConfig(c)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		tap := taps[0]
+		if tc.path != "" {
+			f, ok := tap.io.(*fio)
+			if !ok {
+				t.Fatalf("Test %d: expected file output, got %T", i, tap.io)
+			}
+			if f.cfg.Path != tc.path {
+				t.Errorf("Test %d: expected path %s, got %s", i, tc.path, f.cfg.Path)
+			}
+			if f.cfg.MaxSize != tc.maxSize {
+				t.Errorf("Test %d: expected rotate size %d, got %d", i, tc.maxSize, f.cfg.MaxSize)
+			}
+			if f.cfg.Keep != tc.keep {
+				t.Errorf("Test %d: expected rotate keep %d, got %d", i, tc.keep, f.cfg.Keep)
+			}
+		}
+		if tap.ExtraFormat != tc.extra {
+			t.Errorf("Test %d: expected extra %q, got %q", i, tc.extra, tap.ExtraFormat)
+		}
+		if x := tap.filter != nil; x != tc.filter {
+			t.Errorf("Test %d: expected filter %t, got %t", i, tc.filter, x)
+		}
+	}
+}
@@ -3,13 +3,16 @@ package errors
 
 import (
 	"context"
+	"fmt"
 	"regexp"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -22,6 +25,7 @@ type pattern struct {
 	count       uint32
 	period      time.Duration
 	pattern     *regexp.Regexp
+	level       string
 	logCallback func(format string, v ...interface{})
 }
 
@@ -37,6 +41,7 @@ func (p *pattern) setTimer(t *time.Timer) {
 type errorHandler struct {
 	patterns []*pattern
 	stopFlag uint32
+	output   *logfile.Writer // nil when logging to standard output
 	Next     plugin.Handler
 }
 
@@ -79,6 +84,18 @@ func (h *errorHandler) stop() {
 	}
 }
 
+// fileLogf returns a function that logs to the output file at level, in the same format as the log
+// package, prefixed with the time.
+func (h *errorHandler) fileLogf(level string) func(format string, v ...interface{}) {
+	prefix := "[" + strings.ToUpper(level) + "] plugin/errors: "
+	return func(format string, v ...interface{}) {
+		if level == "debug" && !clog.D.Value() {
+			return
+		}
+		h.output.WriteLine(time.Now().UTC().Format(time.RFC3339Nano) + " " + prefix + fmt.Sprintf(format, v...))
+	}
+}
+
 // ServeDNS implements the plugin.Handler interface.
 func (h *errorHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	rcode, err := plugin.NextOrFailure(h.Name(), h.Next, ctx, w, r)
@@ -94,7 +111,11 @@ func (h *errorHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dn
 			}
 		}
 		state := request.Request{W: w, Req: r}
-		log.Errorf("%d %s %s: %s", rcode, state.Name(), state.Type(), strErr)
+		logf := log.Errorf
+		if h.output != nil {
+			logf = h.fileLogf("error")
+		}
+		logf("%d %s %s: %s", rcode, state.Name(), state.Type(), strErr)
 	}
 
 	return rcode, err
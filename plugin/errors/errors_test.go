@@ -6,12 +6,15 @@ import (
 	"errors"
 	"fmt"
 	golog "log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
@@ -235,3 +238,35 @@ func genErrorHandler(rcode int, err error) plugin.Handler {
 		return rcode, err
 	})
 }
+
+func TestErrorsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.log")
+	c := caddy.NewTestController("dns", "errors {\n output "+path+"\n consolidate 1m ^consolidated warning\n}")
+	h, err := errorsParse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.output.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Next = test.NextHandler(dns.RcodeServerFailure, errors.New("some error"))
+	h.ServeDNS(context.TODO(), &test.ResponseWriter{}, new(dns.Msg).SetQuestion("example.org.", dns.TypeA))
+	h.Next = test.NextHandler(dns.RcodeServerFailure, errors.New("consolidated error"))
+	h.ServeDNS(context.TODO(), &test.ResponseWriter{}, new(dns.Msg).SetQuestion("example.org.", dns.TypeA))
+	h.stop()
+	h.output.Close()
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"[ERROR] plugin/errors: 2 example.org. A: some error\n",
+		"[WARNING] plugin/errors: 1 errors like '^consolidated' occurred in last 1m0s\n",
+	} {
+		if !strings.Contains(string(buf), expect) {
+			t.Errorf("Expected %q to be logged, got %q", expect, buf)
+		}
+	}
+}
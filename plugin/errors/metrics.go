@@ -0,0 +1,16 @@
+package errors
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// droppedEntries is the number of log entries dropped because the output file couldn't keep up.
+var droppedEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "errors",
+	Name:      "dropped_entries_total",
+	Help:      "Counter of error log entries dropped because the output file couldn't keep up.",
+}, []string{"file"})
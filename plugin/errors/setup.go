@@ -7,6 +7,7 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 )
 
 func init() { plugin.Register("errors", setup) }
@@ -17,8 +18,14 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("errors", err)
 	}
 
+	if handler.output != nil {
+		c.OnStartup(handler.output.Open)
+	}
 	c.OnShutdown(func() error {
 		handler.stop()
+		if handler.output != nil {
+			return handler.output.Close()
+		}
 		return nil
 	})
 
@@ -33,6 +40,7 @@ func setup(c *caddy.Controller) error {
 func errorsParse(c *caddy.Controller) (*errorHandler, error) {
 	handler := newErrorHandler()
 
+	var out logfile.Config
 	i := 0
 	for c.Next() {
 		if i > 0 {
@@ -62,10 +70,25 @@ func errorsParse(c *caddy.Controller) (*errorHandler, error) {
 				}
 				handler.patterns = append(handler.patterns, pattern)
 			default:
-				return handler, c.SyntaxErr("Unknown field " + c.Val())
+				ok, err := out.Option(c)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return handler, c.SyntaxErr("Unknown field " + c.Val())
+				}
 			}
 		}
 	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	if out.Path != "" {
+		handler.output = logfile.New(out, func() { droppedEntries.WithLabelValues(out.Path).Inc() })
+		for _, p := range handler.patterns {
+			p.logCallback = handler.fileLogf(p.level)
+		}
+	}
 	return handler, nil
 }
 
@@ -86,7 +109,11 @@ func parseConsolidate(c *caddy.Controller) (*pattern, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &pattern{period: p, pattern: re, logCallback: lc}, nil
+	level := "error"
+	if len(args) == 3 {
+		level = args[2]
+	}
+	return &pattern{period: p, pattern: re, level: level, logCallback: lc}, nil
 }
 
 func parseLogLevel(c *caddy.Controller, args []string) (func(format string, v ...interface{}), error) {
@@ -65,6 +65,20 @@ func TestErrorsParse(t *testing.T) {
 		    consolidate 1m error1
 		    consolidate 5s error2
 		  }`, false, 2, false},
+		{`errors {
+		    output /var/log/coredns/errors.log
+		    rotate_age 24h
+		    rotate_keep 7
+		    buffer 100
+		    consolidate 1m error1
+		  }`, false, 1, false},
+		{`errors {
+		    rotate_age 24h
+		  }`, true, 0, false},
+		{`errors {
+		    output errors.log
+		    rotate_age -1h
+		  }`, true, 0, false},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.inputErrorsRules)
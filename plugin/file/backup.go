@@ -0,0 +1,69 @@
+package file
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LoadBackup loads the zone from its backup file, if it has one and the file exists. The zone was last known to be
+// current when the backup was written, so it expires if the primaries can't be reached before the SOA expire time
+// after that.
+func (z *Zone) LoadBackup() error {
+	if z.Backup == "" {
+		return nil
+	}
+	f, err := os.Open(filepath.Clean(z.Backup))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zone, err := Parse(f, z.origin, z.Backup, 0)
+	if err != nil {
+		return err
+	}
+
+	z.Lock()
+	z.Apex = zone.Apex
+	z.Tree = zone.Tree
+	z.Unlock()
+	z.setRefreshed(fi.ModTime())
+	z.checkExpired()
+
+	log.Infof("Loaded backup of `%s' from %q with %d SOA serial", z.origin, z.Backup, zone.Apex.SOA.Serial)
+	return nil
+}
+
+// writeBackup writes the zone to its backup file, if it has one.
+func (z *Zone) writeBackup() {
+	if z.Backup == "" {
+		return
+	}
+	z.RLock()
+	apex, t, nsec3 := z.apexRRs(), z.Tree, z.Apex.NSEC3
+	z.RUnlock()
+
+	err := writeFile(z.Backup, func(w io.Writer) error { return writeZone(w, z.origin, apex, t, nsec3) })
+	if err != nil {
+		log.Warningf("Failed to write backup of `%s' to %q: %s", z.origin, z.Backup, err)
+	}
+}
+
+// touchBackup sets the modification time of the backup file to now, because the zone is current.
+func (z *Zone) touchBackup() {
+	if z.Backup == "" {
+		return
+	}
+	now := time.Now()
+	if err := os.Chtimes(z.Backup, now, now); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Failed to touch backup of `%s' in %q: %s", z.origin, z.Backup, err)
+	}
+}
@@ -0,0 +1,66 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+)
+
+func TestBackup(t *testing.T) {
+	primary := parseIxfr(t, dbIxfrV1)
+	s := dnstest.NewServer(primaryHandler(t, primary, new(uint16)))
+	defer s.Close()
+
+	backup := filepath.Join(t.TempDir(), "ixfr.example.backup")
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{s.Addr}
+	z.Backup = backup
+	if err := z.LoadBackup(); err != nil {
+		t.Fatalf("Expected no error without a backup, got %q", err)
+	}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+
+	z1 := NewZone(ixfrZone, "stdin")
+	z1.Backup = backup
+	if err := z1.LoadBackup(); err != nil {
+		t.Fatalf("Expected no error when loading the backup, got %q", err)
+	}
+	if z1.Apex.SOA == nil || z1.Apex.SOA.Serial != 1 {
+		t.Fatalf("Expected SOA serial 1 in the backup, got %v", z1.Apex.SOA)
+	}
+	if x, y := len(z1.All()), len(z.All()); x != y {
+		t.Errorf("Expected %d records in the backup, got %d", y, x)
+	}
+	if z1.Expired {
+		t.Error("Expected a current backup not to be expired")
+	}
+
+	// A backup that's older than the SOA expire time is expired, until the zone is transferred again.
+	old := time.Now().Add(-time.Duration(z1.Apex.SOA.Expire+60) * time.Second)
+	if err := os.Chtimes(backup, old, old); err != nil {
+		t.Fatal(err)
+	}
+	z2 := NewZone(ixfrZone, "stdin")
+	z2.TransferFrom = []string{s.Addr}
+	z2.Backup = backup
+	if err := z2.LoadBackup(); err != nil {
+		t.Fatalf("Expected no error when loading the backup, got %q", err)
+	}
+	if !z2.Expired {
+		t.Fatal("Expected an old backup to be expired")
+	}
+	if err := z2.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if z2.Expired {
+		t.Error("Expected the zone not to be expired after a transfer")
+	}
+	if fi, err := os.Stat(backup); err != nil || time.Since(fi.ModTime()) > time.Minute {
+		t.Errorf("Expected the backup to be touched after a transfer")
+	}
+}
@@ -0,0 +1,122 @@
+package file
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// catalogVersion is the version of the catalog zone schema (RFC 9432) that is produced and understood.
+const catalogVersion = "2"
+
+// SetCatalog makes z a catalog zone (RFC 9432) that lists the zones in members. It returns true if the
+// members changed, in which case the SOA serial is incremented.
+func (z *Zone) SetCatalog(members []string) bool {
+	z.RLock()
+	soa := z.Apex.SOA
+	z.RUnlock()
+
+	serial := uint32(time.Now().Unix())
+	if soa != nil && !less(soa.Serial, serial) {
+		serial = soa.Serial + 1
+	}
+	zone := newCatalog(z.origin, members, serial)
+
+	d, size := z.difference(zone)
+	if soa != nil && len(d.del) == 0 && len(d.add) == 0 {
+		return false
+	}
+
+	z.Lock()
+	z.keepHistory(d, size)
+	z.Apex = zone.Apex
+	z.Tree = zone.Tree
+	z.Unlock()
+	return true
+}
+
+// newCatalog returns a catalog zone with origin that lists the zones in members.
+func newCatalog(origin string, members []string, serial uint32) *Zone {
+	z := NewZone(origin, "")
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 0}
+	}
+	z.Insert(&dns.SOA{Hdr: hdr(z.origin, dns.TypeSOA), Ns: "invalid.", Mbox: "invalid.", Serial: serial, Refresh: 3600, Retry: 600, Expire: 2147483646})
+	z.Insert(&dns.NS{Hdr: hdr(z.origin, dns.TypeNS), Ns: "invalid."})
+	z.Insert(&dns.TXT{Hdr: hdr("version."+z.origin, dns.TypeTXT), Txt: []string{catalogVersion}})
+	for _, m := range members {
+		m = dns.Fqdn(strings.ToLower(m))
+		z.Insert(&dns.PTR{Hdr: hdr(memberID(m)+".zones."+z.origin, dns.TypePTR), Ptr: m})
+	}
+	return z
+}
+
+// memberID returns the unique label of the member zone name in a catalog zone, a hash of the name so it stays the
+// same when the catalog is regenerated.
+func memberID(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// Members returns the member zones listed in the catalog zone z, mapped to their unique labels. Unique labels
+// with more than one member zone are ignored, just as member zones listed more than once.
+func (z *Zone) Members() (map[string]string, error) {
+	z.RLock()
+	t := z.Tree
+	z.RUnlock()
+	if t == nil {
+		return nil, fmt.Errorf("no catalog")
+	}
+
+	version := ""
+	if e, ok := t.Search("version." + z.origin); ok {
+		for _, rr := range e.Type(dns.TypeTXT) {
+			version = strings.Join(rr.(*dns.TXT).Txt, "")
+		}
+	}
+	if version != catalogVersion {
+		return nil, fmt.Errorf("unsupported catalog version %q", version)
+	}
+
+	suffix := ".zones." + z.origin
+	ids := map[string][]string{}
+	t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		id := strings.TrimSuffix(e.Name(), suffix)
+		if id == e.Name() || id == "" || strings.Contains(id, ".") {
+			return nil // not a member, or a property of one
+		}
+		for _, rr := range e.Type(dns.TypePTR) {
+			ids[id] = append(ids[id], dns.Fqdn(strings.ToLower(rr.(*dns.PTR).Ptr)))
+		}
+		return nil
+	})
+
+	// Visit the unique labels in order, so the same member zone listed more than once always keeps the same one.
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	members := map[string]string{}
+	for _, id := range sorted {
+		if len(ids[id]) != 1 {
+			log.Warningf("Catalog `%s' has %d member zones for %q, ignoring them", z.origin, len(ids[id]), id)
+			continue
+		}
+		m := ids[id][0]
+		if _, ok := members[m]; ok {
+			log.Warningf("Catalog `%s' has member zone `%s' more than once, ignoring %q", z.origin, m, id)
+			continue
+		}
+		members[m] = id
+	}
+	return members, nil
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+const dbCatalog = `$ORIGIN catalog.invalid.
+@	0 IN SOA invalid. invalid. 1 3600 600 2147483646 0
+@	0 IN NS invalid.
+version	0 IN TXT "2"
+a.zones	0 IN PTR example.org.
+b.zones	0 IN PTR example.net.
+b.zones	0 IN PTR example.com.
+c.zones	0 IN PTR example.org.
+group.a.zones	0 IN TXT "customers"
+`
+
+func TestMembers(t *testing.T) {
+	z, err := Parse(strings.NewReader(dbCatalog), "catalog.invalid.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	members, err := z.Members()
+	if err != nil {
+		t.Fatalf("Expected no error when reading the catalog, got %q", err)
+	}
+	// b has two member zones, and example.org. is listed twice.
+	if len(members) != 1 || members["example.org."] != "a" {
+		t.Errorf("Expected only example.org. with unique label a, got %v", members)
+	}
+
+	z, err = Parse(strings.NewReader(strings.Replace(dbCatalog, `"2"`, `"1"`, 1)), "catalog.invalid.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	if _, err := z.Members(); err == nil {
+		t.Error("Expected an error for catalog version 1")
+	}
+}
+
+func TestSetCatalog(t *testing.T) {
+	z := NewZone("catalog.invalid.", "")
+	if !z.SetCatalog([]string{"example.org.", "Example.NET"}) {
+		t.Fatal("Expected a new catalog to be changed")
+	}
+	members, err := z.Members()
+	if err != nil {
+		t.Fatalf("Expected no error when reading the catalog, got %q", err)
+	}
+	if len(members) != 2 || members["example.org."] != memberID("example.org.") || members["example.net."] != memberID("example.net.") {
+		t.Errorf("Expected example.org. and example.net., got %v", members)
+	}
+
+	serial := z.Apex.SOA.Serial
+	if z.SetCatalog([]string{"example.net.", "example.org."}) {
+		t.Error("Expected the same members not to change the catalog")
+	}
+	if !z.SetCatalog([]string{"example.org."}) {
+		t.Fatal("Expected other members to change the catalog")
+	}
+	if !less(serial, z.Apex.SOA.Serial) {
+		t.Errorf("Expected the serial to be incremented from %d, got %d", serial, z.Apex.SOA.Serial)
+	}
+
+	// The change is kept, so secondaries get only the removed member in an incremental transfer.
+	rrs := transferred(t, z, serial)
+	if len(rrs) != 5 || !strings.Contains(rrs[2], "example.net.") {
+		t.Errorf("Expected an incremental transfer that deletes example.net., got %v", rrs)
+	}
+}
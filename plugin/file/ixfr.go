@@ -0,0 +1,139 @@
+package file
+
+import (
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// maxHistory is the number of diffs kept in the history of a zone for incremental zone transfers.
+const maxHistory = 100
+
+// addHistory adds d, the change from the previous version of the zone to the current one, to the history of z.
+// If size is larger than zero, it's the number of records in the current version; a diff larger than that isn't
+// worth an incremental transfer, and clears the history. The caller must hold the lock of z.
+func (z *Zone) addHistory(d diff, size int) {
+	if size > 0 && len(d.del)+len(d.add) > size {
+		z.history = nil
+		return
+	}
+	if n := len(z.history); n > 0 && z.history[n-1].to.Serial != d.from.Serial {
+		z.history = nil
+	}
+	z.history = append(z.history, d)
+	if len(z.history) > maxHistory {
+		z.history = append([]diff(nil), z.history[len(z.history)-maxHistory:]...)
+	}
+}
+
+// incremental returns the diffs from the version of z with serial to the current version, or nil if the history
+// doesn't go back that far. The caller must hold the lock of z.
+func (z *Zone) incremental(serial uint32) []diff {
+	for i, d := range z.history {
+		if d.from.Serial != serial {
+			continue
+		}
+		if z.history[len(z.history)-1].to.Serial != z.Apex.SOA.Serial {
+			return nil
+		}
+		return z.history[i:]
+	}
+	return nil
+}
+
+// difference returns the diff between the current version of z and zone, and the number of records in zone. It's
+// computed without holding the lock of z, see keepHistory. If z has no SOA record, the diff is empty.
+func (z *Zone) difference(zone *Zone) (diff, int) {
+	z.RLock()
+	current := &Zone{Apex: z.Apex, Tree: z.Tree}
+	z.RUnlock()
+	if current.Apex.SOA == nil {
+		return diff{}, 0
+	}
+	return difference(current, zone)
+}
+
+// keepHistory adds d, as returned by difference, to the history of z if it's the change from the current version
+// of z. Otherwise z changed after d was computed, and the history is cleared. The caller must hold the lock of z.
+func (z *Zone) keepHistory(d diff, size int) {
+	if d.from == nil || d.from != z.Apex.SOA {
+		z.history = nil
+		return
+	}
+	z.addHistory(d, size)
+}
+
+// difference returns the diff between the zones a and b, and the number of records in b. Both zones must have a
+// SOA record.
+func difference(a, b *Zone) (diff, int) {
+	df := &differ{}
+	df.rrs(a.apexRRs()[1:], b.apexRRs()[1:])
+	df.trees(a.Tree, b.Tree)
+	df.trees(a.Apex.NSEC3, b.Apex.NSEC3)
+	return diff{from: a.Apex.SOA, to: b.Apex.SOA, del: df.del, add: df.add}, df.size
+}
+
+// differ collects the records that are deleted and added between two versions of a zone.
+type differ struct {
+	del, add []dns.RR
+	size     int // number of records in the new version
+}
+
+// rrs compares the records a and b, which have the same owner name.
+func (df *differ) rrs(a, b []dns.RR) {
+	df.size += len(b)
+	old := make(map[string]bool, len(a))
+	for _, rr := range a {
+		old[rr.String()] = true
+	}
+	for _, rr := range b {
+		s := rr.String()
+		if old[s] {
+			delete(old, s)
+			continue
+		}
+		df.add = append(df.add, rr)
+	}
+	for _, rr := range a {
+		if old[rr.String()] {
+			df.del = append(df.del, rr)
+		}
+	}
+}
+
+// trees compares the trees a and b, either may be nil.
+func (df *differ) trees(a, b *tree.Tree) {
+	var ea, eb []*tree.Elem
+	if a != nil {
+		ea = a.All()
+	}
+	if b != nil {
+		eb = b.All()
+	}
+
+	i, j := 0, 0
+	for i < len(ea) || j < len(eb) {
+		c := 0
+		switch {
+		case i == len(ea):
+			c = 1
+		case j == len(eb):
+			c = -1
+		default:
+			c = tree.Less(eb[j], ea[i].Name())
+		}
+
+		switch {
+		case c < 0:
+			df.rrs(ea[i].All(), nil)
+			i++
+		case c > 0:
+			df.rrs(nil, eb[j].All())
+			j++
+		default:
+			df.rrs(ea[i].All(), eb[j].All())
+			i++
+			j++
+		}
+	}
+}
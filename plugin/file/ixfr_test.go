@@ -0,0 +1,225 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+
+	"github.com/miekg/dns"
+)
+
+const ixfrZone = "ixfr.example."
+
+const dbIxfrV1 = `$ORIGIN ixfr.example.
+@	3600 IN	SOA	ns1 admin 1 7200 3600 1209600 3600
+	3600 IN	NS	ns1
+ns1	3600 IN	A	10.0.0.53
+a	3600 IN	A	10.0.0.1
+b	3600 IN	A	10.0.0.2
+`
+
+const dbIxfrV2 = `$ORIGIN ixfr.example.
+@	3600 IN	SOA	ns1 admin 2 7200 3600 1209600 3600
+	3600 IN	NS	ns1
+ns1	3600 IN	A	10.0.0.53
+a	3600 IN	A	10.0.0.1
+b	3600 IN	A	10.0.0.3
+c	3600 IN	A	10.0.0.4
+`
+
+// ixfrV1ToV2 is the incremental transfer from version 1 to 2 of the zone.
+var ixfrV1ToV2 = []string{
+	"ixfr.example.	3600	IN	SOA	ns1.ixfr.example. admin.ixfr.example. 2 7200 3600 1209600 3600",
+	"ixfr.example.	3600	IN	SOA	ns1.ixfr.example. admin.ixfr.example. 1 7200 3600 1209600 3600",
+	"b.ixfr.example.	3600	IN	A	10.0.0.2",
+	"ixfr.example.	3600	IN	SOA	ns1.ixfr.example. admin.ixfr.example. 2 7200 3600 1209600 3600",
+	"b.ixfr.example.	3600	IN	A	10.0.0.3",
+	"c.ixfr.example.	3600	IN	A	10.0.0.4",
+	"ixfr.example.	3600	IN	SOA	ns1.ixfr.example. admin.ixfr.example. 2 7200 3600 1209600 3600",
+}
+
+func parseIxfr(t *testing.T, db string) *Zone {
+	z, err := Parse(strings.NewReader(db), ixfrZone, "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	return z
+}
+
+// reloadIxfr replaces the records of z with those in db, like Reload does.
+func reloadIxfr(t *testing.T, z *Zone, db string) {
+	zone := parseIxfr(t, db)
+	d, size := z.difference(zone)
+	z.Lock()
+	z.keepHistory(d, size)
+	z.Apex = zone.Apex
+	z.Tree = zone.Tree
+	z.Unlock()
+}
+
+func transferred(t *testing.T, z *Zone, serial uint32) []string {
+	ch, err := z.Transfer(serial)
+	if err != nil {
+		t.Fatalf("Expected no error when transferring zone, got %q", err)
+	}
+	var rrs []string
+	for r := range ch {
+		for _, rr := range r {
+			rrs = append(rrs, rr.String())
+		}
+	}
+	return rrs
+}
+
+// primaryHandler answers the zone transfers of primary, and records the type of the last one in qtype.
+func primaryHandler(t *testing.T, primary *Zone, qtype *uint16) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		*qtype = req.Question[0].Qtype
+		var serial uint32
+		if *qtype == dns.TypeIXFR && len(req.Ns) == 1 {
+			serial = req.Ns[0].(*dns.SOA).Serial
+		}
+		ch, err := primary.Transfer(serial)
+		if err != nil {
+			t.Errorf("Expected no error when transferring zone, got %q", err)
+			return
+		}
+		out := make(chan *dns.Envelope)
+		tr := new(dns.Transfer)
+		go tr.Out(w, req, out)
+		for rrs := range ch {
+			out <- &dns.Envelope{RR: rrs}
+		}
+		close(out)
+		w.Hijack()
+	}
+}
+
+func TestTransferIncremental(t *testing.T) {
+	z := parseIxfr(t, dbIxfrV1)
+	reloadIxfr(t, z, dbIxfrV2)
+
+	rrs := transferred(t, z, 1)
+	if strings.Join(rrs, "\n") != strings.Join(ixfrV1ToV2, "\n") {
+		t.Errorf("Expected incremental transfer:\n%s\ngot:\n%s", strings.Join(ixfrV1ToV2, "\n"), strings.Join(rrs, "\n"))
+	}
+
+	if rrs := transferred(t, z, 2); len(rrs) != 1 {
+		t.Errorf("Expected only the SOA for the current serial, got %d records", len(rrs))
+	}
+	// A serial that isn't in the history gets a full transfer.
+	if rrs := transferred(t, z, 0); len(rrs) != 7 {
+		t.Errorf("Expected 7 records in a full transfer, got %d", len(rrs))
+	}
+	if rrs := transferred(t, z, 10); len(rrs) != 7 {
+		t.Errorf("Expected 7 records in a full transfer, got %d", len(rrs))
+	}
+
+	// A change larger than the zone clears the history.
+	reloadIxfr(t, z, strings.Replace(strings.Replace(dbIxfrV1, " 1 7200", " 3 7200", 1), "10.0.0.53", "10.0.0.54", 1))
+	if len(z.history) != 0 {
+		t.Fatalf("Expected no history, got %d diffs", len(z.history))
+	}
+	reloadIxfr(t, z, strings.Replace(dbIxfrV2, " 2 7200", " 4 7200", 1))
+	if rrs := transferred(t, z, 1); len(rrs) != 7 {
+		t.Errorf("Expected 7 records in a full transfer, got %d", len(rrs))
+	}
+}
+
+func TestTransferInIncremental(t *testing.T) {
+	primary := parseIxfr(t, dbIxfrV1)
+	var qtype uint16
+	s := dnstest.NewServer(primaryHandler(t, primary, &qtype))
+	defer s.Close()
+
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{s.Addr}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if qtype != dns.TypeAXFR {
+		t.Errorf("Expected a full transfer of an empty zone, got %s", dns.TypeToString[qtype])
+	}
+
+	reloadIxfr(t, primary, dbIxfrV2)
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if qtype != dns.TypeIXFR {
+		t.Errorf("Expected an incremental transfer, got %s", dns.TypeToString[qtype])
+	}
+	if z.Apex.SOA.Serial != 2 {
+		t.Errorf("Expected SOA serial 2, got %d", z.Apex.SOA.Serial)
+	}
+	// The secondary keeps the history too, and can serve the incremental transfer itself.
+	rrs := transferred(t, z, 1)
+	if strings.Join(rrs, "\n") != strings.Join(ixfrV1ToV2, "\n") {
+		t.Errorf("Expected incremental transfer:\n%s\ngot:\n%s", strings.Join(ixfrV1ToV2, "\n"), strings.Join(rrs, "\n"))
+	}
+	if rrs := transferred(t, z, 0); len(rrs) != 7 {
+		t.Errorf("Expected 7 records in a full transfer, got %d", len(rrs))
+	}
+
+	// Without history on the primary, the incremental request gets a full transfer.
+	reloadIxfr(t, primary, strings.Replace(dbIxfrV1, " 1 7200", " 3 7200", 1))
+	primary.history = nil
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if z.Apex.SOA.Serial != 3 {
+		t.Errorf("Expected SOA serial 3, got %d", z.Apex.SOA.Serial)
+	}
+	if rrs := transferred(t, z, 0); len(rrs) != 6 {
+		t.Errorf("Expected 6 records in a full transfer, got %d", len(rrs))
+	}
+	if rrs := transferred(t, z, 2); len(rrs) != 7 {
+		t.Errorf("Expected 7 records in the incremental transfer, got %d", len(rrs))
+	}
+}
+
+func TestTransferInIncrementalOnlySOA(t *testing.T) {
+	primary := parseIxfr(t, strings.Replace(dbIxfrV1, " 1 7200", " 4294967295 7200", 1))
+	var qtype uint16
+	full := primaryHandler(t, primary, &qtype)
+	// The primary answers an incremental transfer with only its SOA record, like a server that can't fit the
+	// changes in the response.
+	s := dnstest.NewServer(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Qtype != dns.TypeIXFR {
+			full(w, req)
+			return
+		}
+		qtype = dns.TypeIXFR
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = []dns.RR{primary.Apex.SOA}
+		w.WriteMsg(m)
+	})
+	defer s.Close()
+
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{s.Addr}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+
+	// The same serial has no changes.
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if qtype != dns.TypeIXFR {
+		t.Errorf("Expected an incremental transfer, got %s", dns.TypeToString[qtype])
+	}
+
+	// A newer serial needs a full transfer, also when it wraps around.
+	reloadIxfr(t, primary, dbIxfrV2)
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if qtype != dns.TypeAXFR {
+		t.Errorf("Expected a full transfer, got %s", dns.TypeToString[qtype])
+	}
+	if z.Apex.SOA.Serial != 2 {
+		t.Errorf("Expected SOA serial 2, got %d", z.Apex.SOA.Serial)
+	}
+}
@@ -0,0 +1,302 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// maxJournal is the number of updates kept in a journal when the zone is written back to its file.
+const maxJournal = 100
+
+// diff holds the difference between two versions of a zone: the records deleted from the version with SOA from,
+// and the records added to it to get the version with SOA to.
+type diff struct {
+	from, to *dns.SOA
+	del, add []dns.RR
+}
+
+// rrs returns the records of d in the order of an incremental zone transfer (RFC 1995): the old SOA, the deleted
+// records, the new SOA and the added records.
+func (d diff) rrs() []dns.RR {
+	rrs := make([]dns.RR, 0, len(d.del)+len(d.add)+2)
+	rrs = append(rrs, d.from)
+	rrs = append(rrs, d.del...)
+	rrs = append(rrs, d.to)
+	return append(rrs, d.add...)
+}
+
+// The journal of a zone holds the updates of the zone as a sequence of diffs in the zone file format. The diffs are
+// written like in an incremental zone transfer, so each starts with the old SOA and the deleted records, followed by
+// the new SOA and the added records.
+
+// appendJournal appends d to the journal in path.
+func appendJournal(path string, d diff) error {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := writeDiffs(f, []diff{d}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readJournal reads the diffs from the journal in path. A journal that doesn't exist has no diffs.
+func readJournal(path, origin string) ([]diff, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(f, origin, path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	diffs, err := toDiffs(rrs)
+	if err != nil {
+		return nil, fmt.Errorf("journal %q %s", path, err)
+	}
+	return diffs, nil
+}
+
+// toDiffs returns the diffs in rrs, which are in the order of an incremental zone transfer, without the SOA
+// records that start and end the transfer.
+func toDiffs(rrs []dns.RR) ([]diff, error) {
+	var (
+		diffs []diff
+		d     *diff
+	)
+	for _, rr := range rrs {
+		soa, isSOA := rr.(*dns.SOA)
+		switch {
+		case isSOA && (d == nil || d.to != nil):
+			diffs = append(diffs, diff{from: soa})
+			d = &diffs[len(diffs)-1]
+		case isSOA:
+			d.to = soa
+		case d == nil:
+			return nil, fmt.Errorf("doesn't start with a SOA record")
+		case d.to == nil:
+			d.del = append(d.del, rr)
+		default:
+			d.add = append(d.add, rr)
+		}
+	}
+	if d != nil && d.to == nil {
+		return nil, fmt.Errorf("ends with an incomplete diff")
+	}
+	return diffs, nil
+}
+
+// writeJournal replaces the journal in path with one that holds diffs. If there are no diffs, the journal is
+// removed.
+func writeJournal(path string, diffs []diff) error {
+	if len(diffs) == 0 {
+		err := os.Remove(filepath.Clean(path))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return writeFile(path, func(w io.Writer) error { return writeDiffs(w, diffs) })
+}
+
+func writeDiffs(w io.Writer, diffs []diff) error {
+	b := bufio.NewWriter(w)
+	for _, d := range diffs {
+		for _, rr := range d.rrs() {
+			if _, err := fmt.Fprintln(b, rr.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// writeFile atomically replaces the file in path with the contents written by fn: the contents are written to a
+// temporary file, which is then renamed.
+func writeFile(path string, fn func(io.Writer) error) error {
+	path = filepath.Clean(path)
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Replay applies the updates from the journal of z that are newer than the zone, for instance after a restart
+// before the zone was written back to its file. A journal that doesn't apply to the zone, because the zone file
+// was changed, is removed.
+func (z *Zone) Replay() error {
+	if z.Updates == nil {
+		return nil
+	}
+	diffs, err := readJournal(z.Updates.Journal, z.origin)
+	if err != nil {
+		return err
+	}
+
+	z.Lock()
+	defer z.Unlock()
+	if z.Apex.SOA == nil || len(diffs) == 0 {
+		return nil
+	}
+
+	serial := z.Apex.SOA.Serial
+	start := -1
+	for i := range diffs {
+		if diffs[i].from.Serial == serial {
+			start = i
+			break
+		}
+	}
+	if start < 0 && diffs[len(diffs)-1].to.Serial != serial {
+		log.Warningf("Removing journal %q: it doesn't apply to zone %q with %d SOA serial", z.Updates.Journal, z.origin, serial)
+		return writeJournal(z.Updates.Journal, nil)
+	}
+
+	if start >= 0 {
+		u := newUpdate(z)
+		for _, d := range diffs[start:] {
+			if err := u.applyDiff(d); err != nil {
+				return fmt.Errorf("journal %q %s", z.Updates.Journal, err)
+			}
+		}
+		z.Apex = u.z.Apex
+		z.Tree = u.z.Tree
+		z.dirty = true
+		log.Infof("Replayed %d updates of zone %q from journal %q to %d SOA serial", len(diffs)-start, z.origin, z.Updates.Journal, z.Apex.SOA.Serial)
+	}
+
+	// The diffs that lead up to the current version are the history of the zone.
+	for _, d := range diffs {
+		z.addHistory(d, 0)
+	}
+	return nil
+}
+
+// Writeback writes z to its file if z was updated since it was last written, and shortens its journal.
+func (z *Zone) Writeback() error {
+	z.RLock()
+	dirty, path := z.dirty, z.file
+	var (
+		apex     []dns.RR
+		t, nsec3 *tree.Tree
+	)
+	if dirty {
+		apex, t, nsec3 = z.apexRRs(), z.Tree, z.Apex.NSEC3
+	}
+	z.RUnlock()
+	if !dirty || z.Updates == nil {
+		return nil
+	}
+	// Don't bring back a zone file that was removed.
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := writeFile(path, func(w io.Writer) error { return writeZone(w, z.origin, apex, t, nsec3) })
+	if err != nil {
+		return err
+	}
+
+	z.Lock()
+	defer z.Unlock()
+	if dns.RR(z.Apex.SOA) == apex[0] {
+		z.dirty = false
+	}
+	diffs, err := readJournal(z.Updates.Journal, z.origin)
+	if err != nil {
+		return err
+	}
+	if len(diffs) > maxJournal {
+		return writeJournal(z.Updates.Journal, diffs[len(diffs)-maxJournal:])
+	}
+	return nil
+}
+
+// writeZone writes the apex records and the records in the trees of a zone to w, in the zone file format. A
+// tree may be nil.
+func writeZone(w io.Writer, origin string, apex []dns.RR, trees ...*tree.Tree) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "$ORIGIN %s\n", origin)
+	for _, rr := range apex {
+		fmt.Fprintln(b, rr.String())
+	}
+	for _, t := range trees {
+		if t == nil {
+			continue
+		}
+		t.Walk(func(e *tree.Elem, rrs map[uint16][]dns.RR) error {
+			types := e.Types()
+			sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+			for _, typ := range types {
+				for _, rr := range rrs[typ] {
+					fmt.Fprintln(b, rr.String())
+				}
+			}
+			return nil
+		})
+	}
+	return b.Flush()
+}
+
+// writeback writes z back to its file every z.Updates.Writeback, until z is shut down.
+func (z *Zone) writeback() {
+	tick := time.NewTicker(z.Updates.Writeback)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := z.Writeback(); err != nil {
+				log.Errorf("Failed to write zone %q to %q: %s", z.origin, z.File(), err)
+			}
+		case <-z.writebackShutdown:
+			return
+		}
+	}
+}
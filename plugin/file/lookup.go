@@ -163,6 +163,9 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 			if do {
 				dss := typeFromElem(elem, dns.TypeDS, do)
 				nsrrs = append(nsrrs, dss...)
+				if len(dss) == 0 && ap.NSEC3 != nil {
+					nsrrs = append(nsrrs, ap.nsec3NoData(elem.Name())...)
+				}
 			}
 
 			return nil, nsrrs, glue, Delegation
@@ -189,8 +192,12 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := ap.soa(do)
 			if do {
-				nsec := typeFromElem(elem, dns.TypeNSEC, do)
-				ret = append(ret, nsec...)
+				if ap.NSEC3 != nil {
+					ret = append(ret, ap.nsec3NoData(qname)...)
+				} else {
+					nsec := typeFromElem(elem, dns.TypeNSEC, do)
+					ret = append(ret, nsec...)
+				}
 			}
 			return nil, ret, nil, NoData
 		}
@@ -228,8 +235,12 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		if len(rrs) == 0 {
 			ret := ap.soa(do)
 			if do {
-				nsec := typeFromElem(wildElem, dns.TypeNSEC, do)
-				ret = append(ret, nsec...)
+				if ap.NSEC3 != nil {
+					ret = append(ret, ap.nsec3WildcardNoData(qname, wildElem)...)
+				} else {
+					nsec := typeFromElem(wildElem, dns.TypeNSEC, do)
+					ret = append(ret, nsec...)
+				}
 			}
 			return nil, ret, nil, NoData
 		}
@@ -237,7 +248,9 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 		auth := ap.ns(do)
 		if do {
 			// An NSEC is needed to say no longer name exists under this wildcard.
-			if deny, found := tr.Prev(qname); found {
+			if ap.NSEC3 != nil {
+				auth = append(auth, ap.nsec3Wildcard(qname, wildElem)...)
+			} else if deny, found := tr.Prev(qname); found {
 				nsec := typeFromElem(deny, dns.TypeNSEC, do)
 				auth = append(auth, nsec...)
 			}
@@ -260,6 +273,14 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 	}
 
 	ret := ap.soa(do)
+	if do && ap.NSEC3 != nil {
+		if rcode == NameError {
+			ret = append(ret, ap.nsec3NameError(qname)...)
+		} else {
+			ret = append(ret, ap.nsec3NoData(qname)...)
+		}
+		return nil, ret, nil, rcode
+	}
 	if do {
 		deny, found := tr.Prev(qname)
 		if !found {
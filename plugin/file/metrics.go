@@ -0,0 +1,43 @@
+package file
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The metrics of secondary zones, those with primaries to transfer from.
+var (
+	// TransferCount is the number of inbound zone transfers, per type and result.
+	TransferCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "transfers_total",
+		Help:      "Counter of inbound zone transfers per zone, type and result.",
+	}, []string{"zone", "type", "result"})
+
+	// SerialGauge is the SOA serial of a zone.
+	SerialGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "zone_serial",
+		Help:      "The SOA serial of a secondary zone.",
+	}, []string{"zone"})
+
+	// RefreshTime is the last time a zone was current with a primary.
+	RefreshTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "zone_refresh_timestamp_seconds",
+		Help:      "The time a secondary zone was last known to be current with a primary, in seconds since the Unix epoch.",
+	}, []string{"zone"})
+
+	// ExpiredGauge is 1 if a zone is expired, and 0 otherwise.
+	ExpiredGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "secondary",
+		Name:      "zone_expired",
+		Help:      "Whether a secondary zone is expired (1) or not (0).",
+	}, []string{"zone"})
+)
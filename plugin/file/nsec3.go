@@ -0,0 +1,120 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// The NSEC3 records of a zone and their signatures are kept in their own tree, Apex.NSEC3, as their owner names
+// are hashes and not names that exist in the zone.
+
+// nsec3 returns the NSEC3 record, and its signatures, that matches name. If no record matches, the record that
+// covers the hash of name is returned and match is false.
+func (a Apex) nsec3(name string) (rrs []dns.RR, match bool) {
+	first := a.NSEC3.Min()
+	if first == nil {
+		return nil, false
+	}
+	rrs = first.Type(dns.TypeNSEC3)
+	if len(rrs) == 0 {
+		return nil, false
+	}
+	params := rrs[0].(*dns.NSEC3)
+	origin, _ := splitFirst(first.Name())
+	owner := strings.ToLower(dns.HashName(name, params.Hash, params.Iterations, params.Salt)) + "." + origin
+
+	elem, found := a.NSEC3.Prev(owner)
+	if !found {
+		// The hash sorts before the first one, it is covered by the last NSEC3 record that wraps around.
+		elem = a.NSEC3.Max()
+	}
+	return typeFromElem(elem, dns.TypeNSEC3, true), elem.Name() == owner
+}
+
+// closestEncloserProof returns the closest (provable) encloser of qname, and the NSEC3 records that prove it: the
+// record matching the closest encloser, and the one covering the next closer name (RFC 5155, section 7.2.1).
+func (a Apex) closestEncloserProof(qname string) (string, []dns.RR) {
+	next := qname
+	for {
+		ce, end := splitFirst(next)
+		if end {
+			return "", nil
+		}
+		if rrs, match := a.nsec3(ce); match {
+			cover, _ := a.nsec3(next)
+			return ce, appendNSEC3(rrs, cover)
+		}
+		next = ce
+	}
+}
+
+// nsec3NoData returns the NSEC3 records that prove name exists, but not with the queried type. If name has no NSEC3
+// record, because it is an insecure delegation covered by an opt-out NSEC3 record, the closest encloser proof is
+// returned.
+func (a Apex) nsec3NoData(name string) []dns.RR {
+	if rrs, match := a.nsec3(name); match {
+		return rrs
+	}
+	_, rrs := a.closestEncloserProof(name)
+	return rrs
+}
+
+// nsec3NameError returns the NSEC3 records that prove qname does not exist: the closest encloser proof, and the
+// record covering the wildcard at the closest encloser.
+func (a Apex) nsec3NameError(qname string) []dns.RR {
+	ce, rrs := a.closestEncloserProof(qname)
+	if ce == "" {
+		return nil
+	}
+	wildcard, _ := a.nsec3("*." + ce)
+	return appendNSEC3(rrs, wildcard)
+}
+
+// nsec3WildcardNoData returns the NSEC3 records that prove qname does not exist, and the wildcard that matched it
+// doesn't have the queried type.
+func (a Apex) nsec3WildcardNoData(qname string, wildcard *tree.Elem) []dns.RR {
+	_, rrs := a.closestEncloserProof(qname)
+	match, _ := a.nsec3(wildcard.Name())
+	return appendNSEC3(rrs, match)
+}
+
+// nsec3Wildcard returns the NSEC3 record that proves that the answer synthesized from wildcard is the only one:
+// the record that covers the next closer name of qname.
+func (a Apex) nsec3Wildcard(qname string, wildcard *tree.Elem) []dns.RR {
+	ce, _ := splitFirst(wildcard.Name())
+	next := qname
+	for {
+		parent, end := splitFirst(next)
+		if end || parent == ce {
+			break
+		}
+		next = parent
+	}
+	cover, _ := a.nsec3(next)
+	return cover
+}
+
+// appendNSEC3 appends the NSEC3 records in rrs to proof, if proof doesn't already have them.
+func appendNSEC3(proof, rrs []dns.RR) []dns.RR {
+	if len(rrs) == 0 {
+		return proof
+	}
+	for _, rr := range proof {
+		if rr.Header().Rrtype == dns.TypeNSEC3 && rr.Header().Name == rrs[0].Header().Name {
+			return proof
+		}
+	}
+	return append(proof, rrs...)
+}
+
+// splitFirst returns name without its first label. End is true if name is the root.
+func splitFirst(name string) (string, bool) {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return ".", true
+	}
+	return name[off:], false
+}
@@ -1,24 +1,154 @@
 package file
 
 import (
+	"context"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestParseNSEC3PARAM(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %s", err)
+	}
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeNSEC3PARAM); len(x) != 1 {
+		t.Errorf("Expected 1 NSEC3PARAM record, got %d", len(x))
 	}
 }
 
 func TestParseNSEC3(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3Test), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3Test), "example.org", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %s", err)
+	}
+	if _, found := z.Search("aub8v9ce95ie18spjubsr058h41n7pa5.example.org."); found {
+		t.Errorf("Expected the NSEC3 record not to be in the zone's tree")
+	}
+	e, found := z.Apex.NSEC3.Search("aub8v9ce95ie18spjubsr058h41n7pa5.example.org.")
+	if !found {
+		t.Fatalf("Expected the NSEC3 record in the NSEC3 chain")
+	}
+	if len(e.Type(dns.TypeNSEC3)) != 1 || len(e.Type(dns.TypeRRSIG)) != 1 {
+		t.Errorf("Expected an NSEC3 record and its signature, got %v", e.All())
+	}
+}
+
+// nsec3Zone returns a zone with an NSEC3 chain for the names in it. Insecure delegations are opted out.
+func nsec3Zone(t *testing.T) *Zone {
+	t.Helper()
+	z, err := Parse(strings.NewReader(nsec3ZoneData), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitmaps := map[string][]uint16{
+		"example.org.":     {dns.TypeSOA, dns.TypeNS, dns.TypeNSEC3PARAM},
+		"a.example.org.":   {dns.TypeA},
+		"c.example.org.":   nil, // empty non-terminal
+		"b.c.example.org.": {dns.TypeA},
+		"w.example.org.":   nil,
+		"*.w.example.org.": {dns.TypeTXT},
+	}
+	hashes := []string{}
+	names := map[string]string{}
+	for name := range bitmaps {
+		h := dns.HashName(name, dns.SHA1, 0, "")
+		hashes = append(hashes, h)
+		names[h] = name
 	}
+	sort.Strings(hashes)
+	for i, h := range hashes {
+		z.Insert(&dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(h) + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Flags:      1,
+			NextDomain: hashes[(i+1)%len(hashes)],
+			HashLength: 20,
+			TypeBitMap: bitmaps[names[h]],
+		})
+	}
+	return z
 }
 
+func TestLookupNSEC3(t *testing.T) {
+	z := nsec3Zone(t)
+	fm := File{Next: test.ErrorHandler(), Zones: Zones{Z: map[string]*Zone{"example.org.": z}, Names: []string{"example.org."}}}
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		rcode   int
+		answers int
+		match   []string // names that must have a matching NSEC3 record in the authority section
+		cover   []string // names that must have a covering NSEC3 record
+	}{
+		{"x.example.org.", dns.TypeA, dns.RcodeNameError, 0, []string{"example.org."}, []string{"x.example.org.", "*.example.org."}},
+		{"x.y.a.example.org.", dns.TypeA, dns.RcodeNameError, 0, []string{"a.example.org."}, []string{"y.a.example.org.", "*.a.example.org."}},
+		{"a.example.org.", dns.TypeMX, dns.RcodeSuccess, 0, []string{"a.example.org."}, nil},
+		{"c.example.org.", dns.TypeA, dns.RcodeSuccess, 0, []string{"c.example.org."}, nil},
+		{"x.w.example.org.", dns.TypeTXT, dns.RcodeSuccess, 1, nil, []string{"x.w.example.org."}},
+		{"x.y.w.example.org.", dns.TypeTXT, dns.RcodeSuccess, 1, nil, []string{"y.w.example.org."}},
+		{"x.w.example.org.", dns.TypeA, dns.RcodeSuccess, 0, []string{"w.example.org.", "*.w.example.org."}, []string{"x.w.example.org."}},
+		// Insecure delegation, opted out.
+		{"www.sub.example.org.", dns.TypeA, dns.RcodeSuccess, 0, []string{"example.org."}, []string{"sub.example.org."}},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := fm.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if len(rec.Msg.Answer) != tc.answers {
+			t.Errorf("Test %d: expected %d answers, got %d", i, tc.answers, len(rec.Msg.Answer))
+		}
+		for _, name := range tc.match {
+			if !nsec3Proves(rec.Msg.Ns, name, true) {
+				t.Errorf("Test %d: expected an NSEC3 record matching %q, got %v", i, name, rec.Msg.Ns)
+			}
+		}
+		for _, name := range tc.cover {
+			if !nsec3Proves(rec.Msg.Ns, name, false) {
+				t.Errorf("Test %d: expected an NSEC3 record covering %q, got %v", i, name, rec.Msg.Ns)
+			}
+		}
+	}
+}
+
+// nsec3Proves returns true if one of the NSEC3 records in rrs matches, or covers, name.
+func nsec3Proves(rrs []dns.RR, name string, match bool) bool {
+	for _, rr := range rrs {
+		if n3, ok := rr.(*dns.NSEC3); ok {
+			if match && n3.Match(name) || !match && n3.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const nsec3ZoneData = `$ORIGIN example.org.
+@        300 SOA ns.example.org. hostmaster.example.org. 1 3600 600 86400 300
+         300 NS  ns.example.org.
+         300 NSEC3PARAM 1 0 0 -
+a        300 A   192.0.2.1
+b.c      300 A   192.0.2.2
+*.w      300 TXT "wildcard"
+sub      300 NS  ns.sub.example.org.
+ns.sub   300 A   192.0.2.3
+`
+
 const nsec3paramTest = `miek.nl.	1800	IN	SOA	linode.atoom.net. miek.miek.nl. 1460175181 14400 3600 604800 14400
 miek.nl.		1800	IN	NS	omval.tednet.nl.
 miek.nl.		0	IN	NSEC3PARAM 1 0 5 A3DEBC9CC4F695C7`
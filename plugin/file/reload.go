@@ -8,8 +8,16 @@ import (
 	"github.com/coredns/coredns/plugin/transfer"
 )
 
-// Reload reloads a zone when it is changed on disk. If z.ReloadInterval is zero, no reloading will be done.
+// Reload reloads a zone when it is changed on disk. If z.ReloadInterval is zero, no reloading will be done. If
+// the zone can be updated, it is also periodically written back to disk, see Writeback.
 func (z *Zone) Reload(t *transfer.Transfer) error {
+	z.Lock()
+	z.transfer = t
+	z.Unlock()
+	if z.Updates != nil && z.Updates.Writeback > 0 {
+		go z.writeback()
+	}
+
 	if z.ReloadInterval == 0 {
 		return nil
 	}
@@ -19,35 +27,7 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 		for {
 			select {
 			case <-tick.C:
-				zFile := z.File()
-				reader, err := os.Open(filepath.Clean(zFile))
-				if err != nil {
-					log.Errorf("Failed to open zone %q in %q: %v", z.origin, zFile, err)
-					continue
-				}
-
-				serial := z.SOASerialIfDefined()
-				zone, err := Parse(reader, z.origin, zFile, serial)
-				reader.Close()
-				if err != nil {
-					if _, ok := err.(*serialErr); !ok {
-						log.Errorf("Parsing zone %q: %v", z.origin, err)
-					}
-					continue
-				}
-
-				// copy elements we need
-				z.Lock()
-				z.Apex = zone.Apex
-				z.Tree = zone.Tree
-				z.Unlock()
-
-				log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, z.Apex.SOA.Serial)
-				if t != nil {
-					if err := t.Notify(z.origin); err != nil {
-						log.Warningf("Failed sending notifies: %s", err)
-					}
-				}
+				z.ReloadFile()
 
 			case <-z.reloadShutdown:
 				tick.Stop()
@@ -58,6 +38,56 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 	return nil
 }
 
+// ReloadFile reloads the zone from its file if the SOA serial in the file is different, and notifies the
+// secondaries of the change.
+func (z *Zone) ReloadFile() {
+	zFile := z.File()
+	reader, err := os.Open(filepath.Clean(zFile))
+	if err != nil {
+		log.Errorf("Failed to open zone %q in %q: %v", z.origin, zFile, err)
+		return
+	}
+
+	serial := z.SOASerialIfDefined()
+	zone, err := Parse(reader, z.origin, zFile, serial)
+	reader.Close()
+	if err != nil {
+		if _, ok := err.(*serialErr); !ok {
+			log.Errorf("Parsing zone %q: %v", z.origin, err)
+		}
+		return
+	}
+
+	d, size := z.difference(zone)
+
+	// copy elements we need
+	z.Lock()
+	if z.Updates != nil {
+		// Updates may have made the serial higher than the one in the file, only reload a newer file;
+		// the updates in the journal don't apply to it.
+		if z.Apex.SOA != nil && !less(z.Apex.SOA.Serial, zone.Apex.SOA.Serial) {
+			z.Unlock()
+			return
+		}
+		if err := writeJournal(z.Updates.Journal, nil); err != nil {
+			log.Warningf("Failed to remove journal %q: %s", z.Updates.Journal, err)
+		}
+		z.dirty = false
+	}
+	z.keepHistory(d, size)
+	z.Apex = zone.Apex
+	z.Tree = zone.Tree
+	t := z.transfer
+	z.Unlock()
+
+	log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, zone.Apex.SOA.Serial)
+	if t != nil {
+		if err := t.Notify(z.origin); err != nil {
+			log.Warningf("Failed sending notifies: %s", err)
+		}
+	}
+}
+
 // SOASerialIfDefined returns the SOA's serial if the zone has a SOA record in the Apex, or -1 otherwise.
 func (z *Zone) SOASerialIfDefined() int64 {
 	z.RLock()
@@ -1,65 +1,201 @@
 package file
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-// TransferIn retrieves the zone from the masters, parses it and sets it live.
+// TransferKey is a TSIG key to sign zone transfers with.
+type TransferKey struct {
+	Name      string
+	Secret    string
+	Algorithm string
+}
+
+// sign signs m with the key k, if there is one, and returns the secrets to verify the response with.
+func (k *TransferKey) sign(m *dns.Msg) map[string]string {
+	if k == nil {
+		return nil
+	}
+	m.SetTsig(k.Name, k.Algorithm, 300, time.Now().Unix())
+	return map[string]string{k.Name: k.Secret}
+}
+
+// TransferIn retrieves the zone from the masters, parses it and sets it live. If the zone has a SOA record, an
+// incremental transfer (IXFR) is requested; if that fails a full transfer (AXFR) is done. The primary that was
+// transferred from last is tried first. If all primaries fail, the zone is expired when it's due.
 func (z *Zone) TransferIn() error {
 	if len(z.TransferFrom) == 0 {
 		return nil
 	}
-	m := new(dns.Msg)
-	m.SetAxfr(z.origin)
+	z.RLock()
+	soa, first := z.Apex.SOA, z.primary
+	z.RUnlock()
 
-	z1 := z.CopyWithoutApex()
-	var (
-		Err error
-		tr  string
-	)
+	var Err error
+	for i := range z.TransferFrom {
+		p := (first + i) % len(z.TransferFrom)
+		tr := z.TransferFrom[p]
+		if soa != nil {
+			if Err = z.transferIn(tr, soa); Err == nil {
+				z.setPrimary(p)
+				return nil
+			}
+			log.Warningf("Failed incremental transfer of `%s' from %q, trying a full transfer", z.origin, tr)
+		}
+		if Err = z.transferIn(tr, nil); Err == nil {
+			z.setPrimary(p)
+			return nil
+		}
+	}
+	z.checkExpired()
+	return Err
+}
 
-Transfer:
-	for _, tr = range z.TransferFrom {
-		t := new(dns.Transfer)
-		c, err := t.In(m, tr)
-		if err != nil {
-			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
-			Err = err
-			continue Transfer
+// setPrimary makes the primary with index p in z.TransferFrom the one that's tried first.
+func (z *Zone) setPrimary(p int) {
+	z.Lock()
+	z.primary = p
+	z.Unlock()
+}
+
+// transferIn transfers the zone from the primary tr. If soa isn't nil an incremental transfer from the version
+// of the zone with soa is requested, otherwise a full transfer. The primary may answer an incremental transfer
+// request with a full transfer.
+func (z *Zone) transferIn(tr string, soa *dns.SOA) error {
+	m := new(dns.Msg)
+	if soa == nil {
+		m.SetAxfr(z.origin)
+	} else {
+		m.SetIxfr(z.origin, soa.Serial, soa.Ns, soa.Mbox)
+	}
+	qtype := dns.TypeToString[m.Question[0].Qtype]
+
+	t := new(dns.Transfer)
+	t.TsigSecret = z.TransferKey.sign(m)
+	rrs, err := z.receive(t, m, tr)
+	if err == nil {
+		incremental := false
+		if len(rrs) > 1 {
+			_, incremental = rrs[1].(*dns.SOA)
 		}
-		for env := range c {
-			if env.Error != nil {
-				log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, env.Error)
-				Err = env.Error
-				continue Transfer
-			}
-			for _, rr := range env.RR {
-				if err := z1.Insert(rr); err != nil {
-					log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
-					Err = err
-					continue Transfer
-				}
-			}
+		switch {
+		case soa != nil && len(rrs) == 1 && less(soa.Serial, rrs[0].(*dns.SOA).Serial):
+			// RFC 1995, section 2: the changes don't fit in the response, they need a full transfer.
+			err = fmt.Errorf("incremental transfer of `%s' from %q has only the SOA record of the newer serial %d", z.origin, tr, rrs[0].(*dns.SOA).Serial)
+		case soa != nil && len(rrs) == 1:
+			log.Infof("Transferred: %s from %s, no changes", z.origin, tr)
+		case soa != nil && incremental:
+			err = z.transferIncremental(tr, soa, rrs)
+		default:
+			err = z.transferFull(tr, rrs)
 		}
-		Err = nil
-		break
 	}
-	if Err != nil {
-		return Err
+	if err != nil {
+		TransferCount.WithLabelValues(z.origin, qtype, "failure").Inc()
+		return err
+	}
+	TransferCount.WithLabelValues(z.origin, qtype, "success").Inc()
+
+	if len(rrs) == 1 {
+		z.touchBackup()
+	} else {
+		z.writeBackup()
+	}
+	z.setRefreshed(time.Now())
+	if len(rrs) > 1 && z.OnTransfer != nil {
+		z.OnTransfer()
+	}
+	return nil
+}
+
+// receive returns the records of the transfer m from the primary tr.
+func (z *Zone) receive(t *dns.Transfer, m *dns.Msg, tr string) ([]dns.RR, error) {
+	c, err := t.In(m, tr)
+	if err != nil {
+		log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
+		return nil, err
+	}
+	var rrs []dns.RR
+	for env := range c {
+		if env.Error != nil {
+			log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, env.Error)
+			return nil, env.Error
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("empty transfer of `%s' from %q", z.origin, tr)
+	}
+	if _, ok := rrs[0].(*dns.SOA); !ok {
+		return nil, fmt.Errorf("transfer of `%s' from %q doesn't start with a SOA record", z.origin, tr)
+	}
+	return rrs, nil
+}
+
+// transferFull replaces the records of the zone with the full transfer rrs.
+func (z *Zone) transferFull(tr string, rrs []dns.RR) error {
+
+	z1 := z.CopyWithoutApex()
+	for _, rr := range rrs {
+		if err := z1.Insert(rr); err != nil {
+			log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
+			return err
+		}
 	}
+	d, size := z.difference(z1)
 
 	z.Lock()
+	z.keepHistory(d, size)
 	z.Tree = z1.Tree
 	z.Apex = z1.Apex
-	z.Expired = false
 	z.Unlock()
 	log.Infof("Transferred: %s from %s", z.origin, tr)
 	return nil
 }
 
+// transferIncremental applies the incremental transfer rrs, from the version of the zone with soa, to the zone.
+func (z *Zone) transferIncremental(tr string, soa *dns.SOA, rrs []dns.RR) error {
+	last := rrs[0].(*dns.SOA)
+	diffs, err := toDiffs(rrs[1 : len(rrs)-1])
+	if err != nil {
+		return fmt.Errorf("incremental transfer of `%s' from %q %s", z.origin, tr, err)
+	}
+
+	// The new version of the zone is made without holding the lock, see ApplyUpdate.
+	z.RLock()
+	t, apex := z.Tree, z.Apex
+	z.RUnlock()
+	if apex.SOA != soa {
+		return fmt.Errorf("zone `%s' changed during the transfer from %q", z.origin, tr)
+	}
+	u := newUpdateOf(z, t, apex)
+	for _, d := range diffs {
+		if err := u.applyDiff(d); err != nil {
+			return fmt.Errorf("incremental transfer of `%s' from %q %s", z.origin, tr, err)
+		}
+	}
+	if u.z.Apex.SOA.Serial != last.Serial {
+		return fmt.Errorf("incremental transfer of `%s' from %q ends at %d SOA serial, not %d", z.origin, tr, u.z.Apex.SOA.Serial, last.Serial)
+	}
+
+	z.Lock()
+	defer z.Unlock()
+	if z.Tree != t || z.Apex.SOA != soa {
+		return fmt.Errorf("zone `%s' changed during the transfer from %q", z.origin, tr)
+	}
+	z.Tree = u.z.Tree
+	z.Apex = u.z.Apex
+	for _, d := range diffs {
+		z.addHistory(d, 0)
+	}
+	log.Infof("Transferred: %s from %s, %d incremental changes", z.origin, tr, len(diffs))
+	return nil
+}
+
 // shouldTransfer checks the primaries of zone, retrieves the SOA record, checks the current serial
 // and the remote serial and will return true if the remote one is higher than the locally configured one.
 func (z *Zone) shouldTransfer() (bool, error) {
@@ -67,6 +203,7 @@ func (z *Zone) shouldTransfer() (bool, error) {
 	c.Net = "tcp" // do this query over TCP to minimize spoofing
 	m := new(dns.Msg)
 	m.SetQuestion(z.origin, dns.TypeSOA)
+	c.TsigSecret = z.TransferKey.sign(m)
 
 	var Err error
 	serial := -1
@@ -89,10 +226,51 @@ Transfer:
 	if serial == -1 {
 		return false, Err
 	}
-	if z.Apex.SOA == nil {
+	z.RLock()
+	soa := z.Apex.SOA
+	z.RUnlock()
+	if soa == nil {
 		return true, Err
 	}
-	return less(z.Apex.SOA.Serial, uint32(serial)), Err
+	if !less(soa.Serial, uint32(serial)) {
+		// The zone is current, which counts as a refresh.
+		z.setRefreshed(time.Now())
+		z.touchBackup()
+		return false, Err
+	}
+	return true, Err
+}
+
+// setRefreshed records that the zone was current with a primary at t, and no longer expired.
+func (z *Zone) setRefreshed(t time.Time) {
+	z.Lock()
+	z.refreshed = t
+	z.Expired = false
+	soa := z.Apex.SOA
+	z.Unlock()
+
+	RefreshTime.WithLabelValues(z.origin).Set(float64(t.Unix()))
+	ExpiredGauge.WithLabelValues(z.origin).Set(0)
+	if soa != nil {
+		SerialGauge.WithLabelValues(z.origin).Set(float64(soa.Serial))
+	}
+}
+
+// checkExpired marks the zone expired when it wasn't refreshed for the SOA expire time.
+func (z *Zone) checkExpired() {
+	z.Lock()
+	defer z.Unlock()
+	if z.Apex.SOA == nil || z.refreshed.IsZero() {
+		return
+	}
+	if time.Since(z.refreshed) < time.Duration(z.Apex.SOA.Expire)*time.Second {
+		return
+	}
+	if !z.Expired {
+		log.Warningf("Zone `%s' expired, it wasn't refreshed since %s", z.origin, z.refreshed.Format(time.RFC3339))
+	}
+	z.Expired = true
+	ExpiredGauge.WithLabelValues(z.origin).Set(1)
 }
 
 // less returns true of a is smaller than b when taking RFC 1982 serial arithmetic into account.
@@ -107,10 +285,17 @@ func less(a, b uint32) bool {
 // and uses the SOA parameters. Every refresh it will check for a new SOA number. If that fails (for all
 // server) it will retry every retry interval. If the zone failed to transfer before the expire, the zone
 // will be marked expired.
-func (z *Zone) Update() error {
+func (z *Zone) Update() error { return z.UpdateUntil(nil) }
+
+// UpdateUntil updates the secondary zone, see Update, until stop is closed.
+func (z *Zone) UpdateUntil(stop <-chan struct{}) error {
 	// If we don't have a SOA, we don't have a zone, wait for it to appear.
 	for z.Apex.SOA == nil {
-		time.Sleep(1 * time.Second)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-stop:
+			return nil
+		}
 	}
 	retryActive := false
 
@@ -125,11 +310,17 @@ Restart:
 
 	for {
 		select {
+		case <-stop:
+			refreshTicker.Stop()
+			retryTicker.Stop()
+			expireTicker.Stop()
+			return nil
+
 		case <-expireTicker.C:
 			if !retryActive {
 				break
 			}
-			z.Expired = true
+			z.checkExpired()
 
 		case <-retryTicker.C:
 			if !retryActive {
@@ -141,6 +332,7 @@ Restart:
 			ok, err := z.shouldTransfer()
 			if err != nil {
 				log.Warningf("Failed retry check %s", err)
+				z.checkExpired()
 				continue
 			}
 
@@ -165,6 +357,7 @@ Restart:
 			ok, err := z.shouldTransfer()
 			if err != nil {
 				log.Warningf("Failed refresh check %s", err)
+				z.checkExpired()
 				retryActive = true
 				continue
 			}
@@ -2,7 +2,10 @@ package file
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
@@ -121,6 +124,103 @@ func TestTransferIn(t *testing.T) {
 	}
 }
 
+func TestTransferInTSIG(t *testing.T) {
+	const key, secret = "transfer.", "c2VjcmV0"
+	primary := parseIxfr(t, dbIxfrV1)
+	handler := primaryHandler(t, primary, new(uint16))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	started := make(chan struct{})
+	s := &dns.Server{
+		Listener:          l,
+		TsigSecret:        map[string]string{key: secret},
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			if req.IsTsig() == nil || w.TsigStatus() != nil {
+				m := new(dns.Msg)
+				m.SetRcode(req, dns.RcodeRefused)
+				w.WriteMsg(m)
+				return
+			}
+			handler(w, req)
+		}),
+	}
+	go s.ActivateAndServe()
+	defer s.Shutdown()
+	<-started
+
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{l.Addr().String()}
+	if err := z.TransferIn(); err == nil {
+		t.Fatal("Expected an error for an unsigned transfer")
+	}
+
+	z.TransferKey = &TransferKey{Name: key, Secret: secret, Algorithm: dns.HmacSHA256}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error for a signed transfer, got %q", err)
+	}
+	if z.Apex.SOA == nil || z.Apex.SOA.Serial != 1 {
+		t.Errorf("Expected SOA serial 1, got %v", z.Apex.SOA)
+	}
+}
+
+func TestTransferInFailover(t *testing.T) {
+	primary := parseIxfr(t, dbIxfrV1)
+	s := dnstest.NewServer(primaryHandler(t, primary, new(uint16)))
+	defer s.Close()
+
+	// Nothing listens on the discard port.
+	z := NewZone(ixfrZone, "stdin")
+	z.TransferFrom = []string{"127.0.0.1:9", s.Addr}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring zone in, got %q", err)
+	}
+	if z.primary != 1 {
+		t.Errorf("Expected the second primary to be tried first, got %d", z.primary)
+	}
+
+	z.Lock()
+	z.refreshed = time.Now().Add(-time.Duration(z.Apex.SOA.Expire+1) * time.Second)
+	z.Unlock()
+	z.TransferFrom = []string{"127.0.0.1:9"}
+	z.primary = 0
+	if err := z.TransferIn(); err == nil {
+		t.Fatal("Expected an error when no primary can be reached")
+	}
+	if !z.Expired {
+		t.Error("Expected the zone to be expired")
+	}
+	if _, err := z.Transfer(0); err == nil {
+		t.Error("Expected an error when transferring an expired zone")
+	}
+}
+
+func TestUpdateUntilExpired(t *testing.T) {
+	// Refresh every second, with nothing listening on the discard port.
+	z := parseIxfr(t, strings.Replace(dbIxfrV1, " 7200 3600 ", " 1 1 ", 1))
+	z.TransferFrom = []string{"127.0.0.1:9"}
+	z.refreshed = time.Now().Add(-time.Duration(z.Apex.SOA.Expire+1) * time.Second)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go z.UpdateUntil(stop)
+
+	// The failed refresh check expires the zone, before the expire ticker fires.
+	for i := 0; i < 100; i++ {
+		z.RLock()
+		expired := z.Expired
+		z.RUnlock()
+		if expired {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("Expected the zone to be expired after a failed refresh check")
+}
+
 func TestIsNotify(t *testing.T) {
 	z := new(Zone)
 	z.origin = testZone
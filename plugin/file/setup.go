@@ -2,8 +2,10 @@ package file
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -11,6 +13,8 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("file", setup) }
@@ -22,6 +26,11 @@ func setup(c *caddy.Controller) error {
 	}
 
 	f := File{Zones: zones}
+	for _, z := range zones.Z {
+		if z.Updates != nil {
+			dnsserver.GetConfig(c).Updates = true
+		}
+	}
 	// get the transfer plugin, so we can send notifies and send notifies on startup as well.
 	c.OnStartup(func() error {
 		t := dnsserver.GetConfig(c).Handler("transfer")
@@ -76,6 +85,10 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 	var openErr error
 	reload := 1 * time.Minute
 
+	// The catalog zones, and their member zones.
+	catalogs := map[string][]string{}
+	catalogNames := []string{}
+
 	for c.Next() {
 		// file db.file [zones...]
 		if !c.NextArg() {
@@ -115,8 +128,46 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			return Zones{}, err
 		}
 
+		var updates *Updates
 		for c.NextBlock() {
 			switch c.Val() {
+			case "update":
+				if updates == nil {
+					updates = &Updates{Journal: fileName + ".jnl", Writeback: 15 * time.Minute}
+				}
+				for _, k := range c.RemainingArgs() {
+					updates.Keys = append(updates.Keys, dns.Fqdn(strings.ToLower(k)))
+				}
+			case "journal":
+				if updates == nil {
+					return Zones{}, c.Err("journal needs update")
+				}
+				if !c.NextArg() {
+					return Zones{}, c.ArgErr()
+				}
+				updates.Journal = c.Val()
+				if !filepath.IsAbs(updates.Journal) && config.Root != "" {
+					updates.Journal = filepath.Join(config.Root, updates.Journal)
+				}
+				if c.NextArg() {
+					return Zones{}, c.ArgErr()
+				}
+			case "writeback":
+				if updates == nil {
+					return Zones{}, c.Err("writeback needs update")
+				}
+				t := c.RemainingArgs()
+				if len(t) != 1 {
+					return Zones{}, c.ArgErr()
+				}
+				d, err := time.ParseDuration(t[0])
+				if err != nil {
+					return Zones{}, plugin.Error("file", err)
+				}
+				if d < 0 {
+					return Zones{}, c.Errf("invalid writeback duration '%s'", t[0])
+				}
+				updates.Writeback = d
 			case "reload":
 				t := c.RemainingArgs()
 				if len(t) < 1 {
@@ -127,6 +178,18 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 					return Zones{}, plugin.Error("file", err)
 				}
 				reload = d
+			case "catalog":
+				if !c.NextArg() {
+					return Zones{}, c.ArgErr()
+				}
+				name := dns.Fqdn(strings.ToLower(c.Val()))
+				if c.NextArg() {
+					return Zones{}, c.ArgErr()
+				}
+				if _, ok := catalogs[name]; !ok {
+					catalogNames = append(catalogNames, name)
+				}
+				catalogs[name] = append(catalogs[name], origins...)
 			case "upstream":
 				// remove soon
 				c.RemainingArgs()
@@ -136,9 +199,17 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			}
 		}
 
+		if updates != nil && len(origins) > 1 {
+			return Zones{}, c.Errf("update needs a file per zone, %q has %d zones", fileName, len(origins))
+		}
+
 		for i := range origins {
 			z[origins[i]].ReloadInterval = reload
 			z[origins[i]].Upstream = upstream.New()
+			z[origins[i]].Updates = updates
+			if err := z[origins[i]].Replay(); err != nil {
+				return Zones{}, plugin.Error("file", err)
+			}
 		}
 	}
 
@@ -149,5 +220,14 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 		}
 		log.Warningf("Failed to open %q: trying again in %s", openErr, reload)
 	}
+	for _, name := range catalogNames {
+		if _, ok := z[name]; ok {
+			return Zones{}, plugin.Error("file", fmt.Errorf("catalog zone %q is also a zone in a file", name))
+		}
+		z[name] = NewZone(name, "")
+		z[name].SetCatalog(catalogs[name])
+		names = append(names, name)
+	}
+
 	return Zones{Z: z, Names: names}, nil
 }
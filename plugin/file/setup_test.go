@@ -1,10 +1,13 @@
 package file
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin/test"
 )
 
@@ -122,3 +125,145 @@ func TestParseReload(t *testing.T) {
 		}
 	}
 }
+
+func TestParseUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		updates   *Updates
+	}{
+		{`file ` + name + ` miek.nl.`, false, nil},
+		{
+			`file ` + name + ` miek.nl. {
+				update
+			}`,
+			false,
+			&Updates{Journal: name + ".jnl", Writeback: 15 * time.Minute},
+		},
+		{
+			`file ` + name + ` miek.nl. {
+				update dhcp.key. Cert-Manager
+				journal /tmp/miek.nl.jnl
+				writeback 0
+			}`,
+			false,
+			&Updates{Keys: []string{"dhcp.key.", "cert-manager."}, Journal: "/tmp/miek.nl.jnl"},
+		},
+		// errors.
+		{
+			`file ` + name + ` miek.nl. {
+				journal /tmp/miek.nl.jnl
+				update
+			}`,
+			true,
+			nil,
+		},
+		{
+			`file ` + name + ` miek.nl. {
+				update
+				writeback -1m
+			}`,
+			true,
+			nil,
+		},
+		{
+			`file ` + name + ` miek.nl. example.org. {
+				update
+			}`,
+			true,
+			nil,
+		},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		z, err := fileParse(c)
+		if err == nil && tc.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		} else if err != nil && !tc.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		u := z.Z["miek.nl."].Updates
+		if !reflect.DeepEqual(u, tc.updates) {
+			t.Errorf("Test %d expected updates %+v, got %+v", i, tc.updates, u)
+		}
+
+		// The server only accepts updates if a zone handles them.
+		c = caddy.NewTestController("dns", tc.input)
+		if err := setup(c); err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if dnsserver.GetConfig(c).Updates != (tc.updates != nil) {
+			t.Errorf("Test %d expected updates in the config to be %t", i, tc.updates != nil)
+		}
+	}
+}
+
+func TestParseCatalog(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		members   []string
+	}{
+		{`file ` + name + ` miek.nl. example.org. {
+			catalog Catalog.Invalid
+		}`, false, []string{"example.org.", "miek.nl."}},
+		{`file ` + name + ` miek.nl. {
+			catalog catalog.invalid
+		}
+		file ` + name + ` example.org. {
+			catalog catalog.invalid
+		}`, false, []string{"example.org.", "miek.nl."}},
+		// errors.
+		{`file ` + name + ` miek.nl. {
+			catalog
+		}`, true, nil},
+		{`file ` + name + ` miek.nl. catalog.invalid. {
+			catalog catalog.invalid
+		}`, true, nil},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		z, err := fileParse(c)
+		if err == nil && tc.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		} else if err != nil && !tc.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		cz, ok := z.Z["catalog.invalid."]
+		if !ok {
+			t.Fatalf("Test %d expected a catalog zone", i)
+		}
+		members, err := cz.Members()
+		if err != nil {
+			t.Fatalf("Test %d expected no error reading the catalog, got %q", i, err)
+		}
+		var names []string
+		for m := range members {
+			names = append(names, m)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.members) {
+			t.Errorf("Test %d expected members %v, got %v", i, tc.members, names)
+		}
+	}
+}
@@ -5,5 +5,9 @@ func (z *Zone) OnShutdown() error {
 	if 0 < z.ReloadInterval {
 		z.reloadShutdown <- true
 	}
+	if z.Updates != nil && 0 < z.Updates.Writeback {
+		z.writebackShutdown <- true
+		return z.Writeback()
+	}
 	return nil
 }
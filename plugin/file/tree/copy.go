@@ -0,0 +1,27 @@
+package tree
+
+import "github.com/miekg/dns"
+
+// Copy returns a copy of t. The copy shares the RRs with t, but not the nodes and elements, so it can be changed
+// without affecting t.
+func (t *Tree) Copy() *Tree {
+	return &Tree{Root: t.Root.copy(), Count: t.Count}
+}
+
+func (n *Node) copy() *Node {
+	if n == nil {
+		return nil
+	}
+	return &Node{Elem: n.Elem.copy(), Left: n.Left.copy(), Right: n.Right.copy(), Color: n.Color}
+}
+
+func (e *Elem) copy() *Elem {
+	if e == nil {
+		return nil
+	}
+	m := make(map[uint16][]dns.RR, len(e.m))
+	for t, rrs := range e.m {
+		m[t] = append([]dns.RR(nil), rrs...)
+	}
+	return &Elem{m: m, name: e.name}
+}
@@ -0,0 +1,38 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCopy(t *testing.T) {
+	t1 := &Tree{}
+	for _, s := range []string{"a.example.org. 3600 IN A 127.0.0.1", "b.example.org. 3600 IN A 127.0.0.2", "c.example.org. 3600 IN A 127.0.0.3"} {
+		rr, _ := dns.NewRR(s)
+		t1.Insert(rr)
+	}
+
+	t2 := t1.Copy()
+	rr, _ := dns.NewRR("b.example.org. 3600 IN A 127.0.0.2")
+	t2.Delete(rr)
+	rr, _ = dns.NewRR("a.example.org. 3600 IN A 127.0.0.4")
+	t2.Insert(rr)
+
+	if t1.Len() != 3 {
+		t.Errorf("expected 3 elements in the original tree, got %d", t1.Len())
+	}
+	if e, _ := t1.Search("b.example.org."); e == nil {
+		t.Errorf("expected b.example.org. in the original tree")
+	}
+	if e, _ := t1.Search("a.example.org."); e == nil || len(e.Type(dns.TypeA)) != 1 {
+		t.Errorf("expected 1 A record for a.example.org. in the original tree")
+	}
+
+	if t2.Len() != 2 {
+		t.Errorf("expected 2 elements in the copy, got %d", t2.Len())
+	}
+	if e, _ := t2.Search("a.example.org."); e == nil || len(e.Type(dns.TypeA)) != 2 {
+		t.Errorf("expected 2 A records for a.example.org. in the copy")
+	}
+}
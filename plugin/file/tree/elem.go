@@ -10,7 +10,7 @@ type Elem struct {
 
 // newElem returns a new elem.
 func newElem(rr dns.RR) *Elem {
-	e := Elem{m: make(map[uint16][]dns.RR)}
+	e := Elem{m: make(map[uint16][]dns.RR), name: rr.Header().Name}
 	e.m[rr.Header().Rrtype] = []dns.RR{rr}
 	return &e
 }
@@ -0,0 +1,458 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Updates holds the configuration for dynamic updates (RFC 2136) of a zone.
+type Updates struct {
+	Keys      []string      // Names of the TSIG keys that may update the zone, any key if empty.
+	Journal   string        // Path of the journal that records the updates.
+	Writeback time.Duration // Interval for writing the zone back to its file, zero to never write it back.
+}
+
+// allowed returns true if the zone may be updated with the TSIG key name.
+func (u *Updates) allowed(name string) bool {
+	if len(u.Keys) == 0 {
+		return true
+	}
+	for _, k := range u.Keys {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyUpdate applies the dynamic update (RFC 2136) in state to z and returns the rcode for the response. The
+// update must be signed with one of the TSIG keys of z.Updates, and validated by the tsig plugin. The update is
+// applied atomically: either all changes are made, or none. The changes are recorded in the journal before they
+// are visible.
+func (z *Zone) ApplyUpdate(ctx context.Context, state request.Request) int {
+	if z.Updates == nil {
+		return dns.RcodeRefused
+	}
+	key, ok := tsig.KeyName(ctx)
+	if !ok || !z.Updates.allowed(key) {
+		log.Warningf("Refusing update of %s from %s: not signed with an allowed TSIG key", z.origin, state.IP())
+		return dns.RcodeRefused
+	}
+
+	r := state.Req
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA || r.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeFormatError
+	}
+	if !strings.EqualFold(r.Question[0].Name, z.origin) {
+		return dns.RcodeNotAuth
+	}
+
+	// Updates are made one at a time. The new version of the zone is made without holding the lock of the zone,
+	// so lookups go on meanwhile, and it replaces the current version if that didn't change in the meantime.
+	z.updating.Lock()
+	defer z.updating.Unlock()
+	for {
+		z.RLock()
+		t, apex := z.Tree, z.Apex
+		z.RUnlock()
+
+		if apex.SOA == nil {
+			return dns.RcodeServerFailure
+		}
+		if len(apex.SIGSOA) > 0 {
+			log.Warningf("Refusing update of %s from %s: the zone is signed", z.origin, state.IP())
+			return dns.RcodeRefused
+		}
+
+		u := newUpdateOf(z, t, apex)
+		if rcode := u.prerequisites(r.Answer); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		if rcode := u.prescan(r.Ns); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		for _, rr := range r.Ns {
+			u.apply(rr)
+		}
+
+		if len(u.del) == 0 && len(u.add) == 0 && !u.soa {
+			return dns.RcodeSuccess
+		}
+		if !u.soa {
+			soa := dns.Copy(apex.SOA).(*dns.SOA)
+			soa.Serial++
+			u.z.Apex.SOA = soa
+		}
+
+		d := diff{from: apex.SOA, to: u.z.Apex.SOA, del: u.del, add: u.add}
+		rcode, ok := z.commit(u, t, d)
+		if !ok {
+			// The zone was reloaded or transferred, apply the update to the new version.
+			continue
+		}
+		if rcode != dns.RcodeSuccess {
+			return rcode
+		}
+
+		log.Infof("Updated zone %q by %s with key %q: %d deleted, %d added, %d SOA serial", z.origin, state.IP(), key, len(d.del), len(d.add), d.to.Serial)
+		if t := z.transfer; t != nil {
+			go func() {
+				if err := t.Notify(z.origin); err != nil {
+					log.Warningf("Failed sending notifies: %s", err)
+				}
+			}()
+		}
+		return dns.RcodeSuccess
+	}
+}
+
+// commit records d in the journal, and makes the zone of u the current version of z. It returns false if the
+// current version of z isn't the one with tree t anymore.
+func (z *Zone) commit(u *update, t *tree.Tree, d diff) (int, bool) {
+	z.Lock()
+	defer z.Unlock()
+	if z.Tree != t || z.Apex.SOA != d.from {
+		return 0, false
+	}
+
+	if err := appendJournal(z.Updates.Journal, d); err != nil {
+		log.Errorf("Failed to write update of %s to journal %q: %s", z.origin, z.Updates.Journal, err)
+		return dns.RcodeServerFailure, true
+	}
+
+	z.Apex = u.z.Apex
+	z.Tree = u.z.Tree
+	z.dirty = true
+	z.addHistory(d, 0)
+	return dns.RcodeSuccess, true
+}
+
+// update applies changes to a copy of a zone, so they can be made visible at once, and records the deleted and
+// added records.
+type update struct {
+	z        *Zone
+	del, add []dns.RR
+	soa      bool // the SOA was replaced by the update
+}
+
+// newUpdate returns an update of z, the caller must hold the lock of z.
+func newUpdate(z *Zone) *update { return newUpdateOf(z, z.Tree, z.Apex) }
+
+// newUpdateOf returns an update of the version of z with tree t and apex. A tree isn't changed once it's part of
+// a zone, a new version replaces it, so it can be copied without holding the lock of z.
+func newUpdateOf(z *Zone, t *tree.Tree, apex Apex) *update {
+	c := &Zone{origin: z.origin, origLen: z.origLen, Tree: t.Copy(), Apex: apex}
+	c.Apex.NS = append([]dns.RR(nil), apex.NS...)
+	return &update{z: c}
+}
+
+// applyDiff applies d, which must start at the serial of the zone, to the zone.
+func (u *update) applyDiff(d diff) error {
+	if d.from.Serial != u.z.Apex.SOA.Serial {
+		return fmt.Errorf("has a gap after %d SOA serial", u.z.Apex.SOA.Serial)
+	}
+	for _, rr := range d.del {
+		for _, r := range u.rrset(strings.ToLower(rr.Header().Name), rr.Header().Rrtype) {
+			if dns.IsDuplicate(r, rr) {
+				u.remove(r)
+			}
+		}
+	}
+	for _, rr := range d.add {
+		u.insert(rr)
+	}
+	u.z.Insert(d.to)
+	return nil
+}
+
+// prerequisites checks the prerequisites (RFC 2136, Section 3.2) against the zone.
+func (u *update) prerequisites(rrs []dns.RR) int {
+	values := map[string]map[uint16][]dns.RR{}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		name := strings.ToLower(hdr.Name)
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(u.z.origin, name) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if !empty(rr) {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(u.types(name)) == 0 {
+					return dns.RcodeNameError
+				}
+			} else if len(u.rrset(name, hdr.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if !empty(rr) {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(u.types(name)) > 0 {
+					return dns.RcodeYXDomain
+				}
+			} else if len(u.rrset(name, hdr.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			if empty(rr) {
+				return dns.RcodeFormatError
+			}
+			if values[name] == nil {
+				values[name] = map[uint16][]dns.RR{}
+			}
+			if !contains(values[name][hdr.Rrtype], rr) {
+				values[name][hdr.Rrtype] = append(values[name][hdr.Rrtype], rr)
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for name, sets := range values {
+		for t, set := range sets {
+			if !equalSets(u.rrset(name, t), set) {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescan checks the updates (RFC 2136, Section 3.4.1) before any of them is applied.
+func (u *update) prescan(rrs []dns.RR) int {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(u.z.origin, strings.ToLower(hdr.Name)) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Rrtype {
+		case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+			return dns.RcodeFormatError
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			return dns.RcodeRefused
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			if hdr.Rrtype == dns.TypeANY || empty(rr) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || !empty(rr) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || hdr.Rrtype == dns.TypeANY || empty(rr) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply applies a single update (RFC 2136, Section 3.4.2) to the zone. Updates that conflict with the zone's
+// data, such as a CNAME for a name that has other records, are silently ignored.
+func (u *update) apply(rr dns.RR) {
+	hdr := rr.Header()
+	hdr.Name = strings.ToLower(hdr.Name)
+	name, t := hdr.Name, hdr.Rrtype
+	apex := name == u.z.origin
+
+	switch hdr.Class {
+	case dns.ClassINET:
+		if t == dns.TypeCNAME {
+			for _, t1 := range u.types(name) {
+				if t1 != dns.TypeCNAME {
+					return
+				}
+			}
+		} else if len(u.rrset(name, dns.TypeCNAME)) > 0 {
+			return
+		}
+
+		switch t {
+		case dns.TypeSOA:
+			soa := rr.(*dns.SOA)
+			if !apex || !less(u.z.Apex.SOA.Serial, soa.Serial) {
+				return
+			}
+			u.z.Insert(soa)
+			u.soa = true
+			return
+		case dns.TypeCNAME:
+			u.deleteRRset(name, t)
+		default:
+			for _, r := range u.rrset(name, t) {
+				if !dns.IsDuplicate(r, rr) {
+					continue
+				}
+				if r.Header().Ttl == hdr.Ttl {
+					return
+				}
+				u.remove(r)
+			}
+		}
+		u.insert(rr)
+
+	case dns.ClassANY:
+		if t == dns.TypeANY {
+			for _, t1 := range u.types(name) {
+				if apex && (t1 == dns.TypeSOA || t1 == dns.TypeNS) {
+					continue
+				}
+				u.deleteRRset(name, t1)
+			}
+			return
+		}
+		if apex && (t == dns.TypeSOA || t == dns.TypeNS) {
+			return
+		}
+		u.deleteRRset(name, t)
+
+	case dns.ClassNONE:
+		if t == dns.TypeSOA {
+			return
+		}
+		rr = dns.Copy(rr)
+		rr.Header().Class = dns.ClassINET
+		if apex && t == dns.TypeNS {
+			if ns := u.rrset(name, t); len(ns) == 1 && dns.IsDuplicate(ns[0], rr) {
+				return
+			}
+		}
+		for _, r := range u.rrset(name, t) {
+			if dns.IsDuplicate(r, rr) {
+				u.remove(r)
+			}
+		}
+	}
+}
+
+// rrset returns the records with name and type t.
+func (u *update) rrset(name string, t uint16) []dns.RR {
+	if name == u.z.origin {
+		switch t {
+		case dns.TypeSOA:
+			return []dns.RR{u.z.Apex.SOA}
+		case dns.TypeNS:
+			return u.z.Apex.NS
+		}
+	}
+	e, ok := u.z.Tree.Search(name)
+	if !ok {
+		return nil
+	}
+	return e.Type(t)
+}
+
+// types returns the types of the records with name.
+func (u *update) types(name string) []uint16 {
+	var types []uint16
+	if name == u.z.origin {
+		types = append(types, dns.TypeSOA)
+		if len(u.z.Apex.NS) > 0 {
+			types = append(types, dns.TypeNS)
+		}
+	}
+	if e, ok := u.z.Tree.Search(name); ok {
+		types = append(types, e.Types()...)
+	}
+	return types
+}
+
+// insert adds rr to the zone.
+func (u *update) insert(rr dns.RR) {
+	u.z.Insert(rr)
+	for i, r := range u.del {
+		if dns.IsDuplicate(r, rr) && r.Header().Ttl == rr.Header().Ttl {
+			u.del = append(u.del[:i], u.del[i+1:]...)
+			return
+		}
+	}
+	u.add = append(u.add, rr)
+}
+
+// remove removes rr, which must be a record of the zone, from the zone.
+func (u *update) remove(rr dns.RR) {
+	hdr := rr.Header()
+	var keep []dns.RR
+	for _, r := range u.rrset(hdr.Name, hdr.Rrtype) {
+		if r != rr {
+			keep = append(keep, r)
+		}
+	}
+	u.set(hdr.Name, hdr.Rrtype, keep)
+
+	for i, r := range u.add {
+		if r == rr {
+			u.add = append(u.add[:i], u.add[i+1:]...)
+			return
+		}
+	}
+	u.del = append(u.del, rr)
+}
+
+// deleteRRset removes the records with name and type t from the zone.
+func (u *update) deleteRRset(name string, t uint16) {
+	for _, r := range u.rrset(name, t) {
+		u.remove(r)
+	}
+}
+
+// set replaces the records with name and type t with rrs.
+func (u *update) set(name string, t uint16, rrs []dns.RR) {
+	if name == u.z.origin && t == dns.TypeNS {
+		u.z.Apex.NS = rrs
+		return
+	}
+	u.z.Tree.Delete(&dns.RR_Header{Name: name, Rrtype: t})
+	for _, r := range rrs {
+		u.z.Tree.Insert(r)
+	}
+}
+
+// empty returns true if rr has no rdata, as the prerequisites and updates with class ANY. The rdata length is the
+// one from the wire.
+func empty(rr dns.RR) bool { return rr.Header().Rdlength == 0 }
+
+// equalSets returns true if a and b hold the same records, regardless of their TTLs.
+func equalSets(a, b []dns.RR) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		if !contains(b, x) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true if rrs holds rr, regardless of its TTL.
+func contains(rrs []dns.RR, rr dns.RR) bool {
+	for _, r := range rrs {
+		if dns.IsDuplicate(r, rr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/tsig"
+
+	"github.com/miekg/dns"
+)
+
+const dbUpdateExampleOrg = `$ORIGIN example.org.
+@	3600 IN	SOA sns.dns.icann.org. noc.dns.icann.org. 2017042745 7200 3600 1209600 3600
+	3600 IN NS a.iana-servers.net.
+	3600 IN NS b.iana-servers.net.
+
+www     IN A     127.0.0.1
+        IN A     127.0.0.2
+mail    IN A     127.0.0.3
+        IN TXT   "mail"
+alias   IN CNAME www
+`
+
+func newUpdateZone(t *testing.T, dir string) *Zone {
+	path := filepath.Join(dir, "db.example.org")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, []byte(dbUpdateExampleOrg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z, err := Parse(f, "example.org.", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.Updates = &Updates{Keys: []string{"update.key."}, Journal: path + ".jnl"}
+	if err := z.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+// sendUpdate sends the update m through the tsig plugin to a file plugin that serves z, and returns the rcode
+// of the response. If key is empty, m is not signed.
+func sendUpdate(t *testing.T, z *Zone, m *dns.Msg, key string) int {
+	if key != "" {
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	// Pack and unpack, so records without rdata have the types they have when received from the network.
+	buf, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = new(dns.Msg)
+	if err := m.Unpack(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	f := File{Zones: Zones{Z: map[string]*Zone{"example.org.": z}, Names: []string{"example.org."}}}
+	ts := tsig.TSIGServer{Zones: []string{"example.org."}, Next: f}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := ts.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Msg.Rcode
+}
+
+func lookup(t *testing.T, z *Zone, qname string, qtype uint16) []dns.RR {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	f := File{Zones: Zones{Z: map[string]*Zone{"example.org.": z}, Names: []string{"example.org."}}}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Msg.Answer
+}
+
+func TestUpdate(t *testing.T) {
+	rr := func(s string) dns.RR { return test.A(s) }
+	tests := []struct {
+		name    string
+		prereq  func(m *dns.Msg)
+		update  func(m *dns.Msg)
+		key     string
+		zone    string
+		rcode   int
+		serial  uint32
+		qname   string
+		qtype   uint16
+		answers int
+	}{
+		{
+			name:   "add",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("new.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "new.example.org.", qtype: dns.TypeA, answers: 1,
+		},
+		{
+			name:   "add existing",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 3600 IN A 127.0.0.1")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name:   "delete rrset",
+			update: func(m *dns.Msg) { m.RemoveRRset([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.1")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "www.example.org.", qtype: dns.TypeA, answers: 0,
+		},
+		{
+			name:   "delete record",
+			update: func(m *dns.Msg) { m.Remove([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.2")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "www.example.org.", qtype: dns.TypeA, answers: 1,
+		},
+		{
+			name:   "delete name",
+			update: func(m *dns.Msg) { m.RemoveName([]dns.RR{rr("mail.example.org. 0 IN A 127.0.0.3")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "mail.example.org.", qtype: dns.TypeTXT, answers: 0,
+		},
+		{
+			name:   "delete apex ns",
+			update: func(m *dns.Msg) { m.RemoveRRset([]dns.RR{test.NS("example.org. 0 IN NS a.iana-servers.net.")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042745, qname: "example.org.", qtype: dns.TypeNS, answers: 2,
+		},
+		{
+			name:   "cname for a name with data",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{test.CNAME("mail.example.org. 300 IN CNAME www.example.org.")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042745, qname: "mail.example.org.", qtype: dns.TypeCNAME, answers: 0,
+		},
+		{
+			name:   "name in use",
+			prereq: func(m *dns.Msg) { m.NameUsed([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.1")}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "www.example.org.", qtype: dns.TypeA, answers: 3,
+		},
+		{
+			name:   "name not in use",
+			prereq: func(m *dns.Msg) { m.NameUsed([]dns.RR{rr("nothere.example.org. 0 IN A 127.0.0.1")}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeNameError, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name:   "name in use, but shouldn't be",
+			prereq: func(m *dns.Msg) { m.NameNotUsed([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.1")}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeYXDomain, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name:   "rrset doesn't exist",
+			prereq: func(m *dns.Msg) { m.RRsetUsed([]dns.RR{test.TXT(`www.example.org. 0 IN TXT "x"`)}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeNXRrset, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name:   "rrset exists, but shouldn't",
+			prereq: func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.1")}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeYXRrset, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name: "rrset has the values",
+			prereq: func(m *dns.Msg) {
+				m.Used([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.2"), rr("www.example.org. 0 IN A 127.0.0.1")})
+			},
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeSuccess, serial: 2017042746, qname: "www.example.org.", qtype: dns.TypeA, answers: 3,
+		},
+		{
+			name:   "rrset has other values",
+			prereq: func(m *dns.Msg) { m.Used([]dns.RR{rr("www.example.org. 0 IN A 127.0.0.1")}) },
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeNXRrset, serial: 2017042745, qname: "www.example.org.", qtype: dns.TypeA, answers: 2,
+		},
+		{
+			name: "failure applies nothing",
+			update: func(m *dns.Msg) {
+				m.Insert([]dns.RR{rr("new.example.org. 300 IN A 127.0.0.9"), rr("www.example.net. 300 IN A 127.0.0.9")})
+			},
+			rcode: dns.RcodeNotZone, serial: 2017042745, qname: "new.example.org.", qtype: dns.TypeA, answers: 0,
+		},
+		{
+			name:   "not the zone's apex",
+			zone:   "www.example.org.",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("new.www.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeNotAuth, serial: 2017042745, qname: "new.www.example.org.", qtype: dns.TypeA, answers: 0,
+		},
+		{
+			name:   "not signed",
+			key:    "-",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("new.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeRefused, serial: 2017042745, qname: "new.example.org.", qtype: dns.TypeA, answers: 0,
+		},
+		{
+			name:   "other key",
+			key:    "other.key.",
+			update: func(m *dns.Msg) { m.Insert([]dns.RR{rr("new.example.org. 300 IN A 127.0.0.9")}) },
+			rcode:  dns.RcodeRefused, serial: 2017042745, qname: "new.example.org.", qtype: dns.TypeA, answers: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			z := newUpdateZone(t, t.TempDir())
+
+			zone := "example.org."
+			if tc.zone != "" {
+				zone = tc.zone
+			}
+			m := new(dns.Msg)
+			m.SetUpdate(zone)
+			if tc.prereq != nil {
+				tc.prereq(m)
+			}
+			tc.update(m)
+
+			key := "update.key."
+			switch tc.key {
+			case "-":
+				key = ""
+			case "":
+			default:
+				key = tc.key
+			}
+			if rcode := sendUpdate(t, z, m, key); rcode != tc.rcode {
+				t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+			}
+			if serial := z.Apex.SOA.Serial; serial != tc.serial {
+				t.Errorf("Expected serial %d, got %d", tc.serial, serial)
+			}
+			if answers := lookup(t, z, tc.qname, tc.qtype); len(answers) != tc.answers {
+				t.Errorf("Expected %d answers for %s, got %d: %v", tc.answers, tc.qname, len(answers), answers)
+			}
+		})
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	z := newUpdateZone(t, t.TempDir())
+
+	const n = 10
+	rcodes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		m := new(dns.Msg)
+		m.SetUpdate("example.org.")
+		m.Insert([]dns.RR{test.A("new" + strconv.Itoa(i) + ".example.org. 300 IN A 127.0.0.9")})
+		go func() { rcodes <- sendUpdate(t, z, m, "update.key.") }()
+	}
+	for i := 0; i < n; i++ {
+		if answers := lookup(t, z, "www.example.org.", dns.TypeA); len(answers) != 2 {
+			t.Errorf("Expected 2 answers for www.example.org. during the updates, got %v", answers)
+		}
+		if rcode := <-rcodes; rcode != dns.RcodeSuccess {
+			t.Errorf("Expected rcode NOERROR, got %s", dns.RcodeToString[rcode])
+		}
+	}
+
+	if serial := z.Apex.SOA.Serial; serial != 2017042745+n {
+		t.Errorf("Expected serial %d, got %d", 2017042745+n, serial)
+	}
+	for i := 0; i < n; i++ {
+		if answers := lookup(t, z, "new"+strconv.Itoa(i)+".example.org.", dns.TypeA); len(answers) != 1 {
+			t.Errorf("Expected an answer for new%d.example.org., got %v", i, answers)
+		}
+	}
+}
+
+func TestUpdateCommitChanged(t *testing.T) {
+	z := newUpdateZone(t, t.TempDir())
+	u := newUpdate(z)
+	u.insert(test.A("new.example.org. 300 IN A 127.0.0.9"))
+	d := diff{from: z.Apex.SOA, to: z.Apex.SOA, add: u.add}
+
+	// The zone is reloaded while the update is made.
+	old := z.Tree
+	z.Tree = newUpdate(z).z.Tree
+	if _, ok := z.commit(u, old, d); ok {
+		t.Fatal("Expected the update not to be committed to a changed zone")
+	}
+	if answers := lookup(t, z, "new.example.org.", dns.TypeA); len(answers) != 0 {
+		t.Errorf("Expected no answer for new.example.org., got %v", answers)
+	}
+	if _, ok := z.commit(u, z.Tree, d); !ok {
+		t.Fatal("Expected the update to be committed")
+	}
+	if answers := lookup(t, z, "new.example.org.", dns.TypeA); len(answers) != 1 {
+		t.Errorf("Expected an answer for new.example.org., got %v", answers)
+	}
+}
+
+func TestUpdateJournal(t *testing.T) {
+	dir := t.TempDir()
+	z := newUpdateZone(t, dir)
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 127.0.0.9")})
+	m.Remove([]dns.RR{test.A("www.example.org. 0 IN A 127.0.0.2")})
+	if rcode := sendUpdate(t, z, m, "update.key."); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected rcode NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	m = new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.RemoveRRset([]dns.RR{test.CNAME("alias.example.org. 0 IN CNAME www.example.org.")})
+	if rcode := sendUpdate(t, z, m, "update.key."); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected rcode NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	diffs, err := readJournal(z.Updates.Journal, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("Expected 2 updates in the journal, got %d", len(diffs))
+	}
+	if d := diffs[0]; d.from.Serial != 2017042745 || d.to.Serial != 2017042746 || len(d.del) != 1 || len(d.add) != 1 {
+		t.Errorf("Expected the first update to delete and add a record, got %v", d.rrs())
+	}
+
+	check := func(z *Zone) {
+		t.Helper()
+		if serial := z.Apex.SOA.Serial; serial != 2017042747 {
+			t.Errorf("Expected serial 2017042747, got %d", serial)
+		}
+		if answers := lookup(t, z, "new.example.org.", dns.TypeA); len(answers) != 1 {
+			t.Errorf("Expected an answer for new.example.org., got %v", answers)
+		}
+		if answers := lookup(t, z, "www.example.org.", dns.TypeA); len(answers) != 1 {
+			t.Errorf("Expected 1 answer for www.example.org., got %v", answers)
+		}
+		if answers := lookup(t, z, "alias.example.org.", dns.TypeCNAME); len(answers) != 0 {
+			t.Errorf("Expected no answer for alias.example.org., got %v", answers)
+		}
+	}
+
+	// A restart reads the unchanged zone file and replays the journal.
+	check(newUpdateZone(t, dir))
+
+	// After writing back the zone file has the updates, and the journal applies to no zone file version.
+	if err := z.Writeback(); err != nil {
+		t.Fatal(err)
+	}
+	if z.dirty {
+		t.Errorf("Expected zone not to be dirty after it was written back")
+	}
+	buf, err := os.ReadFile(z.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "2017042747") {
+		t.Errorf("Expected the zone file to have serial 2017042747, got\n%s", buf)
+	}
+	check(newUpdateZone(t, dir))
+	if _, err := os.Stat(z.Updates.Journal); err != nil {
+		t.Errorf("Expected the journal to be kept: %s", err)
+	}
+
+	// A changed zone file makes the journal useless.
+	if err := os.WriteFile(z.file, []byte(strings.Replace(dbUpdateExampleOrg, "2017042745", "2017042800", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	z = newUpdateZone(t, dir)
+	if serial := z.Apex.SOA.Serial; serial != 2017042800 {
+		t.Errorf("Expected serial 2017042800, got %d", serial)
+	}
+	if _, err := os.Stat(z.Updates.Journal); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed, got %v", err)
+	}
+}
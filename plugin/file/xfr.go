@@ -1,6 +1,8 @@
 package file
 
 import (
+	"fmt"
+
 	"github.com/coredns/coredns/plugin/file/tree"
 	"github.com/coredns/coredns/plugin/transfer"
 
@@ -16,14 +18,25 @@ func (f File) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	return z.Transfer(serial)
 }
 
-// Transfer transfers a zone with serial in the returned channel and implements IXFR fallback, by just
-// sending a single SOA record.
+// Transfer transfers a zone with serial in the returned channel. If serial is the zone's current serial, only the
+// SOA record is sent. If the history of the zone goes back to serial, an incremental transfer (RFC 1995) is sent,
+// otherwise all records are sent, as in a full transfer.
 func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
-	// get soa and apex
-	apex, err := z.ApexIfDefined()
-	if err != nil {
-		return nil, err
+	z.RLock()
+	if z.Apex.SOA == nil {
+		z.RUnlock()
+		return nil, fmt.Errorf("no SOA")
+	}
+	if z.Expired {
+		z.RUnlock()
+		return nil, fmt.Errorf("zone expired")
+	}
+	apex, t, nsec3 := z.apexRRs(), z.Tree, z.Apex.NSEC3
+	var diffs []diff
+	if serial != 0 {
+		diffs = z.incremental(serial)
 	}
+	z.RUnlock()
 
 	ch := make(chan []dns.RR)
 	go func() {
@@ -34,8 +47,22 @@ func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 			return
 		}
 
+		if len(diffs) > 0 {
+			ch <- []dns.RR{apex[0]}
+			for _, d := range diffs {
+				ch <- d.rrs()
+			}
+			ch <- []dns.RR{apex[0]}
+
+			close(ch)
+			return
+		}
+
 		ch <- apex
-		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
+		t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
+		if nsec3 != nil {
+			nsec3.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
+		}
 		ch <- []dns.RR{apex[0]}
 
 		close(ch)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/coredns/coredns/plugin/file/tree"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/transfer"
 
 	"github.com/miekg/dns"
 )
@@ -26,29 +27,46 @@ type Zone struct {
 
 	StartupOnce  sync.Once
 	TransferFrom []string
+	TransferKey  *TransferKey // TSIG key to sign the transfers with, nil if they aren't signed.
+	Backup       string       // File to keep a copy of a transferred zone in, empty if there is none.
+	refreshed    time.Time    // The last time the zone was known to be current with a primary.
+	primary      int          // Index in TransferFrom of the primary that was transferred from last.
+	OnTransfer   func()       // Called after an inbound transfer changed the zone, if not nil.
 
 	ReloadInterval time.Duration
 	reloadShutdown chan bool
 
 	Upstream *upstream.Upstream // Upstream for looking up external names during the resolution process.
+
+	Updates           *Updates   // Configuration for dynamic updates, nil if the zone can't be updated.
+	dirty             bool       // The zone was updated since it was last written to its file.
+	updating          sync.Mutex // Serializes the dynamic updates.
+	writebackShutdown chan bool
+
+	history []diff // The most recent changes of the zone, for incremental transfers.
+
+	transfer *transfer.Transfer
 }
 
-// Apex contains the apex records of a zone: SOA, NS and their potential signatures.
+// Apex contains the apex records of a zone: SOA, NS and their potential signatures. The NSEC3 chain of a
+// signed zone is kept here as well.
 type Apex struct {
 	SOA    *dns.SOA
 	NS     []dns.RR
 	SIGSOA []dns.RR
 	SIGNS  []dns.RR
+	NSEC3  *tree.Tree // NSEC3 records and their signatures, nil if the zone has none
 }
 
 // NewZone returns a new zone.
 func NewZone(name, file string) *Zone {
 	return &Zone{
-		origin:         dns.Fqdn(name),
-		origLen:        dns.CountLabel(dns.Fqdn(name)),
-		file:           filepath.Clean(file),
-		Tree:           &tree.Tree{},
-		reloadShutdown: make(chan bool),
+		origin:            dns.Fqdn(name),
+		origLen:           dns.CountLabel(dns.Fqdn(name)),
+		file:              filepath.Clean(file),
+		Tree:              &tree.Tree{},
+		reloadShutdown:    make(chan bool),
+		writebackShutdown: make(chan bool),
 	}
 }
 
@@ -89,11 +107,15 @@ func (z *Zone) Insert(r dns.RR) error {
 
 		z.Apex.SOA = r.(*dns.SOA)
 		return nil
-	case dns.TypeNSEC3, dns.TypeNSEC3PARAM:
-		return fmt.Errorf("NSEC3 zone is not supported, dropping RR: %s for zone: %s", r.Header().Name, z.origin)
+	case dns.TypeNSEC3:
+		z.insertNSEC3(r)
+		return nil
 	case dns.TypeRRSIG:
 		x := r.(*dns.RRSIG)
 		switch x.TypeCovered {
+		case dns.TypeNSEC3:
+			z.insertNSEC3(r)
+			return nil
 		case dns.TypeSOA:
 			z.Apex.SIGSOA = append(z.Apex.SIGSOA, x)
 			return nil
@@ -115,6 +137,14 @@ func (z *Zone) Insert(r dns.RR) error {
 	return nil
 }
 
+// insertNSEC3 inserts r into the NSEC3 chain of z.
+func (z *Zone) insertNSEC3(r dns.RR) {
+	if z.Apex.NSEC3 == nil {
+		z.Apex.NSEC3 = &tree.Tree{}
+	}
+	z.Apex.NSEC3.Insert(r)
+}
+
 // File retrieves the file path in a safe way.
 func (z *Zone) File() string {
 	z.RLock()
@@ -136,7 +166,11 @@ func (z *Zone) ApexIfDefined() ([]dns.RR, error) {
 	if z.Apex.SOA == nil {
 		return nil, fmt.Errorf("no SOA")
 	}
+	return z.apexRRs(), nil
+}
 
+// apexRRs returns the apex records of z, the SOA record, which must exist, is the first record.
+func (z *Zone) apexRRs() []dns.RR {
 	rrs := []dns.RR{z.Apex.SOA}
 
 	if len(z.Apex.SIGSOA) > 0 {
@@ -148,8 +182,7 @@ func (z *Zone) ApexIfDefined() ([]dns.RR, error) {
 	if len(z.Apex.SIGNS) > 0 {
 		rrs = append(rrs, z.Apex.SIGNS...)
 	}
-
-	return rrs, nil
+	return rrs
 }
 
 // NameFromRight returns the labels from the right, staring with the
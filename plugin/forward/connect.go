@@ -87,6 +87,7 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 
 	pc, cached, err := p.transport.Dial(proto)
 	if err != nil {
+		p.updateRtt(readTimeout)
 		return nil, err
 	}
 
@@ -114,13 +115,36 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 
 	var ret *dns.Msg
 	pc.c.SetReadDeadline(time.Now().Add(readTimeout))
+	// stop stops unblocking the read, it must have returned before the connection is given back.
+	stop := func() {}
+	if ctx.Done() != nil {
+		// Unblock the read below when the exchange is cancelled.
+		done, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				pc.c.SetReadDeadline(time.Now())
+			case <-done:
+			}
+		}()
+		stop = func() {
+			close(done)
+			<-stopped
+		}
+	}
 	for {
 		ret, err = pc.c.ReadMsg()
 		if err != nil {
+			stop()
 			pc.c.Close() // not giving it back
 			if err == io.EOF && cached {
 				return nil, ErrCachedClosed
 			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			p.updateRtt(readTimeout)
 			// recovery the origin Id after upstream.
 			if ret != nil {
 				ret.Id = originId
@@ -135,16 +159,24 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 	// recovery the origin Id after upstream.
 	ret.Id = originId
 
-	p.transport.Yield(pc)
+	stop()
+	if ctx.Err() != nil {
+		pc.c.Close() // the read deadline may have been set by the cancellation, not giving it back
+	} else {
+		p.transport.Yield(pc)
+	}
 
 	rc, ok := dns.RcodeToString[ret.Rcode]
 	if !ok {
 		rc = strconv.Itoa(ret.Rcode)
 	}
 
+	rtt := time.Since(start)
+	p.updateRtt(rtt)
+
 	RequestCount.WithLabelValues(p.addr).Add(1)
 	RcodeCount.WithLabelValues(rc, p.addr).Add(1)
-	RequestDuration.WithLabelValues(p.addr, rc).Observe(time.Since(start).Seconds())
+	RequestDuration.WithLabelValues(p.addr, rc).Observe(rtt.Seconds())
 
 	return ret, nil
 }
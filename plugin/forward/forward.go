@@ -42,6 +42,13 @@ type Forward struct {
 	maxfails      uint32
 	expire        time.Duration
 	maxConcurrent int64
+	hedgeDelay    time.Duration
+	hedgeMax      int
+
+	strictQuestion bool
+	bailiwick      bool
+	rebind         bool
+	rebindAllowed  []string
 
 	opts options // also here for testing
 
@@ -51,6 +58,10 @@ type Forward struct {
 
 	tapPlugins []*dnstap.Dnstap // when dnstap plugins are loaded, we use to this to send messages out.
 
+	groups       map[string]*Forward // upstream groups by name, selected through routes
+	groupConfigs map[string]*groupConfig
+	routes       *routes
+
 	Next plugin.Handler
 }
 
@@ -88,6 +99,20 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		}
 	}
 
+	if f.routes != nil {
+		if g := f.routes.Lookup(state.Name()); g != "" {
+			return f.groups[g].serve(ctx, w, state)
+		}
+	}
+	return f.serve(ctx, w, state)
+}
+
+// serve forwards the request in state to the upstreams of f and writes the reply to w.
+func (f *Forward) serve(ctx context.Context, w dns.ResponseWriter, state request.Request) (int, error) {
+	if f.hedgeMax > 1 {
+		return f.serveHedged(ctx, w, state)
+	}
+
 	fails := 0
 	var span, child ot.Span
 	var upstreamErr error
@@ -128,32 +153,12 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return proxy.addr
 		})
 
-		var (
-			ret *dns.Msg
-			err error
-		)
-		opts := f.opts
-		for {
-			ret, err = proxy.Connect(ctx, state, opts)
-			if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
-				continue
-			}
-			// Retry with TCP if truncated and prefer_udp configured.
-			if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
-				opts.forceTCP = true
-				continue
-			}
-			break
-		}
+		ret, err := f.exchange(ctx, proxy, state, start)
 
 		if child != nil {
 			child.Finish()
 		}
 
-		if len(f.tapPlugins) != 0 {
-			toDnstap(f, proxy.addr, state, opts, ret, start)
-		}
-
 		upstreamErr = err
 
 		if err != nil {
@@ -168,6 +173,17 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			break
 		}
 
+		// With strict_question a reply for a different question is discarded and the next upstream is tried.
+		if f.strictQuestion && !state.Match(ret) {
+			debug.Hexdumpf(ret, "Wrong reply for id: %d, %s %d", ret.Id, state.QName(), state.QType())
+			RejectedResponseCount.WithLabelValues(proxy.addr, "question").Add(1)
+			upstreamErr = ErrQuestionMismatch
+			if fails < len(f.proxies) {
+				continue
+			}
+			break
+		}
+
 		// Check if the reply is correct; if not return FormErr.
 		if !state.Match(ret) {
 			debug.Hexdumpf(ret, "Wrong reply for id: %d, %s %d", ret.Id, state.QName(), state.QType())
@@ -178,7 +194,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return 0, nil
 		}
 
-		w.WriteMsg(ret)
+		f.writeReply(w, proxy, state, ret)
 		return 0, nil
 	}
 
@@ -189,6 +205,33 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	return dns.RcodeServerFailure, ErrNoHealthy
 }
 
+// exchange sends the request in state to proxy and returns the reply. It retries when a cached connection
+// was closed by the remote side and retries over TCP when the reply is truncated and prefer_udp is set.
+func (f *Forward) exchange(ctx context.Context, proxy *Proxy, state request.Request, start time.Time) (*dns.Msg, error) {
+	var (
+		ret *dns.Msg
+		err error
+	)
+	opts := f.opts
+	for {
+		ret, err = proxy.Connect(ctx, state, opts)
+		if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+			continue
+		}
+		// Retry with TCP if truncated and prefer_udp configured.
+		if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
+			opts.forceTCP = true
+			continue
+		}
+		break
+	}
+
+	if len(f.tapPlugins) != 0 {
+		toDnstap(ctx, f, proxy.addr, state, opts, ret, start)
+	}
+	return ret, err
+}
+
 func (f *Forward) match(state request.Request) bool {
 	if !plugin.Name(f.from).Matches(state.Name()) || !f.isAllowedDomain(state.Name()) {
 		return false
@@ -226,6 +269,8 @@ var (
 	ErrNoForward = errors.New("no forwarder defined")
 	// ErrCachedClosed means cached connection was closed by peer.
 	ErrCachedClosed = errors.New("cached connection was closed by peer")
+	// ErrQuestionMismatch means the upstream replied with a question that differs from the one asked.
+	ErrQuestionMismatch = errors.New("question section of reply does not match")
 )
 
 // options holds various options that can be set.
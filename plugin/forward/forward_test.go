@@ -22,3 +22,25 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestListFastest(t *testing.T) {
+	f := Forward{
+		proxies: []*Proxy{{addr: "1.1.1.1:53", avgRtt: 30}, {addr: "2.2.2.2:53", avgRtt: 10}, {addr: "3.3.3.3:53", avgRtt: 20}},
+		p:       &fastest{},
+	}
+
+	first := 0
+	for i := 0; i < 1000; i++ {
+		got := f.List()
+		if len(got) != len(f.proxies) {
+			t.Fatalf("Expected: %v results, got: %v", len(f.proxies), len(got))
+		}
+		if got[0].addr == "2.2.2.2:53" {
+			first++
+		}
+	}
+	// With exploration the fastest proxy is first in about 95% of the lists.
+	if first < 900 || first == 1000 {
+		t.Errorf("Expected fastest proxy to be first in most, but not all, lists, got %d of 1000", first)
+	}
+}
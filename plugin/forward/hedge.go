@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin/debug"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// hedgeResult is the outcome of a single upstream exchange of a hedged query.
+type hedgeResult struct {
+	proxy *Proxy
+	ret   *dns.Msg
+	err   error
+}
+
+// serveHedged forwards the request in state to up to f.hedgeMax upstreams. The next upstream is queried when
+// the previous ones haven't answered within f.hedgeDelay, or immediately when one of them fails. The first
+// valid reply is written to w and the remaining exchanges are cancelled.
+func (f *Forward) serveHedged(ctx context.Context, w dns.ResponseWriter, state request.Request) (int, error) {
+	list := make([]*Proxy, 0, len(f.proxies))
+	for _, proxy := range f.List() {
+		if !proxy.Down(f.maxfails) {
+			list = append(list, proxy)
+		}
+	}
+	if len(list) == 0 {
+		// All upstream proxies are dead, assume healthcheck is completely broken and randomly
+		// select an upstream to connect to.
+		r := new(random)
+		list = r.List(f.proxies)[:1]
+
+		HealthcheckBrokenCount.Add(1)
+	}
+	if len(list) > f.hedgeMax {
+		list = list[:f.hedgeMax]
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan hedgeResult, len(list))
+	launched := 0
+	launch := func() {
+		proxy := list[launched]
+		if launched > 0 {
+			HedgeCount.Add(1)
+		}
+		launched++
+		// Connect rewrites the message ID, so every exchange needs its own copy of the request.
+		st := request.Request{W: state.W, Req: state.Req.Copy()}
+		go func() {
+			ret, err := f.exchange(hctx, proxy, st, start)
+			results <- hedgeResult{proxy: proxy, ret: ret, err: err}
+		}()
+	}
+
+	launch()
+	if f.hedgeDelay == 0 {
+		for launched < len(list) {
+			launch()
+		}
+	}
+
+	hedge := time.NewTimer(f.hedgeDelay)
+	defer hedge.Stop()
+	deadline := time.NewTimer(defaultTimeout)
+	defer deadline.Stop()
+
+	var upstreamErr error
+	for received := 0; received < launched; {
+		select {
+		case res := <-results:
+			received++
+			if res.err == nil && state.Match(res.ret) {
+				cancel()
+				HedgeWinCount.WithLabelValues(res.proxy.addr).Add(1)
+				metadata.SetValueFunc(ctx, "forward/upstream", func() string {
+					return res.proxy.addr
+				})
+				f.writeReply(w, res.proxy, state, res.ret)
+				return 0, nil
+			}
+
+			if res.err != nil {
+				upstreamErr = res.err
+				// Kick off health check to see if *our* upstream is broken.
+				if f.maxfails != 0 {
+					res.proxy.Healthcheck()
+				}
+			} else {
+				debug.Hexdumpf(res.ret, "Wrong reply for id: %d, %s %d", res.ret.Id, state.QName(), state.QType())
+				if f.strictQuestion {
+					RejectedResponseCount.WithLabelValues(res.proxy.addr, "question").Add(1)
+					upstreamErr = ErrQuestionMismatch
+				}
+			}
+			// Don't wait for the delay to expire, if there is an upstream left, use it now.
+			if launched < len(list) {
+				launch()
+			}
+
+		case <-hedge.C:
+			if launched < len(list) {
+				launch()
+				hedge.Reset(f.hedgeDelay)
+			}
+
+		case <-deadline.C:
+			return dns.RcodeServerFailure, ErrNoHealthy
+		}
+	}
+
+	if upstreamErr != nil {
+		return dns.RcodeServerFailure, upstreamErr
+	}
+
+	formerr := new(dns.Msg)
+	formerr.SetRcode(state.Req, dns.RcodeFormatError)
+	w.WriteMsg(formerr)
+	return 0, nil
+}
@@ -0,0 +1,115 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetupHedge(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedDelay time.Duration
+		expectedMax   int
+		expectedErr   string
+	}{
+		// positive
+		{"forward . 127.0.0.1 127.0.0.2", false, 0, 0, ""},
+		{"forward . 127.0.0.1 127.0.0.2 {\nhedge 100ms\n}\n", false, 100 * time.Millisecond, 2, ""},
+		{"forward . 127.0.0.1 127.0.0.2 {\nhedge 0s 3\n}\n", false, 0, 3, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nhedge\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nhedge -1s\n}\n", true, 0, 0, "can't be negative"},
+		{"forward . 127.0.0.1 {\nhedge 10ms 1\n}\n", true, 0, 0, "must be between"},
+		{"forward . 127.0.0.1 {\nhedge 10ms two\n}\n", true, 0, 0, "invalid syntax"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			continue
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+			continue
+		}
+		if fs[0].hedgeDelay != test.expectedDelay {
+			t.Errorf("Test %d: expected hedge delay %s, got %s", i, test.expectedDelay, fs[0].hedgeDelay)
+		}
+		if fs[0].hedgeMax != test.expectedMax {
+			t.Errorf("Test %d: expected hedge max %d, got %d", i, test.expectedMax, fs[0].hedgeMax)
+		}
+	}
+}
+
+func TestHedge(t *testing.T) {
+	defer func(d time.Duration) { defaultTimeout = d }(defaultTimeout)
+	defaultTimeout = 5 * time.Second
+
+	var slowPort atomic.Value
+	slowPort.Store("")
+	// dnstest servers share a single handler, so tell them apart by the port they answer on.
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		_, port, _ := net.SplitHostPort(w.LocalAddr().String())
+		if port == slowPort.Load().(string) {
+			time.Sleep(1 * time.Second)
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.TXT(r.Question[0].Name+" IN TXT "+port))
+		w.WriteMsg(ret)
+	}
+	s := dnstest.NewServer(handler)
+	defer s.Close()
+	fast := dnstest.NewServer(handler)
+	defer fast.Close()
+
+	_, port, _ := net.SplitHostPort(s.Addr)
+	slowPort.Store(port)
+	_, fastPort, _ := net.SplitHostPort(fast.Addr)
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" "+fast.Addr+" {\npolicy sequential\nhedge 50ms\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeTXT)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	start := time.Now()
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, but got: %s", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Expected hedged reply well within 500ms, took %s", d)
+	}
+	if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != fastPort {
+		t.Errorf("Expected answer from port %s, got %s", fastPort, x)
+	}
+	if rec.Msg.Id != m.Id {
+		t.Errorf("Expected reply id %d, got %d", m.Id, rec.Msg.Id)
+	}
+}
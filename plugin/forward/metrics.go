@@ -28,6 +28,12 @@ var (
 		Buckets:   plugin.TimeBuckets,
 		Help:      "Histogram of the time each request took.",
 	}, []string{"to", "rcode"})
+	UpstreamRtt = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "upstream_rtt_seconds",
+		Help:      "Gauge of the smoothed round trip time per upstream.",
+	}, []string{"to"})
 	HealthcheckFailureCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "forward",
@@ -46,6 +52,24 @@ var (
 		Name:      "max_concurrent_rejects_total",
 		Help:      "Counter of the number of queries rejected because the concurrent queries were at maximum.",
 	})
+	HedgeCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "hedged_requests_total",
+		Help:      "Counter of the number of additional upstream queries sent because of hedging.",
+	})
+	HedgeWinCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "hedge_wins_total",
+		Help:      "Counter of hedged queries per upstream that returned the first valid answer.",
+	}, []string{"to"})
+	RejectedResponseCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "rejected_responses_total",
+		Help:      "Counter of responses per upstream that were rejected or modified by a response safeguard.",
+	}, []string{"to", "reason"})
 	ConnCacheHitsCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "forward",
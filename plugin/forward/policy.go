@@ -1,6 +1,7 @@
 package forward
 
 import (
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -65,4 +66,32 @@ func (r *sequential) List(p []*Proxy) []*Proxy {
 	return p
 }
 
+// fastest is a policy that orders hosts by their smoothed round trip time, fastest first. To keep
+// measurements for the slower hosts current, once every exploreRatio calls a random slower host is
+// moved to the front of the list.
+type fastest struct{}
+
+func (r *fastest) String() string { return "fastest" }
+
+func (r *fastest) List(p []*Proxy) []*Proxy {
+	fast := make([]*Proxy, len(p))
+	copy(fast, p)
+	if len(fast) == 1 {
+		return fast
+	}
+
+	sort.SliceStable(fast, func(i, j int) bool { return fast[i].rtt() < fast[j].rtt() })
+
+	if rn.Int()%exploreRatio == 0 {
+		i := 1 + rn.Int()%(len(fast)-1)
+		explore := fast[i]
+		copy(fast[1:i+1], fast[:i])
+		fast[0] = explore
+	}
+	return fast
+}
+
+// exploreRatio is the 1 in N chance of the fastest policy trying a slower host first.
+const exploreRatio = 20
+
 var rn = rand.New(time.Now().UnixNano())
@@ -11,8 +11,9 @@ import (
 
 // Proxy defines an upstream host.
 type Proxy struct {
-	fails uint32
-	addr  string
+	avgRtt int64 // smoothed round trip time in nanoseconds, atomic so must be first in struct for proper alignment
+	fails  uint32
+	addr   string
 
 	transport *Transport
 
@@ -65,6 +66,18 @@ func (p *Proxy) Down(maxfails uint32) bool {
 	return fails > maxfails
 }
 
+// rtt returns the smoothed round trip time to this proxy. It is zero if no exchange has been measured yet.
+func (p *Proxy) rtt() time.Duration { return time.Duration(atomic.LoadInt64(&p.avgRtt)) }
+
+// updateRtt moves the smoothed round trip time towards the observed duration d. The first
+// observation is taken as is.
+func (p *Proxy) updateRtt(d time.Duration) {
+	if !atomic.CompareAndSwapInt64(&p.avgRtt, 0, int64(d)) {
+		averageTimeout(&p.avgRtt, d, rttAvgWeight)
+	}
+	UpstreamRtt.WithLabelValues(p.addr).Set(p.rtt().Seconds())
+}
+
 // close stops the health checking goroutine.
 func (p *Proxy) stop()      { p.probe.Stop() }
 func (p *Proxy) finalizer() { p.transport.Stop() }
@@ -76,7 +89,8 @@ func (p *Proxy) start(duration time.Duration) {
 }
 
 const (
-	maxTimeout = 2 * time.Second
+	maxTimeout   = 2 * time.Second
+	rttAvgWeight = 8
 )
 
 var hcInterval = 500 * time.Millisecond
@@ -0,0 +1,157 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+// routes maps domains to the name of the upstream group that handles them. Routes can be given inline
+// in the Corefile and read from a file, the latter is periodically checked for changes.
+type routes struct {
+	sync.RWMutex
+	inline map[string]string
+	file   map[string]string
+
+	path   string
+	reload time.Duration
+	groups map[string]*Forward // used to validate the group names found in the file
+
+	// mtime and size are only read and modified by a single goroutine
+	mtime time.Time
+	size  int64
+
+	stop chan bool
+}
+
+func newRoutes() *routes {
+	return &routes{inline: make(map[string]string), file: make(map[string]string), reload: routesReload}
+}
+
+// Lookup returns the group for the longest domain in r that matches name. Inline routes take precedence
+// over routes from the file when both define the same domain. The empty string is returned when nothing matches.
+func (r *routes) Lookup(name string) string {
+	name = dns.Fqdn(name)
+
+	r.RLock()
+	defer r.RUnlock()
+
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if g, ok := r.inline[name[off:]]; ok {
+			return g
+		}
+		if g, ok := r.file[name[off:]]; ok {
+			return g
+		}
+	}
+	return ""
+}
+
+// Len returns the number of routes in r.
+func (r *routes) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.inline) + len(r.file)
+}
+
+// readRoutes reads the route file when its size or modification time has changed.
+func (r *routes) readRoutes() {
+	if r.path == "" {
+		return
+	}
+	file, err := os.Open(r.path)
+	if err != nil {
+		log.Warningf("Failed to open route file %q: %s", r.path, err)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if r.mtime.Equal(stat.ModTime()) && r.size == stat.Size() {
+		return
+	}
+
+	m := r.parse(file)
+	log.Debugf("Parsed route file %q into %d entries", r.path, len(m))
+
+	r.Lock()
+	r.file = m
+	r.Unlock()
+
+	r.mtime = stat.ModTime()
+	r.size = stat.Size()
+}
+
+// parse reads lines of the form "DOMAIN GROUP" from rd. Lines referencing an unknown group are skipped.
+func (r *routes) parse(rd io.Reader) map[string]string {
+	m := make(map[string]string)
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if i := bytes.Index(line, []byte{'#'}); i >= 0 {
+			// Discard comments.
+			line = line[0:i]
+		}
+		f := bytes.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 2 {
+			log.Warningf("Malformed line in route file %q: %q", r.path, line)
+			continue
+		}
+		group := string(f[1])
+		if _, ok := r.groups[group]; !ok {
+			log.Warningf("Unknown group %q in route file %q", group, r.path)
+			continue
+		}
+		m[plugin.Name(string(f[0])).Normalize()] = group
+	}
+	return m
+}
+
+// start reads the route file and, if reloading is enabled, keeps checking it for changes.
+func (r *routes) start() {
+	if r.path == "" {
+		return
+	}
+	r.readRoutes()
+	if r.reload == 0 {
+		return
+	}
+
+	r.stop = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(r.reload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.readRoutes()
+			}
+		}
+	}()
+}
+
+// close stops checking the route file.
+func (r *routes) close() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+const routesReload = 5 * time.Second
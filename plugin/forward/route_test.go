@@ -0,0 +1,137 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestRoutesLookup(t *testing.T) {
+	r := newRoutes()
+	r.inline["example.org."] = "a"
+	r.inline["sub.example.org."] = "b"
+	r.file["example.net."] = "c"
+	r.file["example.org."] = "d"
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"example.org.", "a"},
+		{"www.example.org.", "a"},
+		{"sub.example.org.", "b"},
+		{"a.b.sub.example.org.", "b"},
+		{"example.net", "c"},
+		{"example.com.", ""},
+		{"org.", ""},
+	}
+	for i, tc := range tests {
+		if x := r.Lookup(tc.name); x != tc.expected {
+			t.Errorf("Test %d: expected group %q for %s, got %q", i, tc.expected, tc.name, x)
+		}
+	}
+}
+
+func TestSetupRoutes(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expectedErr string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 10.0.0.2\nroute corp example.org\n}\n", false, ""},
+		{"forward . 127.0.0.1 {\ngroup corp tls://10.0.0.1 policy sequential tls_servername dns.corp health_check 1s max_fails 3\nroute corp example.org example.net\n}\n", false, ""},
+		// negative
+		{"forward . 127.0.0.1 {\ngroup corp\n}\n", true, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\ngroup corp policy random\n}\n", true, "no upstreams"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 policy\n}\n", true, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 policy fast\n}\n", true, "unknown policy"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\ngroup corp 10.0.0.2\n}\n", true, "already defined"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\n}\n", true, "no route or route_file"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\nroute other example.org\n}\n", true, "unknown group"},
+		{"forward . 127.0.0.1 {\nroute corp\n}\n", true, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nroute_file routes.txt -1s\n}\n", true, "can't be negative"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			continue
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+	}
+}
+
+func TestRoutesServeDNS(t *testing.T) {
+	// dnstest servers share a single handler, so tell them apart by the port they answer on.
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		_, port, _ := net.SplitHostPort(w.LocalAddr().String())
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.TXT(r.Question[0].Name+" IN TXT "+port))
+		w.WriteMsg(ret)
+	}
+	def := dnstest.NewServer(handler)
+	defer def.Close()
+	corp := dnstest.NewServer(handler)
+	defer corp.Close()
+	lab := dnstest.NewServer(handler)
+	defer lab.Close()
+
+	dir := t.TempDir()
+	routeFile := filepath.Join(dir, "routes")
+	if err := os.WriteFile(routeFile, []byte("# lab domains\nlab.example.org lab\nunknown.example.org nosuchgroup\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "forward . " + def.Addr + " {\ngroup corp " + corp.Addr + "\ngroup lab " + lab.Addr + "\nroute corp example.org\nroute_file " + routeFile + " 0s\n}\n"
+	c := caddy.NewTestController("dns", input)
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	tests := []struct {
+		qname    string
+		expected string
+	}{
+		{"example.com.", def.Addr},
+		{"www.example.org.", corp.Addr},
+		{"unknown.example.org.", corp.Addr},
+		{"www.lab.example.org.", lab.Addr},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeTXT)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected to receive reply, but got: %s", i, err)
+		}
+		_, port, _ := net.SplitHostPort(tc.expected)
+		if x := rec.Msg.Answer[0].(*dns.TXT).Txt[0]; x != port {
+			t.Errorf("Test %d: expected answer from port %s for %s, got %s", i, port, tc.qname, x)
+		}
+	}
+}
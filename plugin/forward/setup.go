@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -53,6 +54,9 @@ func setup(c *caddy.Controller) error {
 			if taph := dnsserver.GetConfig(c).Handler("dnstap"); taph != nil {
 				if tapPlugin, ok := taph.(dnstap.Dnstap); ok {
 					f.tapPlugins = append(f.tapPlugins, &tapPlugin)
+					for _, g := range f.groups {
+						g.tapPlugins = append(g.tapPlugins, &tapPlugin)
+					}
 				}
 			}
 			return nil
@@ -71,6 +75,12 @@ func (f *Forward) OnStartup() (err error) {
 	for _, p := range f.proxies {
 		p.start(f.hcInterval)
 	}
+	for _, g := range f.groups {
+		g.OnStartup()
+	}
+	if f.routes != nil {
+		f.routes.start()
+	}
 	return nil
 }
 
@@ -79,6 +89,12 @@ func (f *Forward) OnShutdown() error {
 	for _, p := range f.proxies {
 		p.stop()
 	}
+	for _, g := range f.groups {
+		g.OnShutdown()
+	}
+	if f.routes != nil {
+		f.routes.close()
+	}
 	return nil
 }
 
@@ -116,34 +132,53 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 		return f, c.ArgErr()
 	}
 
-	toHosts, err := parse.HostPortOrFile(to...)
+	transports, err := f.addProxies(to)
 	if err != nil {
 		return f, err
 	}
 
+	for c.NextBlock() {
+		if err := parseBlock(c, f); err != nil {
+			return f, err
+		}
+	}
+
+	if f.tlsServerName != "" {
+		f.tlsConfig.ServerName = f.tlsServerName
+	}
+	f.initProxies(transports)
+
+	if err := f.initGroups(); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+// addProxies parses the upstreams in to and adds them to f. The transport for each proxy is returned.
+func (f *Forward) addProxies(to []string) ([]string, error) {
+	toHosts, err := parse.HostPortOrFile(to...)
+	if err != nil {
+		return nil, err
+	}
+
 	transports := make([]string, len(toHosts))
 	allowedTrans := map[string]bool{"dns": true, "tls": true}
 	for i, host := range toHosts {
 		trans, h := parse.Transport(host)
 
 		if !allowedTrans[trans] {
-			return f, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
+			return nil, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
 		}
 		p := NewProxy(h, trans)
 		f.proxies = append(f.proxies, p)
 		transports[i] = trans
 	}
+	return transports, nil
+}
 
-	for c.NextBlock() {
-		if err := parseBlock(c, f); err != nil {
-			return f, err
-		}
-	}
-
-	if f.tlsServerName != "" {
-		f.tlsConfig.ServerName = f.tlsServerName
-	}
-
+// initProxies applies the configuration of f to its proxies.
+func (f *Forward) initProxies(transports []string) {
 	// Initialize ClientSessionCache in tls.Config. This may speed up a TLS handshake
 	// in upcoming connections to the same TLS server.
 	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(f.proxies))
@@ -161,8 +196,6 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 		}
 		f.proxies[i].health.SetDomain(f.opts.hcDomain)
 	}
-
-	return f, nil
 }
 
 func parseBlock(c *caddy.Controller, f *Forward) error {
@@ -258,16 +291,11 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-		switch x := c.Val(); x {
-		case "random":
-			f.p = &random{}
-		case "round_robin":
-			f.p = &roundRobin{}
-		case "sequential":
-			f.p = &sequential{}
-		default:
-			return c.Errf("unknown policy '%s'", x)
+		p, err := newPolicy(c.Val())
+		if err != nil {
+			return c.Err(err.Error())
 		}
+		f.p = p
 	case "max_concurrent":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -281,6 +309,80 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 		}
 		f.ErrLimitExceeded = errors.New("concurrent queries exceeded maximum " + c.Val())
 		f.maxConcurrent = int64(n)
+	case "hedge":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return fmt.Errorf("hedge delay can't be negative: %s", dur)
+		}
+		f.hedgeDelay = dur
+		f.hedgeMax = 2
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+			if n < 2 || n > max {
+				return fmt.Errorf("hedge upstreams must be between 2 and %d: %d", max, n)
+			}
+			f.hedgeMax = n
+		}
+	case "strict_question":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.strictQuestion = true
+	case "bailiwick":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.bailiwick = true
+	case "rebind_protection":
+		f.rebind = true
+		for _, allow := range c.RemainingArgs() {
+			f.rebindAllowed = append(f.rebindAllowed, plugin.Host(allow).NormalizeExact()...)
+		}
+	case "group":
+		return parseGroup(c, f)
+	case "route":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRoutes()
+		}
+		for _, domain := range args[1:] {
+			f.routes.inline[plugin.Name(domain).Normalize()] = args[0]
+		}
+	case "route_file":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRoutes()
+		}
+		f.routes.path = args[0]
+		if !filepath.IsAbs(f.routes.path) && dnsserver.GetConfig(c).Root != "" {
+			f.routes.path = filepath.Join(dnsserver.GetConfig(c).Root, f.routes.path)
+		}
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur < 0 {
+				return fmt.Errorf("route_file reload can't be negative: %s", dur)
+			}
+			f.routes.reload = dur
+		}
 
 	default:
 		return c.Errf("unknown property '%s'", c.Val())
@@ -289,4 +391,154 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 	return nil
 }
 
+// newPolicy returns the policy with the given name.
+func newPolicy(name string) (Policy, error) {
+	switch name {
+	case "random":
+		return &random{}, nil
+	case "round_robin":
+		return &roundRobin{}, nil
+	case "sequential":
+		return &sequential{}, nil
+	case "fastest":
+		return &fastest{}, nil
+	}
+	return nil, fmt.Errorf("unknown policy '%s'", name)
+}
+
 const max = 15 // Maximum number of upstreams.
+
+// groupConfig holds the configuration of an upstream group as given in the Corefile. Settings that are
+// not specified are inherited from the forward instance defining the group.
+type groupConfig struct {
+	to            []string
+	policy        Policy
+	tlsServerName string
+	hcInterval    time.Duration
+	hcSet         bool
+	maxfails      uint32
+	maxfailsSet   bool
+}
+
+// parseGroup parses "group NAME TO... [policy POLICY] [tls_servername NAME] [health_check DURATION] [max_fails INTEGER]".
+func parseGroup(c *caddy.Controller, f *Forward) error {
+	args := c.RemainingArgs()
+	if len(args) < 2 {
+		return c.ArgErr()
+	}
+	name := args[0]
+	if _, ok := f.groupConfigs[name]; ok {
+		return c.Errf("group '%s' already defined", name)
+	}
+
+	g := &groupConfig{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "policy", "tls_servername", "health_check", "max_fails":
+			if i+1 == len(args) {
+				return c.ArgErr()
+			}
+		default:
+			g.to = append(g.to, args[i])
+			continue
+		}
+
+		opt, val := args[i], args[i+1]
+		i++
+		switch opt {
+		case "policy":
+			p, err := newPolicy(val)
+			if err != nil {
+				return c.Err(err.Error())
+			}
+			g.policy = p
+		case "tls_servername":
+			g.tlsServerName = val
+		case "health_check":
+			dur, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			if dur < 0 {
+				return fmt.Errorf("health_check can't be negative: %d", dur)
+			}
+			g.hcInterval, g.hcSet = dur, true
+		case "max_fails":
+			n, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return err
+			}
+			g.maxfails, g.maxfailsSet = uint32(n), true
+		}
+	}
+	if len(g.to) == 0 {
+		return c.Errf("group '%s' has no upstreams", name)
+	}
+
+	if f.groupConfigs == nil {
+		f.groupConfigs = make(map[string]*groupConfig)
+	}
+	f.groupConfigs[name] = g
+	return nil
+}
+
+// initGroups creates the upstream groups of f, these inherit the settings of f unless overridden
+// in the group definition. It also checks that all inline routes point to a defined group.
+func (f *Forward) initGroups() error {
+	if f.routes == nil {
+		if len(f.groupConfigs) > 0 {
+			return fmt.Errorf("groups defined, but no route or route_file given")
+		}
+		return nil
+	}
+
+	f.groups = make(map[string]*Forward)
+	for name, cfg := range f.groupConfigs {
+		g := New()
+		g.from = f.from
+		g.maxfails = f.maxfails
+		g.expire = f.expire
+		g.opts = f.opts
+		g.hcInterval = f.hcInterval
+		g.hedgeDelay = f.hedgeDelay
+		g.hedgeMax = f.hedgeMax
+		g.strictQuestion = f.strictQuestion
+		g.bailiwick = f.bailiwick
+		g.rebind = f.rebind
+		g.rebindAllowed = f.rebindAllowed
+		g.tlsConfig = f.tlsConfig.Clone()
+
+		p, _ := newPolicy(f.p.String())
+		g.p = p
+		if cfg.policy != nil {
+			g.p = cfg.policy
+		}
+		if cfg.tlsServerName != "" {
+			g.tlsConfig.ServerName = cfg.tlsServerName
+		}
+		if cfg.hcSet {
+			g.hcInterval = cfg.hcInterval
+		}
+		if cfg.maxfailsSet {
+			g.maxfails = cfg.maxfails
+		}
+
+		transports, err := g.addProxies(cfg.to)
+		if err != nil {
+			return err
+		}
+		if g.Len() > max {
+			return fmt.Errorf("more than %d TOs configured in group '%s': %d", max, name, g.Len())
+		}
+		g.initProxies(transports)
+		f.groups[name] = g
+	}
+
+	for domain, name := range f.routes.inline {
+		if _, ok := f.groups[name]; !ok {
+			return fmt.Errorf("route for '%s' uses unknown group '%s'", domain, name)
+		}
+	}
+	f.routes.groups = f.groups
+	return nil
+}
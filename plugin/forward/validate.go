@@ -0,0 +1,180 @@
+package forward
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// writeReply applies the configured response safeguards to the reply ret from proxy and writes the result to w.
+func (f *Forward) writeReply(w dns.ResponseWriter, proxy *Proxy, state request.Request, ret *dns.Msg) {
+	if f.bailiwick {
+		if dropped := inBailiwick(f.from, state.Name(), ret); dropped > 0 {
+			log.Debugf("Dropped %d out-of-bailiwick records from %s for %s", dropped, proxy.addr, state.Name())
+			RejectedResponseCount.WithLabelValues(proxy.addr, "bailiwick").Add(1)
+		}
+	}
+
+	if f.rebind && !f.rebindIsAllowed(state.Name()) {
+		if rr := rebinding(ret); rr != nil {
+			log.Warningf("Possible DNS rebinding attack detected, refusing reply from %s for %s: %s", proxy.addr, state.Name(), rr)
+			RejectedResponseCount.WithLabelValues(proxy.addr, "rebind").Add(1)
+
+			refused := new(dns.Msg)
+			refused.SetRcode(state.Req, dns.RcodeRefused)
+			w.WriteMsg(refused)
+			return
+		}
+	}
+
+	w.WriteMsg(ret)
+}
+
+// rebindIsAllowed returns true when name is allowed to resolve to private addresses.
+func (f *Forward) rebindIsAllowed(name string) bool {
+	for _, allowed := range f.rebindAllowed {
+		if plugin.Name(allowed).Matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebinding returns the first address record in the answer section of m that points to a private, loopback,
+// link-local or unspecified address. If there are none, nil is returned.
+func rebinding(m *dns.Msg) dns.RR {
+	for _, rr := range m.Answer {
+		var ip net.IP
+		switch x := rr.(type) {
+		case *dns.A:
+			ip = x.A
+		case *dns.AAAA:
+			ip = x.AAAA
+		default:
+			continue
+		}
+		if isPrivate(ip) {
+			return rr
+		}
+	}
+	return nil
+}
+
+// isPrivate returns true if ip is not reachable from the public internet. IPv4 mapped IPv6 addresses are
+// checked as IPv4 addresses.
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// privateNets are the networks not covered by the net.IP helpers used in isPrivate.
+var privateNets = func() []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "255.255.255.255/32"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// inBailiwick removes the records from m that fall outside of the bailiwick of the query for qname
+// forwarded for zone. Records in the answer section must be for qname or for a name on the CNAME or
+// DNAME chain starting at qname. Records in the authority and additional sections must be in zone and in
+// the zone that answered: the closest enclosing zone of a name on the chain with a SOA or NS record in the
+// authority section, or the name on the chain itself if there is no such record. This also works for
+// `forward .`, where every record is in zone. The number of removed records is returned.
+func inBailiwick(zone, qname string, m *dns.Msg) int {
+	// Walk the answer section to collect the names on the alias chain, this assumes the chain is in order.
+	names := map[string]bool{qname: true}
+	for _, rr := range m.Answer {
+		owner := plugin.Name(rr.Header().Name).Normalize()
+		switch x := rr.(type) {
+		case *dns.CNAME:
+			if names[owner] {
+				names[plugin.Name(x.Target).Normalize()] = true
+			}
+		case *dns.DNAME:
+			for n := range names {
+				if n != owner && dns.IsSubDomain(owner, n) {
+					names[owner] = true
+					names[plugin.Name(n[:len(n)-len(owner)]+x.Target).Normalize()] = true
+					break
+				}
+			}
+		}
+	}
+
+	// The zones that answered, the root zone only answers for top level domains.
+	var zones []string
+	for _, rr := range m.Ns {
+		if t := rr.Header().Rrtype; t != dns.TypeSOA && t != dns.TypeNS {
+			continue
+		}
+		owner := plugin.Name(rr.Header().Name).Normalize()
+		for n := range names {
+			if dns.IsSubDomain(owner, n) && (owner != "." || dns.CountLabel(n) <= 1) {
+				zones = append(zones, owner)
+				break
+			}
+		}
+	}
+	if len(zones) == 0 {
+		for n := range names {
+			zones = append(zones, n)
+		}
+	}
+	inZone := func(name string) bool {
+		if !plugin.Name(zone).Matches(name) {
+			return false
+		}
+		for _, z := range zones {
+			if plugin.Name(z).Matches(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	dropped := 0
+	answer := m.Answer[:0]
+	for _, rr := range m.Answer {
+		if names[plugin.Name(rr.Header().Name).Normalize()] {
+			answer = append(answer, rr)
+			continue
+		}
+		dropped++
+	}
+	m.Answer = answer
+
+	ns := m.Ns[:0]
+	for _, rr := range m.Ns {
+		if inZone(rr.Header().Name) {
+			ns = append(ns, rr)
+			continue
+		}
+		dropped++
+	}
+	m.Ns = ns
+
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype == dns.TypeOPT || inZone(rr.Header().Name) {
+			extra = append(extra, rr)
+			continue
+		}
+		dropped++
+	}
+	m.Extra = extra
+
+	return dropped
+}
@@ -0,0 +1,173 @@
+package forward
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestInBailiwick(t *testing.T) {
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{
+		test.CNAME("www.example.org. 300 IN CNAME web.example.net."),
+		test.A("web.example.net. 300 IN A 192.0.2.1"),
+		test.A("evil.example.com. 300 IN A 192.0.2.2"),
+	}
+	m.Ns = []dns.RR{
+		test.NS("example.org. 300 IN NS ns.example.org."),
+		test.NS("example.com. 300 IN NS ns.example.com."),
+	}
+	m.Extra = []dns.RR{
+		test.A("ns.example.org. 300 IN A 192.0.2.3"),
+		test.A("ns.example.com. 300 IN A 192.0.2.4"),
+		test.OPT(4096, false),
+	}
+
+	if x := inBailiwick("example.org.", "www.example.org.", m); x != 3 {
+		t.Errorf("Expected 3 records to be dropped, got %d", x)
+	}
+	if len(m.Answer) != 2 {
+		t.Errorf("Expected 2 answer records, got %d", len(m.Answer))
+	}
+	if len(m.Ns) != 1 || m.Ns[0].Header().Name != "example.org." {
+		t.Errorf("Expected only the example.org. NS record, got %v", m.Ns)
+	}
+	if len(m.Extra) != 2 || m.Extra[1].Header().Rrtype != dns.TypeOPT {
+		t.Errorf("Expected the glue record for ns.example.org. and OPT, got %v", m.Extra)
+	}
+}
+
+func TestInBailiwickDNAME(t *testing.T) {
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{
+		test.DNAME("example.org. 300 IN DNAME example.net."),
+		test.CNAME("www.example.org. 300 IN CNAME www.example.net."),
+		test.A("www.example.net. 300 IN A 192.0.2.1"),
+	}
+
+	if x := inBailiwick(".", "www.example.org.", m); x != 0 {
+		t.Errorf("Expected no records to be dropped, got %d", x)
+	}
+}
+
+func TestInBailiwickRoot(t *testing.T) {
+	m := new(dns.Msg)
+	m.Answer = []dns.RR{test.A("www.example.org. 300 IN A 192.0.2.1")}
+	m.Ns = []dns.RR{
+		test.NS("example.org. 300 IN NS ns.example.org."),
+		test.NS(". 300 IN NS a.root-servers.net."),
+		test.NS("example.com. 300 IN NS ns.example.com."),
+	}
+	m.Extra = []dns.RR{
+		test.A("ns.example.org. 300 IN A 192.0.2.3"),
+		test.A("www.example.com. 300 IN A 192.0.2.4"),
+	}
+
+	if x := inBailiwick(".", "www.example.org.", m); x != 3 {
+		t.Errorf("Expected 3 records to be dropped, got %d", x)
+	}
+	if len(m.Ns) != 1 || m.Ns[0].Header().Name != "example.org." {
+		t.Errorf("Expected only the example.org. NS record, got %v", m.Ns)
+	}
+	if len(m.Extra) != 1 || m.Extra[0].Header().Name != "ns.example.org." {
+		t.Errorf("Expected only the glue record for ns.example.org., got %v", m.Extra)
+	}
+
+	// Without a SOA or NS record, only records for the names on the chain are accepted.
+	m.Ns = []dns.RR{test.A("evil.example.org. 300 IN A 192.0.2.5")}
+	m.Extra = []dns.RR{test.A("www.example.org. 300 IN A 192.0.2.1")}
+	if x := inBailiwick(".", "www.example.org.", m); x != 1 || len(m.Extra) != 1 {
+		t.Errorf("Expected 1 record to be dropped, got %d", x)
+	}
+}
+
+func TestRebinding(t *testing.T) {
+	tests := []struct {
+		rr        dns.RR
+		rebinding bool
+	}{
+		{test.A("example.org. 300 IN A 192.0.2.1"), false},
+		{test.A("example.org. 300 IN A 10.0.0.1"), true},
+		{test.A("example.org. 300 IN A 127.0.0.1"), true},
+		{test.A("example.org. 300 IN A 0.0.0.0"), true},
+		{test.A("example.org. 300 IN A 100.64.1.1"), true},
+		{test.A("example.org. 300 IN A 169.254.1.1"), true},
+		{test.AAAA("example.org. 300 IN AAAA 2001:db8::1"), false},
+		{test.AAAA("example.org. 300 IN AAAA ::1"), true},
+		{test.AAAA("example.org. 300 IN AAAA fd00::1"), true},
+		{test.AAAA("example.org. 300 IN AAAA ::ffff:192.168.1.1"), true},
+		{test.TXT("example.org. 300 IN TXT 127.0.0.1"), false},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.Answer = []dns.RR{tc.rr}
+		if x := rebinding(m) != nil; x != tc.rebinding {
+			t.Errorf("Test %d: expected rebinding to be %t for %s", i, tc.rebinding, tc.rr)
+		}
+	}
+}
+
+func TestRebindProtection(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 192.168.1.1"))
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\nrebind_protection corp.example.org\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	tests := []struct {
+		qname string
+		rcode int
+	}{
+		{"example.org.", dns.RcodeRefused},
+		{"www.corp.example.org.", dns.RcodeSuccess},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected to receive reply, but got: %s", i, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s for %s, got %s", i, dns.RcodeToString[tc.rcode], tc.qname, dns.RcodeToString[rec.Msg.Rcode])
+		}
+	}
+}
+
+func TestSetupSafeguards(t *testing.T) {
+	c := caddy.NewTestController("dns", "forward . 127.0.0.1 {\nstrict_question\nbailiwick\nrebind_protection example.org example.net\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %s", err)
+	}
+	f := fs[0]
+	if !f.strictQuestion || !f.bailiwick || !f.rebind {
+		t.Errorf("Expected all safeguards to be enabled")
+	}
+	if len(f.rebindAllowed) != 2 || f.rebindAllowed[0] != "example.org." {
+		t.Errorf("Expected rebind allowed domains [example.org. example.net.], got %v", f.rebindAllowed)
+	}
+
+	for _, input := range []string{"forward . 127.0.0.1 {\nstrict_question yes\n}\n", "forward . 127.0.0.1 {\nbailiwick example.org\n}\n"} {
+		c := caddy.NewTestController("dns", input)
+		if _, err := parseForward(c); err == nil {
+			t.Errorf("Expected error for input %s", input)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 	"github.com/coredns/coredns/plugin/pkg/replacer"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/request"
@@ -44,9 +45,18 @@ func (l Logger) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 			class := response.Classify(tpe)
 			_, ok1 = rule.Class[class]
 		}
-		if ok || ok1 {
-			logstr := l.repl.Replace(ctx, state, rrw, rule.Format)
-			clog.Info(logstr)
+		if now := time.Now(); (ok || ok1) && rule.sampler.sample(now) {
+			var logstr string
+			if rule.Format == JSONLogFormat {
+				logstr = l.repl.JSON(ctx, state, rrw)
+			} else {
+				logstr = l.repl.Replace(ctx, state, rrw, rule.Format)
+			}
+			if rule.output != nil {
+				rule.output.WriteLine(fileLine(now, logstr, rule.Format == JSONLogFormat))
+			} else {
+				clog.Info(logstr)
+			}
 		}
 
 		return rc, err
@@ -62,6 +72,18 @@ type Rule struct {
 	NameScope string
 	Class     map[response.Class]struct{}
 	Format    string
+
+	sampler *sampler        // nil when every query is logged
+	output  *logfile.Writer // nil when logging to standard output
+}
+
+// fileLine returns the line to write to a log file for logstr, it adds the time of the query.
+func fileLine(now time.Time, logstr string, json bool) string {
+	ts := now.UTC().Format(time.RFC3339Nano)
+	if json {
+		return `{"time":"` + ts + `",` + logstr[1:]
+	}
+	return ts + " " + logstr
 }
 
 const (
@@ -71,4 +93,6 @@ const (
 	CombinedLogFormat = CommonLogFormat + ` "{>opcode}"`
 	// DefaultLogFormat is the default log format.
 	DefaultLogFormat = CommonLogFormat
+	// JSONLogFormat logs a JSON object with all placeholder values and all metadata.
+	JSONLogFormat = "{json}"
 )
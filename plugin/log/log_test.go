@@ -3,13 +3,18 @@ package log
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 	"github.com/coredns/coredns/plugin/pkg/replacer"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/test"
@@ -164,6 +169,19 @@ func TestLogged(t *testing.T) {
 		},
 
 		// case for format
+		{
+			Rules: []Rule{
+				{
+					NameScope: ".",
+					Format:    JSONLogFormat,
+					Class:     map[response.Class]struct{}{response.All: {}},
+				},
+			},
+			Domain:          "example.org.",
+			ShouldLog:       true,
+			ShouldString:    `"remote":"10.240.0.1","port":40212,`,
+			ShouldNOTString: "A IN example.org",
+		},
 		{
 			Rules: []Rule{
 				{
@@ -278,3 +296,68 @@ func BenchmarkLogged(b *testing.B) {
 		logger.ServeDNS(ctx, rec, r)
 	}
 }
+
+func TestSampler(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		sampler *sampler
+		logged  int
+	}{
+		{nil, 100},
+		{&sampler{every: 10}, 10},
+		{&sampler{rate: 5}, 5},
+		{&sampler{every: 10, rate: 5}, 5},
+	}
+	for i, tc := range tests {
+		logged := 0
+		for j := 0; j < 100; j++ {
+			if tc.sampler.sample(now) {
+				logged++
+			}
+		}
+		if logged != tc.logged {
+			t.Errorf("Test %d: expected %d queries to be logged, got %d", i, tc.logged, logged)
+		}
+	}
+
+	// The rate limit resets every second.
+	s := &sampler{rate: 1}
+	if !s.sample(now) || s.sample(now) || !s.sample(now.Add(time.Second)) {
+		t.Errorf("Expected one query per second to be logged")
+	}
+}
+
+func TestLoggedToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.log")
+	out := logfile.New(logfile.Config{Path: path}, nil)
+	if err := out.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := Logger{
+		Rules: []Rule{{
+			NameScope: ".",
+			Format:    JSONLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+			output:    out,
+		}},
+		Next: test.ErrorHandler(),
+		repl: replacer.New(),
+	}
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeA)
+	logger.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+	out.Close()
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %s", buf, err)
+	}
+	if fields["name"] != "example.org." || fields["time"] == nil {
+		t.Errorf("Expected name and time to be logged, got %q", buf)
+	}
+}
@@ -0,0 +1,43 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sampler decides which of the queries matching a rule are logged.
+type sampler struct {
+	n uint64 // number of queries seen, accessed atomically
+
+	every uint64 // log one in every queries, 0 and 1 log all
+	rate  int    // log at most rate queries per second, 0 is no limit
+
+	mu     sync.Mutex
+	second int64 // the current second
+	count  int   // number of queries logged in the current second
+}
+
+// sample returns true if the query should be logged. A nil sampler logs all queries.
+func (s *sampler) sample(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	if s.every > 1 && atomic.AddUint64(&s.n, 1)%s.every != 0 {
+		return false
+	}
+	if s.rate <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sec := now.Unix(); sec != s.second {
+		s.second, s.count = sec, 0
+	}
+	if s.count >= s.rate {
+		return false
+	}
+	s.count++
+	return true
+}
@@ -1,11 +1,14 @@
 package log
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 	"github.com/coredns/coredns/plugin/pkg/replacer"
 	"github.com/coredns/coredns/plugin/pkg/response"
 
@@ -20,6 +23,17 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("log", err)
 	}
 
+	outputs := map[*logfile.Writer]struct{}{}
+	for _, r := range rules {
+		if r.output != nil {
+			outputs[r.output] = struct{}{}
+		}
+	}
+	for w := range outputs {
+		c.OnStartup(w.Open)
+		c.OnShutdown(w.Close)
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		return Logger{Next: next, Rules: rules, repl: replacer.New()}
 	})
@@ -56,6 +70,9 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 				format = args[len(args)-1]
 				format = strings.Replace(format, "{common}", CommonLogFormat, -1)
 				format = strings.Replace(format, "{combined}", CombinedLogFormat, -1)
+				if strings.Contains(format, JSONLogFormat) && format != JSONLogFormat {
+					return nil, fmt.Errorf("%s can not be combined with other placeholders: %q", JSONLogFormat, format)
+				}
 				args = args[:len(args)-1]
 			}
 
@@ -70,6 +87,8 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 
 		// Class refinements in an extra block.
 		classes := make(map[response.Class]struct{})
+		var s *sampler
+		var out logfile.Config
 		for c.NextBlock() {
 			switch c.Val() {
 			// class followed by combinations of all, denial, error and success.
@@ -85,18 +104,69 @@ func logParse(c *caddy.Controller) ([]Rule, error) {
 					}
 					classes[cls] = struct{}{}
 				}
+			// sample N logs one in every N queries.
+			case "sample":
+				n, err := sampleArg(c)
+				if err != nil {
+					return nil, err
+				}
+				if s == nil {
+					s = &sampler{}
+				}
+				s.every = uint64(n)
+			// rate N logs at most N queries per second.
+			case "rate":
+				n, err := sampleArg(c)
+				if err != nil {
+					return nil, err
+				}
+				if s == nil {
+					s = &sampler{}
+				}
+				s.rate = n
 			default:
-				return nil, c.ArgErr()
+				ok, err := out.Option(c)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return nil, c.ArgErr()
+				}
 			}
 		}
+		if err := out.Validate(); err != nil {
+			return nil, err
+		}
+		var w *logfile.Writer
+		if out.Path != "" {
+			path := out.Path
+			w = logfile.New(out, func() { droppedEntries.WithLabelValues(path).Inc() })
+		}
 		if len(classes) == 0 {
 			classes[response.All] = struct{}{}
 		}
 
 		for i := len(rules) - 1; i >= length; i-- {
 			rules[i].Class = classes
+			rules[i].sampler = s
+			rules[i].output = w
 		}
 	}
 
 	return rules, nil
 }
+
+func sampleArg(c *caddy.Controller) (int, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s must be positive: %d", c.Val(), n)
+	}
+	return n, nil
+}
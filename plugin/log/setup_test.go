@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/logfile"
 	"github.com/coredns/coredns/plugin/pkg/response"
 )
 
@@ -149,6 +150,49 @@ func TestLogParse(t *testing.T) {
 			Format:    "{when} " + CommonLogFormat + " {/forward/upstream}",
 			Class:     map[response.Class]struct{}{response.All: {}},
 		}}},
+		{`log . {json}`, false, []Rule{{
+			NameScope: ".",
+			Format:    JSONLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+		}}},
+		{`log . "{json} {name}"`, true, []Rule{}},
+		{`log example.org example.net {
+			sample 100
+			rate 10
+		}`, false, []Rule{{
+			NameScope: "example.org.",
+			Format:    DefaultLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+			sampler:   &sampler{every: 100, rate: 10},
+		}, {
+			NameScope: "example.net.",
+			Format:    DefaultLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+			sampler:   &sampler{every: 100, rate: 10},
+		}}},
+		{`log {
+			sample 0
+		}`, true, []Rule{}},
+		{`log . {json} {
+			output /var/log/coredns/query.log
+			rotate_size 10M
+			rotate_keep 3
+			rotate_compress
+		}`, false, []Rule{{
+			NameScope: ".",
+			Format:    JSONLogFormat,
+			Class:     map[response.Class]struct{}{response.All: {}},
+			output:    logfile.New(logfile.Config{Path: "/var/log/coredns/query.log", MaxSize: 10 << 20, Keep: 3, Compress: true}, nil),
+		}}},
+		{`log {
+			rotate_size 10M
+		}`, true, []Rule{}},
+		{`log {
+			output
+		}`, true, []Rule{}},
+		{`log {
+			rate
+		}`, true, []Rule{}},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.inputLogRules)
@@ -179,6 +223,16 @@ func TestLogParse(t *testing.T) {
 				t.Errorf("Test %d expected %dth LogRule Class to be  %v  , but got %v",
 					i, j, test.expectedLogRules[j].Class, actualLogRule.Class)
 			}
+
+			if out, expected := actualLogRule.output, test.expectedLogRules[j].output; (out == nil) != (expected == nil) || (out != nil && out.Config != expected.Config) {
+				t.Errorf("Test %d expected %dth LogRule output to be  %v  , but got %v",
+					i, j, expected, out)
+			}
+
+			if !reflect.DeepEqual(actualLogRule.sampler, test.expectedLogRules[j].sampler) {
+				t.Errorf("Test %d expected %dth LogRule sampler to be  %v  , but got %v",
+					i, j, test.expectedLogRules[j].sampler, actualLogRule.sampler)
+			}
 		}
 	}
 }
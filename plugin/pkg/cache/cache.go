@@ -1,11 +1,14 @@
 // Package cache implements a cache. The cache hold 256 shards, each shard
-// holds a cache: a map with a mutex. There is no fancy expunge algorithm, it
-// just randomly evicts elements when it gets full.
+// holds a cache: a map with a mutex. By default there is no fancy expunge
+// algorithm, it just randomly evicts elements when it gets full. Optionally
+// the least recently or least frequently used element of a small sample is
+// evicted, and the total size of the elements in bytes can be limited.
 package cache
 
 import (
 	"hash/fnv"
 	"sync"
+	"time"
 )
 
 // Hash returns the FNV hash of what.
@@ -15,15 +18,43 @@ func Hash(what []byte) uint64 {
 	return h.Sum64()
 }
 
+// Sizer is implemented by elements that know their size in bytes. Elements that don't implement it
+// count as zero bytes for the memory limit of the cache.
+type Sizer interface {
+	Size() int
+}
+
+// Usage is implemented by elements that track how often and how recently they are used. It is used by
+// the LRU and LFU eviction policies; elements that don't implement it are evicted first.
+type Usage interface {
+	LastUsed() time.Time
+	Hits() int
+}
+
+// Policy is the policy used to select the element that is evicted when a shard is full.
+type Policy int
+
+const (
+	// Random evicts a random element.
+	Random Policy = iota
+	// LRU evicts the least recently used element of a sample of elements.
+	LRU
+	// LFU evicts the least frequently used element of a sample of elements, ties are broken by LRU.
+	LFU
+)
+
 // Cache is cache.
 type Cache struct {
 	shards [shardSize]*shard
 }
 
-// shard is a cache with random eviction.
+// shard is a cache with random, LRU or LFU eviction.
 type shard struct {
-	items map[uint64]interface{}
-	size  int
+	items    map[uint64]interface{}
+	size     int
+	bytes    int // total size of the elements
+	maxBytes int // maximum total size of the elements, 0 means no limit
+	policy   Policy
 
 	sync.RWMutex
 }
@@ -44,6 +75,25 @@ func New(size int) *Cache {
 	return c
 }
 
+// SetPolicy sets the eviction policy of the cache. It must be called before the cache is used.
+func (c *Cache) SetPolicy(p Policy) {
+	for _, s := range &c.shards {
+		s.policy = p
+	}
+}
+
+// SetMaxBytes limits the total size of the elements in the cache to about n bytes, each shard gets an equal
+// part of n. Elements larger than this part are not added. It must be called before the cache is used.
+func (c *Cache) SetMaxBytes(n int) {
+	per := n / shardSize
+	if n > 0 && per < 1 {
+		per = 1
+	}
+	for _, s := range &c.shards {
+		s.maxBytes = per
+	}
+}
+
 // Add adds a new element to the cache. If the element already exists it is overwritten.
 // Returns true if an existing element was evicted to make room for this element.
 func (c *Cache) Add(key uint64, el interface{}) bool {
@@ -72,6 +122,24 @@ func (c *Cache) Len() int {
 	return l
 }
 
+// Bytes returns the total size of the elements in the cache.
+func (c *Cache) Bytes() int {
+	b := 0
+	for _, s := range &c.shards {
+		b += s.Bytes()
+	}
+	return b
+}
+
+// ShardLens returns the number of elements in each shard of the cache.
+func (c *Cache) ShardLens() []int {
+	lens := make([]int, shardSize)
+	for i, s := range &c.shards {
+		lens[i] = s.Len()
+	}
+	return lens
+}
+
 // Walk walks each shard in the cache.
 func (c *Cache) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	for _, s := range &c.shards {
@@ -86,32 +154,92 @@ func newShard(size int) *shard { return &shard{items: make(map[uint64]interface{
 // Returns true if an existing element was evicted to make room for this element.
 func (s *shard) Add(key uint64, el interface{}) bool {
 	eviction := false
+	size := sizeOf(el)
 	s.Lock()
-	if len(s.items) >= s.size {
-		if _, ok := s.items[key]; !ok {
-			for k := range s.items {
-				delete(s.items, k)
-				eviction = true
-				break
-			}
+	old, exists := s.items[key]
+	if exists {
+		s.bytes -= sizeOf(old)
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		delete(s.items, key)
+		s.Unlock()
+		return false
+	}
+	for (!exists && len(s.items) >= s.size) || (s.maxBytes > 0 && s.bytes+size > s.maxBytes) {
+		k, ok := s.victim(key)
+		if !ok {
+			break
 		}
+		s.bytes -= sizeOf(s.items[k])
+		delete(s.items, k)
+		eviction = true
 	}
 	s.items[key] = el
+	s.bytes += size
 	s.Unlock()
 	return eviction
 }
 
+// victim returns the key of the element to evict according to the policy of the shard, the element
+// with key skip is never selected. The lock must be held by the caller.
+func (s *shard) victim(skip uint64) (uint64, bool) {
+	var (
+		key   uint64
+		el    interface{}
+		found bool
+		n     int
+	)
+	// Map iteration order is random, so this samples the elements.
+	for k, e := range s.items {
+		if k == skip {
+			continue
+		}
+		if s.policy == Random {
+			return k, true
+		}
+		if !found || s.less(e, el) {
+			key, el, found = k, e, true
+		}
+		if n++; n >= evictSamples {
+			break
+		}
+	}
+	return key, found
+}
+
+// less returns true if element a should be evicted before element b.
+func (s *shard) less(a, b interface{}) bool {
+	ua, ok := a.(Usage)
+	if !ok {
+		return true
+	}
+	ub, ok := b.(Usage)
+	if !ok {
+		return false
+	}
+	if s.policy == LFU {
+		if ha, hb := ua.Hits(), ub.Hits(); ha != hb {
+			return ha < hb
+		}
+	}
+	return ua.LastUsed().Before(ub.LastUsed())
+}
+
 // Remove removes the element indexed by key from the cache.
 func (s *shard) Remove(key uint64) {
 	s.Lock()
-	delete(s.items, key)
+	if el, ok := s.items[key]; ok {
+		s.bytes -= sizeOf(el)
+		delete(s.items, key)
+	}
 	s.Unlock()
 }
 
 // Evict removes a random element from the cache.
 func (s *shard) Evict() {
 	s.Lock()
-	for k := range s.items {
+	for k, el := range s.items {
+		s.bytes -= sizeOf(el)
 		delete(s.items, k)
 		break
 	}
@@ -134,6 +262,14 @@ func (s *shard) Len() int {
 	return l
 }
 
+// Bytes returns the total size of the elements in the shard.
+func (s *shard) Bytes() int {
+	s.RLock()
+	b := s.bytes
+	s.RUnlock()
+	return b
+}
+
 // Walk walks the shard for each element the function f is executed while holding a write lock.
 func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	s.RLock()
@@ -146,7 +282,13 @@ func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	s.RUnlock()
 	for _, k := range items {
 		s.Lock()
+		el, exists := s.items[k]
 		ok := f(s.items, k)
+		if exists {
+			// f may have deleted or replaced the element.
+			s.bytes -= sizeOf(el)
+			s.bytes += sizeOf(s.items[k])
+		}
 		s.Unlock()
 		if !ok {
 			return
@@ -154,4 +296,15 @@ func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	}
 }
 
-const shardSize = 256
+func sizeOf(el interface{}) int {
+	if s, ok := el.(Sizer); ok {
+		return s.Size()
+	}
+	return 0
+}
+
+const (
+	shardSize = 256
+	// evictSamples is the number of elements compared to select the element to evict with the LRU and LFU policies.
+	evictSamples = 8
+)
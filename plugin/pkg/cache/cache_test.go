@@ -83,3 +83,18 @@ func BenchmarkCache(b *testing.B) {
 		c.Get(1)
 	}
 }
+
+func TestCacheShardLens(t *testing.T) {
+	c := New(shardSize * 4)
+	c.Add(1, 1)
+	c.Add(2, 2)
+	c.Add(shardSize+1, 3)
+
+	lens := c.ShardLens()
+	if len(lens) != shardSize {
+		t.Fatalf("Expected %d shards, got %d", shardSize, len(lens))
+	}
+	if lens[1] != 2 || lens[2] != 1 || lens[0] != 0 {
+		t.Errorf("Expected shard lengths 0, 2 and 1, got %d, %d and %d", lens[0], lens[1], lens[2])
+	}
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestShardAddAndGet(t *testing.T) {
@@ -137,3 +138,82 @@ func BenchmarkShardParallel(b *testing.B) {
 		}
 	})
 }
+
+type sized int
+
+func (s sized) Size() int { return int(s) }
+
+func TestShardMaxBytes(t *testing.T) {
+	s := newShard(100)
+	s.maxBytes = 10
+
+	s.Add(1, sized(4))
+	s.Add(2, sized(4))
+	if b := s.Bytes(); b != 8 {
+		t.Fatalf("Expected 8 bytes, got %d", b)
+	}
+	if evicted := s.Add(3, sized(4)); !evicted {
+		t.Fatal("Expected an eviction to stay within the byte limit")
+	}
+	if l, b := s.Len(), s.Bytes(); l != 2 || b != 8 {
+		t.Fatalf("Expected 2 elements of 8 bytes, got %d of %d bytes", l, b)
+	}
+
+	// Replacing an element doesn't count its old size.
+	s.Add(3, sized(6))
+	if l, b := s.Len(), s.Bytes(); l != 2 || b != 10 {
+		t.Fatalf("Expected 2 elements of 10 bytes, got %d of %d bytes", l, b)
+	}
+
+	// Elements larger than the limit are not added.
+	s.Add(4, sized(11))
+	if _, found := s.Get(4); found {
+		t.Fatal("Expected element larger than the limit not to be added")
+	}
+
+	s.Remove(3)
+	if b := s.Bytes(); b != 4 {
+		t.Fatalf("Expected 4 bytes after remove, got %d", b)
+	}
+	s.Walk(func(items map[uint64]interface{}, key uint64) bool {
+		delete(items, key)
+		return true
+	})
+	if b := s.Bytes(); b != 0 {
+		t.Fatalf("Expected 0 bytes after walk, got %d", b)
+	}
+}
+
+type used struct {
+	last time.Time
+	hits int
+}
+
+func (u used) LastUsed() time.Time { return u.last }
+func (u used) Hits() int           { return u.hits }
+
+func TestShardPolicy(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		policy  Policy
+		evicted uint64
+	}{
+		{LRU, 2},
+		{LFU, 1},
+	}
+	for i, tc := range tests {
+		s := newShard(3)
+		s.policy = tc.policy
+		s.Add(1, used{now, 1})
+		s.Add(2, used{now.Add(-time.Minute), 10})
+		s.Add(3, used{now, 5})
+		s.Add(4, used{now, 1})
+
+		if _, found := s.Get(tc.evicted); found {
+			t.Errorf("Test %d: expected %d to be evicted", i, tc.evicted)
+		}
+		if l := s.Len(); l != 3 {
+			t.Errorf("Test %d: expected 3 elements, got %d", i, l)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package logfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+)
+
+// Config is the configuration of a log file.
+type Config struct {
+	Path     string
+	MaxSize  int64         // rotate when the file would grow beyond MaxSize bytes, 0 disables
+	MaxAge   time.Duration // rotate when the file is older than MaxAge, 0 disables
+	Keep     int           // number of rotated files to keep, 0 keeps all
+	Compress bool          // gzip rotated files
+	Buffer   int           // number of lines that can be queued
+}
+
+// Option parses the log file option in c.Val() into cfg. It returns false if c.Val() isn't a log file option.
+// The options are:
+//
+//	output FILE
+//	rotate_size SIZE
+//	rotate_age DURATION
+//	rotate_keep N
+//	rotate_compress
+//	buffer N
+func (cfg *Config) Option(c *caddy.Controller) (bool, error) {
+	opt := c.Val()
+	switch opt {
+	case "output", "rotate_size", "rotate_age", "rotate_keep", "buffer":
+	case "rotate_compress":
+		if c.NextArg() {
+			return true, c.ArgErr()
+		}
+		cfg.Compress = true
+		return true, nil
+	default:
+		return false, nil
+	}
+
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return true, c.ArgErr()
+	}
+	arg := args[0]
+
+	switch opt {
+	case "output":
+		cfg.Path = arg
+		if !filepath.IsAbs(cfg.Path) && dnsserver.GetConfig(c).Root != "" {
+			cfg.Path = filepath.Join(dnsserver.GetConfig(c).Root, cfg.Path)
+		}
+	case "rotate_size":
+		n, err := parse.Size(arg)
+		if err != nil {
+			return true, err
+		}
+		cfg.MaxSize = n
+	case "rotate_age":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return true, err
+		}
+		if d <= 0 {
+			return true, fmt.Errorf("rotate_age must be positive: %s", d)
+		}
+		cfg.MaxAge = d
+	case "rotate_keep", "buffer":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return true, err
+		}
+		if n < 0 || (opt == "buffer" && n == 0) {
+			return true, fmt.Errorf("invalid value for %s: %d", opt, n)
+		}
+		if opt == "buffer" {
+			cfg.Buffer = n
+		} else {
+			cfg.Keep = n
+		}
+	}
+	return true, nil
+}
+
+// Validate returns an error if options were set that need an output file, but none is configured.
+func (cfg *Config) Validate() error {
+	if cfg.Path == "" && (cfg.MaxSize > 0 || cfg.MaxAge > 0 || cfg.Keep > 0 || cfg.Compress || cfg.Buffer > 0) {
+		return fmt.Errorf("rotate and buffer options need an output file")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package logfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+var log = clog.NewWithPlugin("logfile")
+
+// file is a log file that rotates itself. It is only used from a single goroutine.
+type file struct {
+	Config
+
+	f       *os.File
+	size    int64
+	opened  time.Time
+	partial bool // the last write ended in the middle of a line
+	now     func() time.Time
+}
+
+func openFile(cfg Config) (*file, error) {
+	f := &file{Config: cfg, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *file) open() error {
+	fh, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	f.f, f.size, f.opened, f.partial = fh, info.Size(), f.now(), false
+	return nil
+}
+
+// Write implements io.Writer. The file is rotated before the write if it would grow beyond MaxSize,
+// or if it is older than MaxAge. A file is only rotated on a line boundary: if the previous write ended
+// in the middle of a line, the rest of that line is written to the current file first.
+func (f *file) Write(p []byte) (int, error) {
+	if f.size == 0 || !((f.MaxSize > 0 && f.size+int64(len(p)) > f.MaxSize) || (f.MaxAge > 0 && f.now().Sub(f.opened) >= f.MaxAge)) {
+		return f.write(p)
+	}
+	written := 0
+	if f.partial {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			return f.write(p)
+		}
+		n, err := f.write(p[:i+1])
+		if err != nil || i+1 == len(p) {
+			return n, err
+		}
+		written, p = n, p[i+1:]
+	}
+	if err := f.rotate(); err != nil {
+		log.Errorf("Failed to rotate %q: %s", f.Path, err)
+	}
+	n, err := f.write(p)
+	return written + n, err
+}
+
+func (f *file) write(p []byte) (int, error) {
+	if f.f == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	if n > 0 {
+		f.partial = p[n-1] != '\n'
+	}
+	return n, err
+}
+
+// rotate renames the current file to a name with a timestamp suffix and opens a new file. The renamed file is
+// cleaned up in the background, see Cleanup.
+func (f *file) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	f.f = nil
+
+	rotated := RotatedName(f.Path, f.now())
+	if err := os.Rename(f.Path, rotated); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	Cleanup(f.Config, rotated)
+	return nil
+}
+
+// RotatedName returns the name a file at path is renamed to when it is rotated at time t.
+func RotatedName(path string, t time.Time) string {
+	return path + "." + t.UTC().Format(timeFormat)
+}
+
+// Cleanup compresses the rotated file if cfg.Compress is set, and removes the oldest rotated files of cfg.Path,
+// keeping at most cfg.Keep of them. This is done in the background, by a single goroutine per cfg.Path, so the
+// rotated files are compressed and pruned one after the other, in the order they were rotated.
+func Cleanup(cfg Config, rotated string) {
+	cleanups.Lock()
+	defer cleanups.Unlock()
+	q, ok := cleanups.m[cfg.Path]
+	cleanups.m[cfg.Path] = append(q, rotated)
+	if !ok {
+		go cleanup(cfg)
+	}
+}
+
+// cleanups holds the rotated files still to be cleaned up, per path. A path is in m while its goroutine runs.
+var cleanups = struct {
+	sync.Mutex
+	m map[string][]string
+}{m: map[string][]string{}}
+
+func cleanup(cfg Config) {
+	for {
+		cleanups.Lock()
+		q := cleanups.m[cfg.Path]
+		if len(q) == 0 {
+			delete(cleanups.m, cfg.Path)
+			cleanups.Unlock()
+			return
+		}
+		rotated := q[0]
+		cleanups.m[cfg.Path] = q[1:]
+		cleanups.Unlock()
+
+		if cfg.Compress {
+			if err := compress(rotated); err != nil {
+				log.Errorf("Failed to compress %q: %s", rotated, err)
+			}
+		}
+		prune(cfg.Path, cfg.Keep)
+	}
+}
+
+// prune removes the oldest rotated files of path, keeping at most keep of them. Keep 0 keeps all files.
+func prune(path string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return
+	}
+	backups := matches[:0]
+	for _, m := range matches {
+		if suffix := strings.TrimSuffix(strings.TrimPrefix(m, path+"."), ".gz"); isTimestamp(suffix) {
+			backups = append(backups, m)
+		}
+	}
+	// The timestamps sort chronologically.
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove %q: %s", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+func (f *file) close() error {
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
+
+// compress gzips the file at path to path.gz and removes the original.
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func isTimestamp(s string) bool {
+	_, err := time.Parse(timeFormat, s)
+	return err == nil
+}
+
+// timeFormat is the format of the timestamp added to rotated files, it sorts chronologically.
+const timeFormat = "20060102T150405.000"
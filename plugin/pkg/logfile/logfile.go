@@ -0,0 +1,116 @@
+// Package logfile implements an asynchronous, buffered writer of log lines to a file. The file can be
+// rotated when it reaches a size or age, and rotated files can be compressed. Lines are written from a
+// separate goroutine; when the buffer is full lines are dropped instead of blocking the caller.
+package logfile
+
+import (
+	"bufio"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Writer writes lines to a log file.
+type Writer struct {
+	Config
+
+	dropped uint64 // number of dropped lines, accessed atomically
+	onDrop  func()
+
+	mu     sync.RWMutex // protects closed, and lines from being closed while writing to it
+	closed bool
+	lines  chan string
+	done   chan struct{}
+	file   *file
+}
+
+// New returns a Writer for cfg. When a line is dropped because the buffer is full onDrop, if not nil, is called.
+// The file is opened by Open.
+func New(cfg Config, onDrop func()) *Writer {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+	return &Writer{Config: cfg, onDrop: onDrop}
+}
+
+// Open opens the file and starts the goroutine that writes to it.
+func (w *Writer) Open() error {
+	f, err := openFile(w.Config)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.lines = make(chan string, w.Buffer)
+	w.done = make(chan struct{})
+	go w.run()
+	return nil
+}
+
+// WriteLine queues line to be written to the file, a newline is added. It never blocks: if the buffer is full,
+// or the Writer isn't open, the line is dropped.
+func (w *Writer) WriteLine(line string) {
+	w.mu.RLock()
+	if w.lines != nil && !w.closed {
+		select {
+		case w.lines <- line:
+			w.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	w.mu.RUnlock()
+
+	atomic.AddUint64(&w.dropped, 1)
+	if w.onDrop != nil {
+		w.onDrop()
+	}
+}
+
+// Dropped returns the number of lines dropped so far.
+func (w *Writer) Dropped() uint64 { return atomic.LoadUint64(&w.dropped) }
+
+// Close writes all queued lines and closes the file. Lines written after Close are dropped.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.lines == nil || w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.lines)
+	w.mu.Unlock()
+
+	<-w.done
+	return w.file.close()
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	buf := bufio.NewWriter(w.file)
+	tick := time.NewTicker(flushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case line, ok := <-w.lines:
+			if !ok {
+				buf.Flush()
+				return
+			}
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+			// Flush when there is nothing else to write, to keep the file current.
+			if len(w.lines) == 0 {
+				buf.Flush()
+			}
+		case <-tick.C:
+			buf.Flush()
+		}
+	}
+}
+
+const (
+	// DefaultBuffer is the default number of lines that can be queued.
+	DefaultBuffer = 4096
+	flushInterval = time.Second
+)
@@ -0,0 +1,166 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.log")
+	w := New(Config{Path: path}, nil)
+	if err := w.Open(); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteLine("one")
+	w.WriteLine("two")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteLine("three") // dropped
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "one\ntwo\n" {
+		t.Errorf("Expected two lines, got %q", buf)
+	}
+	if d := w.Dropped(); d != 1 {
+		t.Errorf("Expected 1 dropped line, got %d", d)
+	}
+}
+
+func TestWriterDrops(t *testing.T) {
+	dropped := 0
+	w := New(Config{Path: filepath.Join(t.TempDir(), "query.log"), Buffer: 2}, func() { dropped++ })
+	// Without Open nothing is written, so the buffer is full immediately.
+	w.WriteLine("one")
+	if dropped != 1 || w.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped line, got %d", dropped)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "query.log")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	f, err := openFile(Config{Path: path, MaxSize: 10, MaxAge: time.Hour, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	write := func(s string) {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("12345\n")
+	write("12345\n") // size rotation
+	now = now.Add(time.Second)
+	write("1\n")
+	now = now.Add(2 * time.Hour)
+	write("2\n") // age rotation
+	now = now.Add(time.Second)
+	write("12345\n")
+	write("12345\n") // size rotation, prunes the oldest file
+	f.close()
+
+	// Pruning happens in the background.
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(path + ".*")
+		if len(backups) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 rotated files, got %v", backups)
+	}
+	buf, _ := os.ReadFile(path)
+	if string(buf) != "12345\n" {
+		t.Errorf("Expected last line in current file, got %q", buf)
+	}
+}
+
+func TestRotateLineBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.log")
+	f, err := openFile(Config{Path: path, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes as a bufio.Writer could do them, splitting lines.
+	for _, s := range []string{"12345\n678", "9\nab\n"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.close()
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %v", backups)
+	}
+	if buf, _ := os.ReadFile(backups[0]); string(buf) != "12345\n6789\n" {
+		t.Errorf("Expected whole lines in rotated file, got %q", buf)
+	}
+	if buf, _ := os.ReadFile(path); string(buf) != "ab\n" {
+		t.Errorf("Expected whole lines in current file, got %q", buf)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "query.log")
+	cfg := Config{Path: path, Keep: 2, Compress: true}
+	for _, ts := range []string{"20260101T000000.000", "20260101T000001.000", "20260101T000002.000"} {
+		rotated := path + "." + ts
+		os.WriteFile(rotated, []byte("one\n"), 0644)
+		Cleanup(cfg, rotated)
+	}
+
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(path + ".*")
+		if len(backups) == 2 && strings.HasSuffix(backups[0], ".gz") && strings.HasSuffix(backups[1], ".gz") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []string{path + ".20260101T000001.000.gz", path + ".20260101T000002.000.gz"}
+	if len(backups) != 2 || backups[0] != want[0] || backups[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, backups)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.log.20260101T000000.000")
+	os.WriteFile(path, []byte("one\n"), 0644)
+	if err := compress(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected %q to be removed", path)
+	}
+	fh, err := os.Open(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := io.ReadAll(gz)
+	if !strings.HasPrefix(string(buf), "one") {
+		t.Errorf("Expected compressed content, got %q", buf)
+	}
+}
@@ -0,0 +1,78 @@
+// Package nsec contains helper functions for the NSEC records of DNSSEC signed zones, shared by the plugins that
+// validate or synthesize denial of existence.
+package nsec
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MaxIterations is the maximum number of extra NSEC3 hash iterations. RFC 9276 recommends 0, and validators may
+// treat zones with more than 100 iterations as insecure (section 3.2), which is what is done here.
+const MaxIterations = 100
+
+// Compare compares a and b in the canonical DNS name order (RFC 4034, section 6.1): label by label starting at the
+// root, each label compared as the octets of its lowercased wire format.
+func Compare(a, b string) int {
+	la, lb := labels(a), labels(b)
+	for i := 0; i < len(la) && i < len(lb); i++ {
+		if c := bytes.Compare(la[len(la)-1-i], lb[len(lb)-1-i]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// labels returns the lowercased labels of name in wire format, without the length bytes.
+func labels(name string) [][]byte {
+	buf := make([]byte, 256)
+	off, err := dns.PackDomainName(dns.Fqdn(strings.ToLower(name)), buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	ls := [][]byte{}
+	for i := 0; i < off && buf[i] != 0; i += int(buf[i]) + 1 {
+		ls = append(ls, buf[i+1:i+1+int(buf[i])])
+	}
+	return ls
+}
+
+// Covers returns true if name sorts between owner and next, the owner and next name of an NSEC record. The last
+// NSEC record in a zone wraps around to the apex.
+func Covers(owner, next, name string) bool {
+	if Compare(owner, next) < 0 {
+		return Compare(owner, name) < 0 && Compare(name, next) < 0
+	}
+	return Compare(owner, name) < 0 && dns.IsSubDomain(next, name)
+}
+
+// HasType returns true if t is in the type bit map of an NSEC or NSEC3 record.
+func HasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NoData returns true if the type bit map of an NSEC or NSEC3 record proves its owner has no records of type t:
+// there are no records of type t, nor a CNAME. The parent side of a delegation only proves this for DS records,
+// and the child apex never does for DS records.
+func NoData(bitmap []uint16, t uint16) bool {
+	if HasType(bitmap, t) || HasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	if t == dns.TypeDS {
+		return !HasType(bitmap, dns.TypeSOA)
+	}
+	return !HasType(bitmap, dns.TypeNS) || HasType(bitmap, dns.TypeSOA)
+}
+
+// Cut returns true if the type bit map of an NSEC or NSEC3 record belongs to a delegation or a DNAME. Such a record
+// proves nothing about the names below its owner.
+func Cut(bitmap []uint16) bool {
+	return HasType(bitmap, dns.TypeDNAME) || HasType(bitmap, dns.TypeNS) && !HasType(bitmap, dns.TypeSOA)
+}
@@ -0,0 +1,83 @@
+package nsec
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCompare(t *testing.T) {
+	// The example from RFC 4034, section 6.1.
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 0; i < len(names)-1; i++ {
+		if Compare(names[i], names[i+1]) >= 0 {
+			t.Errorf("Expected %s to sort before %s", names[i], names[i+1])
+		}
+		if Compare(names[i+1], names[i]) <= 0 {
+			t.Errorf("Expected %s to sort after %s", names[i+1], names[i])
+		}
+	}
+	if Compare("A.example.", "a.EXAMPLE.") != 0 {
+		t.Errorf("Expected the names to be equal")
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		owner, next string
+		name        string
+		cover       bool
+	}{
+		{"a.example.org.", "c.example.org.", "b.example.org.", true},
+		{"a.example.org.", "c.example.org.", "x.a.example.org.", true},
+		{"a.example.org.", "c.example.org.", "a.example.org.", false},
+		{"a.example.org.", "c.example.org.", "c.example.org.", false},
+		{"a.example.org.", "c.example.org.", "d.example.org.", false},
+		{"x.example.org.", "example.org.", "z.example.org.", true}, // the last NSEC record
+		{"x.example.org.", "example.org.", "example.net.", false},
+		// A black lie for NODATA only covers the name \000.www.example.com. itself.
+		{"www.example.com.", "\\000.www.example.com.", "2.www.example.com.", false},
+		{"www.example.com.", "\\000.www.example.com.", "-.www.example.com.", false},
+		{"www.example.com.", "\\000.www.example.com.", "*.www.example.com.", false},
+		{"www.example.com.", "\\000.www.example.com.", "\\000.www.example.com.", false},
+	}
+	for i, tc := range tests {
+		if x := Covers(tc.owner, tc.next, tc.name); x != tc.cover {
+			t.Errorf("Test %d: expected cover of %s to be %t, got %t", i, tc.name, tc.cover, x)
+		}
+	}
+}
+
+func TestNoData(t *testing.T) {
+	tests := []struct {
+		bitmap []uint16
+		t      uint16
+		nodata bool
+	}{
+		{[]uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeMX, true},
+		{[]uint16{dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeA, false},
+		{[]uint16{dns.TypeCNAME, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeA, false},
+		{[]uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeA, false},   // delegation
+		{[]uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeDS, true},   // unsigned delegation
+		{[]uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG}, dns.TypeDS, false},   // child apex
+		{[]uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG}, dns.TypeA, true},     // apex
+		{[]uint16{dns.TypeDNAME, dns.TypeRRSIG, dns.TypeNSEC}, dns.TypeA, true}, // DNAME, only the names below it are redirected
+	}
+	for i, tc := range tests {
+		if got := NoData(tc.bitmap, tc.t); got != tc.nodata {
+			t.Errorf("Test %d: expected %t for %s, got %t", i, tc.nodata, dns.TypeToString[tc.t], got)
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	if !Cut([]uint16{dns.TypeNS, dns.TypeDS, dns.TypeRRSIG, dns.TypeNSEC}) {
+		t.Error("Expected a delegation to be a cut")
+	}
+	if !Cut([]uint16{dns.TypeA, dns.TypeDNAME, dns.TypeRRSIG, dns.TypeNSEC}) {
+		t.Error("Expected a DNAME to be a cut")
+	}
+	if Cut([]uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY}) {
+		t.Error("Expected the apex not to be a cut")
+	}
+}
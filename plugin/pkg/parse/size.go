@@ -0,0 +1,29 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Size parses a size in bytes, with an optional K, M or G suffix (powers of 1024), e.g. 100M.
+func Size(s string) (int64, error) {
+	mult := int64(1)
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	switch {
+	case strings.HasSuffix(num, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * mult, nil
+}
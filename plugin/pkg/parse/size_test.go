@@ -0,0 +1,26 @@
+package parse
+
+import "testing"
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+		err bool
+	}{
+		{"100", 100, false},
+		{"10K", 10 << 10, false},
+		{"10kb", 10 << 10, false},
+		{"5M", 5 << 20, false},
+		{"1G", 1 << 30, false},
+		{"0", 0, true},
+		{"M", 0, true},
+		{"10X", 0, true},
+	}
+	for i, tc := range tests {
+		n, err := Size(tc.in)
+		if (err != nil) != tc.err || n != tc.out {
+			t.Errorf("Test %d: expected %d (error %t), got %d (%v)", i, tc.out, tc.err, n, err)
+		}
+	}
+}
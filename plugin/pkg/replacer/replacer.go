@@ -1,11 +1,14 @@
 package replacer
 
 import (
+	"bytes"
 	"context"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
@@ -28,6 +31,105 @@ func (r Replacer) Replace(ctx context.Context, state request.Request, rr *dnstes
 	return loadFormat(s).Replace(ctx, state, rr)
 }
 
+// JSON returns a JSON object with the values of all labels, and the values of all metadata in ctx as an object
+// under the "metadata" key.
+func (r Replacer) JSON(ctx context.Context, state request.Request, rr *dnstest.Recorder) string {
+	b := bufPool.Get().([]byte)
+	v := bufPool.Get().([]byte)
+	b = append(b, '{')
+	for i, f := range jsonLabels {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, f.key)
+		b = append(b, ':')
+
+		v = appendValue(v[:0], state, rr, f.label)
+		switch f.label {
+		case "{remote}", "{local}":
+			v = bytes.TrimSuffix(bytes.TrimPrefix(v, []byte{'['}), []byte{']'})
+		case "{duration}":
+			v = bytes.TrimSuffix(v, []byte{'s'})
+		}
+		switch {
+		case f.raw && (len(v) == 0 || string(v) == EmptyValue):
+			b = append(b, "null"...)
+		case f.raw:
+			b = append(b, v...)
+		default:
+			b = appendJSONString(b, string(v))
+		}
+	}
+
+	if labels := metadata.Labels(ctx); len(labels) > 0 {
+		sort.Strings(labels)
+		b = append(b, `,"metadata":{`...)
+		for i, label := range labels {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, label)
+			b = append(b, ':')
+			value := EmptyValue
+			if fm := metadata.ValueFunc(ctx, label); fm != nil {
+				value = fm()
+			}
+			b = appendJSONString(b, value)
+		}
+		b = append(b, '}')
+	}
+	b = append(b, '}')
+
+	s := string(b)
+	//nolint:staticcheck
+	bufPool.Put(b[:0])
+	//nolint:staticcheck
+	bufPool.Put(v[:0])
+	return s
+}
+
+// jsonLabels are the labels in the JSON output, in order, with their keys. The values of raw labels are
+// numbers or booleans and are not quoted.
+var jsonLabels = []struct {
+	key   string
+	label string
+	raw   bool
+}{
+	{"remote", "{remote}", false},
+	{"port", "{port}", true},
+	{"local", "{local}", false},
+	{"id", headerReplacer + "id}", true},
+	{"type", "{type}", false},
+	{"class", "{class}", false},
+	{"name", "{name}", false},
+	{"proto", "{proto}", false},
+	{"size", "{size}", true},
+	{"do", headerReplacer + "do}", true},
+	{"bufsize", headerReplacer + "bufsize}", true},
+	{"opcode", headerReplacer + "opcode}", true},
+	{"rcode", "{rcode}", false},
+	{"rflags", headerReplacer + "rflags}", false},
+	{"rsize", "{rsize}", true},
+	{"duration", "{duration}", true},
+}
+
+// appendJSONString appends s as a quoted JSON string. Invalid UTF-8 is replaced with the replacement character.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', byte(c))
+		case c < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		default:
+			b = utf8.AppendRune(b, c)
+		}
+	}
+	return append(b, '"')
+}
+
 const (
 	headerReplacer = "{>"
 	// EmptyValue is the default empty value.
@@ -2,6 +2,7 @@ package replacer
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 	"strings"
 	"testing"
@@ -440,3 +441,45 @@ func TestNoResponseWasWritten(t *testing.T) {
 		}
 	}
 }
+
+func TestJSON(t *testing.T) {
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+	r := new(dns.Msg)
+	r.SetQuestion("exa\"mple.org.", dns.TypeHINFO)
+	r.Id = 1053
+	state := request.Request{W: w, Req: r}
+
+	m := metadata.Metadata{
+		Zones:     []string{"."},
+		Providers: []metadata.Provider{testProvider{"test/meta": func() string { return "one\ntwo" }}},
+		Next:      &testHandler{},
+	}
+	ctx := m.Collect(context.TODO(), state)
+
+	s := New().JSON(ctx, state, nil)
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		t.Fatalf("Expected valid JSON, got %q: %s", s, err)
+	}
+
+	expect := map[string]interface{}{
+		"name":     `exa\"mple.org.`, // presentation format
+		"type":     "HINFO",
+		"remote":   "10.240.0.1",
+		"port":     float64(40212),
+		"id":       float64(1053),
+		"do":       false,
+		"rcode":    "-",
+		"rsize":    nil,
+		"duration": nil,
+		"metadata": map[string]interface{}{"test/meta": "one\ntwo"},
+	}
+	for k, v := range expect {
+		if !reflect.DeepEqual(fields[k], v) {
+			t.Errorf("Expected %s to be %v, got %v", k, v, fields[k])
+		}
+	}
+	if len(fields) != len(jsonLabels)+1 {
+		t.Errorf("Expected %d fields, got %d", len(jsonLabels)+1, len(fields))
+	}
+}
@@ -0,0 +1,18 @@
+package ratelimit
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// LimitedCount is the number of responses over the rate limit.
+	LimitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "limited_responses_total",
+		Help:      "Counter of responses over the rate limit by category and the action taken.",
+	}, []string{"server", "zone", "view", "category", "action"})
+)
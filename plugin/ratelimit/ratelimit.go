@@ -0,0 +1,166 @@
+// Package ratelimit implements response rate limiting (RRL).
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("ratelimit")
+
+// RateLimit limits the rate of responses sent to a client network, to stop the server from being used as a
+// reflection amplifier. Responses are counted per client network, response category and, for answers and
+// NXDOMAIN responses, the name they are about.
+type RateLimit struct {
+	Next  plugin.Handler
+	Zones []string
+
+	rates    [numCategories]float64 // responses per second per category, 0 is unlimited
+	window   float64                // seconds a client's balance can go into debt
+	v4Prefix int
+	v6Prefix int
+	slip     int // send a truncated response for every slip-th limited response, 0 never does
+	allow    *iptree.Tree
+	logOnly  bool
+
+	table *table
+	now   func() time.Time
+}
+
+// category is the category of a response, each has its own rate.
+type category int
+
+const (
+	categoryAnswer category = iota
+	categoryNXDomain
+	categoryError
+	numCategories
+)
+
+var categoryNames = [numCategories]string{"answer", "nxdomain", "error"}
+
+func (c category) String() string { return categoryNames[c] }
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RateLimit) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	// Clients can't spoof their address over TCP, only responses over UDP are limited.
+	if zone == "" || state.Proto() == "tcp" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	ip := clientIP(state)
+	if ip == nil {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	if _, ok := rl.allow.GetByIP(ip); ok {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rl: rl, ctx: ctx, state: state, zone: zone, client: rl.network(ip)}
+	return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, rw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RateLimit) Name() string { return "ratelimit" }
+
+// clientIP returns the address of the client, or nil if it can't be parsed.
+func clientIP(state request.Request) net.IP {
+	addr := state.IP()
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr = addr[:i]
+	}
+	return net.ParseIP(addr)
+}
+
+// network returns the network of the client at ip, ip truncated to the configured prefix length.
+func (rl *RateLimit) network(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4.Mask(net.CIDRMask(rl.v4Prefix, 32)), Mask: net.CIDRMask(rl.v4Prefix, 32)}
+	}
+	return &net.IPNet{IP: ip.Mask(net.CIDRMask(rl.v6Prefix, 128)), Mask: net.CIDRMask(rl.v6Prefix, 128)}
+}
+
+// classify returns the category of the response m, and the name it is counted for. Answers are counted per
+// name and type, NXDOMAIN responses for the zone they are from, and errors are counted together.
+func classify(state request.Request, m *dns.Msg) (category, string) {
+	switch m.Rcode {
+	case dns.RcodeSuccess:
+		return categoryAnswer, strings.ToLower(state.Name()) + " " + state.Type()
+	case dns.RcodeNameError:
+		for _, rr := range m.Ns {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				return categoryNXDomain, strings.ToLower(rr.Header().Name)
+			}
+		}
+		return categoryNXDomain, strings.ToLower(state.Name())
+	}
+	return categoryError, ""
+}
+
+// ResponseWriter limits the rate of the responses written to a client network.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rl     *RateLimit
+	ctx    context.Context
+	state  request.Request
+	zone   string
+	client *net.IPNet
+}
+
+// WriteMsg writes m if the client network is within its rate limit. Otherwise nothing is written, or, in
+// accordance with slip, a truncated response that makes the client retry over TCP.
+func (w *ResponseWriter) WriteMsg(m *dns.Msg) error {
+	cat, name := classify(w.state, m)
+	rate := w.rl.rates[cat]
+	if rate == 0 {
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	key := string(w.client.IP) + string(w.client.Mask) + "/" + strconv.Itoa(int(cat)) + "/" + name
+	ok, limited := w.rl.table.take(key, w.rl.now(), rate, w.rl.window)
+	if ok {
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	if limited == 1 {
+		if name == "" {
+			log.Infof("Limiting %s responses to %s", cat, w.client)
+		} else {
+			log.Infof("Limiting %s responses for %q to %s", cat, name, w.client)
+		}
+	}
+
+	action := "drop"
+	switch {
+	case w.rl.logOnly:
+		action = "log"
+	case w.rl.slip > 0 && limited%w.rl.slip == 0:
+		action = "slip"
+	}
+	LimitedCount.WithLabelValues(metrics.WithServer(w.ctx), w.zone, metrics.WithView(w.ctx), cat.String(), action).Inc()
+
+	switch action {
+	case "log":
+		return w.ResponseWriter.WriteMsg(m)
+	case "slip":
+		tc := new(dns.Msg)
+		tc.SetRcode(w.state.Req, m.Rcode)
+		tc.Truncated = true
+		return w.ResponseWriter.WriteMsg(tc)
+	}
+	return nil
+}
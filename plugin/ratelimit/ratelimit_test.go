@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newTestRateLimit returns a RateLimit configured with config, answering with rcode, and with a clock
+// that doesn't move unless advanced.
+func newTestRateLimit(t *testing.T, config string, rcode int) (*RateLimit, *time.Time) {
+	t.Helper()
+	c := caddy.NewTestController("dns", config)
+	c.ServerBlockKeys = []string{"example.org."}
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	rl.Next = test.HandlerFunc(func(_ context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		switch rcode {
+		case dns.RcodeSuccess:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 3600 IN A 127.0.0.1")}
+		case dns.RcodeNameError:
+			m.Ns = []dns.RR{test.SOA("example.org. 3600 IN SOA ns.example.org. hostmaster.example.org. 1 7200 3600 1209600 3600")}
+		}
+		w.WriteMsg(m)
+		return rcode, nil
+	})
+	return rl, &now
+}
+
+// query sends a query for name from ip, and returns the response, or nil if there was none.
+func query(t *testing.T, rl *RateLimit, name, ip string, tcp bool) *dns.Msg {
+	t.Helper()
+	r := new(dns.Msg)
+	r.SetQuestion(name, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	if _, err := rl.ServeDNS(context.TODO(), rec, r); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Msg
+}
+
+func TestRateLimit(t *testing.T) {
+	rl, now := newTestRateLimit(t, "ratelimit {\nresponses_per_second 2\nslip 2\nwindow 5\n}", dns.RcodeSuccess)
+
+	// The burst is the rate.
+	for i := 0; i < 2; i++ {
+		if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil || m.Truncated {
+			t.Fatalf("Expected response %d to be sent", i)
+		}
+	}
+	// Over the limit every second response slips.
+	if m := query(t, rl, "a.example.org.", "10.0.0.2", false); m != nil {
+		t.Errorf("Expected response to be dropped, got %v", m)
+	}
+	m := query(t, rl, "a.example.org.", "10.0.0.3", false)
+	if m == nil || !m.Truncated || len(m.Answer) != 0 {
+		t.Errorf("Expected truncated response, got %v", m)
+	}
+
+	// Other names, other networks, TCP and names outside the zones are not limited.
+	if m := query(t, rl, "b.example.org.", "10.0.0.1", false); m == nil || m.Truncated {
+		t.Error("Expected response for another name")
+	}
+	if m := query(t, rl, "a.example.org.", "10.0.1.1", false); m == nil || m.Truncated {
+		t.Error("Expected response for another network")
+	}
+	if m := query(t, rl, "a.example.org.", "10.0.0.1", true); m == nil || m.Truncated {
+		t.Error("Expected response over TCP")
+	}
+	if m := query(t, rl, "a.example.net.", "10.0.0.1", false); m == nil || m.Truncated {
+		t.Error("Expected response for a name outside the zone")
+	}
+
+	// The limited responses put the network in debt.
+	*now = now.Add(1 * time.Second)
+	if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m != nil {
+		t.Errorf("Expected response to be dropped after 1s, got %v", m)
+	}
+	*now = now.Add(3 * time.Second)
+	if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil || m.Truncated {
+		t.Error("Expected response after 4s")
+	}
+}
+
+func TestRateLimitCategories(t *testing.T) {
+	rl, _ := newTestRateLimit(t, "ratelimit {\nnxdomains_per_second 1\nslip 0\n}", dns.RcodeNameError)
+
+	// NXDOMAIN responses for different names in the same zone are counted together.
+	if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil {
+		t.Fatal("Expected response")
+	}
+	if m := query(t, rl, "b.example.org.", "10.0.0.1", false); m != nil {
+		t.Errorf("Expected response to be dropped, got %v", m)
+	}
+
+	rl, _ = newTestRateLimit(t, "ratelimit {\nerrors_per_second 0\nslip 0\n}", dns.RcodeServerFailure)
+	for i := 0; i < 20; i++ {
+		if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil {
+			t.Fatal("Expected errors not to be limited")
+		}
+	}
+}
+
+func TestRateLimitAllowAndLogOnly(t *testing.T) {
+	rl, _ := newTestRateLimit(t, "ratelimit {\nresponses_per_second 1\nallow 10.0.0.0/8\nslip 0\n}", dns.RcodeSuccess)
+	for i := 0; i < 5; i++ {
+		if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil {
+			t.Fatal("Expected allowed network not to be limited")
+		}
+	}
+	query(t, rl, "a.example.org.", "2001:db8::1", false)
+	if m := query(t, rl, "a.example.org.", "2001:db8:0:ff::1", false); m != nil {
+		t.Errorf("Expected response to the same /56 to be dropped, got %v", m)
+	}
+
+	rl, _ = newTestRateLimit(t, "ratelimit {\nresponses_per_second 1\nlog_only\n}", dns.RcodeSuccess)
+	for i := 0; i < 5; i++ {
+		if m := query(t, rl, "a.example.org.", "10.0.0.1", false); m == nil || m.Truncated {
+			t.Fatal("Expected log_only not to limit")
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/infobloxopen/go-trees/iptree"
+)
+
+const pluginName = "ratelimit"
+
+func init() { plugin.Register(pluginName, setup) }
+
+const (
+	defaultRate         = 10
+	defaultWindow       = 15
+	defaultV4Prefix     = 24
+	defaultV6Prefix     = 56
+	defaultSlip         = 2
+	defaultMaxTableSize = 100000
+)
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RateLimit, error) {
+	rl := &RateLimit{
+		window:   defaultWindow,
+		v4Prefix: defaultV4Prefix,
+		v6Prefix: defaultV6Prefix,
+		slip:     defaultSlip,
+		allow:    iptree.NewTree(),
+		now:      time.Now,
+	}
+	maxTableSize := defaultMaxTableSize
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		rates := [numCategories]float64{-1, -1, -1}
+		for c.NextBlock() {
+			opt := c.Val()
+			switch opt {
+			case "responses_per_second", "nxdomains_per_second", "errors_per_second":
+				n, err := intArg(c, 0, 1<<20)
+				if err != nil {
+					return nil, err
+				}
+				switch opt {
+				case "responses_per_second":
+					rates[categoryAnswer] = float64(n)
+				case "nxdomains_per_second":
+					rates[categoryNXDomain] = float64(n)
+				default:
+					rates[categoryError] = float64(n)
+				}
+			case "window":
+				n, err := intArg(c, 1, 3600)
+				if err != nil {
+					return nil, err
+				}
+				rl.window = float64(n)
+			case "ipv4_prefix_length":
+				n, err := intArg(c, 0, 32)
+				if err != nil {
+					return nil, err
+				}
+				rl.v4Prefix = n
+			case "ipv6_prefix_length":
+				n, err := intArg(c, 0, 128)
+				if err != nil {
+					return nil, err
+				}
+				rl.v6Prefix = n
+			case "slip":
+				n, err := intArg(c, 0, 10)
+				if err != nil {
+					return nil, err
+				}
+				rl.slip = n
+			case "max_table_size":
+				n, err := intArg(c, 1, 1<<24)
+				if err != nil {
+					return nil, err
+				}
+				maxTableSize = n
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					_, n, err := net.ParseCIDR(normalize(a))
+					if err != nil {
+						return nil, c.Errf("illegal CIDR notation %q", a)
+					}
+					rl.allow.InplaceInsertNet(n, struct{}{})
+				}
+			case "log_only":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rl.logOnly = true
+			default:
+				return nil, c.Errf("unknown property '%s'", opt)
+			}
+		}
+
+		// The NXDOMAIN and error rates default to the responses rate.
+		if rates[categoryAnswer] < 0 {
+			rates[categoryAnswer] = defaultRate
+		}
+		for cat := range rates {
+			if rates[cat] < 0 {
+				rates[cat] = rates[categoryAnswer]
+			}
+		}
+		rl.rates = rates
+	}
+	rl.table = newTable(maxTableSize)
+	return rl, nil
+}
+
+// intArg returns the single integer argument of the current option, which must be between min and max.
+func intArg(c *caddy.Controller, min, max int) (int, error) {
+	opt := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, c.Errf("invalid value for %s: %q", opt, args[0])
+	}
+	if n < min || n > max {
+		return 0, c.Errf("%s must be between %d and %d: %d", opt, min, max, n)
+	}
+	return n, nil
+}
+
+// normalize appends '/32' for any single IPv4 address and '/128' for IPv6.
+func normalize(rawNet string) string {
+	if strings.IndexByte(rawNet, '/') >= 0 {
+		return rawNet
+	}
+	if strings.IndexByte(rawNet, ':') >= 0 {
+		return rawNet + "/128"
+	}
+	return rawNet + "/32"
+}
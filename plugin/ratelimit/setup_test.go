@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		config  string
+		wantErr bool
+		rates   [numCategories]float64
+	}{
+		{"ratelimit", false, [numCategories]float64{10, 10, 10}},
+		{"ratelimit example.org {\nresponses_per_second 5\n}", false, [numCategories]float64{5, 5, 5}},
+		{"ratelimit {\nresponses_per_second 5\nnxdomains_per_second 2\nerrors_per_second 0\n}", false, [numCategories]float64{5, 2, 0}},
+		{"ratelimit {\nwindow 5\nslip 0\nipv4_prefix_length 32\nipv6_prefix_length 64\nmax_table_size 1000\n}", false, [numCategories]float64{10, 10, 10}},
+		{"ratelimit {\nallow 10.0.0.0/8 192.168.1.1 ::1\nlog_only\n}", false, [numCategories]float64{10, 10, 10}},
+		{"ratelimit {\nresponses_per_second\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nresponses_per_second -1\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nwindow 0\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nipv4_prefix_length 33\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nslip 11\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nallow 10.0.0.0/33\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nlog_only yes\n}", true, [numCategories]float64{}},
+		{"ratelimit {\nfoo\n}", true, [numCategories]float64{}},
+		{"ratelimit\nratelimit", true, [numCategories]float64{}},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		rl, err := parse(c)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if rl.rates != tc.rates {
+			t.Errorf("Test %d: expected rates %v, got %v", i, tc.rates, rl.rates)
+		}
+	}
+}
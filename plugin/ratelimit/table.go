@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// sweepInterval is how often buckets that have filled up again are removed from the table.
+	sweepInterval = time.Minute
+	// evictSample is the number of buckets looked at to pick one to evict when the table is full.
+	evictSample = 8
+)
+
+// bucket is a token bucket. It gains rate tokens per second up to rate, and each response takes one. Limited
+// responses take tokens too, so a client that keeps on sending stays limited; the debt is capped at window
+// seconds worth of tokens.
+type bucket struct {
+	tokens  float64
+	rate    float64
+	last    time.Time
+	limited int // responses over the limit since the bucket was last within it
+}
+
+// full returns true if the bucket has filled up at time now, and is the same as a new bucket.
+func (b *bucket) full(now time.Time) bool {
+	return b.at(now) >= b.rate
+}
+
+// at returns the number of tokens in the bucket at time now, without the cap.
+func (b *bucket) at(now time.Time) float64 {
+	return b.tokens + now.Sub(b.last).Seconds()*b.rate
+}
+
+// table holds the buckets, up to max of them.
+type table struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	max       int
+	lastSweep time.Time
+}
+
+func newTable(max int) *table {
+	return &table{buckets: make(map[string]*bucket), max: max}
+}
+
+// take takes a token from the bucket for key, and returns false if there was none. Limited is the number of
+// responses over the limit since the bucket was last within it. When the table is full, a bucket is evicted to
+// make room for a new key.
+func (t *table) take(key string, now time.Time, rate, window float64) (ok bool, limited int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= sweepInterval {
+		t.sweep(now)
+	}
+
+	b, ok := t.buckets[key]
+	if !ok {
+		if len(t.buckets) >= t.max {
+			t.evict(now)
+		}
+		b = &bucket{tokens: rate, rate: rate, last: now}
+		t.buckets[key] = b
+	}
+
+	b.tokens = math.Min(rate, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.tokens = math.Max(-rate*window, b.tokens-1)
+	if b.tokens >= 0 {
+		b.limited = 0
+		return true, 0
+	}
+	b.limited++
+	return false, b.limited
+}
+
+// sweep removes the buckets that have filled up.
+func (t *table) sweep(now time.Time) {
+	for k, b := range t.buckets {
+		if b.full(now) {
+			delete(t.buckets, k)
+		}
+	}
+	t.lastSweep = now
+}
+
+// evict removes the fullest of evictSample buckets picked at random. Buckets that are limiting have few tokens,
+// so they are unlikely to be evicted: a client can't reset its bucket by making the table overflow.
+func (t *table) evict(now time.Time) {
+	victim, most, n := "", math.Inf(-1), 0
+	for k, b := range t.buckets {
+		if tokens := b.at(now); tokens > most {
+			victim, most = k, tokens
+		}
+		if n++; n == evictSample {
+			break
+		}
+	}
+	delete(t.buckets, victim)
+}
+
+// len returns the number of buckets.
+func (t *table) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.buckets)
+}
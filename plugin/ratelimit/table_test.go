@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTable(t *testing.T) {
+	tbl := newTable(2)
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	if ok, _ := tbl.take("a", now, 1, 2); !ok {
+		t.Fatal("Expected first take to succeed")
+	}
+	for i := 1; i <= 3; i++ {
+		ok, limited := tbl.take("a", now, 1, 2)
+		if ok || limited != i {
+			t.Fatalf("Expected take to be limited %d, got %t, %d", i, ok, limited)
+		}
+	}
+
+	// The table is full: a new key evicts the fullest bucket, "b", and is limited like any other key.
+	tbl.take("b", now, 1, 2)
+	if ok, _ := tbl.take("c", now, 1, 2); !ok {
+		t.Fatal("Expected first take to succeed in a full table")
+	}
+	if ok, _ := tbl.take("c", now, 1, 2); ok {
+		t.Fatal("Expected take to be limited in a full table")
+	}
+	if _, ok := tbl.buckets["a"]; !ok {
+		t.Error("Expected the limiting bucket to be kept")
+	}
+
+	// After a sweep interval all buckets have filled up again, and are removed.
+	now = now.Add(sweepInterval)
+	if ok, _ := tbl.take("c", now, 1, 2); !ok {
+		t.Fatal("Expected take to succeed")
+	}
+	if x := tbl.len(); x != 1 {
+		t.Errorf("Expected 1 bucket after the sweep, got %d", x)
+	}
+}
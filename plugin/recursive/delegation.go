@@ -0,0 +1,85 @@
+package recursive
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	minDelegationTTL = 5 * time.Second
+	maxDelegationTTL = 24 * time.Hour
+	maxDelegations   = 10000 // the cache is emptied when it grows beyond this
+)
+
+// delegation is a zone cut: the names of the name servers of the zone below it, and their addresses.
+type delegation struct {
+	ns      []string
+	addrs   []string
+	expires time.Time
+}
+
+// newDelegation returns the delegation to cut in the referral m from the name servers of zone. Only the glue
+// records in zone are used, the others can't be trusted (RFC 2181, section 5.4.1).
+func newDelegation(m *dns.Msg, zone, cut string) *delegation {
+	d := &delegation{}
+	ttl := maxDelegationTTL
+	for _, rr := range m.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok || !strings.EqualFold(ns.Header().Name, cut) {
+			continue
+		}
+		d.ns = append(d.ns, strings.ToLower(ns.Ns))
+		if t := time.Duration(ns.Header().Ttl) * time.Second; t < ttl {
+			ttl = t
+		}
+	}
+	for _, name := range d.ns {
+		if dns.IsSubDomain(zone, name) {
+			d.addrs = append(d.addrs, addresses(m.Extra, name)...)
+		}
+	}
+	if ttl < minDelegationTTL {
+		ttl = minDelegationTTL
+	}
+	d.expires = time.Now().Add(ttl)
+	return d
+}
+
+// delegationCache holds the delegations seen in referrals.
+type delegationCache struct {
+	mu sync.RWMutex
+	m  map[string]*delegation
+}
+
+func newDelegationCache() *delegationCache { return &delegationCache{m: map[string]*delegation{}} }
+
+// closest returns the closest zone cut at or above name, and its delegation. For the root zone the delegation is nil,
+// the root hints are used for it.
+func (c *delegationCache) closest(name string) (string, *delegation) {
+	name = strings.ToLower(name)
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for {
+		if d, ok := c.m[name]; ok && now.Before(d.expires) {
+			return name, d
+		}
+		if name == "." {
+			return ".", nil
+		}
+		name = parent(name)
+	}
+}
+
+func (c *delegationCache) add(zone string, d *delegation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.m) >= maxDelegations {
+		c.m = map[string]*delegation{}
+	}
+	c.m[zone] = d
+}
@@ -0,0 +1,64 @@
+package recursive
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// root holds the addresses of the root name servers, from https://www.internic.net/domain/named.root.
+var root = []string{
+	"198.41.0.4", "2001:503:ba3e::2:30", // a.root-servers.net
+	"170.247.170.2", "2801:1b8:10::b", // b.root-servers.net
+	"192.33.4.12", "2001:500:2::c", // c.root-servers.net
+	"199.7.91.13", "2001:500:2d::d", // d.root-servers.net
+	"192.203.230.10", "2001:500:a8::e", // e.root-servers.net
+	"192.5.5.241", "2001:500:2f::f", // f.root-servers.net
+	"192.112.36.4", "2001:500:12::d0d", // g.root-servers.net
+	"198.97.190.53", "2001:500:1::53", // h.root-servers.net
+	"192.36.148.17", "2001:7fe::53", // i.root-servers.net
+	"192.58.128.30", "2001:503:c27::2:30", // j.root-servers.net
+	"193.0.14.129", "2001:7fd::1", // k.root-servers.net
+	"199.7.83.42", "2001:500:9f::42", // l.root-servers.net
+	"202.12.27.33", "2001:dc3::35", // m.root-servers.net
+}
+
+func rootHints() []string { return append([]string{}, root...) }
+
+// readHints reads the addresses of the root name servers from the file path, in the format of named.root: the NS
+// records of the root zone, and the A and AAAA records of the name servers.
+func readHints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ns := map[string]bool{}
+	var glue []dns.RR
+	zp := dns.NewZoneParser(f, ".", path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch x := rr.(type) {
+		case *dns.NS:
+			if x.Header().Name == "." {
+				ns[strings.ToLower(x.Ns)] = true
+			}
+		case *dns.A, *dns.AAAA:
+			glue = append(glue, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	hints := []string{}
+	for name := range ns {
+		hints = append(hints, addresses(glue, name)...)
+	}
+	if len(hints) == 0 {
+		return nil, fmt.Errorf("no addresses of root name servers in %q", path)
+	}
+	return hints, nil
+}
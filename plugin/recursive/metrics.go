@@ -0,0 +1,16 @@
+package recursive
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// QueryCount is the number of queries sent to name servers.
+var QueryCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "recursive",
+	Name:      "queries_total",
+	Help:      "Counter of queries sent to authoritative name servers.",
+}, []string{"server"})
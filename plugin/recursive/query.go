@@ -0,0 +1,101 @@
+package recursive
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxTries = 4    // the maximum number of name servers asked for a single query
+	udpSize  = 1232 // the EDNS0 buffer size, see https://www.dnsflagday.net/2020/
+)
+
+// query asks the name servers at addrs for name and qtype, the fastest one first. Name servers that don't answer,
+// or answer with an error, are skipped.
+func (s *resolution) query(addrs []string, name string, qtype uint16) (*dns.Msg, error) {
+	if len(addrs) == 0 {
+		return nil, errNoServers
+	}
+
+	var err error
+	for i, addr := range s.r.rtt.sort(addrs) {
+		if i == maxTries {
+			break
+		}
+		if s.queries >= maxQueries {
+			return nil, errMaxQueries
+		}
+		if e := s.ctx.Err(); e != nil {
+			return nil, e
+		}
+		s.queries++
+
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		if s.r.use0x20 {
+			m.Question[0].Name = randomCase(name)
+		}
+		m.RecursionDesired = false
+		m.SetEdns0(udpSize, s.do)
+
+		var r *dns.Msg
+		r, err = s.exchange(m, addr)
+		if err != nil {
+			continue
+		}
+		switch r.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+			return r, nil
+		}
+		err = fmt.Errorf("%s: rcode %s", addr, dns.RcodeToString[r.Rcode])
+	}
+	return nil, err
+}
+
+// exchange sends m to the name server at addr, over UDP, and over TCP if the answer is truncated.
+func (s *resolution) exchange(m *dns.Msg, addr string) (*dns.Msg, error) {
+	server := net.JoinHostPort(addr, s.r.port)
+	start := time.Now()
+
+	c := &dns.Client{Net: "udp", Timeout: s.r.timeout}
+	r, _, err := c.ExchangeContext(s.ctx, m, server)
+	if err == nil && r.Truncated {
+		c.Net = "tcp"
+		r, _, err = c.ExchangeContext(s.ctx, m, server)
+	}
+	QueryCount.WithLabelValues(s.server).Inc()
+	if err != nil {
+		s.r.rtt.update(addr, s.r.timeout)
+		return nil, err
+	}
+	s.r.rtt.update(addr, time.Since(start))
+
+	// The response must have the question exactly as asked, the case of the name included, otherwise it may be
+	// spoofed (draft-vixie-dnsext-dns0x20).
+	if len(r.Question) != 1 || r.Question[0].Name != m.Question[0].Name || r.Question[0].Qtype != m.Question[0].Qtype {
+		return nil, fmt.Errorf("%s: the question in the response doesn't match", addr)
+	}
+	return r, nil
+}
+
+// randomCase returns name with the case of its letters randomised.
+func randomCase(name string) string {
+	b := []byte(strings.ToLower(name))
+	r := 0
+	for i, c := range b {
+		if c < 'a' || c > 'z' {
+			continue
+		}
+		if i%30 == 0 {
+			r = rn.Int()
+		}
+		if r&(1<<(i%30)) != 0 {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,104 @@
+// Package recursive implements a plugin that resolves names iteratively, starting at the root name servers.
+package recursive
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("recursive")
+
+// Recursive is a plugin that resolves names itself: it follows the delegations from the root zone down to
+// the name servers that are authoritative for the name.
+type Recursive struct {
+	Next  plugin.Handler
+	Zones []string
+
+	hints       []string // addresses of the root name servers
+	delegations *delegationCache
+	rtt         *rttTable
+
+	minimise bool          // QNAME minimisation (RFC 9156)
+	use0x20  bool          // randomise the case of the query names
+	timeout  time.Duration // timeout of a single query to a name server
+	port     string        // port the name servers listen on, only changed in tests
+}
+
+// New returns a new Recursive with the built-in root hints.
+func New(zones []string) *Recursive {
+	return &Recursive{
+		Zones:       zones,
+		hints:       rootHints(),
+		delegations: newDelegationCache(),
+		rtt:         newRTTTable(),
+		minimise:    true,
+		use0x20:     true,
+		timeout:     defaultTimeout,
+		port:        "53",
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (r *Recursive) ServeDNS(ctx context.Context, w dns.ResponseWriter, req *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: req}
+
+	if plugin.Zones(r.Zones).Matches(state.Name()) == "" || !req.RecursionDesired {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, req)
+	}
+
+	res := &resolution{r: r, ctx: ctx, server: metrics.WithServer(ctx), do: state.Do(), minimise: r.minimise}
+	resp, err := res.resolve(state.Name(), state.QType(), 0)
+	if err != nil {
+		log.Debugf("Failed to resolve %s %s: %s", state.Name(), state.Type(), err)
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		m.RecursionAvailable = true
+		if opt := req.IsEdns0(); opt != nil {
+			m.SetEdns0(uint16(state.Size()), opt.Do())
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNoReachableAuthority})
+		}
+		w.WriteMsg(m)
+		return dns.RcodeServerFailure, nil
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = false
+	m.RecursionAvailable = true
+	m.AuthenticatedData = false
+	m.Rcode = resp.Rcode
+	m.Answer = resp.Answer
+	// Of the authority section only the SOA record is kept, for negative caching, and with DO the NSEC and NSEC3
+	// records and the signatures, for the client to validate denials of existence and wildcard answers. The NS
+	// records there, and the records in the additional section, are meant for resolvers, and aren't checked.
+	for _, rr := range resp.Ns {
+		switch x := rr.(type) {
+		case *dns.SOA:
+			m.Ns = append(m.Ns, rr)
+		case *dns.NSEC, *dns.NSEC3:
+			if res.do {
+				m.Ns = append(m.Ns, rr)
+			}
+		case *dns.RRSIG:
+			if res.do && x.TypeCovered != dns.TypeNS {
+				m.Ns = append(m.Ns, rr)
+			}
+		}
+	}
+	state.SizeAndDo(m)
+	m = state.Scrub(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (r *Recursive) Name() string { return "recursive" }
+
+const defaultTimeout = 2 * time.Second
@@ -0,0 +1,407 @@
+package recursive
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const dbRoot = `
+.                 3600 IN SOA  ns.root-servers.test. hostmaster.root-servers.test. 1 3600 600 86400 300
+.                 3600 IN NS   ns.root-servers.test.
+org.              3600 IN NS   ns.org.
+ns.org.           3600 IN A    127.0.0.2
+net.              3600 IN NS   ns.net.
+ns.net.           3600 IN A    127.0.0.4
+`
+
+const dbOrg = `
+org.              3600 IN SOA  ns.org. hostmaster.org. 1 3600 600 86400 300
+org.              3600 IN NS   ns.org.
+ns.org.           3600 IN A    127.0.0.2
+example.org.      3600 IN NS   ns.example.org.
+example.org.      3600 IN NS   ns2.example.org.
+ns.example.org.   3600 IN A    127.0.0.3
+ns2.example.org.  3600 IN A    127.0.0.5
+other.org.        3600 IN NS   ns.example.net.
+signed.org.       3600 IN NS   ns.example.org.
+`
+
+const dbExampleOrg = `
+example.org.         3600 IN SOA   ns.example.org. hostmaster.example.org. 1 3600 600 86400 300
+example.org.         3600 IN NS    ns.example.org.
+example.org.         3600 IN NS    ns2.example.org.
+ns.example.org.      3600 IN A     127.0.0.3
+ns2.example.org.     3600 IN A     127.0.0.5
+www.example.org.     3600 IN A     192.0.2.1
+cname.example.org.   3600 IN CNAME www.other.org.
+a.b.c.example.org.   3600 IN TXT   "deep"
+`
+
+const dbOtherOrg = `
+other.org.           3600 IN SOA   ns.example.net. hostmaster.other.org. 1 3600 600 86400 300
+other.org.           3600 IN NS    ns.example.net.
+www.other.org.       3600 IN A     192.0.2.2
+`
+
+// dbSignedOrg is signed, the signatures aren't valid, but they aren't checked.
+const dbSignedOrg = `
+signed.org.          3600 IN SOA   ns.example.org. hostmaster.signed.org. 1 3600 600 86400 300
+signed.org.          3600 IN RRSIG SOA 8 2 3600 20300101000000 20200101000000 12345 signed.org. AAAA
+signed.org.          3600 IN NS    ns.example.org.
+signed.org.          3600 IN RRSIG NS 8 2 3600 20300101000000 20200101000000 12345 signed.org. AAAA
+signed.org.          300  IN NSEC  www.signed.org. SOA NS RRSIG NSEC
+signed.org.          300  IN RRSIG NSEC 8 2 300 20300101000000 20200101000000 12345 signed.org. AAAA
+www.signed.org.      3600 IN A     192.0.2.3
+www.signed.org.      3600 IN RRSIG A 8 3 3600 20300101000000 20200101000000 12345 signed.org. AAAA
+www.signed.org.      300  IN NSEC  signed.org. A RRSIG NSEC
+www.signed.org.      300  IN RRSIG NSEC 8 3 300 20300101000000 20200101000000 12345 signed.org. AAAA
+`
+
+const dbNet = `
+net.                 3600 IN SOA   ns.net. hostmaster.net. 1 3600 600 86400 300
+net.                 3600 IN NS    ns.net.
+ns.net.              3600 IN A     127.0.0.4
+example.net.         3600 IN NS    ns2.example.net.
+ns2.example.net.     3600 IN A     127.0.0.4
+`
+
+const dbExampleNet = `
+example.net.         3600 IN SOA   ns2.example.net. hostmaster.example.net. 1 3600 600 86400 300
+example.net.         3600 IN NS    ns2.example.net.
+ns2.example.net.     3600 IN A     127.0.0.4
+ns.example.net.      3600 IN A     127.0.0.3
+`
+
+// authServer is an authoritative name server for the zones in f, that logs the questions it gets.
+type authServer struct {
+	f file.File
+
+	mu        sync.Mutex
+	questions []dns.Question
+	spoof     map[string][]dns.RR // records added to the answer and additional sections of the responses for a name
+}
+
+func (a *authServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	a.mu.Lock()
+	a.questions = append(a.questions, r.Question[0])
+	spoof := a.spoof[strings.ToLower(r.Question[0].Name)]
+	a.mu.Unlock()
+
+	nw := nonwriter.New(w)
+	rcode, _ := a.f.ServeDNS(context.TODO(), nw, r)
+	m := nw.Msg
+	if m == nil {
+		m = new(dns.Msg)
+		m.SetRcode(r, rcode)
+	}
+	// The file plugin fails to look up CNAME targets outside the zone without a server; a plain authoritative
+	// name server just returns the CNAME record.
+	if m.Rcode == dns.RcodeServerFailure && len(m.Answer) > 0 {
+		m.Rcode = dns.RcodeSuccess
+	}
+	m.Answer = append(m.Answer, spoof...)
+	m.Extra = append(m.Extra, spoof...)
+	w.WriteMsg(m)
+}
+
+func (a *authServer) asked(name string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, q := range a.questions {
+		if strings.EqualFold(q.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func newAuthServer(t *testing.T, zones map[string]string) *authServer {
+	t.Helper()
+	f := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{}}}
+	for origin, db := range zones {
+		z, err := file.Parse(strings.NewReader(db), origin, "stdin", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Zones.Z[origin] = z
+		f.Zones.Names = append(f.Zones.Names, origin)
+	}
+	return &authServer{f: f}
+}
+
+// startServers starts the name servers on their addresses, all on the same port, which is returned.
+func startServers(t *testing.T, servers map[string]*authServer) string {
+	t.Helper()
+	for try := 0; try < 10; try++ {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+		pc.Close()
+
+		started := []*dns.Server{}
+		ok := true
+		for addr, a := range servers {
+			pc, err := net.ListenPacket("udp", net.JoinHostPort(addr, port))
+			if err != nil {
+				ok = false
+				break
+			}
+			l, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+			if err != nil {
+				pc.Close()
+				ok = false
+				break
+			}
+			for _, s := range []*dns.Server{{PacketConn: pc, Handler: a}, {Listener: l, Handler: a}} {
+				waitLock := sync.Mutex{}
+				waitLock.Lock()
+				s.NotifyStartedFunc = waitLock.Unlock
+				go s.ActivateAndServe()
+				waitLock.Lock()
+				started = append(started, s)
+			}
+		}
+		t.Cleanup(func() {
+			for _, s := range started {
+				s.Shutdown()
+			}
+		})
+		if ok {
+			return port
+		}
+		for _, s := range started {
+			s.Shutdown()
+		}
+		started = nil
+	}
+	t.Fatal("Failed to start the name servers")
+	return ""
+}
+
+func newTestRecursive(t *testing.T) (*Recursive, map[string]*authServer) {
+	t.Helper()
+	servers := map[string]*authServer{
+		"127.0.0.1": newAuthServer(t, map[string]string{".": dbRoot}),
+		"127.0.0.2": newAuthServer(t, map[string]string{"org.": dbOrg}),
+		"127.0.0.3": newAuthServer(t, map[string]string{"example.org.": dbExampleOrg, "other.org.": dbOtherOrg, "signed.org.": dbSignedOrg}),
+		"127.0.0.4": newAuthServer(t, map[string]string{"net.": dbNet, "example.net.": dbExampleNet}),
+	}
+	// 127.0.0.5 is a name server of example.org. that doesn't answer.
+	port := startServers(t, servers)
+
+	r := New([]string{"."})
+	r.Next = test.ErrorHandler()
+	r.hints = []string{"127.0.0.1"}
+	r.port = port
+	r.timeout = 500 * time.Millisecond
+	return r, servers
+}
+
+func TestRecursive(t *testing.T) {
+	r, _ := newTestRecursive(t)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer []dns.RR
+	}{
+		{"www.example.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{test.A("www.example.org. 3600 IN A 192.0.2.1")}},
+		{"www.example.org.", dns.TypeAAAA, dns.RcodeSuccess, nil},
+		{"nx.example.org.", dns.TypeA, dns.RcodeNameError, nil},
+		{"a.b.c.example.org.", dns.TypeTXT, dns.RcodeSuccess, []dns.RR{test.TXT(`a.b.c.example.org. 3600 IN TXT "deep"`)}},
+		// other.org. is delegated without glue, the address of ns.example.net. is resolved first.
+		{"www.other.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{test.A("www.other.org. 3600 IN A 192.0.2.2")}},
+		{"cname.example.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{
+			test.CNAME("cname.example.org. 3600 IN CNAME www.other.org."),
+			test.A("www.other.org. 3600 IN A 192.0.2.2"),
+		}},
+		{"nx.example.com.", dns.TypeA, dns.RcodeNameError, nil},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := r.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[resp.Rcode])
+		}
+		if !resp.RecursionAvailable || resp.Authoritative {
+			t.Errorf("Test %d: expected RA and no AA, got %t and %t", i, resp.RecursionAvailable, resp.Authoritative)
+		}
+		if err := test.Section(test.Case{Answer: tc.answer}, test.Answer, resp.Answer); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+		if tc.rcode == dns.RcodeNameError && !hasSOA(resp.Ns) {
+			t.Errorf("Test %d: expected an SOA record in the authority section", i)
+		}
+	}
+
+	if zone, _ := r.delegations.closest("www.example.org."); zone != "example.org." {
+		t.Errorf("Expected the delegation of example.org. to be cached, got %s", zone)
+	}
+}
+
+func TestRecursiveDNSSEC(t *testing.T) {
+	r, _ := newTestRecursive(t)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		do    bool
+		ns    []uint16 // the types in the authority section
+	}{
+		{"www.signed.org.", dns.TypeA, true, nil}, // no NS records, nor their signatures
+		{"www.signed.org.", dns.TypeMX, true, []uint16{dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeRRSIG}},
+		{"nx.signed.org.", dns.TypeA, true, []uint16{dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeRRSIG}}, // the NSEC record of the apex covers the wildcard too
+		{"nx.signed.org.", dns.TypeA, false, []uint16{dns.TypeSOA}},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r.ServeDNS(context.TODO(), rec, m)
+
+		ns := []uint16{}
+		for _, rr := range rec.Msg.Ns {
+			ns = append(ns, rr.Header().Rrtype)
+		}
+		if len(ns) != len(tc.ns) {
+			t.Errorf("Test %d: expected %d records in the authority section, got %v", i, len(tc.ns), rec.Msg.Ns)
+			continue
+		}
+		for j := range ns {
+			if ns[j] != tc.ns[j] {
+				t.Errorf("Test %d: expected a %s record, got %s", i, dns.TypeToString[tc.ns[j]], rec.Msg.Ns[j])
+			}
+		}
+	}
+}
+
+func TestRecursiveOutOfZone(t *testing.T) {
+	r, servers := newTestRecursive(t)
+	servers["127.0.0.3"].mu.Lock()
+	servers["127.0.0.3"].spoof = map[string][]dns.RR{
+		"cname.example.org.": {test.A("www.other.org. 3600 IN A 192.0.2.66"), test.A("www.example.net. 3600 IN A 192.0.2.66")},
+	}
+	servers["127.0.0.3"].mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetQuestion("cname.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	r.ServeDNS(context.TODO(), rec, m)
+
+	answer := []dns.RR{
+		test.CNAME("cname.example.org. 3600 IN CNAME www.other.org."),
+		test.A("www.other.org. 3600 IN A 192.0.2.2"),
+	}
+	if err := test.Section(test.Case{Answer: answer}, test.Answer, rec.Msg.Answer); err != nil {
+		t.Error(err)
+	}
+	if len(rec.Msg.Ns) != 0 || len(rec.Msg.Extra) != 0 {
+		t.Errorf("Expected empty authority and additional sections, got %s", rec.Msg)
+	}
+}
+
+func TestRecursiveMinimisation(t *testing.T) {
+	for _, minimise := range []bool{true, false} {
+		r, servers := newTestRecursive(t)
+		r.minimise = minimise
+
+		m := new(dns.Msg)
+		m.SetQuestion("a.b.c.example.org.", dns.TypeTXT)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		r.ServeDNS(context.TODO(), rec, m)
+		if len(rec.Msg.Answer) != 1 {
+			t.Fatalf("Expected an answer, got %s", rec.Msg)
+		}
+
+		// With QNAME minimisation, the root and org. name servers only see the names one label below their zone.
+		for _, s := range []string{"127.0.0.1", "127.0.0.2"} {
+			if x := servers[s].asked("a.b.c.example.org."); x == minimise {
+				t.Errorf("Expected name server %s to be asked for the full name to be %t, got %t", s, !minimise, x)
+			}
+		}
+		if minimise && (!servers["127.0.0.1"].asked("org.") || !servers["127.0.0.3"].asked("b.c.example.org.")) {
+			t.Errorf("Expected the minimised names to be asked")
+		}
+	}
+}
+
+func TestRecursiveSpoofed(t *testing.T) {
+	// A name server that doesn't return the case of the name as asked.
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Question[0].Name = strings.ToLower(m.Question[0].Name)
+		w.WriteMsg(m)
+	})
+	defer s.Close()
+	host, port, _ := net.SplitHostPort(s.Addr)
+
+	r := New([]string{"."})
+	r.port = port
+	res := &resolution{r: r, ctx: context.TODO()}
+
+	m := new(dns.Msg)
+	m.SetQuestion("WwW.example.org.", dns.TypeA)
+	if _, err := res.exchange(m, host); err == nil {
+		t.Errorf("Expected an error for a response with a different question")
+	}
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	if _, err := res.exchange(m, host); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+}
+
+func TestRandomCase(t *testing.T) {
+	name := "abcdefghijklmnopqrstuvwxyz-0123456789.example.org."
+	changed := false
+	for i := 0; i < 10; i++ {
+		x := randomCase(name)
+		if !strings.EqualFold(x, name) {
+			t.Fatalf("Expected %s to be %s in another case", x, name)
+		}
+		changed = changed || x != name
+	}
+	if !changed {
+		t.Errorf("Expected the case of %s to be randomised", name)
+	}
+}
+
+func TestRTTSort(t *testing.T) {
+	rtt := newRTTTable()
+	rtt.update("192.0.2.1", 100*time.Millisecond)
+	rtt.update("192.0.2.2", 10*time.Millisecond)
+	rtt.update("192.0.2.2", 2*time.Second) // a timeout
+	rtt.update("192.0.2.3", 50*time.Millisecond)
+
+	sorted := rtt.sort([]string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"})
+	expect := []string{"192.0.2.4", "192.0.2.3", "192.0.2.1", "192.0.2.2"}
+	for i := range expect {
+		if sorted[i] != expect[i] {
+			t.Fatalf("Expected %v, got %v", expect, sorted)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package recursive
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxDepth   = 8  // the maximum nesting of resolutions, for the addresses of name servers and CNAME targets
+	maxQueries = 64 // the maximum number of queries sent to name servers for a single request
+	maxCNAME   = 8  // the maximum length of a CNAME chain
+	maxNSNames = 3  // the maximum number of name server names without glue that are resolved for a delegation
+)
+
+var (
+	errMaxDepth   = errors.New("maximum depth reached")
+	errMaxQueries = errors.New("maximum number of queries reached")
+	errCNAMELoop  = errors.New("CNAME chain too long")
+	errLame       = errors.New("lame delegation")
+	errNoServers  = errors.New("no addresses for the name servers")
+)
+
+// resolution is the resolution of a single request.
+type resolution struct {
+	r      *Recursive
+	ctx    context.Context
+	server string
+	do     bool
+
+	minimise bool // cleared when a name server doesn't cope with QNAME minimisation
+	queries  int
+}
+
+// resolve resolves qname and qtype, following CNAME records.
+func (s *resolution) resolve(qname string, qtype uint16, depth int) (*dns.Msg, error) {
+	if depth > maxDepth {
+		return nil, errMaxDepth
+	}
+
+	var chain []dns.RR
+	seen := map[string]bool{}
+	for i := 0; i < maxCNAME; i++ {
+		seen[strings.ToLower(qname)] = true
+		m, err := s.iterate(qname, qtype, depth)
+		if err != nil {
+			return nil, err
+		}
+		target, follow := cnameTarget(m, qname, qtype)
+		if !follow {
+			m.Answer = append(chain, m.Answer...)
+			return m, nil
+		}
+		if seen[strings.ToLower(target)] {
+			return nil, errCNAMELoop
+		}
+		chain = append(chain, m.Answer...)
+		qname = target
+	}
+	return nil, errCNAMELoop
+}
+
+// iterate follows the delegations to the name servers of qname, and returns their answer.
+func (s *resolution) iterate(qname string, qtype uint16, depth int) (*dns.Msg, error) {
+	// The DS records are in the zone above the zone cut.
+	apex := qname
+	if qtype == dns.TypeDS && qname != "." {
+		apex = parent(qname)
+	}
+	zone, d := s.r.delegations.closest(apex)
+	servers := s.r.hints
+	if d != nil {
+		servers = d.addrs
+	}
+	known := zone // the longest name that is known to be in zone
+	minimise := s.minimise
+
+	for {
+		name, qt := qname, qtype
+		if minimise && dns.CountLabel(qname)-dns.CountLabel(known) > 1 {
+			// RFC 9156, section 2.1: ask for the A records of the name one label below what is known.
+			name, qt = child(known, qname), dns.TypeA
+		}
+
+		m, err := s.query(servers, name, qt)
+		if err != nil {
+			return nil, err
+		}
+
+		if cut := referral(m, zone, name); cut != "" {
+			d := newDelegation(m, zone, cut)
+			if len(d.addrs) == 0 {
+				d.addrs = s.resolveAddrs(d.ns, depth)
+			}
+			if len(d.addrs) == 0 {
+				return nil, errNoServers
+			}
+			s.r.delegations.add(cut, d)
+			zone, known, servers = cut, cut, d.addrs
+			continue
+		}
+
+		if name != qname || qt != qtype {
+			if m.Rcode != dns.RcodeSuccess {
+				// The name server may not handle empty non-terminals properly, ask for the full name.
+				minimise, s.minimise = false, false
+				continue
+			}
+			known = name
+			continue
+		}
+
+		// Only the records in zone can come from its name servers; others, like the records of the target of a
+		// CNAME in another zone, may be spoofed. A CNAME target out of zone is resolved from its own delegation.
+		m.Answer, m.Ns = inZone(m.Answer, zone), inZone(m.Ns, zone)
+		if len(m.Answer) == 0 && m.Rcode == dns.RcodeSuccess && !m.Authoritative && !hasSOA(m.Ns) {
+			return nil, errLame
+		}
+		return m, nil
+	}
+}
+
+// resolveAddrs resolves the addresses of the name servers ns, for a delegation without glue.
+func (s *resolution) resolveAddrs(ns []string, depth int) []string {
+	addrs := []string{}
+	for i, name := range ns {
+		if i == maxNSNames {
+			break
+		}
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			m, err := s.resolve(name, qtype, depth+1)
+			if err != nil {
+				log.Debugf("Failed to resolve the name server %s: %s", name, err)
+				break
+			}
+			addrs = append(addrs, addresses(m.Answer, name)...)
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+	return addrs
+}
+
+// cnameTarget returns the name the CNAME chain in the answer of m ends at, if it doesn't have the records of type
+// qtype, and they need to be resolved separately.
+func cnameTarget(m *dns.Msg, qname string, qtype uint16) (string, bool) {
+	if m.Rcode != dns.RcodeSuccess || qtype == dns.TypeCNAME {
+		return "", false
+	}
+	target := qname
+	for i := 0; i <= len(m.Answer); i++ {
+		next := ""
+		for _, rr := range m.Answer {
+			if !strings.EqualFold(rr.Header().Name, target) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype || qtype == dns.TypeANY {
+				return "", false
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				next = cname.Target
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+	}
+	if target == qname {
+		return "", false
+	}
+	return target, true
+}
+
+// referral returns the zone cut m is a referral to, or the empty string if m isn't a referral. The zone cut must be
+// below zone, the zone of the name servers that were asked, and at or above name.
+func referral(m *dns.Msg, zone, name string) string {
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) > 0 || hasSOA(m.Ns) {
+		return ""
+	}
+	for _, rr := range m.Ns {
+		if rr.Header().Rrtype != dns.TypeNS {
+			continue
+		}
+		cut := rr.Header().Name
+		if dns.IsSubDomain(zone, cut) && !strings.EqualFold(zone, cut) && dns.IsSubDomain(cut, name) {
+			return strings.ToLower(cut)
+		}
+	}
+	return ""
+}
+
+func hasSOA(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return true
+		}
+	}
+	return false
+}
+
+// inZone returns the records in rrs that are in zone.
+func inZone(rrs []dns.RR, zone string) []dns.RR {
+	var in []dns.RR
+	for _, rr := range rrs {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			in = append(in, rr)
+		}
+	}
+	return in
+}
+
+// addresses returns the addresses in the A and AAAA records of name in rrs.
+func addresses(rrs []dns.RR, name string) []string {
+	addrs := []string{}
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		switch x := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, x.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, x.AAAA.String())
+		}
+	}
+	return addrs
+}
+
+// child returns the name one label below ancestor on the way to name.
+func child(ancestor, name string) string {
+	idx := dns.Split(name)
+	return name[idx[len(idx)-dns.CountLabel(ancestor)-1]:]
+}
+
+// parent returns the name one label above name.
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
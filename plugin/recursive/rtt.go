@@ -0,0 +1,60 @@
+package recursive
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/rand"
+)
+
+const (
+	rttAvgWeight = 8
+	maxRTTs      = 10000 // the table is emptied when it grows beyond this
+)
+
+var rn = rand.New(time.Now().UnixNano())
+
+// rttTable holds the smoothed round trip time of the name servers, to pick the fastest one to ask.
+type rttTable struct {
+	mu sync.Mutex
+	m  map[string]time.Duration
+}
+
+func newRTTTable() *rttTable { return &rttTable{m: map[string]time.Duration{}} }
+
+// get returns the smoothed round trip time to addr. It is zero if no exchange has been measured yet.
+func (t *rttTable) get(addr string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.m[addr]
+}
+
+// update moves the smoothed round trip time of addr towards the observed duration d. The first observation is taken
+// as is. A timeout is observed as the timeout itself.
+func (t *rttTable) update(addr string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.m) >= maxRTTs {
+		t.m = map[string]time.Duration{}
+	}
+	avg, ok := t.m[addr]
+	if !ok {
+		t.m[addr] = d
+		return
+	}
+	t.m[addr] = avg + (d-avg)/rttAvgWeight
+}
+
+// sort returns addrs ordered by their round trip time. Name servers that haven't been asked yet come first, so all of
+// them get measured; ties are broken randomly.
+func (t *rttTable) sort(addrs []string) []string {
+	sorted := make([]string, len(addrs))
+	for i, j := range rn.Perm(len(addrs)) {
+		sorted[i] = addrs[j]
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sort.SliceStable(sorted, func(i, j int) bool { return t.m[sorted[i]] < t.m[sorted[j]] })
+	return sorted
+}
@@ -0,0 +1,91 @@
+package recursive
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("recursive", setup) }
+
+func setup(c *caddy.Controller) error {
+	r, err := parse(c)
+	if err != nil {
+		return plugin.Error("recursive", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		r.Next = next
+		return r
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Recursive, error) {
+	config := dnsserver.GetConfig(c)
+	var r *Recursive
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		r = New(plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys))
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "root_hints":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				path := args[0]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				hints, err := readHints(path)
+				if err != nil {
+					return nil, c.Errf("failed to read root hints: %s", err)
+				}
+				r.hints = hints
+			case "timeout":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Errf("invalid duration for timeout '%s'", args[0])
+				}
+				if d <= 0 {
+					return nil, c.Errf("invalid timeout '%s', must be positive", args[0])
+				}
+				r.timeout = d
+			case "disable":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					switch a {
+					case "qname_minimisation":
+						r.minimise = false
+					case "0x20":
+						r.use0x20 = false
+					default:
+						return nil, c.Errf("unknown feature '%s'; expect 'qname_minimisation' or '0x20'", a)
+					}
+				}
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return r, nil
+}
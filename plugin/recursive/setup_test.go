@@ -0,0 +1,65 @@
+package recursive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	hints := filepath.Join(t.TempDir(), "named.root")
+	if err := os.WriteFile(hints, []byte(`
+.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+A.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:ba3e::2:30
+B.EXAMPLE.NET.           3600000      A     192.0.2.1
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config   string
+		wantErr  bool
+		hints    int
+		minimise bool
+		use0x20  bool
+		timeout  time.Duration
+	}{
+		{"recursive", false, len(root), true, true, defaultTimeout},
+		{"recursive . {\nroot_hints " + hints + "\ntimeout 500ms\n}", false, 2, true, true, 500 * time.Millisecond},
+		{"recursive {\ndisable qname_minimisation 0x20\n}", false, len(root), false, false, defaultTimeout},
+		{"recursive {\ndisable 0x20\n}", false, len(root), true, false, defaultTimeout},
+		{"recursive {\ndisable foo\n}", true, 0, false, false, 0},
+		{"recursive {\ndisable\n}", true, 0, false, false, 0},
+		{"recursive {\ntimeout -1s\n}", true, 0, false, false, 0},
+		{"recursive {\ntimeout foo\n}", true, 0, false, false, 0},
+		{"recursive {\nroot_hints " + filepath.Join(t.TempDir(), "missing") + "\n}", true, 0, false, false, 0},
+		{"recursive {\nfoo\n}", true, 0, false, false, 0},
+		{"recursive\nrecursive", true, 0, false, false, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		r, err := parse(c)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(r.hints) != tc.hints {
+			t.Errorf("Test %d: expected %d root hints, got %d", i, tc.hints, len(r.hints))
+		}
+		if r.minimise != tc.minimise || r.use0x20 != tc.use0x20 {
+			t.Errorf("Test %d: expected minimise %t and 0x20 %t, got %t and %t", i, tc.minimise, tc.use0x20, r.minimise, r.use0x20)
+		}
+		if r.timeout != tc.timeout {
+			t.Errorf("Test %d: expected timeout %s, got %s", i, tc.timeout, r.timeout)
+		}
+	}
+}
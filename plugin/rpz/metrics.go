@@ -0,0 +1,25 @@
+package rpz
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HitCount is the number of queries a policy rule applied to.
+	HitCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "hits_total",
+		Help:      "Counter of queries a policy rule applied to.",
+	}, []string{"server", "zone", "trigger", "action"})
+	// ruleCount is the number of rules in a policy zone.
+	ruleCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "rules",
+		Help:      "The number of rules in a policy zone.",
+	}, []string{"zone"})
+)
@@ -0,0 +1,112 @@
+package rpz
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	nsCacheSize = 10000     // number of names the NS lookups are cached for
+	nsMaxTTL    = time.Hour // maximum time an NS lookup is cached
+)
+
+// nsEntry is the cached result of the NS lookup for name.
+type nsEntry struct {
+	name   string
+	ns     []string // the names of the name servers, if name has NS records
+	zone   string   // otherwise the owner of the SOA record in the response, if any
+	expire time.Time
+}
+
+// nameServers returns the names of the name servers for the query: the names in the NS records of the response res,
+// followed by the name servers of the zone of the query name. That zone is the owner of the SOA record in the
+// authority section of res, or else the closest enclosing name with NS records.
+func (x *RPZ) nameServers(ctx context.Context, state request.Request, res *dns.Msg) []string {
+	var names []string
+	name := strings.ToLower(state.Name())
+	for _, section := range [][]dns.RR{res.Answer, res.Ns} {
+		for _, rr := range section {
+			switch rr := rr.(type) {
+			case *dns.NS:
+				names = append(names, strings.ToLower(rr.Ns))
+			case *dns.SOA:
+				name = strings.ToLower(rr.Hdr.Name)
+			}
+		}
+	}
+
+	for {
+		e := x.lookupNS(ctx, state, name)
+		if e == nil {
+			return names
+		}
+		if len(e.ns) > 0 {
+			return append(names, e.ns...)
+		}
+		// Go to the zone of the SOA record, or else one label up.
+		if e.zone != "" && e.zone != name && dns.IsSubDomain(e.zone, name) {
+			name = e.zone
+			continue
+		}
+		off, end := dns.NextLabel(name, 0)
+		if end {
+			return names
+		}
+		name = name[off:]
+	}
+}
+
+// lookupNS returns the result of the NS lookup for name, from the cache or from the next plugin. It returns nil if
+// the lookup failed.
+func (x *RPZ) lookupNS(ctx context.Context, state request.Request, name string) *nsEntry {
+	now := time.Now()
+	key := cache.Hash([]byte(name))
+	if v, ok := x.ns.Get(key); ok {
+		if e := v.(*nsEntry); e.name == name && now.Before(e.expire) {
+			return e
+		}
+	}
+
+	req := state.NewWithQuestion(name, dns.TypeNS)
+	nw := nonwriter.New(state.W)
+	plugin.NextOrFailure(x.Name(), x.Next, ctx, nw, req.Req)
+	m := nw.Msg
+	if m == nil || (m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError) {
+		return nil
+	}
+
+	e := &nsEntry{name: name}
+	ttl := uint32(nsMaxTTL.Seconds())
+	for _, rr := range m.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			e.ns = append(e.ns, strings.ToLower(ns.Ns))
+			ttl = min32(ttl, ns.Hdr.Ttl)
+		}
+	}
+	if len(e.ns) == 0 {
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				e.zone = strings.ToLower(soa.Hdr.Name)
+				ttl = min32(ttl, min32(soa.Hdr.Ttl, soa.Minttl))
+			}
+		}
+	}
+	e.expire = now.Add(time.Duration(ttl) * time.Second)
+	x.ns.Add(key, e)
+	return e
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,44 @@
+package rpz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestNameServers(t *testing.T) {
+	lookups := 0
+	next := backend()
+	x := &RPZ{ns: cache.New(nsCacheSize), Next: test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		lookups++
+		return next.ServeDNS(ctx, w, r)
+	})}
+
+	for i, tc := range []struct {
+		qname   string
+		lookups int
+	}{
+		{"www.example.net.", 2}, // www.example.net. NS has the SOA of example.net.
+		{"www.example.net.", 2}, // cached
+		{"a.b.example.net.", 4}, // a.b.example.net. and b.example.net. have no NS records, example.net. is cached
+	} {
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, dns.TypeA)
+		state := request.Request{W: &test.ResponseWriter{}, Req: r}
+		res := new(dns.Msg)
+		res.SetReply(r)
+
+		ns := x.nameServers(context.TODO(), state, res)
+		if len(ns) != 1 || ns[0] != "ns.evil.example." {
+			t.Errorf("Test %d: expected name server ns.evil.example. for %s, got %v", i, tc.qname, ns)
+		}
+		if lookups != tc.lookups {
+			t.Errorf("Test %d: expected %d lookups, got %d", i, tc.lookups, lookups)
+		}
+	}
+}
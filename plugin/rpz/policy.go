@@ -0,0 +1,320 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+// The labels that put the triggers of a policy zone below the origin in separate subtrees.
+const (
+	clientIPLabel = "rpz-client-ip"
+	ipLabel       = "rpz-ip"
+	nsdnameLabel  = "rpz-nsdname"
+	nsipLabel     = "rpz-nsip"
+)
+
+// action is the policy action of a rule.
+type action int
+
+const (
+	actionNXDomain action = iota
+	actionNoData
+	actionPassthru
+	actionDrop
+	actionTCPOnly
+	actionLocalData
+)
+
+var actionNames = [...]string{"nxdomain", "nodata", "passthru", "drop", "tcp-only", "local-data"}
+
+func (a action) String() string { return actionNames[a] }
+
+// trigger is what a rule matches on.
+type trigger int
+
+const (
+	triggerClientIP trigger = iota
+	triggerQName
+	triggerResponseIP
+	triggerNSDName
+)
+
+var triggerNames = [...]string{"client-ip", "qname", "response-ip", "nsdname"}
+
+func (t trigger) String() string { return triggerNames[t] }
+
+// rule is a rule of a policy zone.
+type rule struct {
+	owner  string   // owner name of the rule in the policy zone
+	action action   //
+	data   []dns.RR // local data, for actionLocalData
+	prefix int      // prefix length of IP triggers
+}
+
+// newRule returns the rule for the records rrs at owner. The action is encoded in a CNAME record, any other
+// records are local data.
+func newRule(owner string, rrs []dns.RR) *rule {
+	r := &rule{owner: owner, action: actionLocalData, data: rrs}
+	if len(rrs) != 1 {
+		return r
+	}
+	cname, ok := rrs[0].(*dns.CNAME)
+	if !ok {
+		return r
+	}
+	switch cname.Target {
+	case ".":
+		r.action = actionNXDomain
+	case "*.":
+		r.action = actionNoData
+	case "rpz-passthru.":
+		r.action = actionPassthru
+	case "rpz-drop.":
+		r.action = actionDrop
+	case "rpz-tcp-only.":
+		r.action = actionTCPOnly
+	default:
+		return r
+	}
+	r.data = nil
+	return r
+}
+
+// names holds the rules of name triggers.
+type names struct {
+	exact    map[string]*rule
+	wildcard map[string]*rule // rules for *.NAME, keyed by NAME
+}
+
+func newNames() names {
+	return names{exact: make(map[string]*rule), wildcard: make(map[string]*rule)}
+}
+
+func (n names) add(name string, r *rule) {
+	if name == "*." {
+		n.wildcard["."] = r
+		return
+	}
+	if strings.HasPrefix(name, "*.") {
+		n.wildcard[name[2:]] = r
+		return
+	}
+	n.exact[name] = r
+}
+
+// match returns the rule for name: the rule for name itself, or else the wildcard rule of the closest
+// enclosing name. Name must be lower case.
+func (n names) match(name string) *rule {
+	if r, ok := n.exact[name]; ok {
+		return r
+	}
+	if len(n.wildcard) == 0 {
+		return nil
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if r, ok := n.wildcard[name[off:]]; ok {
+			return r
+		}
+	}
+	if name != "." {
+		return n.wildcard["."]
+	}
+	return nil
+}
+
+// rules are the rules of a policy zone, by trigger.
+type rules struct {
+	soa        *dns.SOA
+	qname      names
+	nsdname    names
+	clientIP   *iptree.Tree
+	responseIP *iptree.Tree
+	response   bool // true if there are response IP or NSDNAME rules
+}
+
+// compile returns the rules of the policy zone origin, with the records in t.
+func compile(origin string, t *tree.Tree, soa *dns.SOA) *rules {
+	rs := &rules{
+		soa:        soa,
+		qname:      newNames(),
+		nsdname:    newNames(),
+		clientIP:   iptree.NewTree(),
+		responseIP: iptree.NewTree(),
+	}
+	n := 0
+	for _, e := range t.All() {
+		owner := e.Name()
+		if owner == origin || !dns.IsSubDomain(origin, owner) {
+			continue
+		}
+		var rrs []dns.RR
+		for _, rr := range e.All() {
+			switch rr.Header().Rrtype {
+			case dns.TypeRRSIG, dns.TypeNSEC:
+			default:
+				rrs = append(rrs, rr)
+			}
+		}
+		if len(rrs) == 0 {
+			continue
+		}
+
+		r := newRule(owner, rrs)
+		name := strings.TrimSuffix(owner, origin) // name with the trigger label, with a trailing dot
+		labels := dns.SplitDomainName(name)
+		switch labels[len(labels)-1] {
+		case clientIPLabel, ipLabel:
+			ipnet, err := ipTrigger(labels[:len(labels)-1])
+			if err != nil {
+				log.Warningf("Ignoring rule %q in %q: %s", owner, origin, err)
+				continue
+			}
+			r.prefix, _ = ipnet.Mask.Size()
+			if labels[len(labels)-1] == clientIPLabel {
+				rs.clientIP.InplaceInsertNet(ipnet, r)
+			} else {
+				rs.responseIP.InplaceInsertNet(ipnet, r)
+				rs.response = true
+			}
+		case nsdnameLabel:
+			rs.nsdname.add(strings.TrimSuffix(name, nsdnameLabel+"."), r)
+			rs.response = true
+		case nsipLabel:
+			log.Warningf("Ignoring rule %q in %q: NSIP triggers are not supported", owner, origin)
+			continue
+		default:
+			// The legacy way of specifying passthru is a CNAME to the name itself.
+			if cname, ok := rrs[0].(*dns.CNAME); ok && len(rrs) == 1 && cname.Target == name {
+				r.action, r.data = actionPassthru, nil
+			}
+			rs.qname.add(name, r)
+		}
+		n++
+	}
+	ruleCount.WithLabelValues(origin).Set(float64(n))
+	return rs
+}
+
+// ipTrigger returns the network encoded in the labels of an IP trigger: the prefix length followed by the
+// address in reverse order, e.g. 24.0.2.0.192 for 192.0.2.0/24, or 64.zz.db8.2001 for 2001:db8::/64.
+func ipTrigger(labels []string) (*net.IPNet, error) {
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("not an IP trigger")
+	}
+	prefix, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix length %q", labels[0])
+	}
+	addr := make([]string, 0, len(labels)-1)
+	for i := len(labels) - 1; i > 0; i-- {
+		addr = append(addr, labels[i])
+	}
+
+	if ip := net.ParseIP(strings.Join(addr, ".")).To4(); ip != nil && len(addr) == 4 {
+		if prefix < 1 || prefix > 32 {
+			return nil, fmt.Errorf("invalid IPv4 prefix length %d", prefix)
+		}
+		mask := net.CIDRMask(prefix, 32)
+		return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+	}
+
+	s := strings.Replace(strings.Join(addr, ":"), "zz", "", 1)
+	switch {
+	case s == "":
+		s = "::"
+	case strings.HasPrefix(s, ":") && !strings.HasPrefix(s, "::"):
+		s = ":" + s
+	case strings.HasSuffix(s, ":") && !strings.HasSuffix(s, "::"):
+		s += ":"
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil || prefix < 1 || prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 trigger")
+	}
+	mask := net.CIDRMask(prefix, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// matchIP returns the rule in t for the longest prefix that matches any of the addresses in rrs.
+func matchIP(t *iptree.Tree, rrs []dns.RR) *rule {
+	var best *rule
+	for _, rr := range rrs {
+		var ip net.IP
+		switch v := rr.(type) {
+		case *dns.A:
+			ip = v.A
+		case *dns.AAAA:
+			ip = v.AAAA
+		default:
+			continue
+		}
+		if v, ok := t.GetByIP(ip); ok {
+			if r := v.(*rule); best == nil || r.prefix > best.prefix {
+				best = r
+			}
+		}
+	}
+	return best
+}
+
+// matchNSDName returns the rule for the first name server name that matches. The names are only asked for when
+// there are NSDNAME rules.
+func (rs *rules) matchNSDName(names func() []string) *rule {
+	if len(rs.nsdname.exact) == 0 && len(rs.nsdname.wildcard) == 0 {
+		return nil
+	}
+	for _, name := range names() {
+		if r := rs.nsdname.match(name); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// policyZone is a policy zone, loaded from a file or transferred from a primary.
+type policyZone struct {
+	name string
+	z    *file.Zone
+
+	mu       sync.Mutex   // serializes compiling
+	compiled atomic.Value // *compiled
+}
+
+// compiled holds the rules compiled from the tree of the zone.
+type compiled struct {
+	tree  *tree.Tree
+	rules *rules
+}
+
+// current returns the rules of the zone, compiling them when the zone has changed. It returns nil when the
+// zone isn't loaded or has expired.
+func (p *policyZone) current() *rules {
+	p.z.RLock()
+	t, soa, expired := p.z.Tree, p.z.Apex.SOA, p.z.Expired
+	p.z.RUnlock()
+	if soa == nil || expired {
+		return nil
+	}
+	if c, ok := p.compiled.Load().(*compiled); ok && c.tree == t {
+		return c.rules
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.compiled.Load().(*compiled); ok && c.tree == t {
+		return c.rules
+	}
+	c := &compiled{tree: t, rules: compile(p.name, t, soa)}
+	p.compiled.Store(c)
+	return c.rules
+}
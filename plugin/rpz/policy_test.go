@@ -0,0 +1,155 @@
+package rpz
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/file"
+)
+
+const policyZoneData = `$ORIGIN rpz.example.
+$TTL 300
+@                     SOA   ns.rpz.example. hostmaster.rpz.example. 1 3600 600 86400 60
+                      NS    localhost.
+bad.example.org       CNAME .
+*.bad.example.org     CNAME .
+empty.example.org     CNAME *.
+ok.bad.example.org    CNAME rpz-passthru.
+legacy.example.org    CNAME legacy.example.org.
+drop.example.org      CNAME rpz-drop.
+tcp.example.org       CNAME rpz-tcp-only.
+walled.example.org    A     192.0.2.53
+                      TXT   "walled garden"
+redirect.example.org  CNAME garden.example.net.
+32.1.0.0.127.rpz-client-ip CNAME rpz-drop.
+24.0.2.0.192.rpz-ip   CNAME .
+32.1.2.0.192.rpz-ip   CNAME rpz-passthru.
+48.zz.db8.2001.rpz-ip CNAME *.
+ns.evil.example.rpz-nsdname CNAME .
+*.sinkhole.example.rpz-nsdname CNAME *.
+24.0.0.10.rpz-nsip    CNAME .
+`
+
+func newPolicyZone(t *testing.T, name, data string) *policyZone {
+	t.Helper()
+	z, err := file.Parse(strings.NewReader(data), name, "stdin", -1)
+	if err != nil {
+		t.Fatalf("Failed to parse policy zone: %s", err)
+	}
+	return &policyZone{name: name, z: z}
+}
+
+func TestIPTrigger(t *testing.T) {
+	tests := []struct {
+		owner string
+		net   string
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32"},
+		{"24.5.2.0.192", "192.0.2.0/24"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"48.zz.db8.2001", "2001:db8::/48"},
+		{"128.1.zz", "::1/128"},
+		{"16.zz.2001", "2001::/16"},
+		{"64.0.0.0.0.0.0.db8.2001", "2001:db8::/64"},
+		{"1.zz", "::/1"},
+		{"33.1.2.0.192", ""},
+		{"0.1.2.0.192", ""},
+		{"x.1.2.0.192", ""},
+		{"32.1.2.192", ""},
+		{"32", ""},
+		{"64.zz.db8.zz.2001", ""},
+	}
+	for i, tc := range tests {
+		n, err := ipTrigger(strings.Split(tc.owner, "."))
+		if tc.net == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q, got %s", i, tc.owner, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error for %q, got %s", i, tc.owner, err)
+			continue
+		}
+		if n.String() != tc.net {
+			t.Errorf("Test %d: expected %s for %q, got %s", i, tc.net, tc.owner, n)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	p := newPolicyZone(t, "rpz.example.", policyZoneData)
+	rs := p.current()
+	if rs == nil {
+		t.Fatal("Expected rules")
+	}
+	if p.current() != rs {
+		t.Error("Expected the rules to be compiled once")
+	}
+
+	qnames := []struct {
+		name   string
+		action action
+		owner  string
+	}{
+		{"bad.example.org.", actionNXDomain, "bad.example.org.rpz.example."},
+		{"www.bad.example.org.", actionNXDomain, "*.bad.example.org.rpz.example."},
+		{"a.b.bad.example.org.", actionNXDomain, "*.bad.example.org.rpz.example."},
+		{"ok.bad.example.org.", actionPassthru, "ok.bad.example.org.rpz.example."},
+		{"empty.example.org.", actionNoData, "empty.example.org.rpz.example."},
+		{"legacy.example.org.", actionPassthru, "legacy.example.org.rpz.example."},
+		{"drop.example.org.", actionDrop, "drop.example.org.rpz.example."},
+		{"tcp.example.org.", actionTCPOnly, "tcp.example.org.rpz.example."},
+		{"walled.example.org.", actionLocalData, "walled.example.org.rpz.example."},
+		{"redirect.example.org.", actionLocalData, "redirect.example.org.rpz.example."},
+		{"example.org.", -1, ""},
+		{"www.walled.example.org.", -1, ""},
+	}
+	for i, tc := range qnames {
+		rl := rs.qname.match(tc.name)
+		if tc.action < 0 {
+			if rl != nil {
+				t.Errorf("Test %d: expected no rule for %q, got %q", i, tc.name, rl.owner)
+			}
+			continue
+		}
+		if rl == nil {
+			t.Errorf("Test %d: expected a rule for %q", i, tc.name)
+			continue
+		}
+		if rl.action != tc.action || rl.owner != tc.owner {
+			t.Errorf("Test %d: expected %s rule %q for %q, got %s rule %q", i, tc.action, tc.owner, tc.name, rl.action, rl.owner)
+		}
+	}
+
+	if v, ok := rs.clientIP.GetByIP(net.ParseIP("127.0.0.1")); !ok || v.(*rule).action != actionDrop {
+		t.Error("Expected a drop rule for client 127.0.0.1")
+	}
+	if _, ok := rs.clientIP.GetByIP(net.ParseIP("127.0.0.2")); ok {
+		t.Error("Expected no rule for client 127.0.0.2")
+	}
+
+	if rl := rs.nsdname.match("ns.evil.example."); rl == nil || rl.action != actionNXDomain {
+		t.Error("Expected an nxdomain rule for name server ns.evil.example.")
+	}
+	if rl := rs.nsdname.match("ns1.sinkhole.example."); rl == nil || rl.action != actionNoData {
+		t.Error("Expected a nodata rule for name server ns1.sinkhole.example.")
+	}
+	if rl := rs.nsdname.match("ns.example."); rl != nil {
+		t.Error("Expected no rule for name server ns.example.")
+	}
+}
+
+func TestNamesMatchRootWildcard(t *testing.T) {
+	n := newNames()
+	n.add("*.", &rule{owner: "*.rpz."})
+	n.add("example.org.", &rule{owner: "example.org.rpz."})
+
+	if rl := n.match("example.org."); rl == nil || rl.owner != "example.org.rpz." {
+		t.Errorf("Expected the exact rule for example.org.")
+	}
+	if rl := n.match("www.example.org."); rl == nil || rl.owner != "*.rpz." {
+		t.Errorf("Expected the root wildcard rule for www.example.org.")
+	}
+}
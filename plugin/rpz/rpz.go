@@ -0,0 +1,236 @@
+// Package rpz implements a plugin that applies the policies of response policy zones.
+package rpz
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("rpz")
+
+// RPZ applies the rules of its policy zones to queries and their responses.
+type RPZ struct {
+	Next  plugin.Handler
+	Zones []string
+
+	policies []*policyZone // in order of precedence
+	logHits  bool
+	upstream *upstream.Upstream
+	ns       *cache.Cache // NS lookups for NSDNAME triggers, *nsEntry by name
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (x *RPZ) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(x.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(x.Name(), x.Next, ctx, w, r)
+	}
+
+	// Apply a client IP or QNAME rule before resolving the query, unless a policy zone before it has rules that
+	// can only be checked with the response.
+	if p, t, rl, ok := x.match(ctx, state, nil); ok && rl != nil {
+		return x.apply(ctx, state, p, t, rl)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rpz: x, ctx: ctx, state: state}
+	return plugin.NextOrFailure(x.Name(), x.Next, ctx, rw, r)
+}
+
+// match returns the first rule that applies to the query, with its policy zone and trigger. The policy zones are
+// checked in order, and in each zone the triggers in order of precedence: client IP, QNAME, response IP and
+// NSDNAME. Without the response res, match returns false when it reaches a zone with response IP or NSDNAME
+// rules, as these can only be checked once the query is resolved.
+func (x *RPZ) match(ctx context.Context, state request.Request, res *dns.Msg) (*policyZone, trigger, *rule, bool) {
+	ip := net.ParseIP(state.IP())
+	qname := strings.ToLower(state.Name())
+	var (
+		ns     []string // the name servers for the query, looked up once when a zone has NSDNAME rules
+		lookup bool
+	)
+	names := func() []string {
+		if !lookup {
+			ns, lookup = x.nameServers(ctx, state, res), true
+		}
+		return ns
+	}
+	for _, p := range x.policies {
+		rs := p.current()
+		if rs == nil {
+			continue
+		}
+		if ip != nil {
+			if v, ok := rs.clientIP.GetByIP(ip); ok {
+				return p, triggerClientIP, v.(*rule), true
+			}
+		}
+		if rl := rs.qname.match(qname); rl != nil {
+			return p, triggerQName, rl, true
+		}
+		if !rs.response {
+			continue
+		}
+		if res == nil {
+			return nil, 0, nil, false
+		}
+		if rl := matchIP(rs.responseIP, res.Answer); rl != nil {
+			return p, triggerResponseIP, rl, true
+		}
+		if rl := rs.matchNSDName(names); rl != nil {
+			return p, triggerNSDName, rl, true
+		}
+	}
+	return nil, 0, nil, true
+}
+
+// Name implements the plugin.Handler interface.
+func (x *RPZ) Name() string { return "rpz" }
+
+// apply applies the action of rule rl to the query.
+func (x *RPZ) apply(ctx context.Context, state request.Request, p *policyZone, t trigger, rl *rule) (int, error) {
+	x.hit(ctx, state, p, t, rl)
+
+	switch rl.action {
+	case actionPassthru:
+		return plugin.NextOrFailure(x.Name(), x.Next, ctx, state.W, state.Req)
+	case actionDrop:
+		return dns.RcodeSuccess, nil
+	case actionTCPOnly:
+		if state.Proto() == "tcp" {
+			return plugin.NextOrFailure(x.Name(), x.Next, ctx, state.W, state.Req)
+		}
+	}
+	state.W.WriteMsg(x.response(ctx, state, p, rl))
+	return dns.RcodeSuccess, nil
+}
+
+// response returns the response for a query that rule rl of policy zone p applies to. Rl's action must not be
+// actionPassthru or actionDrop.
+func (x *RPZ) response(ctx context.Context, state request.Request, p *policyZone, rl *rule) *dns.Msg {
+	m := new(dns.Msg)
+	switch rl.action {
+	case actionNXDomain:
+		m.SetRcode(state.Req, dns.RcodeNameError)
+		m.Ns = p.soa()
+	case actionNoData:
+		m.SetReply(state.Req)
+		m.Ns = p.soa()
+	case actionTCPOnly:
+		m.SetReply(state.Req)
+		m.Truncated = true
+	case actionLocalData:
+		m.SetReply(state.Req)
+		m.Answer = x.localData(ctx, state, rl)
+		if len(m.Answer) == 0 {
+			m.Ns = p.soa()
+		}
+	}
+	m.RecursionAvailable = true
+	return m
+}
+
+// localData returns the local data of rule rl for the query, with the query name as the owner. When there are
+// no records of the query type, but a CNAME, the target of the CNAME is resolved.
+func (x *RPZ) localData(ctx context.Context, state request.Request, rl *rule) []dns.RR {
+	qtype := state.QType()
+	var (
+		answer []dns.RR
+		cname  *dns.CNAME
+	)
+	for _, rr := range rl.data {
+		switch {
+		case rr.Header().Rrtype == qtype || qtype == dns.TypeANY:
+			answer = append(answer, withOwner(rr, state.QName()))
+		case rr.Header().Rrtype == dns.TypeCNAME:
+			cname = rr.(*dns.CNAME)
+		}
+	}
+	if len(answer) > 0 || cname == nil {
+		return answer
+	}
+
+	answer = []dns.RR{withOwner(cname, state.QName())}
+	if x.upstream == nil {
+		return answer
+	}
+	resp, err := x.upstream.Lookup(ctx, state, cname.Target, qtype)
+	if err != nil {
+		log.Debugf("Failed to resolve %q for %q: %s", cname.Target, state.Name(), err)
+		return answer
+	}
+	return append(answer, resp.Answer...)
+}
+
+// withOwner returns a copy of rr with owner name name.
+func withOwner(rr dns.RR, name string) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Name = name
+	return rr
+}
+
+// hit records that rule rl of policy zone p applied to the query.
+func (x *RPZ) hit(ctx context.Context, state request.Request, p *policyZone, t trigger, rl *rule) {
+	HitCount.WithLabelValues(metrics.WithServer(ctx), p.name, t.String(), rl.action.String()).Inc()
+
+	metadata.SetValueFunc(ctx, "rpz/zone", func() string { return p.name })
+	metadata.SetValueFunc(ctx, "rpz/trigger", func() string { return t.String() })
+	metadata.SetValueFunc(ctx, "rpz/action", func() string { return rl.action.String() })
+	metadata.SetValueFunc(ctx, "rpz/rule", func() string { return rl.owner })
+
+	if x.logHits {
+		log.Infof("%s %s %s: %s rule %q of %q: %s", state.IP(), state.Name(), state.Type(), t, rl.owner, p.name, rl.action)
+	}
+}
+
+// ResponseWriter applies the rules of the policy zones to the responses it writes, for queries that were resolved
+// before a rule could be chosen.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rpz   *RPZ
+	ctx   context.Context
+	state request.Request
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	p, t, rl, _ := w.rpz.match(w.ctx, w.state, res)
+	if rl == nil {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+
+	w.rpz.hit(w.ctx, w.state, p, t, rl)
+	switch rl.action {
+	case actionPassthru:
+		return w.ResponseWriter.WriteMsg(res)
+	case actionDrop:
+		return nil
+	case actionTCPOnly:
+		if w.state.Proto() == "tcp" {
+			return w.ResponseWriter.WriteMsg(res)
+		}
+	}
+	return w.ResponseWriter.WriteMsg(w.rpz.response(w.ctx, w.state, p, rl))
+}
+
+// soa returns the SOA record of the policy zone, for the authority section of negative responses.
+func (p *policyZone) soa() []dns.RR {
+	rs := p.current()
+	if rs == nil {
+		return nil
+	}
+	soa := dns.Copy(rs.soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return []dns.RR{soa}
+}
@@ -0,0 +1,195 @@
+package rpz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// backend answers the queries that no policy applied to before resolving.
+func backend() test.Handler {
+	return test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeNS {
+			switch r.Question[0].Name {
+			case "example.net.":
+				m.Answer = []dns.RR{test.NS("example.net. 300 IN NS ns.evil.example.")}
+			case "www.example.net.":
+				m.Ns = []dns.RR{test.SOA("example.net. 300 IN SOA ns.evil.example. h.example.net. 1 3600 600 86400 60")}
+			}
+			w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		}
+		switch r.Question[0].Name {
+		case "a.example.com.":
+			m.Answer = []dns.RR{test.A("a.example.com. 300 IN A 192.0.2.7")}
+		case "pass.example.com.":
+			m.Answer = []dns.RR{test.A("pass.example.com. 300 IN A 192.0.2.7"), test.A("pass.example.com. 300 IN A 192.0.2.1")}
+		case "v6.example.com.":
+			m.Answer = []dns.RR{test.AAAA("v6.example.com. 300 IN AAAA 2001:db8::1")}
+		case "delegated.example.com.":
+			m.Answer = []dns.RR{test.A("delegated.example.com. 300 IN A 198.51.100.1")}
+			m.Ns = []dns.RR{test.NS("example.com. 300 IN NS ns.EVIL.example.")}
+		default:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 198.51.100.1")}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func TestRPZ(t *testing.T) {
+	x := &RPZ{
+		Zones:    []string{"."},
+		policies: []*policyZone{newPolicyZone(t, "rpz.example.", policyZoneData)},
+		Next:     backend(),
+		ns:       cache.New(nsCacheSize),
+	}
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		remote  string
+		tcp     bool
+		rcode   int // -1 for no response
+		answer  []string
+		soa     bool
+		trunc   bool
+		trigger string
+		action  string
+	}{
+		{qname: "bad.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "qname", action: "nxdomain"},
+		{qname: "www.BAD.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "qname", action: "nxdomain"},
+		{qname: "ok.bad.example.org.", qtype: dns.TypeA, answer: []string{"ok.bad.example.org. 300 IN A 198.51.100.1"}, trigger: "qname", action: "passthru"},
+		{qname: "empty.example.org.", qtype: dns.TypeA, soa: true, trigger: "qname", action: "nodata"},
+		{qname: "drop.example.org.", qtype: dns.TypeA, rcode: -1, trigger: "qname", action: "drop"},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, trunc: true, trigger: "qname", action: "tcp-only"},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, tcp: true, answer: []string{"tcp.example.org. 300 IN A 198.51.100.1"}, trigger: "qname", action: "tcp-only"},
+		{qname: "walled.example.org.", qtype: dns.TypeA, answer: []string{"walled.example.org. 300 IN A 192.0.2.53"}, trigger: "qname", action: "local-data"},
+		{qname: "walled.example.org.", qtype: dns.TypeTXT, answer: []string{`walled.example.org. 300 IN TXT "walled garden"`}, trigger: "qname", action: "local-data"},
+		{qname: "walled.example.org.", qtype: dns.TypeMX, soa: true, trigger: "qname", action: "local-data"},
+		{qname: "redirect.example.org.", qtype: dns.TypeA, answer: []string{"redirect.example.org. 300 IN CNAME garden.example.net."}, trigger: "qname", action: "local-data"},
+		{qname: "example.org.", qtype: dns.TypeA, remote: "127.0.0.1", rcode: -1, trigger: "client-ip", action: "drop"},
+		{qname: "a.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "response-ip", action: "nxdomain"},
+		{qname: "pass.example.com.", qtype: dns.TypeA, answer: []string{"pass.example.com. 300 IN A 192.0.2.7", "pass.example.com. 300 IN A 192.0.2.1"}, trigger: "response-ip", action: "passthru"},
+		{qname: "v6.example.com.", qtype: dns.TypeAAAA, soa: true, trigger: "response-ip", action: "nodata"},
+		{qname: "delegated.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "nsdname", action: "nxdomain"},
+		{qname: "www.example.net.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "nsdname", action: "nxdomain"},
+		{qname: "a.b.example.net.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true, trigger: "nsdname", action: "nxdomain"},
+		{qname: "clean.example.com.", qtype: dns.TypeA, answer: []string{"clean.example.com. 300 IN A 198.51.100.1"}},
+	}
+
+	for i, tc := range tests {
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.remote, TCP: tc.tcp})
+		if _, err := x.ServeDNS(ctx, rec, r); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+
+		trigger, action := "", ""
+		if f := metadata.ValueFunc(ctx, "rpz/trigger"); f != nil {
+			trigger = f()
+		}
+		if f := metadata.ValueFunc(ctx, "rpz/action"); f != nil {
+			action = f()
+		}
+		if trigger != tc.trigger || action != tc.action {
+			t.Errorf("Test %d: expected %s %s hit, got %q %q", i, tc.trigger, tc.action, trigger, action)
+		}
+
+		if tc.rcode < 0 {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected no response, got %s", i, rec.Msg)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Fatalf("Test %d: expected a response", i)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if rec.Msg.Truncated != tc.trunc {
+			t.Errorf("Test %d: expected truncated %t, got %t", i, tc.trunc, rec.Msg.Truncated)
+		}
+		if len(rec.Msg.Answer) != len(tc.answer) {
+			t.Errorf("Test %d: expected %d answers, got %d", i, len(tc.answer), len(rec.Msg.Answer))
+			continue
+		}
+		for j, a := range tc.answer {
+			rr, _ := dns.NewRR(a)
+			if got := rec.Msg.Answer[j].String(); got != rr.String() {
+				t.Errorf("Test %d: expected answer %q, got %q", i, rr, got)
+			}
+		}
+		if soa := len(rec.Msg.Ns) == 1 && rec.Msg.Ns[0].Header().Rrtype == dns.TypeSOA; soa != tc.soa {
+			t.Errorf("Test %d: expected SOA in the authority section %t, got %v", i, tc.soa, rec.Msg.Ns)
+		}
+		if tc.soa && rec.Msg.Ns[0].Header().Ttl != 60 {
+			t.Errorf("Test %d: expected the SOA TTL to be the minimum TTL, got %d", i, rec.Msg.Ns[0].Header().Ttl)
+		}
+	}
+}
+
+func TestRPZOrder(t *testing.T) {
+	first := newPolicyZone(t, "first.", `first. 300 SOA ns.first. h.first. 1 3600 600 86400 60
+www.example.org.first. CNAME rpz-passthru.`)
+	second := newPolicyZone(t, "second.", `second. 300 SOA ns.second. h.second. 1 3600 600 86400 60
+*.example.org.second. CNAME .`)
+	x := &RPZ{Zones: []string{"."}, policies: []*policyZone{first, second}, Next: backend(), ns: cache.New(nsCacheSize)}
+
+	for _, tc := range []struct {
+		qname string
+		rcode int
+	}{
+		{"www.example.org.", dns.RcodeSuccess},
+		{"ftp.example.org.", dns.RcodeNameError},
+	} {
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		x.ServeDNS(context.TODO(), rec, r)
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d for %q, got %d", tc.rcode, tc.qname, rec.Msg.Rcode)
+		}
+	}
+}
+
+func TestRPZOrderResponseIP(t *testing.T) {
+	// The response IP rule of the first zone takes precedence over the QNAME rules of the second.
+	first := newPolicyZone(t, "first.", `first. 300 SOA ns.first. h.first. 1 3600 600 86400 60
+24.0.2.0.192.rpz-ip.first. CNAME *.`)
+	second := newPolicyZone(t, "second.", `second. 300 SOA ns.second. h.second. 1 3600 600 86400 60
+*.example.com.second. CNAME .`)
+	x := &RPZ{Zones: []string{"."}, policies: []*policyZone{first, second}, Next: backend(), ns: cache.New(nsCacheSize)}
+
+	for _, tc := range []struct {
+		qname string
+		rcode int
+		zone  string
+	}{
+		{"a.example.com.", dns.RcodeSuccess, "first."},        // 192.0.2.7
+		{"clean.example.com.", dns.RcodeNameError, "second."}, // 198.51.100.1
+	} {
+		ctx := metadata.ContextWithMetadata(context.TODO())
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		x.ServeDNS(ctx, rec, r)
+		if rec.Msg.Rcode != tc.rcode || len(rec.Msg.Answer) != 0 {
+			t.Errorf("Expected rcode %d and no answer for %q, got %s", tc.rcode, tc.qname, rec.Msg)
+		}
+		if f := metadata.ValueFunc(ctx, "rpz/zone"); f == nil || f() != tc.zone {
+			t.Errorf("Expected a rule of %q to apply to %q", tc.zone, tc.qname)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package rpz
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/pkg/upstream"
+)
+
+const pluginName = "rpz"
+
+func init() { plugin.Register(pluginName, setup) }
+
+// defaultReload is how often policy zone files are checked for changes.
+const defaultReload = time.Minute
+
+func setup(c *caddy.Controller) error {
+	x, err := rpzParse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	for _, p := range x.policies {
+		p := p
+		if len(p.z.TransferFrom) > 0 {
+			c.OnStartup(func() error {
+				p.z.StartupOnce.Do(func() { go p.transferIn() })
+				return nil
+			})
+			continue
+		}
+		c.OnStartup(func() error {
+			p.load()
+			return p.z.Reload(nil)
+		})
+		c.OnShutdown(p.z.OnShutdown)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		x.Next = next
+		return x
+	})
+
+	return nil
+}
+
+// load loads the policy zone from its file. When this fails, loading is retried when the zone is reloaded.
+func (p *policyZone) load() {
+	reader, err := os.Open(filepath.Clean(p.z.File()))
+	if err != nil {
+		log.Errorf("Failed to open policy zone %q in %q: %s", p.name, p.z.File(), err)
+		return
+	}
+	defer reader.Close()
+
+	z, err := file.Parse(reader, p.name, p.z.File(), -1)
+	if err != nil {
+		log.Errorf("Failed to parse policy zone %q: %s", p.name, err)
+		return
+	}
+	p.z.Lock()
+	p.z.Tree, p.z.Apex = z.Tree, z.Apex
+	p.z.Unlock()
+}
+
+// transferIn transfers the policy zone from its primaries, and keeps it up to date.
+func (p *policyZone) transferIn() {
+	dur := time.Millisecond * 250
+	step := time.Duration(2)
+	max := time.Second * 10
+	for {
+		err := p.z.TransferIn()
+		if err == nil {
+			break
+		}
+		log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", p.name, dur.String(), err)
+		time.Sleep(dur)
+		dur = step * dur
+		if dur > max {
+			dur = max
+		}
+	}
+	p.z.Update()
+}
+
+func rpzParse(c *caddy.Controller) (*RPZ, error) {
+	config := dnsserver.GetConfig(c)
+	x := &RPZ{upstream: upstream.New(), ns: cache.New(nsCacheSize)}
+	reload := defaultReload
+	seen := make(map[string]bool)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		x.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "file", "transfer":
+				source := c.Val()
+				args := c.RemainingArgs()
+				if len(args) < 2 || (source == "file" && len(args) != 2) {
+					return nil, c.ArgErr()
+				}
+				name := plugin.Name(args[0]).Normalize()
+				if seen[name] {
+					return nil, c.Errf("policy zone %q is defined more than once", name)
+				}
+				seen[name] = true
+
+				var z *file.Zone
+				if source == "file" {
+					path := args[1]
+					if !filepath.IsAbs(path) && config.Root != "" {
+						path = filepath.Join(config.Root, path)
+					}
+					z = file.NewZone(name, path)
+				} else {
+					z = file.NewZone(name, "stdin")
+					for _, addr := range args[1:] {
+						normalized, err := parse.HostPort(addr, transport.Port)
+						if err != nil {
+							return nil, err
+						}
+						z.TransferFrom = append(z.TransferFrom, normalized)
+					}
+				}
+				x.policies = append(x.policies, &policyZone{name: name, z: z})
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.Errf("reload needs a duration (zero seconds to disable)")
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Errf("invalid duration for reload '%s'", args[0])
+				}
+				if d < 0 {
+					return nil, c.Errf("invalid negative duration for reload '%s'", args[0])
+				}
+				reload = d
+			case "log":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				x.logHits = true
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(x.policies) == 0 {
+		return nil, c.Errf("no policy zones")
+	}
+	for _, p := range x.policies {
+		if len(p.z.TransferFrom) == 0 {
+			p.z.ReloadInterval = reload
+		}
+	}
+	return x, nil
+}
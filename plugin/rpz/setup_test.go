@@ -0,0 +1,89 @@
+package rpz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		config   string
+		wantErr  bool
+		policies []string
+		reload   time.Duration
+		log      bool
+	}{
+		{"rpz {\nfile rpz.example db.rpz\n}", false, []string{"rpz.example."}, defaultReload, false},
+		{"rpz example.org {\nfile a.rpz db.a\ntransfer b.rpz 10.0.0.1 10.0.0.2:5300\nreload 10s\nlog\n}", false, []string{"a.rpz.", "b.rpz."}, 10 * time.Second, true},
+		{"rpz {\nfile rpz.example db.rpz\nreload 0\n}", false, []string{"rpz.example."}, 0, false},
+		{"rpz", true, nil, 0, false},
+		{"rpz {\nfile rpz.example\n}", true, nil, 0, false},
+		{"rpz {\nfile rpz.example a b\n}", true, nil, 0, false},
+		{"rpz {\ntransfer rpz.example\n}", true, nil, 0, false},
+		{"rpz {\nfile rpz.example a\ntransfer rpz.example 10.0.0.1\n}", true, nil, 0, false},
+		{"rpz {\nfile rpz.example a\nreload -1s\n}", true, nil, 0, false},
+		{"rpz {\nfile rpz.example a\nlog foo\n}", true, nil, 0, false},
+		{"rpz {\nfile rpz.example a\nfoo\n}", true, nil, 0, false},
+		{"rpz {\nfile a a\n}\nrpz {\nfile b b\n}", true, nil, 0, false},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		x, err := rpzParse(c)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(x.policies) != len(tc.policies) {
+			t.Fatalf("Test %d: expected %d policy zones, got %d", i, len(tc.policies), len(x.policies))
+		}
+		for j, p := range x.policies {
+			if p.name != tc.policies[j] {
+				t.Errorf("Test %d: expected policy zone %q, got %q", i, tc.policies[j], p.name)
+			}
+			reload := tc.reload
+			if len(p.z.TransferFrom) > 0 {
+				reload = 0
+			}
+			if p.z.ReloadInterval != reload {
+				t.Errorf("Test %d: expected reload %s, got %s", i, reload, p.z.ReloadInterval)
+			}
+		}
+		if x.logHits != tc.log {
+			t.Errorf("Test %d: expected log %t, got %t", i, tc.log, x.logHits)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.rpz")
+	if err := os.WriteFile(path, []byte(policyZoneData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("dns", "rpz {\nfile rpz.example "+path+"\n}")
+	x, err := rpzParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	p := x.policies[0]
+	if p.current() != nil {
+		t.Fatal("Expected no rules before the zone is loaded")
+	}
+	p.load()
+	rs := p.current()
+	if rs == nil {
+		t.Fatal("Expected rules after the zone is loaded")
+	}
+	if rl := rs.qname.match("bad.example.org."); rl == nil || rl.action != actionNXDomain {
+		t.Error("Expected an nxdomain rule for bad.example.org.")
+	}
+}
@@ -0,0 +1,163 @@
+package secondary
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/file"
+)
+
+// catalogs keeps the member zones of catalog zones (RFC 9432) in sync with the catalogs.
+type catalogs struct {
+	sync.RWMutex
+	static  file.Zones         // The configured zones.
+	zones   file.Zones         // The configured zones and the member zones.
+	members map[string]*member // The member zones, by name.
+	stop    chan struct{}      // Closed on shutdown.
+}
+
+// member is a member zone of a catalog zone.
+type member struct {
+	catalog string // Name of the catalog zone.
+	id      string // Unique label of the member zone in the catalog.
+	z       *file.Zone
+	stop    chan struct{}
+}
+
+func newCatalogs(static file.Zones) *catalogs {
+	return &catalogs{static: static, zones: static, members: map[string]*member{}, stop: make(chan struct{})}
+}
+
+// Zones returns the configured zones and the member zones.
+func (c *catalogs) Zones() file.Zones {
+	c.RLock()
+	defer c.RUnlock()
+	return c.zones
+}
+
+// sync adds and removes member zones, so they are the ones listed in the catalog zone z named name. A member zone
+// gets the primaries, the TSIG key and the backup directory of the catalog zone.
+func (c *catalogs) sync(name string, z *file.Zone) {
+	members, err := z.Members()
+	if err != nil {
+		log.Errorf("Failed to read catalog '%s': %s", name, err)
+		return
+	}
+
+	// The new member zones are created, and their backups loaded, without holding the lock. A member zone that
+	// is reset doesn't get its backup, that is removed with the old member zone.
+	added := map[string]*member{}
+	c.RLock()
+	for n, id := range members {
+		m, ok := c.members[n]
+		if ok && (m.catalog != name || m.id == id) {
+			continue
+		}
+		if _, ok := c.static.Z[n]; ok {
+			continue
+		}
+		added[n] = newMember(n, id, name, z, !ok)
+	}
+	c.RUnlock()
+
+	c.Lock()
+	defer c.Unlock()
+	select {
+	case <-c.stop:
+		return
+	default:
+	}
+
+	for n, m := range c.members {
+		if m.catalog != name {
+			continue
+		}
+		// A member zone with another unique label is reset, by removing it and adding it again.
+		if id, ok := members[n]; ok && id == m.id {
+			continue
+		}
+		c.remove(n)
+	}
+	for n, id := range members {
+		if m, ok := c.members[n]; ok {
+			if m.catalog != name {
+				log.Warningf("Zone '%s' in catalog '%s' is already a member of catalog '%s'", n, name, m.catalog)
+			}
+			continue
+		}
+		if _, ok := c.static.Z[n]; ok {
+			log.Warningf("Zone '%s' in catalog '%s' is already configured", n, name)
+			continue
+		}
+		// The members changed since the new member zones were created, this one gets no backup.
+		m, ok := added[n]
+		if !ok {
+			m = newMember(n, id, name, z, false)
+		}
+		c.add(n, m)
+	}
+
+	zones := file.Zones{Z: make(map[string]*file.Zone, len(c.static.Z)+len(c.members))}
+	zones.Names = append(zones.Names, c.static.Names...)
+	for n, z := range c.static.Z {
+		zones.Z[n] = z
+	}
+	for n, m := range c.members {
+		zones.Z[n] = m.z
+		zones.Names = append(zones.Names, n)
+	}
+	c.zones = zones
+}
+
+// newMember returns the member zone name, with unique label id, of the catalog zone cz named catalog. If backup is
+// true the backup of the member zone is loaded.
+func newMember(name, id, catalog string, cz *file.Zone, backup bool) *member {
+	z := file.NewZone(name, "stdin")
+	z.TransferFrom = cz.TransferFrom
+	z.TransferKey = cz.TransferKey
+	z.Upstream = cz.Upstream
+	if cz.Backup != "" {
+		z.Backup = filepath.Join(filepath.Dir(cz.Backup), "db."+strings.TrimSuffix(name, "."))
+	}
+	if backup && z.Backup != "" {
+		if err := z.LoadBackup(); err != nil {
+			log.Warningf("Failed to load backup of '%s' from %q: %s", name, z.Backup, err)
+		}
+	}
+	return &member{catalog: catalog, id: id, z: z, stop: make(chan struct{})}
+}
+
+// add adds the member zone m named name, and starts transferring it. The caller must hold the lock.
+func (c *catalogs) add(name string, m *member) {
+	c.members[name] = m
+	go keepUpdated(name, m.z, m.stop)
+	log.Infof("Adding zone '%s' from catalog '%s'", name, m.catalog)
+}
+
+// remove stops transferring the member zone name, and removes it with its backup. The caller must hold the lock.
+func (c *catalogs) remove(name string) {
+	m := c.members[name]
+	close(m.stop)
+	delete(c.members, name)
+	if m.z.Backup != "" {
+		if err := os.Remove(m.z.Backup); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove backup of '%s' in %q: %s", name, m.z.Backup, err)
+		}
+	}
+	file.SerialGauge.DeleteLabelValues(name)
+	file.RefreshTime.DeleteLabelValues(name)
+	file.ExpiredGauge.DeleteLabelValues(name)
+	log.Infof("Removing zone '%s' from catalog '%s'", name, m.catalog)
+}
+
+// shutdown stops transferring all member zones.
+func (c *catalogs) shutdown() {
+	c.Lock()
+	defer c.Unlock()
+	close(c.stop)
+	for _, m := range c.members {
+		close(m.stop)
+	}
+}
@@ -0,0 +1,123 @@
+package secondary
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const dbMember = `@	3600 IN	SOA	ns1 admin 1 7200 3600 1209600 3600
+	3600 IN	NS	ns1
+ns1	3600 IN	A	10.0.0.53
+www	3600 IN	A	10.0.0.1
+`
+
+func TestCatalog(t *testing.T) {
+	const catalog = "catalog.invalid."
+	primary := map[string]*file.Zone{catalog: file.NewZone(catalog, "")}
+	primary[catalog].SetCatalog([]string{"example.org.", "example.net."})
+	for _, name := range []string{"example.org.", "example.net."} {
+		z, err := file.Parse(strings.NewReader(dbMember), name, "stdin", 0)
+		if err != nil {
+			t.Fatalf("Expected no error when reading zone, got %q", err)
+		}
+		primary[name] = z
+	}
+
+	s := dnstest.NewServer(func(w dns.ResponseWriter, req *dns.Msg) {
+		var serial uint32
+		if req.Question[0].Qtype == dns.TypeIXFR && len(req.Ns) == 1 {
+			serial = req.Ns[0].(*dns.SOA).Serial
+		}
+		ch, err := primary[req.Question[0].Name].Transfer(serial)
+		if err != nil {
+			t.Errorf("Expected no error when transferring zone, got %q", err)
+			return
+		}
+		out := make(chan *dns.Envelope)
+		go new(dns.Transfer).Out(w, req, out)
+		for rrs := range ch {
+			out <- &dns.Envelope{RR: rrs}
+		}
+		close(out)
+		w.Hijack()
+	})
+	defer s.Close()
+
+	cz := file.NewZone(catalog, "stdin")
+	cz.TransferFrom = []string{s.Addr}
+	zones := file.Zones{Z: map[string]*file.Zone{catalog: cz}, Names: []string{catalog}}
+	c := newCatalogs(zones)
+	defer c.shutdown()
+	cz.OnTransfer = func() { c.sync(catalog, cz) }
+
+	if err := cz.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring the catalog, got %q", err)
+	}
+	if names := c.Zones().Names; len(names) != 3 {
+		t.Fatalf("Expected the catalog and 2 member zones, got %v", names)
+	}
+
+	// The member zones are transferred in the background.
+	member := c.Zones().Z["example.org."]
+	for i := 0; member.SOASerialIfDefined() < 0; i++ {
+		if i == 50 {
+			t.Fatal("Expected example.org. to be transferred")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	sec := Secondary{File: file.File{Next: test.ErrorHandler(), Zones: zones}, catalogs: c}
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := sec.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %q", err)
+	}
+	if rec.Msg == nil || len(rec.Msg.Answer) != 1 {
+		t.Errorf("Expected an answer from the member zone, got %v", rec.Msg)
+	}
+
+	primary[catalog].SetCatalog([]string{"example.org."})
+	if err := cz.TransferIn(); err != nil {
+		t.Fatalf("Expected no error when transferring the catalog, got %q", err)
+	}
+	if _, ok := c.Zones().Z["example.net."]; ok {
+		t.Error("Expected example.net. to be removed")
+	}
+	if c.Zones().Z["example.org."] != member {
+		t.Error("Expected example.org. to be kept")
+	}
+}
+
+func TestNewMember(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org"), []byte(dbMember), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cz := file.NewZone("catalog.invalid.", "stdin")
+	cz.Backup = filepath.Join(dir, "db.catalog.invalid")
+
+	m := newMember("example.org.", "1", "catalog.invalid.", cz, true)
+	if m.z.Backup != filepath.Join(dir, "db.example.org") {
+		t.Errorf("Expected the backup next to the one of the catalog, got %q", m.z.Backup)
+	}
+	if serial := m.z.SOASerialIfDefined(); serial != 1 {
+		t.Errorf("Expected the backup to be loaded, got SOA serial %d", serial)
+	}
+
+	// A member zone that is reset doesn't get the backup.
+	m = newMember("example.org.", "2", "catalog.invalid.", cz, false)
+	if serial := m.z.SOASerialIfDefined(); serial != -1 {
+		t.Errorf("Expected no backup to be loaded, got SOA serial %d", serial)
+	}
+}
@@ -1,10 +1,37 @@
 // Package secondary implements a secondary plugin.
 package secondary
 
-import "github.com/coredns/coredns/plugin/file"
+import (
+	"context"
 
-// Secondary implements a secondary plugin that allows CoreDNS to retrieve (via AXFR)
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
+)
+
+// Secondary implements a secondary plugin that allows CoreDNS to retrieve (via AXFR or IXFR)
 // zone information from a primary server.
 type Secondary struct {
 	file.File
+	catalogs *catalogs // The member zones of catalog zones, nil if there are no catalog zones.
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (s Secondary) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	return s.file().ServeDNS(ctx, w, r)
+}
+
+// Transfer implements the transfer.Transferer interface.
+func (s Secondary) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	return s.file().Transfer(zone, serial)
+}
+
+// file returns the file plugin that serves the configured zones and the member zones of the catalog zones.
+func (s Secondary) file() file.File {
+	if s.catalogs == nil {
+		return s.File
+	}
+	f := s.File
+	f.Zones = s.catalogs.Zones()
+	return f
 }
@@ -1,6 +1,8 @@
 package secondary
 
 import (
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -10,6 +12,8 @@ import (
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
+
+	"github.com/miekg/dns"
 )
 
 var log = clog.NewWithPlugin("secondary")
@@ -17,36 +21,44 @@ var log = clog.NewWithPlugin("secondary")
 func init() { plugin.Register("secondary", setup) }
 
 func setup(c *caddy.Controller) error {
-	zones, err := secondaryParse(c)
+	zones, catalogNames, err := secondaryParse(c)
 	if err != nil {
 		return plugin.Error("secondary", err)
 	}
 
+	s := Secondary{File: file.File{Zones: zones}}
+	if len(catalogNames) > 0 {
+		s.catalogs = newCatalogs(zones)
+		c.OnShutdown(func() error {
+			s.catalogs.shutdown()
+			return nil
+		})
+	}
+	stop := make(chan struct{})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
 	// Add startup functions to retrieve the zone and keep it up to date.
 	for i := range zones.Names {
 		n := zones.Names[i]
 		z := zones.Z[n]
+		if err := z.LoadBackup(); err != nil {
+			log.Warningf("Failed to load backup of '%s' from %q: %s", n, z.Backup, err)
+		}
+		catalog := contains(catalogNames, n)
+		if catalog {
+			z.OnTransfer = func() { s.catalogs.sync(n, z) }
+		}
 		if len(z.TransferFrom) > 0 {
 			c.OnStartup(func() error {
 				z.StartupOnce.Do(func() {
-					go func() {
-						dur := time.Millisecond * 250
-						step := time.Duration(2)
-						max := time.Second * 10
-						for {
-							err := z.TransferIn()
-							if err == nil {
-								break
-							}
-							log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", n, dur.String(), err)
-							time.Sleep(dur)
-							dur = step * dur
-							if dur > max {
-								dur = max
-							}
-						}
-						z.Update()
-					}()
+					// Start with the member zones from the backup of the catalog zone.
+					if catalog && z.SOASerialIfDefined() >= 0 {
+						s.catalogs.sync(n, z)
+					}
+					go keepUpdated(n, z, stop)
 				})
 				return nil
 			})
@@ -54,15 +66,62 @@ func setup(c *caddy.Controller) error {
 	}
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return Secondary{file.File{Next: next, Zones: zones}}
+		s.Next = next
+		return s
 	})
 
 	return nil
 }
 
-func secondaryParse(c *caddy.Controller) (file.Zones, error) {
+// keepUpdated transfers the zone z named n, and retries until that succeeds. Then it keeps the zone up to date,
+// until stop is closed.
+func keepUpdated(n string, z *file.Zone, stop <-chan struct{}) {
+	dur := time.Millisecond * 250
+	step := time.Duration(2)
+	max := time.Second * 10
+	for {
+		err := z.TransferIn()
+		if err == nil {
+			break
+		}
+		log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", n, dur.String(), err)
+		select {
+		case <-time.After(dur):
+		case <-stop:
+			return
+		}
+		dur = step * dur
+		if dur > max {
+			dur = max
+		}
+	}
+	z.UpdateUntil(stop)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// algorithms are the TSIG algorithms that can sign transfers.
+var algorithms = map[string]struct{}{
+	dns.HmacSHA1:   {},
+	dns.HmacSHA224: {},
+	dns.HmacSHA256: {},
+	dns.HmacSHA384: {},
+	dns.HmacSHA512: {},
+}
+
+// secondaryParse returns the zones, and the names of those that are catalog zones.
+func secondaryParse(c *caddy.Controller) (file.Zones, []string, error) {
+	config := dnsserver.GetConfig(c)
 	z := make(map[string]*file.Zone)
 	names := []string{}
+	catalogs := []string{}
 	for c.Next() {
 		if c.Val() == "secondary" {
 			// secondary [origin]
@@ -73,27 +132,72 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 			}
 
 			for c.NextBlock() {
-				var f []string
+				var (
+					f      []string
+					key    *file.TransferKey
+					backup string
+				)
 
 				switch c.Val() {
 				case "transfer":
 					var err error
 					f, err = parse.TransferIn(c)
 					if err != nil {
-						return file.Zones{}, err
+						return file.Zones{}, nil, err
+					}
+				case "tsig":
+					args := c.RemainingArgs()
+					if len(args) != 2 && len(args) != 3 {
+						return file.Zones{}, nil, c.ArgErr()
+					}
+					key = &file.TransferKey{Name: plugin.Name(args[0]).Normalize(), Secret: args[1], Algorithm: dns.HmacSHA256}
+					if len(args) == 3 {
+						key.Algorithm = dns.Fqdn(strings.ToLower(args[2]))
+						if _, ok := algorithms[key.Algorithm]; !ok {
+							return file.Zones{}, nil, c.Errf("unknown TSIG algorithm '%s'", args[2])
+						}
+					}
+				case "backup":
+					if !c.NextArg() {
+						return file.Zones{}, nil, c.ArgErr()
+					}
+					if len(origins) > 1 {
+						return file.Zones{}, nil, c.Errf("backup can only be used with a single zone")
+					}
+					backup = c.Val()
+					if !filepath.IsAbs(backup) && config.Root != "" {
+						backup = filepath.Join(config.Root, backup)
+					}
+					if c.NextArg() {
+						return file.Zones{}, nil, c.ArgErr()
+					}
+				case "catalog":
+					if c.NextArg() {
+						return file.Zones{}, nil, c.ArgErr()
+					}
+					for _, origin := range origins {
+						if !contains(catalogs, origin) {
+							catalogs = append(catalogs, origin)
+						}
 					}
 				default:
-					return file.Zones{}, c.Errf("unknown property '%s'", c.Val())
+					return file.Zones{}, nil, c.Errf("unknown property '%s'", c.Val())
 				}
 
 				for _, origin := range origins {
 					if f != nil {
 						z[origin].TransferFrom = append(z[origin].TransferFrom, f...)
 					}
+					if key != nil {
+						z[origin].TransferKey = key
+					}
+					if backup != "" {
+						z[origin].Backup = backup
+					}
 					z[origin].Upstream = upstream.New()
 				}
 			}
 		}
 	}
-	return file.Zones{Z: z, Names: names}, nil
+	return file.Zones{Z: z, Names: names}, catalogs, nil
 }
@@ -1,9 +1,13 @@
 package secondary
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/file"
+
+	"github.com/miekg/dns"
 )
 
 func TestSecondaryParse(t *testing.T) {
@@ -39,7 +43,7 @@ func TestSecondaryParse(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.inputFileRules)
-		s, err := secondaryParse(c)
+		s, _, err := secondaryParse(c)
 
 		if err == nil && test.shouldErr {
 			t.Fatalf("Test %d expected errors, but got no error", i)
@@ -61,3 +65,54 @@ func TestSecondaryParse(t *testing.T) {
 		}
 	}
 }
+
+func TestSecondaryParseOptions(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		key       *file.TransferKey
+		backup    string
+	}{
+		{`secondary example.org {
+			transfer from 127.0.0.1
+			tsig transfer.example.org c2VjcmV0
+			backup /var/lib/coredns/example.org
+		}`, false, &file.TransferKey{Name: "transfer.example.org.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA256}, "/var/lib/coredns/example.org"},
+		{`secondary example.org {
+			tsig transfer.example.org c2VjcmV0 HMAC-SHA512
+		}`, false, &file.TransferKey{Name: "transfer.example.org.", Secret: "c2VjcmV0", Algorithm: dns.HmacSHA512}, ""},
+		{`secondary example.org {
+			tsig transfer.example.org c2VjcmV0 hmac-md5
+		}`, true, nil, ""},
+		{`secondary example.org {
+			tsig transfer.example.org
+		}`, true, nil, ""},
+		{`secondary example.org {
+			backup
+		}`, true, nil, ""},
+		{`secondary example.org example.net {
+			backup /var/lib/coredns/example.org
+		}`, true, nil, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		s, _, err := secondaryParse(c)
+		if err == nil && test.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		} else if err != nil && !test.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		z := s.Z["example.org."]
+		if !reflect.DeepEqual(z.TransferKey, test.key) {
+			t.Errorf("Test %d expected key %v, got %v", i, test.key, z.TransferKey)
+		}
+		if z.Backup != test.backup {
+			t.Errorf("Test %d expected backup %q, got %q", i, test.backup, z.Backup)
+		}
+	}
+}
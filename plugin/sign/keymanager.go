@@ -0,0 +1,357 @@
+package sign
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// keyPolicy holds the configuration of managed keys: the keys are created in, and their state kept in, dir, and
+// they are rolled over when their lifetime ends.
+type keyPolicy struct {
+	dir               string
+	algorithm         uint8
+	zskLifetime       time.Duration // 0 means the ZSK is never rolled over
+	kskLifetime       time.Duration // 0 means the KSK is never rolled over
+	maxZoneTTL        time.Duration // the largest TTL in the zone, including the DNSKEY records
+	parentDSTTL       time.Duration // the TTL of the DS records in the parent zone
+	parentPropagation time.Duration // the time the parent needs to publish a change in the DS records
+	parentAgents      []string      // name servers of the parent zone to check for the DS records
+}
+
+func newKeyPolicy() *keyPolicy {
+	return &keyPolicy{
+		algorithm:         dns.ECDSAP256SHA256,
+		zskLifetime:       durationZSKLifetime,
+		maxZoneTTL:        24 * time.Hour,
+		parentDSTTL:       24 * time.Hour,
+		parentPropagation: 24 * time.Hour,
+	}
+}
+
+// keyManager creates the keys for a zone and rolls them over. A ZSK is rolled over with the pre-publish method,
+// a KSK with the double-DS method (RFC 6781, section 4.1). All the timings are derived from the policy.
+type keyManager struct {
+	keyPolicy
+	origin string
+
+	mu     sync.Mutex
+	keys   []*managedKey
+	loaded bool
+}
+
+func newKeyManager(p *keyPolicy, origin string) *keyManager {
+	return &keyManager{keyPolicy: *p, origin: origin}
+}
+
+// keySet is the set of keys to sign a zone with at some point in time.
+type keySet struct {
+	dnskey []Pair // keys that are published as DNSKEY records
+	ksk    []Pair // keys that sign the DNSKEY, CDS and CDNSKEY records
+	zsk    []Pair // keys that sign the other records
+	cds    []Pair // keys that are published as CDS and CDNSKEY records, the DS records the parent should have
+}
+
+// csk returns the key set that signs everything with keys.
+func csk(keys []Pair) keySet {
+	return keySet{dnskey: keys, ksk: keys, zsk: keys, cds: keys}
+}
+
+// keySet returns the keys for now.
+func (m *keyManager) keySet(now time.Time) keySet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ks := keySet{}
+	for _, k := range m.keys {
+		if between(now, k.published, k.removed) {
+			ks.dnskey = append(ks.dnskey, k.Pair)
+		}
+		if between(now, k.active, k.retired) {
+			if k.ksk {
+				ks.ksk = append(ks.ksk, k.Pair)
+			} else {
+				ks.zsk = append(ks.zsk, k.Pair)
+			}
+		}
+		if k.ksk && between(now, k.dsPublish, k.dsRemove) {
+			ks.cds = append(ks.cds, k.Pair)
+		}
+	}
+	return ks
+}
+
+// between returns true if now is in [from, to). A zero from is never reached, a zero to is never reached.
+func between(now, from, to time.Time) bool {
+	return !from.IsZero() && !now.Before(from) && (to.IsZero() || now.Before(to))
+}
+
+// changedSince returns true if the key set changed in (then, now].
+func (m *keyManager) changedSince(then, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.keys {
+		for _, st := range k.stateTimes() {
+			if st.t.After(then) && !st.t.After(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// plan creates keys and advances the rollovers for now. It returns true if keys were created or the state of a key
+// changed.
+func (m *keyManager) plan(now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.loaded {
+		keys, err := readKeys(m.dir, m.origin)
+		if err != nil {
+			return false, err
+		}
+		m.keys = keys
+		m.loaded = true
+	}
+
+	changed := map[*managedKey]bool{}
+	if err := m.planZSK(now, changed); err != nil {
+		return false, err
+	}
+	if err := m.planKSK(now, changed); err != nil {
+		return false, err
+	}
+	for k := range changed {
+		if err := k.writeState(m.dir); err != nil {
+			return false, err
+		}
+	}
+	m.actions(now)
+	return len(changed) > 0, nil
+}
+
+// current returns the key with role ksk that is active at now, and its successor: a key that is (or will be)
+// published but isn't active yet.
+func (m *keyManager) current(now time.Time, ksk bool) (cur, next *managedKey) {
+	for _, k := range m.keys {
+		if k.ksk != ksk {
+			continue
+		}
+		switch {
+		case between(now, k.active, k.retired):
+			if cur == nil || k.active.After(cur.active) {
+				cur = k
+			}
+		case k.retired.IsZero() && (k.active.IsZero() || k.active.After(now)):
+			next = k
+		}
+	}
+	return cur, next
+}
+
+// planZSK rolls the ZSK over with the pre-publish method: the new key is published, and once the DNSKEY RRset with
+// it is in all caches, it replaces the old key. The old key stays published until all signatures made with it are
+// expired from the caches.
+func (m *keyManager) planZSK(now time.Time, changed map[*managedKey]bool) error {
+	cur, next := m.current(now, false)
+	if cur == nil && next == nil {
+		k, err := m.generate(false)
+		if err != nil {
+			return err
+		}
+		k.published, k.active = now, now
+		changed[k] = true
+		return nil
+	}
+	if cur == nil || next != nil || m.zskLifetime == 0 || !cur.retired.IsZero() {
+		return nil
+	}
+
+	prepublish := durationPropagation + m.maxZoneTTL
+	if now.Before(cur.active.Add(m.zskLifetime - prepublish)) {
+		return nil
+	}
+	k, err := m.generate(false)
+	if err != nil {
+		return err
+	}
+	k.published = now
+	k.active = maxTime(now.Add(prepublish), cur.active.Add(m.zskLifetime))
+	cur.retired = k.active
+	cur.removed = cur.retired.Add(durationPropagation + m.maxZoneTTL)
+	changed[k], changed[cur] = true, true
+	log.Infof("Rolling over ZSK %d of %q: ZSK %d is published and becomes active at %s", cur.KeyTag, m.origin, k.KeyTag, k.active.Format(timeFmt))
+	return nil
+}
+
+// planKSK rolls the KSK over with the double-DS method: the parent is asked to add the DS record of the new key,
+// and once that DS RRset is in all caches, the new key replaces the old one. Then the parent is asked to remove
+// the DS record of the old key. The parent is asked with the CDS and CDNSKEY records; if the parent doesn't use
+// these, the operator must make the changes, see actions.
+func (m *keyManager) planKSK(now time.Time, changed map[*managedKey]bool) error {
+	cur, next := m.current(now, true)
+	if cur == nil && next == nil {
+		k, err := m.generate(true)
+		if err != nil {
+			return err
+		}
+		k.published, k.active, k.dsPublish = now, now, now
+		changed[k] = true
+		cur = k
+	}
+
+	for _, k := range m.keys {
+		if !k.ksk {
+			continue
+		}
+		if !k.dsPublish.IsZero() && k.dsSeen.IsZero() && m.dsAtParent(now, k, k.dsPublish, true) {
+			k.dsSeen = now
+			changed[k] = true
+		}
+		if !k.dsRemove.IsZero() && !now.Before(k.dsRemove) && k.dsGone.IsZero() && m.dsAtParent(now, k, k.dsRemove, false) {
+			k.dsGone = now
+			changed[k] = true
+		}
+	}
+
+	if cur == nil {
+		return nil
+	}
+	if next == nil {
+		if m.kskLifetime == 0 {
+			return nil
+		}
+		lead := m.parentPropagation + m.parentDSTTL + durationPropagation
+		if now.Before(cur.active.Add(m.kskLifetime - lead)) {
+			return nil
+		}
+		k, err := m.generate(true)
+		if err != nil {
+			return err
+		}
+		k.dsPublish = now
+		changed[k] = true
+		log.Infof("Rolling over KSK %d of %q: the DS of KSK %d is to be published in the parent zone", cur.KeyTag, m.origin, k.KeyTag)
+		return nil
+	}
+
+	// Both DS records must be in all caches before the DNSKEY records are swapped.
+	if next.dsSeen.IsZero() || now.Before(next.dsSeen.Add(m.parentDSTTL)) {
+		return nil
+	}
+	next.published, next.active = now, now
+	cur.retired, cur.removed = now, now
+	cur.dsRemove = now.Add(durationPropagation + m.maxZoneTTL)
+	changed[next], changed[cur] = true, true
+	log.Infof("Rolled over KSK %d of %q to KSK %d, the DS of KSK %d is to be removed from the parent zone at %s", cur.KeyTag, m.origin, next.KeyTag, cur.KeyTag, cur.dsRemove.Format(timeFmt))
+	return nil
+}
+
+// dsAtParent returns true if the DS record of k is published (or removed, if publish is false) in the parent
+// zone. Without parent agents, it is assumed the parent made the change parentPropagation after since.
+func (m *keyManager) dsAtParent(now time.Time, k *managedKey, since time.Time, publish bool) bool {
+	if len(m.parentAgents) == 0 {
+		return !now.Before(since.Add(m.parentPropagation))
+	}
+	dss, err := queryDS(m.origin, m.parentAgents)
+	if err != nil {
+		log.Warningf("Failed to query the parent agents for the DS records of %q: %s", m.origin, err)
+		return false
+	}
+	found := false
+	for _, ds := range dss {
+		if ds.KeyTag != k.KeyTag || ds.Algorithm != k.Public.Algorithm {
+			continue
+		}
+		if kds := k.Public.ToDS(ds.DigestType); kds != nil && strings.EqualFold(kds.Digest, ds.Digest) {
+			found = true
+			break
+		}
+	}
+	return found == publish
+}
+
+// queryDS returns the DS records of origin from the first agent that answers.
+func queryDS(origin string, agents []string) ([]*dns.DS, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(origin, dns.TypeDS)
+	c := &dns.Client{Timeout: 5 * time.Second}
+
+	var err error
+	for _, agent := range agents {
+		var r *dns.Msg
+		r, _, err = c.Exchange(m, agent)
+		if err != nil {
+			continue
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("%s: rcode %s", agent, dns.RcodeToString[r.Rcode])
+			continue
+		}
+		dss := []*dns.DS{}
+		for _, rr := range r.Answer {
+			if ds, ok := rr.(*dns.DS); ok {
+				dss = append(dss, ds)
+			}
+		}
+		return dss, nil
+	}
+	return nil, err
+}
+
+// actions sets the metric, and logs, the changes to the DS records in the parent zone that haven't been seen yet.
+func (m *keyManager) actions(now time.Time) {
+	publish, remove := 0.0, 0.0
+	for _, k := range m.keys {
+		if !k.ksk {
+			continue
+		}
+		if !k.dsPublish.IsZero() && k.dsSeen.IsZero() {
+			publish = 1
+			log.Warningf("Zone %q: the DS record for KSK %d is to be added to the parent zone: %s", m.origin, k.KeyTag, k.Public.ToDS(dns.SHA256))
+		}
+		if !k.dsRemove.IsZero() && !now.Before(k.dsRemove) && k.dsGone.IsZero() {
+			remove = 1
+			log.Warningf("Zone %q: the DS record for KSK %d is to be removed from the parent zone: %s", m.origin, k.KeyTag, k.Public.ToDS(dns.SHA256))
+		}
+	}
+	ActionRequired.WithLabelValues(m.origin, "publish_ds").Set(publish)
+	ActionRequired.WithLabelValues(m.origin, "remove_ds").Set(remove)
+}
+
+// generate creates a new key and writes it to the key directory. A key with a key tag that is already used by
+// another key is thrown away.
+func (m *keyManager) generate(ksk bool) (*managedKey, error) {
+	for {
+		k, err := generateKey(m.origin, m.algorithm, ksk)
+		if err != nil {
+			return nil, err
+		}
+		unique := true
+		for _, other := range m.keys {
+			if other.KeyTag == k.KeyTag {
+				unique = false
+			}
+		}
+		if !unique {
+			continue
+		}
+		if err := k.writeKey(m.dir); err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, k)
+		return k, nil
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
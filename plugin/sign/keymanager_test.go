@@ -0,0 +1,188 @@
+package sign
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func testKeyManager(t *testing.T) (*keyPolicy, *keyManager) {
+	t.Helper()
+	p := newKeyPolicy()
+	p.dir = t.TempDir()
+	return p, newKeyManager(p, "miek.nl.")
+}
+
+func plan(t *testing.T, m *keyManager, now time.Time, expectChange bool) keySet {
+	t.Helper()
+	changed, err := m.plan(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != expectChange {
+		t.Fatalf("At %s: expected changed to be %t, got %t", now.Format(timeFmt), expectChange, changed)
+	}
+	return m.keySet(now)
+}
+
+func expectKeys(t *testing.T, ks keySet, dnskey, ksk, zsk, cds int) {
+	t.Helper()
+	if len(ks.dnskey) != dnskey || len(ks.ksk) != ksk || len(ks.zsk) != zsk || len(ks.cds) != cds {
+		t.Fatalf("Expected %d DNSKEYs, %d KSKs, %d ZSKs and %d CDSs, got %d, %d, %d and %d",
+			dnskey, ksk, zsk, cds, len(ks.dnskey), len(ks.ksk), len(ks.zsk), len(ks.cds))
+	}
+}
+
+func TestKeyManagerZSKRollover(t *testing.T) {
+	p, _ := testKeyManager(t)
+	p.zskLifetime = 30 * 24 * time.Hour
+	m := newKeyManager(p, "miek.nl.")
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ks := plan(t, m, now, true)
+	expectKeys(t, ks, 2, 1, 1, 1)
+	if ks.ksk[0].Public.Flags != 257 || ks.zsk[0].Public.Flags != 256 {
+		t.Errorf("Expected a KSK and a ZSK, got flags %d and %d", ks.ksk[0].Public.Flags, ks.zsk[0].Public.Flags)
+	}
+	old := ks.zsk[0].KeyTag
+	plan(t, m, now.Add(time.Hour), false)
+
+	// Pre-publish: the new ZSK is published propagation + max zone TTL before the old one retires.
+	prepublish := durationPropagation + m.maxZoneTTL
+	ks = plan(t, m, now.Add(m.zskLifetime-prepublish), true)
+	expectKeys(t, ks, 3, 1, 1, 1)
+	if ks.zsk[0].KeyTag != old {
+		t.Errorf("Expected ZSK %d to sign, got %d", old, ks.zsk[0].KeyTag)
+	}
+
+	ks = plan(t, m, now.Add(m.zskLifetime), false)
+	expectKeys(t, ks, 3, 1, 1, 1)
+	if ks.zsk[0].KeyTag == old {
+		t.Errorf("Expected the new ZSK to sign, got %d", old)
+	}
+	if !m.changedSince(now.Add(m.zskLifetime-time.Minute), now.Add(m.zskLifetime)) {
+		t.Errorf("Expected the keys to have changed")
+	}
+
+	ks = plan(t, m, now.Add(m.zskLifetime+prepublish), false)
+	expectKeys(t, ks, 2, 1, 1, 1)
+
+	// The state is read back from the key directory.
+	m = newKeyManager(p, "miek.nl.")
+	ks2 := plan(t, m, now.Add(m.zskLifetime+prepublish), false)
+	expectKeys(t, ks2, 2, 1, 1, 1)
+	if ks2.zsk[0].KeyTag != ks.zsk[0].KeyTag || ks2.ksk[0].KeyTag != ks.ksk[0].KeyTag {
+		t.Errorf("Expected the same keys after reading the state, got %d and %d", ks2.zsk[0].KeyTag, ks2.ksk[0].KeyTag)
+	}
+}
+
+func TestKeyManagerKSKRollover(t *testing.T) {
+	_, m := testKeyManager(t)
+	m.zskLifetime = 0
+	m.kskLifetime = 365 * 24 * time.Hour
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ks := plan(t, m, now, true)
+	expectKeys(t, ks, 2, 1, 1, 1)
+	old := ks.ksk[0].KeyTag
+	// Without parent agents, the DS is assumed to be published after the parent's propagation delay.
+	plan(t, m, now.Add(m.parentPropagation), true)
+
+	// Double-DS: the new DS is added to the parent, the DNSKEY isn't published yet.
+	start := now.Add(m.kskLifetime - m.parentPropagation - m.parentDSTTL - durationPropagation)
+	ks = plan(t, m, start, true)
+	expectKeys(t, ks, 2, 1, 1, 2)
+
+	ks = plan(t, m, start.Add(m.parentPropagation), true) // the new DS is seen
+	expectKeys(t, ks, 2, 1, 1, 2)
+	ks = plan(t, m, start.Add(m.parentPropagation+m.parentDSTTL-time.Minute), false)
+	if ks.ksk[0].KeyTag != old {
+		t.Errorf("Expected KSK %d to sign, got %d", old, ks.ksk[0].KeyTag)
+	}
+
+	// The DNSKEYs are swapped once the new DS is in all caches.
+	swap := start.Add(m.parentPropagation + m.parentDSTTL)
+	ks = plan(t, m, swap, true)
+	expectKeys(t, ks, 2, 1, 1, 2)
+	if ks.ksk[0].KeyTag == old {
+		t.Errorf("Expected the new KSK to sign, got %d", old)
+	}
+
+	// And the old DS is removed from the parent.
+	remove := swap.Add(durationPropagation + m.maxZoneTTL)
+	ks = plan(t, m, remove, false)
+	expectKeys(t, ks, 2, 1, 1, 1)
+	if ks.cds[0].KeyTag == old {
+		t.Errorf("Expected the CDS of the new KSK, got %d", old)
+	}
+	plan(t, m, remove.Add(m.parentPropagation), true) // the old DS is gone
+	plan(t, m, remove.Add(2*m.parentPropagation), false)
+}
+
+func TestKeyManagerParentAgents(t *testing.T) {
+	_, m := testKeyManager(t)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ks := plan(t, m, now, true)
+
+	var (
+		mu sync.Mutex
+		ds []dns.RR
+	)
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		mu.Lock()
+		ret.Answer = ds
+		w.WriteMsg(ret)
+		mu.Unlock()
+	})
+	defer s.Close()
+	m.parentAgents = []string{s.Addr}
+
+	// The DS isn't in the parent zone, however long we wait.
+	plan(t, m, now.Add(10*m.parentPropagation), false)
+	if !m.keys[1].dsSeen.IsZero() {
+		t.Fatalf("Expected the DS not to be seen")
+	}
+
+	mu.Lock()
+	ds = []dns.RR{test.DS("miek.nl. 3600 IN DS 1 13 2 AABB"), ks.ksk[0].Public.ToDS(dns.SHA256)}
+	mu.Unlock()
+	plan(t, m, now.Add(10*m.parentPropagation+time.Hour), true)
+}
+
+func TestKeyState(t *testing.T) {
+	dir := t.TempDir()
+	k, err := generateKey("miek.nl.", dns.ED25519, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	k.published, k.active, k.dsPublish = now, now, now.Add(time.Hour)
+	if err := k.writeKey(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.writeState(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := readKeys(dir, "miek.nl.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(keys))
+	}
+	k2 := keys[0]
+	if k2.KeyTag != k.KeyTag || !k2.ksk {
+		t.Errorf("Expected KSK %d, got %s %d", k.KeyTag, k2.role(), k2.KeyTag)
+	}
+	if !k2.published.Equal(k.published) || !k2.active.Equal(k.active) || !k2.dsPublish.Equal(k.dsPublish) || !k2.retired.IsZero() {
+		t.Errorf("Expected the same key state, got %v", k2.stateTimes())
+	}
+}
@@ -25,10 +25,11 @@ type Pair struct {
 	Private crypto.Signer
 }
 
-// keyParse reads the public and private key from disk.
-func keyParse(c *caddy.Controller) ([]Pair, error) {
+// keyParse reads the public and private key from disk. For managed keys, "directory", the key directory is returned
+// instead.
+func keyParse(c *caddy.Controller) ([]Pair, string, error) {
 	if !c.NextArg() {
-		return nil, c.ArgErr()
+		return nil, "", c.ArgErr()
 	}
 	pairs := []Pair{}
 	config := dnsserver.GetConfig(c)
@@ -37,7 +38,7 @@ func keyParse(c *caddy.Controller) ([]Pair, error) {
 	case "file":
 		ks := c.RemainingArgs()
 		if len(ks) == 0 {
-			return nil, c.ArgErr()
+			return nil, "", c.ArgErr()
 		}
 		for _, k := range ks {
 			base := k
@@ -54,18 +55,43 @@ func keyParse(c *caddy.Controller) ([]Pair, error) {
 
 			pair, err := readKeyPair(base+".key", base+".private")
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			pairs = append(pairs, pair)
 		}
 	case "directory":
-		return nil, fmt.Errorf("directory: not implemented")
+		if !c.NextArg() {
+			return nil, "", c.ArgErr()
+		}
+		dir := c.Val()
+		if c.NextArg() {
+			return nil, "", c.ArgErr()
+		}
+		if !filepath.IsAbs(dir) && config.Root != "" {
+			dir = filepath.Join(config.Root, dir)
+		}
+		return nil, dir, nil
+	default:
+		return nil, "", c.Errf("unknown key source '%s'", c.Val())
 	}
 
-	return pairs, nil
+	return pairs, "", nil
 }
 
+// readKeyPair reads a key that must be a CSK or KSK.
 func readKeyPair(public, private string) (Pair, error) {
+	pair, err := readKey(public, private)
+	if err != nil {
+		return Pair{}, err
+	}
+	if pair.Public.Flags&dns.SEP == 0 {
+		return Pair{}, fmt.Errorf("DNSKEY in %q is not a CSK/KSK", public)
+	}
+	return pair, nil
+}
+
+// readKey reads the public key from public and the private key from private.
+func readKey(public, private string) (Pair, error) {
 	rk, err := os.Open(filepath.Clean(public))
 	if err != nil {
 		return Pair{}, err
@@ -81,9 +107,8 @@ func readKeyPair(public, private string) (Pair, error) {
 	if _, ok := dnskey.(*dns.DNSKEY); !ok {
 		return Pair{}, fmt.Errorf("RR in %q is not a DNSKEY: %d", public, dnskey.Header().Rrtype)
 	}
-	ksk := dnskey.(*dns.DNSKEY).Flags&(1<<8) == (1<<8) && dnskey.(*dns.DNSKEY).Flags&1 == 1
-	if !ksk {
-		return Pair{}, fmt.Errorf("DNSKEY in %q is not a CSK/KSK", public)
+	if dnskey.(*dns.DNSKEY).Flags&dns.ZONE == 0 {
+		return Pair{}, fmt.Errorf("DNSKEY in %q is not a zone key", public)
 	}
 
 	rp, err := os.Open(filepath.Clean(private))
@@ -0,0 +1,17 @@
+package sign
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ActionRequired is 1 when a change to the DS records in the parent zone of a zone with managed keys is needed
+// and hasn't been seen yet.
+var ActionRequired = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "sign",
+	Name:      "action_required",
+	Help:      "Gauge that is 1 when the DS records in the parent zone must be changed.",
+}, []string{"zone", "action"})
@@ -0,0 +1,98 @@
+package sign
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Params are the parameters of the NSEC3 chain (RFC 5155) of a zone.
+type nsec3Params struct {
+	iterations uint16
+	salt       string // hex encoded, empty for no salt
+	optOut     bool   // leave insecure delegations out of the chain
+}
+
+// NSEC3PARAM returns the NSEC3PARAM record for the apex of origin.
+func (p *nsec3Params) NSEC3PARAM(origin string, ttl uint32) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: origin, Ttl: ttl, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET},
+		Hash:       dns.SHA1,
+		Iterations: p.iterations,
+		SaltLength: uint8(len(p.salt) / 2),
+		Salt:       p.salt,
+	}
+}
+
+// chain returns the NSEC3 records for the authoritative names in z, and the empty non-terminals above them, in hash
+// order. With opt-out, delegations without DS records are left out. The bitmap of each name is the one it has when
+// the zone is signed.
+func (p *nsec3Params) chain(origin string, z *file.Zone, ttl uint32) []*dns.NSEC3 {
+	bitmaps := map[string][]uint16{}
+	z.AuthWalk(func(e *tree.Elem, _ map[uint16][]dns.RR, auth bool) error {
+		if !auth {
+			return nil
+		}
+		name := e.Name()
+		switch {
+		case name == origin:
+			bitmaps[name] = append(e.Types(), dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG)
+		case e.Type(dns.TypeNS) != nil && e.Type(dns.TypeDS) == nil:
+			if p.optOut {
+				return nil
+			}
+			bitmaps[name] = e.Types()
+		default:
+			bitmaps[name] = append(e.Types(), dns.TypeRRSIG)
+		}
+		return nil
+	})
+
+	// Add the empty non-terminals, names that only exist because there are names below them.
+	for name := range bitmaps {
+		for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+			parent := name[off:]
+			if !dns.IsSubDomain(origin, parent) {
+				break
+			}
+			if _, ok := bitmaps[parent]; !ok {
+				bitmaps[parent] = []uint16{}
+			}
+		}
+	}
+
+	hashes := make([]string, 0, len(bitmaps))
+	names := make(map[string]string, len(bitmaps))
+	for name := range bitmaps {
+		h := dns.HashName(name, dns.SHA1, p.iterations, p.salt)
+		hashes = append(hashes, h)
+		names[h] = name
+	}
+	sort.Strings(hashes)
+
+	flags := uint8(0)
+	if p.optOut {
+		flags = 1
+	}
+	chain := make([]*dns.NSEC3, len(hashes))
+	for i, h := range hashes {
+		bitmap := bitmaps[names[h]]
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		chain[i] = &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(h) + "." + origin, Ttl: ttl, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: p.iterations,
+			SaltLength: uint8(len(p.salt) / 2),
+			Salt:       p.salt,
+			HashLength: 20,
+			NextDomain: hashes[(i+1)%len(hashes)],
+			TypeBitMap: bitmap,
+		}
+	}
+	return chain
+}
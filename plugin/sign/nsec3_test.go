@@ -0,0 +1,141 @@
+package sign
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+func TestSignNSEC3(t *testing.T) {
+	tests := []struct {
+		nsec3  string
+		names  []string // names with an NSEC3 record
+		optOut bool
+	}{
+		{"nsec3", []string{"miek.nl.", "a.miek.nl.", "www.miek.nl.", "bla.miek.nl.", "blaaat.miek.nl.", "ns3.blaaat.miek.nl."}, false},
+		{"nsec3 5 AABBCCDD opt-out", []string{"miek.nl.", "a.miek.nl.", "www.miek.nl.", "blaaat.miek.nl.", "ns3.blaaat.miek.nl."}, true},
+	}
+	for i, tc := range tests {
+		input := `sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			directory testdata
+			` + tc.nsec3 + `
+		}`
+		c := caddy.NewTestController("dns", input)
+		sign, err := parse(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer := sign.signers[0]
+		z, err := signer.Sign(time.Now().UTC())
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+
+		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+			if len(e.Type(dns.TypeNSEC)) > 0 {
+				t.Errorf("Test %d: expected no NSEC records, got one for %s", i, e.Name())
+			}
+			return nil
+		})
+		apex, _ := z.Search("miek.nl.")
+		param := apex.Type(dns.TypeNSEC3PARAM)
+		if len(param) != 1 {
+			t.Fatalf("Test %d: expected an NSEC3PARAM record, got %d", i, len(param))
+		}
+		if p := param[0].(*dns.NSEC3PARAM); p.Iterations != signer.nsec3.iterations || p.Salt != signer.nsec3.salt || p.Flags != 0 {
+			t.Errorf("Test %d: expected NSEC3PARAM with the configured parameters, got %s", i, p)
+		}
+
+		chain := z.Apex.NSEC3.All()
+		if len(chain) != len(tc.names) {
+			t.Errorf("Test %d: expected %d NSEC3 records, got %d", i, len(tc.names), len(chain))
+		}
+		for _, name := range tc.names {
+			found := false
+			for _, e := range chain {
+				nsec3 := e.Type(dns.TypeNSEC3)[0].(*dns.NSEC3)
+				if nsec3.Match(name) {
+					found = true
+				}
+				if (nsec3.Flags&1 == 1) != tc.optOut {
+					t.Errorf("Test %d: expected opt-out %t, got flags %d", i, tc.optOut, nsec3.Flags)
+				}
+			}
+			if !found {
+				t.Errorf("Test %d: expected an NSEC3 record for %s", i, name)
+			}
+		}
+
+		// Every NSEC3 record is signed, and the chain links them all.
+		key := signer.keys[0].Public
+		for j, e := range chain {
+			nsec3 := e.Type(dns.TypeNSEC3)[0].(*dns.NSEC3)
+			sigs := e.Type(dns.TypeRRSIG)
+			if len(sigs) != 1 {
+				t.Fatalf("Test %d: expected a signature for %s, got %d", i, e.Name(), len(sigs))
+			}
+			if err := sigs[0].(*dns.RRSIG).Verify(key, []dns.RR{nsec3}); err != nil {
+				t.Errorf("Test %d: expected a valid signature for %s, got %s", i, e.Name(), err)
+			}
+			next := chain[(j+1)%len(chain)].Name()
+			if !strings.HasPrefix(next, strings.ToLower(nsec3.NextDomain)+".") {
+				t.Errorf("Test %d: expected next hashed owner %s for %s, got %s", i, next, e.Name(), nsec3.NextDomain)
+			}
+		}
+
+		// The signed zone can be served by the file plugin.
+		buf := &bytes.Buffer{}
+		if err := write(buf, z); err != nil {
+			t.Fatal(err)
+		}
+		served, err := file.Parse(buf, "miek.nl.", "stdin", 0)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error parsing the signed zone, got %s", i, err)
+		}
+		if x := len(served.Apex.NSEC3.All()); x != len(tc.names) {
+			t.Errorf("Test %d: expected %d NSEC3 records in the signed zone, got %d", i, len(tc.names), x)
+		}
+	}
+}
+
+func TestParseNSEC3(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		exp       nsec3Params
+	}{
+		{"nsec3", false, nsec3Params{}},
+		{"nsec3 opt-out", false, nsec3Params{optOut: true}},
+		{"nsec3 10", false, nsec3Params{iterations: 10}},
+		{"nsec3 0 aabb opt-out", false, nsec3Params{salt: "AABB", optOut: true}},
+		{"nsec3 0 -", false, nsec3Params{}},
+		{"nsec3 101", true, nsec3Params{}},
+		{"nsec3 x", true, nsec3Params{}},
+		{"nsec3 0 xyz", true, nsec3Params{}},
+		{"nsec3 0 aa bb", true, nsec3Params{}},
+	}
+	for i, tc := range tests {
+		input := "sign testdata/db.miek.nl miek.nl {\n" + tc.input + "\n}"
+		sign, err := parse(caddy.NewTestController("dns", input))
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error for %q, got %s", i, tc.input, err)
+		}
+		if x := sign.signers[0].nsec3; x == nil || *x != tc.exp {
+			t.Errorf("Test %d: expected %+v, got %+v", i, tc.exp, x)
+		}
+	}
+}
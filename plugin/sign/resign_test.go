@@ -38,3 +38,34 @@ func TestResignExpire(t *testing.T) {
 		t.Errorf("Expected RRSIG to be invalid for %s, got valid", then.Format(timeFmt))
 	}
 }
+
+func TestResignDenial(t *testing.T) {
+	const (
+		nsec  = `miek.nl.	14400	IN	NSEC	a.miek.nl. NS SOA RRSIG NSEC DNSKEY`
+		nsec3 = `c8dg0ll4j8rghdvi5ddm5n4e6gsmn2e3.miek.nl.	14400	IN	NSEC3	1 1 0 AABB 2OB4GNMHRV0UJK1MBGKF9A8UT8D2AFO4 A RRSIG`
+	)
+	tests := []struct {
+		zone  string
+		nsec3 *nsec3Params
+		valid bool
+	}{
+		{nsec, nil, true},
+		{nsec, &nsec3Params{}, false},
+		{nsec3, nil, false},
+		{nsec3, &nsec3Params{salt: "AABB", optOut: true}, true},
+		{nsec3, &nsec3Params{salt: "aabb", optOut: true}, true},
+		{nsec3, &nsec3Params{salt: "AABB"}, false},
+		{nsec3, &nsec3Params{iterations: 1, salt: "AABB", optOut: true}, false},
+		{nsec3, &nsec3Params{optOut: true}, false},
+		{"", nil, false},
+	}
+	for i, tc := range tests {
+		why := denial(strings.NewReader(tc.zone), tc.nsec3)
+		if tc.valid && why != nil {
+			t.Errorf("Test %d: expected the denial to be valid, got %s", i, why)
+		}
+		if !tc.valid && why == nil {
+			t.Errorf("Test %d: expected the denial to be invalid", i)
+		}
+	}
+}
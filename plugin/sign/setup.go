@@ -1,14 +1,23 @@
 package sign
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/rand"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/nsec"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("sign", setup) }
@@ -64,13 +73,22 @@ func parse(c *caddy.Controller) (*Sign, error) {
 			}
 		}
 
+		policy := newKeyPolicy()
+		managed := ""
 		for c.NextBlock() {
 			switch c.Val() {
 			case "key":
-				pairs, err := keyParse(c)
+				pairs, dir, err := keyParse(c)
 				if err != nil {
 					return sign, err
 				}
+				if dir != "" {
+					if policy.dir != "" {
+						return sign, c.Err("only one key directory can be used")
+					}
+					policy.dir = dir
+					continue
+				}
 				for i := range signers {
 					for _, p := range pairs {
 						p.Public.Header().Name = signers[i].origin
@@ -89,12 +107,124 @@ func parse(c *caddy.Controller) (*Sign, error) {
 					signers[i].directory = dir[0]
 					signers[i].signedfile = fmt.Sprintf("db.%ssigned", signers[i].origin)
 				}
+			case "nsec3":
+				p, err := nsec3Parse(c)
+				if err != nil {
+					return sign, err
+				}
+				for i := range signers {
+					signers[i].nsec3 = p
+				}
+			case "algorithm":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return sign, c.ArgErr()
+				}
+				alg, ok := dns.StringToAlgorithm[strings.ToUpper(args[0])]
+				if !ok {
+					return sign, c.Errf("unknown algorithm '%s'", args[0])
+				}
+				switch alg {
+				case dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+				default:
+					return sign, c.Errf("unsupported algorithm '%s'", args[0])
+				}
+				policy.algorithm = alg
+				managed = c.Val()
+			case "zsk_lifetime", "ksk_lifetime", "max_zone_ttl", "parent_ds_ttl", "parent_propagation":
+				name := c.Val()
+				d, err := durationParse(c)
+				if err != nil {
+					return sign, err
+				}
+				switch name {
+				case "zsk_lifetime":
+					policy.zskLifetime = d
+				case "ksk_lifetime":
+					policy.kskLifetime = d
+				case "max_zone_ttl":
+					policy.maxZoneTTL = d
+				case "parent_ds_ttl":
+					policy.parentDSTTL = d
+				case "parent_propagation":
+					policy.parentPropagation = d
+				}
+				managed = name
+			case "parent_agents":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return sign, c.ArgErr()
+				}
+				for _, addr := range args {
+					normalized, err := pkgparse.HostPort(addr, transport.Port)
+					if err != nil {
+						return sign, err
+					}
+					policy.parentAgents = append(policy.parentAgents, normalized)
+				}
+				managed = c.Val()
 			default:
 				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
+
+		if policy.dir == "" && managed != "" {
+			return sign, c.Errf("'%s' needs a key directory", managed)
+		}
+		if policy.dir != "" {
+			if fi, err := os.Stat(policy.dir); err != nil || !fi.IsDir() {
+				return sign, c.Errf("key directory '%s' is not a directory", policy.dir)
+			}
+			for i := range signers {
+				if len(signers[i].keys) > 0 {
+					return sign, c.Err("key file and key directory can't be used together")
+				}
+				signers[i].manager = newKeyManager(policy, signers[i].origin)
+			}
+		}
 		sign.signers = append(sign.signers, signers...)
 	}
 
 	return sign, nil
 }
+
+// durationParse parses the single duration argument of a property. A duration can't be negative.
+func durationParse(c *caddy.Controller) (time.Duration, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil || d < 0 {
+		return 0, c.Errf("invalid duration '%s'", args[0])
+	}
+	return d, nil
+}
+
+// nsec3Parse parses: nsec3 [ITERATIONS [SALT]] [opt-out].
+func nsec3Parse(c *caddy.Controller) (*nsec3Params, error) {
+	p := &nsec3Params{}
+	args := c.RemainingArgs()
+	if len(args) > 0 && args[len(args)-1] == "opt-out" {
+		p.optOut = true
+		args = args[:len(args)-1]
+	}
+	if len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	if len(args) > 0 {
+		i, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil || i > nsec.MaxIterations {
+			return nil, c.Errf("invalid NSEC3 iterations '%s'", args[0])
+		}
+		p.iterations = uint16(i)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		salt, err := hex.DecodeString(args[1])
+		if err != nil || len(salt) > 255 {
+			return nil, c.Errf("invalid NSEC3 salt '%s'", args[1])
+		}
+		p.salt = strings.ToUpper(args[1])
+	}
+	return p, nil
+}
@@ -2,8 +2,11 @@ package sign
 
 import (
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
+
+	"github.com/miekg/dns"
 )
 
 func TestParse(t *testing.T) {
@@ -44,6 +47,34 @@ func TestParse(t *testing.T) {
 			true,
 			nil,
 		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			key directory testdata
+		 }`,
+			true,
+			nil,
+		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			zsk_lifetime 720h
+		 }`,
+			true,
+			nil,
+		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			algorithm DSA
+		 }`,
+			true,
+			nil,
+		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			parent_ds_ttl -1h
+		 }`,
+			true,
+			nil,
+		},
 	}
 	for i, tc := range tests {
 		c := caddy.NewTestController("dns", tc.input)
@@ -73,3 +104,31 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseManagedKeys(t *testing.T) {
+	input := `sign testdata/db.miek.nl miek.nl {
+		key directory testdata
+		algorithm ED25519
+		zsk_lifetime 720h
+		ksk_lifetime 8760h
+		parent_agents 192.0.2.53 [2001:db8::53]:5353
+	}`
+	c := caddy.NewTestController("dns", input)
+	sign, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := sign.signers[0].manager
+	if m == nil {
+		t.Fatal("Expected managed keys")
+	}
+	if m.dir != "testdata" || m.origin != "miek.nl." || m.algorithm != dns.ED25519 {
+		t.Errorf("Expected ED25519 keys for miek.nl. in testdata, got %d keys for %s in %s", m.algorithm, m.origin, m.dir)
+	}
+	if m.zskLifetime != 720*time.Hour || m.kskLifetime != 8760*time.Hour || m.maxZoneTTL != 24*time.Hour {
+		t.Errorf("Expected lifetimes of 720h and 8760h, got %s and %s", m.zskLifetime, m.kskLifetime)
+	}
+	if len(m.parentAgents) != 2 || m.parentAgents[0] != "192.0.2.53:53" || m.parentAgents[1] != "[2001:db8::53]:5353" {
+		t.Errorf("Expected 2 parent agents, got %v", m.parentAgents)
+	}
+}
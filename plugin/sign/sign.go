@@ -33,6 +33,8 @@ const (
 	durationInceptionJitter         = -18 * time.Hour     // default max jitter for the inception
 	durationExpirationDayJitter     = 5 * 24 * time.Hour  // default max jitter for the expiration
 	durationSignatureInceptionHours = -3 * time.Hour      // -(2+1) hours, be sure to catch daylight saving time and such, jitter is subtracted
+	durationZSKLifetime             = 90 * 24 * time.Hour // default lifetime of a managed ZSK
+	durationPropagation             = time.Hour           // time for a change in the signed zone to reach all secondaries
 )
 
 const timeFmt = "2006-01-02T15:04:05.000Z07:00"
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin/file"
@@ -24,6 +25,8 @@ type Signer struct {
 	directory   string
 	jitterIncep time.Duration
 	jitterExpir time.Duration
+	nsec3       *nsec3Params // if nil, NSEC is used
+	manager     *keyManager  // if not nil, the keys are managed and keys is empty
 
 	signedfile string
 	stop       chan struct{}
@@ -46,18 +49,34 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 	inception, expiration := lifetime(now, s.jitterIncep, s.jitterExpir)
 	z.Apex.SOA.Serial = uint32(now.Unix())
 
-	for _, pair := range s.keys {
+	if s.manager != nil {
+		if _, err := s.manager.plan(now); err != nil {
+			return nil, err
+		}
+	}
+	ks := s.keySet(now)
+
+	for _, pair := range ks.dnskey {
 		pair.Public.Header().Ttl = ttl // set TTL on key so it matches the RRSIG.
 		z.Insert(pair.Public)
+	}
+	for _, pair := range ks.cds {
+		pair.Public.Header().Ttl = ttl
 		z.Insert(pair.Public.ToDS(dns.SHA1).ToCDS())
 		z.Insert(pair.Public.ToDS(dns.SHA256).ToCDS())
 		z.Insert(pair.Public.ToCDNSKEY())
 	}
 
+	var chain []*dns.NSEC3
+	if s.nsec3 != nil {
+		z.Insert(s.nsec3.NSEC3PARAM(s.origin, ttl))
+		chain = s.nsec3.chain(s.origin, z, mttl)
+	}
+
 	names := names(s.origin, z)
 	ln := len(names)
 
-	for _, pair := range s.keys {
+	for _, pair := range ks.zsk {
 		rrsig, err := pair.signRRs([]dns.RR{z.Apex.SOA}, s.origin, ttl, inception, expiration)
 		if err != nil {
 			return nil, err
@@ -80,10 +99,12 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			return nil
 		}
 
-		if e.Name() == s.origin {
+		switch {
+		case s.nsec3 != nil:
+		case e.Name() == s.origin:
 			nsec := NSEC(e.Name(), names[(ln+i)%ln], mttl, append(e.Types(), dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC))
 			z.Insert(nsec)
-		} else {
+		default:
 			nsec := NSEC(e.Name(), names[(ln+i)%ln], mttl, append(e.Types(), dns.TypeRRSIG, dns.TypeNSEC))
 			z.Insert(nsec)
 		}
@@ -94,7 +115,7 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			if t == dns.TypeRRSIG || t == dns.TypeNS {
 				continue
 			}
-			for _, pair := range s.keys {
+			for _, pair := range ks.signers(t) {
 				rrsig, err := pair.signRRs(rrs, s.origin, rrs[0].Header().Ttl, inception, expiration)
 				if err != nil {
 					return err
@@ -105,19 +126,83 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 		i++
 		return nil
 	})
-	return z, err
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nsec3 := range chain {
+		z.Insert(nsec3)
+		for _, pair := range ks.zsk {
+			rrsig, err := pair.signRRs([]dns.RR{nsec3}, s.origin, mttl, inception, expiration)
+			if err != nil {
+				return nil, err
+			}
+			z.Insert(rrsig)
+		}
+	}
+	return z, nil
+}
+
+// keySet returns the keys to sign the zone with at now.
+func (s *Signer) keySet(now time.Time) keySet {
+	if s.manager != nil {
+		return s.manager.keySet(now)
+	}
+	return csk(s.keys)
+}
+
+// signers returns the keys that sign the RRset with type t: the KSKs sign the DNSKEY, CDS and CDNSKEY RRsets, the
+// ZSKs the others.
+func (ks keySet) signers(t uint16) []Pair {
+	switch t {
+	case dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY:
+		return ks.ksk
+	}
+	return ks.zsk
 }
 
-// resign checks if the signed zone exists, or needs resigning.
+// resign checks if the signed zone exists, or needs resigning. Besides the signatures getting old, a zone is
+// resigned when the zone file is newer than the signed zone, or when it isn't signed with the configured NSEC or
+// NSEC3 parameters, as the chain needs to change then. With managed keys, the zone is also resigned when the keys
+// changed.
 func (s *Signer) resign() error {
+	now := time.Now().UTC()
+	if s.manager != nil {
+		changed, err := s.manager.plan(now)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return fmt.Errorf("the keys changed")
+		}
+	}
+
 	signedfile := filepath.Join(s.directory, s.signedfile)
 	rd, err := os.Open(filepath.Clean(signedfile))
-	if err != nil && os.IsNotExist(err) {
+	if err != nil {
 		return err
 	}
+	defer rd.Close()
 
-	now := time.Now().UTC()
-	return resign(rd, now)
+	if why := resign(rd, now); why != nil {
+		return why
+	}
+
+	signed, err := rd.Stat()
+	if err != nil {
+		return err
+	}
+	if db, err := os.Stat(s.dbfile); err == nil && db.ModTime().After(signed.ModTime()) {
+		return fmt.Errorf("zone file %q changed after it was signed", s.dbfile)
+	}
+	if s.manager != nil && s.manager.changedSince(signed.ModTime(), now) {
+		return fmt.Errorf("the keys changed after the zone was signed")
+	}
+
+	if _, err := rd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return denial(rd, s.nsec3)
 }
 
 // resign will scan rd and check the signature on the SOA record. We will resign on the basis
@@ -169,12 +254,42 @@ func resign(rd io.Reader, now time.Time) (why error) {
 	return nil
 }
 
+// denial checks that the zone in rd uses the authenticated denial of existence given by nsec3: NSEC3 with these
+// parameters, or NSEC if nsec3 is nil.
+func denial(rd io.Reader, nsec3 *nsec3Params) (why error) {
+	zp := dns.NewZoneParser(rd, ".", "resign")
+	zp.SetIncludeAllowed(true)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			if nsec3 != nil {
+				return fmt.Errorf("zone is signed with NSEC instead of NSEC3")
+			}
+			return nil
+		case *dns.NSEC3:
+			if nsec3 == nil {
+				return fmt.Errorf("zone is signed with NSEC3 instead of NSEC")
+			}
+			if x.Iterations != nsec3.iterations || !strings.EqualFold(x.Salt, nsec3.salt) || (x.Flags&1 == 1) != nsec3.optOut {
+				return fmt.Errorf("NSEC3 parameters changed")
+			}
+			return nil
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("no NSEC or NSEC3 records found")
+}
+
 func signAndLog(s *Signer, why error) {
 	now := time.Now().UTC()
 	z, err := s.Sign(now)
 	log.Infof("Signing %q because %s", s.origin, why)
+	tags := keyTag(s.keySet(now).dnskey)
 	if err != nil {
-		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, keyTag(s.keys), time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
+		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, tags, time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
 		return
 	}
 
@@ -182,7 +297,7 @@ func signAndLog(s *Signer, why error) {
 		log.Warningf("Error signing %q: failed to move zone file into place: %s", s.origin, err)
 		return
 	}
-	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), keyTag(s.keys), z.Apex.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
+	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), tags, z.Apex.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
 }
 
 // refresh checks every val if some zones need to be resigned.
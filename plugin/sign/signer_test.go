@@ -175,3 +175,40 @@ func TestSignDS(t *testing.T) {
 		t.Errorf("Expected no NSEC TTL to be %d for %s, got %d", minttl, "www.miek.nl.", x)
 	}
 }
+
+func TestSignManagedKeys(t *testing.T) {
+	p := newKeyPolicy()
+	p.dir = t.TempDir()
+	s := &Signer{
+		origin:  "miek.nl.",
+		dbfile:  "testdata/db.miek.nl",
+		manager: newKeyManager(p, "miek.nl."),
+	}
+	z, err := s.Sign(time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := s.keySet(time.Now().UTC())
+
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeDNSKEY); len(x) != 2 {
+		t.Errorf("Expected %d DNSKEY records, got %d", 2, len(x))
+	}
+	if x := apex.Type(dns.TypeCDNSKEY); len(x) != 1 {
+		t.Errorf("Expected %d CDNSKEY record, got %d", 1, len(x))
+	}
+	for _, rr := range apex.Type(dns.TypeRRSIG) {
+		sig := rr.(*dns.RRSIG)
+		expect := ks.zsk[0].KeyTag
+		switch sig.TypeCovered {
+		case dns.TypeDNSKEY, dns.TypeCDS, dns.TypeCDNSKEY:
+			expect = ks.ksk[0].KeyTag
+		}
+		if sig.KeyTag != expect {
+			t.Errorf("Expected the RRSIG for %s to be made by %d, got %d", dns.TypeToString[sig.TypeCovered], expect, sig.KeyTag)
+		}
+	}
+	if z.Apex.SIGSOA[0].(*dns.RRSIG).KeyTag != ks.zsk[0].KeyTag {
+		t.Errorf("Expected the SOA to be signed by the ZSK")
+	}
+}
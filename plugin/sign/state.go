@@ -0,0 +1,195 @@
+package sign
+
+import (
+	"bufio"
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// managedKey is a key managed by the key manager, with the times of the events in its life. A zero time means
+// the event hasn't been scheduled.
+type managedKey struct {
+	Pair
+	ksk bool
+
+	published time.Time // the DNSKEY is added to the zone
+	active    time.Time // the key signs
+	retired   time.Time // the key stops signing
+	removed   time.Time // the DNSKEY is removed from the zone
+
+	// For KSKs, the DS record at the parent.
+	dsPublish time.Time // the CDS and CDNSKEY records ask the parent to publish the DS
+	dsSeen    time.Time // the DS is published by the parent
+	dsRemove  time.Time // the CDS and CDNSKEY records ask the parent to remove the DS
+	dsGone    time.Time // the DS is removed by the parent
+}
+
+// role returns "ksk" or "zsk".
+func (k *managedKey) role() string {
+	if k.ksk {
+		return "ksk"
+	}
+	return "zsk"
+}
+
+// base returns the path of the key files in dir, without extension: K<name>+<alg>+<id>.
+func (k *managedKey) base(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("K%s+%03d+%05d", k.Public.Header().Name, k.Public.Algorithm, k.KeyTag))
+}
+
+// stateTimes returns the names of the times in the state file and pointers to them.
+func (k *managedKey) stateTimes() []struct {
+	name string
+	t    *time.Time
+} {
+	return []struct {
+		name string
+		t    *time.Time
+	}{
+		{"Published", &k.published},
+		{"Active", &k.active},
+		{"Retired", &k.retired},
+		{"Removed", &k.removed},
+		{"DSPublish", &k.dsPublish},
+		{"DSSeen", &k.dsSeen},
+		{"DSRemove", &k.dsRemove},
+		{"DSGone", &k.dsGone},
+	}
+}
+
+const stateTimeFmt = "20060102150405"
+
+// generateKey generates a new key for origin.
+func generateKey(origin string, algorithm uint8, ksk bool) (*managedKey, error) {
+	bits := 256
+	switch algorithm {
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	case dns.RSASHA256, dns.RSASHA512:
+		bits = 2048
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	if ksk {
+		dnskey.Flags |= dns.SEP
+	}
+	priv, err := dnskey.Generate(bits)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %d", algorithm)
+	}
+	return &managedKey{Pair: Pair{Public: dnskey, KeyTag: dnskey.KeyTag(), Private: signer}, ksk: ksk}, nil
+}
+
+// writeKey writes the public and private key files of k to dir.
+func (k *managedKey) writeKey(dir string) error {
+	base := k.base(dir)
+	comment := fmt.Sprintf("; This is a %s signing key, keyid %d, for %s\n", map[bool]string{true: "key", false: "zone"}[k.ksk], k.KeyTag, k.Public.Header().Name)
+	if err := writeFile(base+".key", comment+k.Public.String()+"\n", 0o644); err != nil {
+		return err
+	}
+	return writeFile(base+".private", k.Public.PrivateKeyString(k.Private), 0o600)
+}
+
+// writeState writes the state file of k to dir.
+func (k *managedKey) writeState(dir string) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "; This is the state of the %s %d for %s, maintained by CoreDNS.\n", strings.ToUpper(k.role()), k.KeyTag, k.Public.Header().Name)
+	fmt.Fprintf(b, "Role: %s\n", k.role())
+	for _, st := range k.stateTimes() {
+		if !st.t.IsZero() {
+			fmt.Fprintf(b, "%s: %s\n", st.name, st.t.UTC().Format(stateTimeFmt))
+		}
+	}
+	return writeFile(k.base(dir)+".state", b.String(), 0o644)
+}
+
+// readKeys reads the keys for origin, that have a state file, from dir.
+func readKeys(dir, origin string) ([]*managedKey, error) {
+	states, err := filepath.Glob(filepath.Join(dir, "K"+origin+"+*.state"))
+	if err != nil {
+		return nil, err
+	}
+	keys := []*managedKey{}
+	for _, state := range states {
+		base := strings.TrimSuffix(state, ".state")
+		pair, err := readKey(base+".key", base+".private")
+		if err != nil {
+			return nil, err
+		}
+		k := &managedKey{Pair: pair}
+		if err := k.readState(state); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (k *managedKey) readState(path string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	times := k.stateTimes()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return fmt.Errorf("invalid line in %q: %q", path, line)
+		}
+		name, value := line[:i], strings.TrimSpace(line[i+1:])
+		if name == "Role" {
+			k.ksk = value == "ksk"
+			continue
+		}
+		for _, st := range times {
+			if st.name != name {
+				continue
+			}
+			t, err := time.Parse(stateTimeFmt, value)
+			if err != nil {
+				return fmt.Errorf("invalid time for %s in %q: %q", name, path, value)
+			}
+			*st.t = t
+		}
+	}
+	return scanner.Err()
+}
+
+// writeFile writes a file by moving a temporary file with the contents into place.
+func writeFile(path, contents string, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
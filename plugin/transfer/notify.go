@@ -19,7 +19,7 @@ func (t *Transfer) Notify(zone string) error {
 	m.SetNotify(zone)
 	c := new(dns.Client)
 
-	x := longestMatch(t.xfrs, zone)
+	x := t.match(zone)
 	if x == nil {
 		return fmt.Errorf("no such zone registred in the transfer plugin: %s", zone)
 	}
@@ -57,17 +57,11 @@ func parseTransfer(c *caddy.Controller) (*Transfer, error) {
 				if len(args) == 0 {
 					return nil, c.ArgErr()
 				}
-				for _, host := range args {
-					if host == "*" {
-						x.to = append(x.to, host)
-						continue
-					}
-					normalized, err := parse.HostPort(host, transport.Port)
-					if err != nil {
-						return nil, err
-					}
-					x.to = append(x.to, normalized)
+				to, err := normalizeTo(args)
+				if err != nil {
+					return nil, err
 				}
+				x.to = append(x.to, to...)
 			default:
 				return nil, plugin.Error("transfer", c.Errf("unknown property %q", c.Val()))
 			}
@@ -79,3 +73,20 @@ func parseTransfer(c *caddy.Controller) (*Transfer, error) {
 	}
 	return t, nil
 }
+
+// normalizeTo returns the addresses in hosts with the default port added, "*" is kept as is.
+func normalizeTo(hosts []string) ([]string, error) {
+	var to []string
+	for _, host := range hosts {
+		if host == "*" {
+			to = append(to, host)
+			continue
+		}
+		normalized, err := parse.HostPort(host, transport.Port)
+		if err != nil {
+			return nil, err
+		}
+		to = append(to, normalized)
+	}
+	return to, nil
+}
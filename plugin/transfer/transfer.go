@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
+	"sync"
 
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
@@ -20,6 +22,9 @@ type Transfer struct {
 	xfrs        []*xfr
 	tsigSecret  map[string]string
 	Next        plugin.Handler
+
+	mu        sync.RWMutex
+	overrides map[string]*xfr // Addresses for single zones, see SetTo.
 }
 
 type xfr struct {
@@ -42,8 +47,10 @@ type Transferer interface {
 	//
 	// If serial is not 0, it will be handled as an IXFR request. If the serial is equal to or greater (newer) than
 	// the current serial for the zone, send a single SOA record to the channel and then close it.
-	// If the serial is less (older) than the current serial for the zone, perform an AXFR fallback
-	// by proceeding as if an AXFR was requested (as above).
+	// If the serial is less (older) than the current serial for the zone, either send the changes since that
+	// serial (RFC 1995): the current SOA, then per change the old SOA, the deleted records, the new SOA and the
+	// added records, and the current SOA again. Or, if those changes are not known, perform an AXFR fallback by
+	// proceeding as if an AXFR was requested (as above).
 	Transfer(zone string, serial uint32) (<-chan []dns.RR, error)
 }
 
@@ -63,7 +70,7 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		return dns.RcodeRefused, nil
 	}
 
-	x := longestMatch(t.xfrs, state.QName())
+	x := t.match(state.QName())
 	if x == nil {
 		return plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 	}
@@ -200,6 +207,41 @@ func (x xfr) allowed(state request.Request) bool {
 	return false
 }
 
+// SetTo sets the addresses that may transfer zone and are notified of its changes, overriding the configuration
+// of t for that zone only. If to is empty the override is removed. The string zone must be lowercased.
+func (t *Transfer) SetTo(zone string, to []string) error {
+	if t == nil { // see Notify
+		return nil
+	}
+	hosts, err := normalizeTo(to)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(hosts) == 0 {
+		delete(t.overrides, zone)
+		return nil
+	}
+	if t.overrides == nil {
+		t.overrides = make(map[string]*xfr)
+	}
+	t.overrides[zone] = &xfr{Zones: []string{zone}, to: hosts}
+	return nil
+}
+
+// match returns the xfr for name, the override for the zone name if there is one.
+func (t *Transfer) match(name string) *xfr {
+	t.mu.RLock()
+	x, ok := t.overrides[strings.ToLower(name)]
+	t.mu.RUnlock()
+	if ok {
+		return x
+	}
+	return longestMatch(t.xfrs, name)
+}
+
 // Find the first transfer instance for which the queried zone is the longest match. When nothing
 // is found nil is returned.
 func longestMatch(xfrs []*xfr, name string) *xfr {
@@ -218,4 +260,4 @@ func longestMatch(xfrs []*xfr, name string) *xfr {
 }
 
 // Name implements the Handler interface.
-func (Transfer) Name() string { return "transfer" }
+func (*Transfer) Name() string { return "transfer" }
@@ -276,3 +276,50 @@ func TestTransferNotAllowed(t *testing.T) {
 		t.Errorf("Expected REFUSED response code, got %s", dns.RcodeToString[w.Msg.Rcode])
 	}
 }
+
+func TestTransferSetTo(t *testing.T) {
+	transfer := newTestTransfer()
+	if err := transfer.SetTo("example.org.", []string{"1.2.3.4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &dns.Msg{}
+	m.SetAxfr("example.org.")
+	w := dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	if _, err := transfer.ServeDNS(context.TODO(), w, m); err != nil {
+		t.Error(err)
+	}
+	if w.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED response code, got %s", dns.RcodeToString[w.Msg.Rcode])
+	}
+	// The override applies to the zone in any case.
+	m.SetAxfr("Example.ORG.")
+	w = dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	if _, err := transfer.ServeDNS(context.TODO(), w, m); err != nil {
+		t.Error(err)
+	}
+	if w.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED response code for a mixed case name, got %s", dns.RcodeToString[w.Msg.Rcode])
+	}
+	// The other zone keeps its configuration.
+	m.SetAxfr("example.com.")
+	w = dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	if _, err := transfer.ServeDNS(context.TODO(), w, m); err != nil {
+		t.Error(err)
+	}
+	if w.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR response code, got %s", dns.RcodeToString[w.Msg.Rcode])
+	}
+
+	if err := transfer.SetTo("example.org.", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.SetAxfr("example.org.")
+	w = dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	if _, err := transfer.ServeDNS(context.TODO(), w, m); err != nil {
+		t.Error(err)
+	}
+	if w.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR response code without the override, got %s", dns.RcodeToString[w.Msg.Rcode])
+	}
+}
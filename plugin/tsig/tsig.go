@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -75,6 +76,7 @@ func (t *TSIGServer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	}
 
 	if rcode == dns.RcodeSuccess {
+		ctx = context.WithValue(ctx, keyName{}, strings.ToLower(tsigRR.Hdr.Name))
 		rcode, err = plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 		if err != nil {
 			log.Errorf("request handler returned an error: %v\n", err)
@@ -88,6 +90,15 @@ func (t *TSIGServer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	return dns.RcodeSuccess, nil
 }
 
+type keyName struct{}
+
+// KeyName returns the name of the TSIG key the request was signed with. It returns false if the request wasn't
+// signed, or if it wasn't validated by this plugin.
+func KeyName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(keyName{}).(string)
+	return name, ok
+}
+
 func (t *TSIGServer) tsigRequired(qtype uint16) bool {
 	if t.all {
 		return true
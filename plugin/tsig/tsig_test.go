@@ -226,6 +226,39 @@ func TestServeDNSTsigErrors(t *testing.T) {
 	}
 }
 
+func TestKeyName(t *testing.T) {
+	var (
+		name string
+		ok   bool
+	)
+	tsig := TSIGServer{
+		Zones: []string{"."},
+		Next: test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			name, ok = KeyName(ctx)
+			return testHandler()(ctx, w, r)
+		}),
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion("test.example.", dns.TypeA)
+	r.SetTsig("Test.Key.", dns.HmacSHA256, 300, time.Now().Unix())
+	if _, err := tsig.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r); err != nil {
+		t.Fatal(err)
+	}
+	if !ok || name != "test.key." {
+		t.Errorf("expected key name %q, got %q (%t)", "test.key.", name, ok)
+	}
+
+	r = new(dns.Msg)
+	r.SetQuestion("test.example.", dns.TypeA)
+	if _, err := tsig.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r); err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("expected no key name for an unsigned request, got %q", name)
+	}
+}
+
 func testHandler() test.HandlerFunc {
 	return func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 		state := request.Request{W: w, Req: r}
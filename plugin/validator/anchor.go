@@ -0,0 +1,65 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// root holds the DS records of the root zone KSKs, as published by IANA in https://data.iana.org/root-anchors/.
+const root = `
+. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+func rootAnchors() map[string][]*dns.DS {
+	anchors, err := parseAnchors(strings.NewReader(root), "root")
+	if err != nil {
+		panic(err)
+	}
+	return anchors
+}
+
+// readAnchors reads the trust anchors from the zone file path, in which they are DS or DNSKEY records.
+func readAnchors(path string) (map[string][]*dns.DS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseAnchors(f, path)
+}
+
+func parseAnchors(r io.Reader, file string) (map[string][]*dns.DS, error) {
+	anchors := map[string][]*dns.DS{}
+	zp := dns.NewZoneParser(r, ".", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		var ds *dns.DS
+		switch x := rr.(type) {
+		case *dns.DS:
+			ds = x
+		case *dns.DNSKEY:
+			if x.Flags&dns.ZONE == 0 {
+				return nil, fmt.Errorf("DNSKEY %d of %q in %q is not a zone key", x.KeyTag(), x.Header().Name, file)
+			}
+			ds = x.ToDS(dns.SHA256)
+		default:
+			return nil, fmt.Errorf("trust anchor in %q is not a DS or DNSKEY record: %s", file, rr)
+		}
+		if ds == nil {
+			return nil, fmt.Errorf("invalid trust anchor in %q: %s", file, rr)
+		}
+		zone := strings.ToLower(ds.Header().Name)
+		anchors[zone] = append(anchors[zone], ds)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no trust anchors in %q", file)
+	}
+	return anchors, nil
+}
@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// validate validates the response m to the request in state (RFC 4035, section 5). The records in the answer
+// section are validated first, if the chain of trust holds for all of them, the denial of existence records in the
+// authority section are checked for negative and wildcard answers.
+func (val *validation) validate(state request.Request, m *dns.Msg) result {
+	if val.v.negative(state.Name()) {
+		return resultInsecure
+	}
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		// There is nothing to validate in an error.
+		return resultInsecure
+	}
+
+	res := resultSecure
+	type wildcard struct {
+		name   string
+		labels uint8
+	}
+	wildcards := []wildcard{}
+	sets := rrsets(m.Answer)
+	for _, set := range sets {
+		if synthesized(set, sets) {
+			continue
+		}
+		r, sig := val.verify(set)
+		switch r.status {
+		case bogus:
+			return r
+		case insecure:
+			res = resultInsecure
+		}
+		if sig != nil && int(sig.Labels) < dns.CountLabel(set.name()) {
+			wildcards = append(wildcards, wildcard{set.name(), sig.Labels})
+		}
+	}
+	if res.status == insecure {
+		return res
+	}
+
+	auth := val.verifyAuthority(m.Ns)
+	if auth.status == bogus {
+		return auth
+	}
+	nsecs, nsec3s := denial(m.Ns)
+
+	target, answered := answerTarget(state.Name(), state.QType(), m.Answer)
+	if answered && m.Rcode == dns.RcodeSuccess {
+		if len(wildcards) > 0 && tooManyIterations(nsec3s) {
+			return resultInsecure
+		}
+		for _, w := range wildcards {
+			if !proveWildcard(w.name, w.labels, nsecs, nsec3s) {
+				return resultBogus(dns.ExtendedErrorCodeNSECMissing)
+			}
+		}
+		if len(wildcards) > 0 {
+			return auth
+		}
+		return res
+	}
+
+	if auth.status == insecure {
+		return auth
+	}
+	if len(nsecs) == 0 && len(nsec3s) == 0 {
+		if r := val.unsigned(target); r.status != bogus {
+			return r
+		}
+		return resultBogus(dns.ExtendedErrorCodeNSECMissing)
+	}
+
+	if tooManyIterations(nsec3s) {
+		return resultInsecure
+	}
+	var ok, opt bool
+	if m.Rcode == dns.RcodeNameError {
+		ok, opt = proveNameError(target, nsecs, nsec3s)
+	} else {
+		ok, opt = proveNoData(target, state.QType(), nsecs, nsec3s)
+	}
+	switch {
+	case !ok:
+		return resultBogus(dns.ExtendedErrorCodeNSECMissing)
+	case opt:
+		// RFC 5155, section 9.2: an opt-out proof doesn't prove the name is secure.
+		return resultInsecure
+	}
+	return res
+}
+
+// answerTarget follows the CNAME records in the answer section rrs from qname, and returns the name the chain ends
+// at, and whether that name has records of type qtype.
+func answerTarget(qname string, qtype uint16, rrs []dns.RR) (string, bool) {
+	target := qname
+	for i := 0; i < len(rrs); i++ {
+		found := false
+		for _, rr := range rrs {
+			if !equal(rr.Header().Name, target) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype || qtype == dns.TypeANY {
+				return target, true
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				target = cname.Target
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return target, false
+}
+
+// synthesized returns true if set is an unsigned CNAME synthesized from a DNAME record in sets (RFC 6672,
+// section 5.3.1). The DNAME record is validated instead.
+func synthesized(set *rrset, sets []*rrset) bool {
+	if set.qtype() != dns.TypeCNAME || len(set.sigs) > 0 {
+		return false
+	}
+	for _, s := range sets {
+		if s.qtype() == dns.TypeDNAME && dns.IsSubDomain(s.name(), set.name()) && !equal(s.name(), set.name()) {
+			return true
+		}
+	}
+	return false
+}
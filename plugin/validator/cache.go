@@ -0,0 +1,64 @@
+package validator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	minTTL = 60   // the time, in seconds, a bogus zone is remembered, and the minimum for all others
+	maxTTL = 3600 // the maximum time, in seconds, the keys of a zone are remembered
+
+	maxEntries = 10000 // the cache is emptied when it grows beyond this
+)
+
+// keyEntry is the status of a zone and, if it is secure, its validated keys.
+type keyEntry struct {
+	status status
+	ede    uint16
+	keys   []*dns.DNSKEY
+	ttl    uint32
+}
+
+// keyCache remembers the keys of the zones validated before.
+type keyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedKeys
+}
+
+type cachedKeys struct {
+	keyEntry
+	expires time.Time
+}
+
+func newKeyCache() *keyCache { return &keyCache{entries: map[string]cachedKeys{}} }
+
+func (c *keyCache) get(zone string, now time.Time) (keyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[zone]
+	if !ok || !now.Before(e.expires) {
+		return keyEntry{}, false
+	}
+	return e.keyEntry, true
+}
+
+func (c *keyCache) set(zone string, e keyEntry, now time.Time) {
+	ttl := e.ttl
+	switch {
+	case e.status == bogus || ttl < minTTL:
+		ttl = minTTL
+	case ttl > maxTTL:
+		ttl = maxTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxEntries {
+		c.entries = map[string]cachedKeys{}
+	}
+	c.entries[zone] = cachedKeys{keyEntry: e, expires: now.Add(time.Duration(ttl) * time.Second)}
+}
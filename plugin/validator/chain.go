@@ -0,0 +1,467 @@
+package validator
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/plugin/pkg/nsec"
+
+	"github.com/miekg/dns"
+)
+
+// status is the outcome of validating an answer, an RRset or a zone (RFC 4035, section 4.3).
+type status int
+
+const (
+	secure   status = iota // the chain of trust from a trust anchor is complete
+	insecure               // there is proof the chain of trust ends above the data
+	bogus                  // the chain of trust should be complete, but is not
+	noCut                  // the name isn't a zone cut, the keys of the zone above it apply; only used for zones
+)
+
+func (s status) String() string {
+	switch s {
+	case secure:
+		return "secure"
+	case insecure:
+		return "insecure"
+	case bogus:
+		return "bogus"
+	}
+	return "nocut"
+}
+
+// result is a status with the extended DNS error (RFC 8914) that explains a bogus status.
+type result struct {
+	status status
+	ede    uint16
+}
+
+var (
+	resultSecure   = result{status: secure}
+	resultInsecure = result{status: insecure}
+)
+
+func resultBogus(ede uint16) result { return result{status: bogus, ede: ede} }
+
+// validation validates a single response. The DS and DNSKEY records it needs are asked from the next plugin.
+type validation struct {
+	v   *Validator
+	ctx context.Context
+	w   dns.ResponseWriter
+	now time.Time
+}
+
+// query asks the next plugin for name and qtype, with the DNSSEC records and without validation by the upstream.
+func (val *validation) query(name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.CheckingDisabled = true
+	m.SetEdns0(dns.DefaultMsgSize, true)
+
+	nw := nonwriter.New(val.w)
+	rcode, err := val.v.Next.ServeDNS(val.ctx, nw, m)
+	if err != nil {
+		return nil, err
+	}
+	if nw.Msg == nil {
+		return nil, errNoResponse{name, qtype, rcode}
+	}
+	return nw.Msg, nil
+}
+
+type errNoResponse struct {
+	name  string
+	qtype uint16
+	rcode int
+}
+
+func (e errNoResponse) Error() string {
+	return "no response for " + e.name + " " + dns.TypeToString[e.qtype] + ": " + dns.RcodeToString[e.rcode]
+}
+
+// rrset is a set of records with the same owner name and type, and their signatures.
+type rrset struct {
+	rrs  []dns.RR
+	sigs []*dns.RRSIG
+}
+
+func (s rrset) name() string  { return s.rrs[0].Header().Name }
+func (s rrset) qtype() uint16 { return s.rrs[0].Header().Rrtype }
+
+// rrsets groups rrs by owner name and type, in the order they appear in.
+func rrsets(rrs []dns.RR) []*rrset {
+	sets := []*rrset{}
+	idx := map[string]*rrset{}
+	key := func(name string, qtype uint16) string {
+		return strings.ToLower(name) + "/" + dns.TypeToString[qtype]
+	}
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT || rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
+		}
+		k := key(rr.Header().Name, rr.Header().Rrtype)
+		s, ok := idx[k]
+		if !ok {
+			s = &rrset{}
+			idx[k] = s
+			sets = append(sets, s)
+		}
+		s.rrs = append(s.rrs, rr)
+	}
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		if s, ok := idx[key(sig.Header().Name, sig.TypeCovered)]; ok {
+			s.sigs = append(s.sigs, sig)
+		}
+	}
+	return sets
+}
+
+// verify validates the signatures of set. On success it returns the signature that validated.
+func (val *validation) verify(set *rrset) (result, *dns.RRSIG) {
+	owner := set.name()
+	if len(set.sigs) == 0 {
+		if set.qtype() == dns.TypeDS {
+			// The DS records are in the zone above owner.
+			return val.unsigned(parent(owner)), nil
+		}
+		return val.unsigned(owner), nil
+	}
+
+	res := resultBogus(dns.ExtendedErrorCodeDNSBogus)
+	for _, sig := range set.sigs {
+		signer := dns.Fqdn(strings.ToLower(sig.SignerName))
+		if !dns.IsSubDomain(signer, owner) {
+			continue
+		}
+		// The DS records are signed by the zone above; this also stops zoneKeys from looping.
+		if set.qtype() == dns.TypeDS && equal(signer, owner) {
+			continue
+		}
+		if int(sig.Labels) > dns.CountLabel(owner) {
+			continue
+		}
+
+		keys := val.zoneKeys(signer)
+		switch keys.status {
+		case insecure:
+			return resultInsecure, nil
+		case bogus:
+			res = result{status: bogus, ede: keys.ede}
+			continue
+		case noCut:
+			continue
+		}
+
+		if !sig.ValidityPeriod(val.now) {
+			res = resultBogus(dns.ExtendedErrorCodeSignatureExpired)
+			if val.now.Before(time.Unix(int64(sig.Inception), 0)) {
+				res = resultBogus(dns.ExtendedErrorCodeSignatureNotYetValid)
+			}
+			continue
+		}
+		for _, k := range keys.keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm {
+				continue
+			}
+			if sig.Verify(k, set.rrs) == nil {
+				return resultSecure, sig
+			}
+		}
+	}
+	return res, nil
+}
+
+// zoneKeys returns the validated DNSKEY records of zone. If zone isn't a zone cut, the status is noCut.
+func (val *validation) zoneKeys(zone string) keyEntry {
+	zone = strings.ToLower(zone)
+	if e, ok := val.v.keys.get(zone, val.now); ok {
+		return e
+	}
+
+	var e keyEntry
+	if dss, ok := val.v.anchors[zone]; ok {
+		e = val.dnskeys(zone, dss)
+	} else if zone == "." {
+		e = keyEntry{status: insecure}
+	} else {
+		e = val.ds(zone)
+	}
+
+	val.v.keys.set(zone, e, val.now)
+	return e
+}
+
+// ds validates the DS records of zone and, if there are any, returns the DNSKEY records they point to.
+func (val *validation) ds(zone string) keyEntry {
+	m, err := val.query(zone, dns.TypeDS)
+	if err != nil {
+		log.Debugf("Failed to query the DS records of %s: %s", zone, err)
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeNetworkError, ttl: minTTL}
+	}
+
+	for _, set := range rrsets(m.Answer) {
+		if set.qtype() != dns.TypeDS || !equal(set.name(), zone) {
+			continue
+		}
+		res, _ := val.verify(set)
+		if res.status != secure {
+			return keyEntry{status: res.status, ede: res.ede, ttl: ttl(set.rrs)}
+		}
+		dss := []*dns.DS{}
+		for _, rr := range set.rrs {
+			dss = append(dss, rr.(*dns.DS))
+		}
+		return val.dnskeys(zone, dss)
+	}
+
+	res := val.noDS(zone, m)
+	return keyEntry{status: res.status, ede: res.ede, ttl: ttl(m.Ns)}
+}
+
+// dnskeys returns the DNSKEY records of zone, if they are validated by one of the DS records in dss.
+func (val *validation) dnskeys(zone string, dss []*dns.DS) keyEntry {
+	supported := []*dns.DS{}
+	for _, ds := range dss {
+		if supportedDigest(ds.DigestType) && supportedAlgorithm(ds.Algorithm) {
+			supported = append(supported, ds)
+		}
+	}
+	if len(supported) == 0 {
+		// RFC 4035, section 5.2: without a DS record that can be used, the zone is insecure.
+		return keyEntry{status: insecure, ttl: maxTTL}
+	}
+
+	m, err := val.query(zone, dns.TypeDNSKEY)
+	if err != nil {
+		log.Debugf("Failed to query the DNSKEY records of %s: %s", zone, err)
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeNetworkError, ttl: minTTL}
+	}
+
+	var set *rrset
+	for _, s := range rrsets(m.Answer) {
+		if s.qtype() == dns.TypeDNSKEY && equal(s.name(), zone) {
+			set = s
+		}
+	}
+	if set == nil {
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeDNSKEYMissing, ttl: minTTL}
+	}
+
+	keys := []*dns.DNSKEY{}
+	sep := []*dns.DNSKEY{}
+	for _, rr := range set.rrs {
+		k := rr.(*dns.DNSKEY)
+		if k.Flags&dns.ZONE == 0 {
+			continue
+		}
+		keys = append(keys, k)
+		for _, ds := range supported {
+			if matchDS(k, ds) {
+				sep = append(sep, k)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeNoZoneKeyBitSet, ttl: minTTL}
+	}
+	if len(sep) == 0 {
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeDNSKEYMissing, ttl: minTTL}
+	}
+	if len(set.sigs) == 0 {
+		return keyEntry{status: bogus, ede: dns.ExtendedErrorCodeRRSIGsMissing, ttl: minTTL}
+	}
+
+	// The DNSKEY RRset must be signed by a key the DS records point to.
+	ede := dns.ExtendedErrorCodeDNSBogus
+	for _, sig := range set.sigs {
+		if !equal(sig.SignerName, zone) {
+			continue
+		}
+		if !sig.ValidityPeriod(val.now) {
+			ede = dns.ExtendedErrorCodeSignatureExpired
+			if val.now.Before(time.Unix(int64(sig.Inception), 0)) {
+				ede = dns.ExtendedErrorCodeSignatureNotYetValid
+			}
+			continue
+		}
+		for _, k := range sep {
+			if k.KeyTag() == sig.KeyTag && k.Algorithm == sig.Algorithm && sig.Verify(k, set.rrs) == nil {
+				return keyEntry{status: secure, keys: keys, ttl: ttl(set.rrs)}
+			}
+		}
+	}
+	return keyEntry{status: bogus, ede: ede, ttl: minTTL}
+}
+
+// noDS checks the proof, in the response m to the DS query for zone, that there are no DS records for zone. The
+// status is insecure if zone is a delegation to an unsigned zone, noCut if zone isn't a delegation at all.
+func (val *validation) noDS(zone string, m *dns.Msg) result {
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return resultBogus(dns.ExtendedErrorCodeDNSBogus)
+	}
+	if len(m.Ns) == 0 {
+		return val.unsigned(parent(zone))
+	}
+	if res := val.verifyAuthority(m.Ns); res.status != secure {
+		return res
+	}
+
+	nsecs, nsec3s := denial(m.Ns)
+	for _, n := range nsecs {
+		if equal(n.Header().Name, zone) {
+			return cutStatus(n.TypeBitMap)
+		}
+		if m.Rcode == dns.RcodeNameError && nsecDenies(n, zone) {
+			return result{status: noCut}
+		}
+	}
+	if tooManyIterations(nsec3s) {
+		return resultInsecure
+	}
+	for _, n := range nsec3s {
+		if n.Match(zone) {
+			return cutStatus(n.TypeBitMap)
+		}
+	}
+	if len(nsec3s) > 0 {
+		// RFC 5155, section 8.6: an opt-out NSEC3 record covering the next closer name proves an insecure delegation.
+		if ce, nc := closestEncloser(zone, nsec3s); ce != "" {
+			if n := nsec3Cover(nc, nsec3s); n != nil {
+				if n.Flags&optOut != 0 {
+					return resultInsecure
+				}
+				return result{status: noCut}
+			}
+		}
+	}
+	return resultBogus(dns.ExtendedErrorCodeNSECMissing)
+}
+
+// cutStatus returns the status of a name without DS records from the type bit map of the NSEC or NSEC3 record that
+// matches it.
+func cutStatus(bitmap []uint16) result {
+	switch {
+	case nsec.HasType(bitmap, dns.TypeDS):
+		// The DS records exist, but weren't given.
+		return resultBogus(dns.ExtendedErrorCodeDNSBogus)
+	case nsec.HasType(bitmap, dns.TypeNS) && !nsec.HasType(bitmap, dns.TypeSOA):
+		return resultInsecure
+	}
+	return result{status: noCut}
+}
+
+// unsigned returns the status of unsigned data at name: insecure if the chain of trust ends above name, bogus if
+// the data should have been signed.
+func (val *validation) unsigned(name string) result {
+	name = strings.ToLower(dns.Fqdn(name))
+	if val.v.negative(name) {
+		return resultInsecure
+	}
+	anchor := val.v.anchor(name)
+	if anchor == "" {
+		return resultInsecure
+	}
+
+	// Walk down from the trust anchor to name, looking for the zone cut to an unsigned zone.
+	idx := dns.Split(name)
+	for i := len(idx) - dns.CountLabel(anchor); i >= 0; i-- {
+		zone := "."
+		if i < len(idx) {
+			zone = name[idx[i]:]
+		}
+		keys := val.zoneKeys(zone)
+		switch keys.status {
+		case insecure:
+			return resultInsecure
+		case bogus:
+			return result{status: bogus, ede: keys.ede}
+		}
+	}
+	return resultBogus(dns.ExtendedErrorCodeRRSIGsMissing)
+}
+
+// verifyAuthority validates the SOA, NSEC and NSEC3 RRsets in the authority section rrs.
+func (val *validation) verifyAuthority(rrs []dns.RR) result {
+	res := resultSecure
+	for _, set := range rrsets(rrs) {
+		switch set.qtype() {
+		case dns.TypeSOA, dns.TypeNSEC, dns.TypeNSEC3:
+		default:
+			continue
+		}
+		r, _ := val.verify(set)
+		switch r.status {
+		case bogus:
+			return r
+		case insecure:
+			res = resultInsecure
+		}
+	}
+	return res
+}
+
+// anchor returns the closest trust anchor at or above name, or the empty string if there is none.
+func (v *Validator) anchor(name string) string {
+	closest := ""
+	for zone := range v.anchors {
+		if dns.IsSubDomain(zone, name) && (closest == "" || dns.CountLabel(zone) > dns.CountLabel(closest)) {
+			closest = zone
+		}
+	}
+	return closest
+}
+
+// matchDS returns true if ds is the digest of k.
+func matchDS(k *dns.DNSKEY, ds *dns.DS) bool {
+	if k.KeyTag() != ds.KeyTag || k.Algorithm != ds.Algorithm {
+		return false
+	}
+	kds := k.ToDS(ds.DigestType)
+	return kds != nil && strings.EqualFold(kds.Digest, ds.Digest)
+}
+
+func supportedDigest(t uint8) bool {
+	switch t {
+	case dns.SHA1, dns.SHA256, dns.SHA384:
+		return true
+	}
+	return false
+}
+
+func supportedAlgorithm(a uint8) bool {
+	switch a {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519:
+		return true
+	}
+	return false
+}
+
+// parent returns the name one label above name.
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
+
+func equal(a, b string) bool { return strings.EqualFold(dns.Fqdn(a), dns.Fqdn(b)) }
+
+// ttl returns the smallest TTL in rrs.
+func ttl(rrs []dns.RR) uint32 {
+	min := uint32(0)
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < min {
+			min = rr.Header().Ttl
+		}
+	}
+	return min
+}
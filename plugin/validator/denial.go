@@ -0,0 +1,190 @@
+package validator
+
+import (
+	"github.com/coredns/coredns/plugin/pkg/nsec"
+
+	"github.com/miekg/dns"
+)
+
+// optOut is the opt-out flag of an NSEC3 record (RFC 5155, section 3.1.2.1).
+const optOut = 1
+
+// denial returns the NSEC and NSEC3 records in rrs.
+func denial(rrs []dns.RR) (nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) {
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, x)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, x)
+		}
+	}
+	return nsecs, nsec3s
+}
+
+// tooManyIterations returns true if an NSEC3 record uses more hash iterations than nsec.MaxIterations. The proof is
+// then treated as insecure, without computing the hashes (RFC 9276, section 3.2).
+func tooManyIterations(nsec3s []*dns.NSEC3) bool {
+	for _, n := range nsec3s {
+		if n.Iterations > nsec.MaxIterations {
+			return true
+		}
+	}
+	return false
+}
+
+// proveNoData returns true if the NSEC or NSEC3 records prove name exists, but has no records of type qtype. This
+// includes the proofs for empty non-terminals and wildcards (RFC 4035, section 5.4 and RFC 5155, section 8.5 - 8.7).
+// The second return value is true if the proof relies on an opt-out NSEC3 record.
+func proveNoData(name string, qtype uint16, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) (bool, bool) {
+	for _, n := range nsecs {
+		if equal(n.Header().Name, name) {
+			return nsec.NoData(n.TypeBitMap, qtype), false
+		}
+		// An empty non-terminal: the next name is below name.
+		if nsecDenies(n, name) && dns.IsSubDomain(name, n.NextDomain) && !equal(n.NextDomain, name) {
+			return true, false
+		}
+	}
+	for _, n := range nsecs {
+		if !nsecDenies(n, name) {
+			continue
+		}
+		ce := nsecEncloser(name, n)
+		for _, w := range nsecs {
+			if equal(w.Header().Name, "*."+ce) {
+				return nsec.NoData(w.TypeBitMap, qtype), false
+			}
+		}
+	}
+
+	for _, n := range nsec3s {
+		if n.Match(name) {
+			return nsec.NoData(n.TypeBitMap, qtype), false
+		}
+	}
+	ce, nc := closestEncloser(name, nsec3s)
+	if ce == "" {
+		return false, false
+	}
+	cover := nsec3Cover(nc, nsec3s)
+	if cover == nil {
+		return false, false
+	}
+	if qtype == dns.TypeDS && cover.Flags&optOut != 0 {
+		return true, true
+	}
+	for _, n := range nsec3s {
+		if n.Match("*." + ce) {
+			return nsec.NoData(n.TypeBitMap, qtype), false
+		}
+	}
+	return false, false
+}
+
+// proveNameError returns true if the NSEC or NSEC3 records prove name doesn't exist: the name and the wildcard at
+// its closest encloser are denied. The second return value is true if the proof relies on an opt-out NSEC3 record.
+func proveNameError(name string, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) (bool, bool) {
+	for _, n := range nsecs {
+		// If the next name is below name, name is an empty non-terminal.
+		if !nsecDenies(n, name) || dns.IsSubDomain(name, n.NextDomain) {
+			continue
+		}
+		wildcard := "*." + nsecEncloser(name, n)
+		for _, w := range nsecs {
+			if nsecDenies(w, wildcard) {
+				return true, false
+			}
+		}
+	}
+
+	ce, nc := closestEncloser(name, nsec3s)
+	if ce == "" {
+		return false, false
+	}
+	cover := nsec3Cover(nc, nsec3s)
+	if cover == nil || nsec3Cover("*."+ce, nsec3s) == nil {
+		return false, false
+	}
+	return true, cover.Flags&optOut != 0
+}
+
+// proveWildcard returns true if the NSEC or NSEC3 records prove there is no better match than the wildcard for
+// name, the expansion of a wildcard with sigLabels labels.
+func proveWildcard(name string, sigLabels uint8, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) bool {
+	idx := dns.Split(name)
+	if int(sigLabels) >= len(idx) {
+		return false
+	}
+	nc := name[idx[len(idx)-int(sigLabels)-1]:]
+	for _, n := range nsecs {
+		if nsecDenies(n, nc) {
+			return true
+		}
+	}
+	return nsec3Cover(nc, nsec3s) != nil
+}
+
+// closestEncloser returns the closest encloser of name proven by the NSEC3 records, and the next closer name. A
+// delegation or a DNAME can't be the closest encloser, the names below it aren't in the zone.
+func closestEncloser(name string, nsec3s []*dns.NSEC3) (string, string) {
+	if len(nsec3s) == 0 {
+		return "", ""
+	}
+	nc := name
+	for {
+		off, end := dns.NextLabel(nc, 0)
+		if end {
+			return "", ""
+		}
+		ce := nc[off:]
+		for _, n := range nsec3s {
+			if n.Match(ce) {
+				if nsec.Cut(n.TypeBitMap) {
+					return "", ""
+				}
+				return ce, nc
+			}
+		}
+		nc = ce
+	}
+}
+
+// nsec3Cover returns the NSEC3 record that covers, and doesn't match, name.
+func nsec3Cover(name string, nsec3s []*dns.NSEC3) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		if n.Cover(name) && !n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// nsecCovers returns true if name sorts between the owner and the next name of n. The last NSEC record in a zone
+// wraps around to the apex.
+func nsecCovers(n *dns.NSEC, name string) bool {
+	return nsec.Covers(n.Header().Name, n.NextDomain, name)
+}
+
+// nsecDenies returns true if n covers name, and is not the NSEC record of a delegation or a DNAME above name, which
+// proves nothing about the names below it.
+func nsecDenies(n *dns.NSEC, name string) bool {
+	if dns.IsSubDomain(n.Header().Name, name) && nsec.Cut(n.TypeBitMap) {
+		return false
+	}
+	return nsecCovers(n, name)
+}
+
+// nsecEncloser returns the closest encloser of name that can be derived from n, which covers it: the longest
+// ancestor of name that is an ancestor of either the owner or the next name of n.
+func nsecEncloser(name string, n *dns.NSEC) string {
+	l := dns.CompareDomainName(name, n.Header().Name)
+	if x := dns.CompareDomainName(name, n.NextDomain); x > l {
+		l = x
+	}
+	if l == 0 {
+		return "."
+	}
+	idx := dns.Split(name)
+	return name[idx[len(idx)-l]:]
+}
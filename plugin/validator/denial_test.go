@@ -0,0 +1,170 @@
+package validator
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestNSECCovers(t *testing.T) {
+	tests := []struct {
+		nsec  string
+		name  string
+		cover bool
+	}{
+		{"a.example.org. 300 IN NSEC c.example.org. A", "b.example.org.", true},
+		{"a.example.org. 300 IN NSEC c.example.org. A", "x.a.example.org.", true},
+		{"a.example.org. 300 IN NSEC c.example.org. A", "a.example.org.", false},
+		{"a.example.org. 300 IN NSEC c.example.org. A", "c.example.org.", false},
+		{"a.example.org. 300 IN NSEC c.example.org. A", "d.example.org.", false},
+		{"x.example.org. 300 IN NSEC example.org. A", "z.example.org.", true}, // the last NSEC record
+		{"x.example.org. 300 IN NSEC example.org. A", "example.net.", false},
+	}
+	for i, tc := range tests {
+		n := test.NSEC(tc.nsec)
+		if x := nsecCovers(n, tc.name); x != tc.cover {
+			t.Errorf("Test %d: expected cover of %s to be %t, got %t", i, tc.name, tc.cover, x)
+		}
+	}
+}
+
+func TestProveNSEC(t *testing.T) {
+	nsecs := []*dns.NSEC{
+		test.NSEC("example.org. 300 IN NSEC a.example.org. SOA NS NSEC RRSIG DNSKEY"),
+		test.NSEC("a.example.org. 300 IN NSEC x.b.example.org. A NSEC RRSIG"),
+		test.NSEC("x.b.example.org. 300 IN NSEC example.org. A NSEC RRSIG"),
+	}
+	if ok, _ := proveNameError("aa.example.org.", nsecs, nil); !ok {
+		t.Errorf("Expected aa.example.org. not to exist")
+	}
+	if ok, _ := proveNameError("b.example.org.", nsecs, nil); ok {
+		t.Errorf("Expected the empty non-terminal b.example.org. to exist")
+	}
+	if ok, _ := proveNoData("b.example.org.", dns.TypeA, nsecs, nil); !ok {
+		t.Errorf("Expected no A records for the empty non-terminal b.example.org.")
+	}
+	if ok, _ := proveNoData("a.example.org.", dns.TypeA, nsecs, nil); ok {
+		t.Errorf("Expected A records for a.example.org.")
+	}
+	if ok, _ := proveNoData("a.example.org.", dns.TypeMX, nsecs, nil); !ok {
+		t.Errorf("Expected no MX records for a.example.org.")
+	}
+}
+
+func TestProveNSEC3(t *testing.T) {
+	zone := "example.org."
+	apex := matchNSEC3(zone, zone, dns.TypeSOA, dns.TypeNS)
+	nc := coverNSEC3("b.example.org.", zone)
+	wildcard := coverNSEC3("*.example.org.", zone)
+
+	if ok, _ := proveNameError("a.b.example.org.", nil, []*dns.NSEC3{apex, coverNSEC3("a.b.example.org.", zone), wildcard}); ok {
+		t.Errorf("Expected no proof without a record covering the next closer name b.example.org.")
+	}
+	if ok, _ := proveNameError("a.b.example.org.", nil, []*dns.NSEC3{apex, nc, wildcard}); !ok {
+		t.Errorf("Expected a.b.example.org. not to exist")
+	}
+	if ok, opt := proveNameError("b.example.org.", nil, []*dns.NSEC3{apex, nc, wildcard}); !ok || opt {
+		t.Errorf("Expected b.example.org. not to exist, got %t %t", ok, opt)
+	}
+	if ok, _ := proveNameError("b.example.org.", nil, []*dns.NSEC3{apex, nc}); ok {
+		t.Errorf("Expected no proof without the wildcard")
+	}
+	if ok, _ := proveNoData(zone, dns.TypeA, nil, []*dns.NSEC3{apex}); !ok {
+		t.Errorf("Expected no A records for %s", zone)
+	}
+	if ok, _ := proveNoData(zone, dns.TypeSOA, nil, []*dns.NSEC3{apex}); ok {
+		t.Errorf("Expected an SOA record for %s", zone)
+	}
+
+	// An opt-out NSEC3 record proves there is no signed delegation.
+	nc.Flags = optOut
+	if ok, opt := proveNoData("b.example.org.", dns.TypeDS, nil, []*dns.NSEC3{apex, nc}); !ok || !opt {
+		t.Errorf("Expected an opt-out proof for the DS records of b.example.org., got %t %t", ok, opt)
+	}
+	if ok, _ := proveNoData("b.example.org.", dns.TypeA, nil, []*dns.NSEC3{apex, nc}); ok {
+		t.Errorf("Expected no opt-out proof for the A records of b.example.org.")
+	}
+}
+
+func TestProveCut(t *testing.T) {
+	// The NSEC records of a delegation and a DNAME prove nothing about the names below them.
+	delegation := []*dns.NSEC{test.NSEC("child.example. 300 IN NSEC z.example. NS DS RRSIG NSEC")}
+	if ok, _ := proveNameError("www.child.example.", delegation, nil); ok {
+		t.Errorf("Expected no proof for www.child.example. from the NSEC record of the delegation")
+	}
+	if ok, _ := proveNoData("child.example.", dns.TypeA, delegation, nil); ok {
+		t.Errorf("Expected no proof for child.example. A from the parent side of the delegation")
+	}
+	if ok, _ := proveNoData("child.example.", dns.TypeDNSKEY, delegation, nil); ok {
+		t.Errorf("Expected no proof for child.example. DNSKEY from the parent side of the delegation")
+	}
+	dname := []*dns.NSEC{test.NSEC("d.example. 300 IN NSEC z.example. A DNAME RRSIG NSEC")}
+	if ok, _ := proveNameError("www.d.example.", dname, nil); ok {
+		t.Errorf("Expected no proof for www.d.example. from the NSEC record of the DNAME")
+	}
+	if ok, _ := proveNoData("d.example.", dns.TypeMX, dname, nil); !ok {
+		t.Errorf("Expected no MX records for d.example.")
+	}
+
+	zone := "example."
+	ce := matchNSEC3("child.example.", zone, dns.TypeNS, dns.TypeDS)
+	nc := coverNSEC3("www.child.example.", zone)
+	wildcard := coverNSEC3("*.child.example.", zone)
+	if ok, _ := proveNameError("www.child.example.", nil, []*dns.NSEC3{ce, nc, wildcard}); ok {
+		t.Errorf("Expected no proof for www.child.example. with the delegation as closest encloser")
+	}
+	if ok, _ := proveNoData("child.example.", dns.TypeA, nil, []*dns.NSEC3{ce}); ok {
+		t.Errorf("Expected no proof for child.example. A from the parent side of the delegation")
+	}
+}
+
+func TestTooManyIterations(t *testing.T) {
+	n := matchNSEC3("example.org.", "example.org.", dns.TypeSOA)
+	if tooManyIterations([]*dns.NSEC3{n}) {
+		t.Errorf("Expected 0 iterations to be fine")
+	}
+	n.Iterations = 101
+	if !tooManyIterations([]*dns.NSEC3{n}) {
+		t.Errorf("Expected 101 iterations to be too many")
+	}
+}
+
+var b32 = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// matchNSEC3 returns an NSEC3 record that matches name.
+func matchNSEC3(name, zone string, types ...uint16) *dns.NSEC3 {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, 0, ""))
+	return newNSEC3(h, add(h, 1), zone, types)
+}
+
+// coverNSEC3 returns an NSEC3 record that covers name, and nothing else.
+func coverNSEC3(name, zone string) *dns.NSEC3 {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, 0, ""))
+	return newNSEC3(add(h, -1), add(h, 1), zone, nil)
+}
+
+func newNSEC3(owner, next []byte, zone string, types []uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(b32.EncodeToString(owner)) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash:       dns.SHA1,
+		HashLength: uint8(len(next)),
+		NextDomain: b32.EncodeToString(next),
+		TypeBitMap: types,
+	}
+}
+
+// add adds d, 1 or -1, to the hash h.
+func add(h []byte, d int) []byte {
+	n := append([]byte{}, h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i] += byte(d)
+		if (d > 0 && n[i] != 0) || (d < 0 && n[i] != 0xff) {
+			break
+		}
+	}
+	return n
+}
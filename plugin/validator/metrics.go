@@ -0,0 +1,16 @@
+package validator
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ResponseCount is the number of responses validated, by the result of the validation.
+var ResponseCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "validator",
+	Name:      "responses_total",
+	Help:      "Counter of responses validated, by result: secure, insecure or bogus.",
+}, []string{"server", "result"})
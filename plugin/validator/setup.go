@@ -0,0 +1,85 @@
+package validator
+
+import (
+	"path/filepath"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+func init() { plugin.Register("validator", setup) }
+
+func setup(c *caddy.Controller) error {
+	v, err := parse(c)
+	if err != nil {
+		return plugin.Error("validator", err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		v.Next = next
+		return v
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Validator, error) {
+	config := dnsserver.GetConfig(c)
+	var v *Validator
+	configured := map[string][]*dns.DS{}
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		v = New(plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys))
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "trust_anchor":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, path := range args {
+					if !filepath.IsAbs(path) && config.Root != "" {
+						path = filepath.Join(config.Root, path)
+					}
+					anchors, err := readAnchors(path)
+					if err != nil {
+						return nil, c.Errf("failed to read trust anchors: %s", err)
+					}
+					for zone, dss := range anchors {
+						configured[zone] = append(configured[zone], dss...)
+					}
+				}
+			case "negative_trust_anchor":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					nta := plugin.Host(a).NormalizeExact()
+					if len(nta) == 0 {
+						return nil, c.Errf("invalid negative trust anchor %q", a)
+					}
+					v.nta = append(v.nta, nta...)
+				}
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	// A configured trust anchor for the root zone replaces the built-in one.
+	for zone, dss := range configured {
+		v.anchors[zone] = dss
+	}
+	return v, nil
+}
@@ -0,0 +1,69 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	anchors := filepath.Join(dir, "anchors")
+	if err := os.WriteFile(anchors, []byte(`
+example.org. IN DS 12345 13 2 3490A6806D47F17A34C29E2CE80E8A999FFBE4BE
+example.net. IN DNSKEY 257 3 13 oJMRESz5E4gYzS/q6XDrvU1qMPYIjCWzJaOau8XNEZeqCYKD5ar0IRd8KqXXFJkqmVfRvMGPmM1x8fGAa2XhSA==
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "root")
+	if err := os.WriteFile(root, []byte(". IN DS 12345 8 2 3490A6806D47F17A34C29E2CE80E8A999FFBE4BE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("example.org. IN A 127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config  string
+		wantErr bool
+		anchors int // the number of zones with trust anchors
+		roots   int // the number of root trust anchors
+		nta     int
+	}{
+		{"validator", false, 1, 2, 0},
+		{"validator example.org {\nnegative_trust_anchor example.org example.net\n}", false, 1, 2, 2},
+		{"validator {\ntrust_anchor " + anchors + "\n}", false, 3, 2, 0},
+		{"validator {\ntrust_anchor " + anchors + " " + root + "\n}", false, 3, 1, 0},
+		{"validator {\ntrust_anchor\n}", true, 0, 0, 0},
+		{"validator {\ntrust_anchor " + bad + "\n}", true, 0, 0, 0},
+		{"validator {\ntrust_anchor " + filepath.Join(dir, "missing") + "\n}", true, 0, 0, 0},
+		{"validator {\nnegative_trust_anchor\n}", true, 0, 0, 0},
+		{"validator {\nfoo\n}", true, 0, 0, 0},
+		{"validator\nvalidator", true, 0, 0, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		v, err := parse(c)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if x := len(v.anchors); x != tc.anchors {
+			t.Errorf("Test %d: expected trust anchors for %d zones, got %d", i, tc.anchors, x)
+		}
+		if x := len(v.anchors["."]); x != tc.roots {
+			t.Errorf("Test %d: expected %d root trust anchors, got %d", i, tc.roots, x)
+		}
+		if x := len(v.nta); x != tc.nta {
+			t.Errorf("Test %d: expected %d negative trust anchors, got %d", i, tc.nta, x)
+		}
+	}
+}
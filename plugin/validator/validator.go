@@ -0,0 +1,160 @@
+// Package validator implements a plugin that validates the DNSSEC signatures of the answers it passes on.
+package validator
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin("validator")
+
+// Validator validates the answers of the next plugin with the chain of trust from its trust anchors.
+type Validator struct {
+	Next  plugin.Handler
+	Zones []string
+
+	anchors map[string][]*dns.DS // trust anchors by zone
+	nta     []string             // negative trust anchors, the names below these are not validated
+	keys    *keyCache
+
+	now func() time.Time
+}
+
+// New returns a new Validator with the root trust anchors.
+func New(zones []string) *Validator {
+	return &Validator{
+		Zones:   zones,
+		anchors: rootAnchors(),
+		keys:    newKeyCache(),
+		now:     time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (v *Validator) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(v.Zones).Matches(state.Name())
+	if zone == "" || r.CheckingDisabled {
+		return plugin.NextOrFailure(v.Name(), v.Next, ctx, w, r)
+	}
+
+	// Ask the next plugin for the DNSSEC records, and for the answer even if the upstream thinks it's bogus.
+	req := r.Copy()
+	req.CheckingDisabled = true
+	if opt := req.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		req.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	nw := nonwriter.New(w)
+	rcode, err := plugin.NextOrFailure(v.Name(), v.Next, ctx, nw, req)
+	if nw.Msg == nil {
+		return rcode, err
+	}
+	resp := nw.Msg
+
+	val := &validation{v: v, ctx: ctx, w: w, now: v.now()}
+	res := val.validate(state, resp)
+	server := metrics.WithServer(ctx)
+	ResponseCount.WithLabelValues(server, res.status.String()).Inc()
+
+	if res.status == bogus {
+		log.Debugf("Bogus answer for %s %s: %s", state.Name(), state.Type(), dns.ExtendedErrorCodeToString[res.ede])
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		if opt := r.IsEdns0(); opt != nil {
+			m.SetEdns0(uint16(state.Size()), opt.Do())
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: res.ede})
+		}
+		w.WriteMsg(m)
+		return dns.RcodeServerFailure, nil
+	}
+
+	if f, ok := ctx.Value(denialKey{}).(func(*dns.Msg)); ok && res.status == secure && noAnswer(resp) {
+		d := resp.Copy()
+		d.AuthenticatedData = true
+		f(d)
+	}
+
+	// RFC 6840, section 5.8: only set the AD bit if the client asked for it, or for DNSSEC records.
+	resp.AuthenticatedData = res.status == secure && (state.Do() || r.AuthenticatedData)
+	resp.CheckingDisabled = false
+	resp.Id = r.Id
+	if !state.Do() {
+		resp.Answer = filterDNSSEC(resp.Answer, state.QType())
+		resp.Ns = filterDNSSEC(resp.Ns, state.QType())
+		resp.Extra = filterDNSSEC(resp.Extra, state.QType())
+	}
+	if r.IsEdns0() == nil {
+		resp.Extra = filterOPT(resp.Extra)
+	} else if opt := resp.IsEdns0(); opt != nil && !state.Do() {
+		opt.SetDo(false)
+	}
+
+	w.WriteMsg(resp)
+	return dns.RcodeSuccess, nil
+}
+
+// denialKey is the context key of the function set with WithDenial.
+type denialKey struct{}
+
+// WithDenial returns a copy of ctx in which the validator calls f with each negative response it validated as
+// secure, with all its DNSSEC records and the AD bit set. This happens before the DNSSEC records are removed for
+// a client that didn't set the DO bit, so a plugin in front of the validator can still use the denial of existence.
+func WithDenial(ctx context.Context, f func(m *dns.Msg)) context.Context {
+	return context.WithValue(ctx, denialKey{}, f)
+}
+
+// noAnswer returns true if m is a name error, or a no data response.
+func noAnswer(m *dns.Msg) bool {
+	return m.Rcode == dns.RcodeNameError || (m.Rcode == dns.RcodeSuccess && len(m.Answer) == 0)
+}
+
+// Name implements the plugin.Handler interface.
+func (v *Validator) Name() string { return "validator" }
+
+// negative returns true if name is at or below a negative trust anchor.
+func (v *Validator) negative(name string) bool {
+	for _, nta := range v.nta {
+		if dns.IsSubDomain(nta, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDNSSEC removes the DNSSEC records from rrs, unless they have type qtype.
+func filterDNSSEC(rrs []dns.RR, qtype uint16) []dns.RR {
+	filtered := rrs[:0]
+	for _, rr := range rrs {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		filtered = append(filtered, rr)
+	}
+	return filtered
+}
+
+// filterOPT removes the OPT record from rrs.
+func filterOPT(rrs []dns.RR) []dns.RR {
+	filtered := rrs[:0]
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,382 @@
+package validator
+
+import (
+	"context"
+	"crypto"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/nsec"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is a zone of the test hierarchy, signed if it has a key.
+type testZone struct {
+	origin string
+	rrs    []dns.RR
+	key    *dns.DNSKEY
+	priv   crypto.Signer
+}
+
+func newTestZone(t *testing.T, origin string, signed bool, rrs ...string) *testZone {
+	t.Helper()
+	z := &testZone{origin: origin}
+	z.rrs = append(z.rrs,
+		test.SOA(origin+" 3600 IN SOA ns.example.net. hostmaster.example.net. 1 3600 600 86400 300"),
+		test.NS(origin+" 3600 IN NS ns.example.net."),
+	)
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.rrs = append(z.rrs, rr)
+	}
+	if signed {
+		z.key = &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     dns.ZONE | dns.SEP,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		priv, err := z.key.Generate(256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.priv = priv.(crypto.Signer)
+	}
+	return z
+}
+
+// delegate adds the delegation of child to z, with the DS record of the key of child, if it is signed.
+func (z *testZone) delegate(child *testZone) {
+	z.rrs = append(z.rrs, test.NS(child.origin+" 3600 IN NS ns.example.net."))
+	if child.key != nil {
+		z.rrs = append(z.rrs, child.key.ToDS(dns.SHA256))
+	}
+}
+
+// sign adds the DNSKEY record, the NSEC chain and the signatures to z.
+func (z *testZone) sign(t *testing.T, incep, expir time.Time) {
+	t.Helper()
+	if z.key == nil {
+		return
+	}
+	z.rrs = append(z.rrs, z.key)
+
+	types := map[string][]uint16{}
+	cuts := map[string]bool{}
+	for _, rr := range z.rrs {
+		name := rr.Header().Name
+		types[name] = append(types[name], rr.Header().Rrtype)
+		if rr.Header().Rrtype == dns.TypeNS && name != z.origin {
+			cuts[name] = true
+		}
+	}
+	names := []string{}
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return nsec.Compare(names[i], names[j]) < 0 })
+	for i, name := range names {
+		bitmap := append(types[name], dns.TypeNSEC, dns.TypeRRSIG)
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		z.rrs = append(z.rrs, &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: bitmap,
+		})
+	}
+
+	sets := rrsets(z.rrs)
+	for _, set := range sets {
+		if cuts[set.name()] && set.qtype() == dns.TypeNS {
+			continue
+		}
+		z.rrs = append(z.rrs, z.rrsig(t, set.rrs, incep, expir))
+	}
+}
+
+func (z *testZone) rrsig(t *testing.T, rrs []dns.RR, incep, expir time.Time) *dns.RRSIG {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrs[0].Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.origin,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(incep.Unix()),
+		Expiration: uint32(expir.Unix()),
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// replace replaces the signatures of the RRset with owner name and type qtype with sig, or removes them if sig is nil.
+func (z *testZone) replace(name string, qtype uint16, sig *dns.RRSIG) {
+	rrs := z.rrs[:0]
+	for _, rr := range z.rrs {
+		if s, ok := rr.(*dns.RRSIG); ok && s.Header().Name == name && s.TypeCovered == qtype {
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	if sig != nil {
+		rrs = append(rrs, sig)
+	}
+	z.rrs = rrs
+}
+
+func (z *testZone) file(t *testing.T) file.File {
+	t.Helper()
+	zone := file.NewZone(z.origin, "stdin")
+	for _, rr := range z.rrs {
+		if err := zone.Insert(dns.Copy(rr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{z.origin: zone}, Names: []string{z.origin}}}
+}
+
+// hierarchy returns a handler that answers from a signed root zone, a signed org. zone, and the zones below it:
+// example.org. (signed), insecure.org. (not signed) and bogus.org. (signed, with a DS record that doesn't match).
+// It returns the trust anchor of the root zone as well.
+func hierarchy(t *testing.T) (plugin.Handler, *dns.DS) {
+	t.Helper()
+	now := time.Now()
+	incep, expir := now.Add(-time.Hour), now.Add(time.Hour)
+
+	root := newTestZone(t, ".", true)
+	org := newTestZone(t, "org.", true)
+	example := newTestZone(t, "example.org.", true,
+		"www.example.org. 3600 IN A 127.0.0.1",
+		"*.wild.example.org. 3600 IN A 127.0.0.2",
+		"cname.example.org. 3600 IN CNAME www.example.org.",
+		"expired.example.org. 3600 IN A 127.0.0.3",
+		"tampered.example.org. 3600 IN A 127.0.0.4",
+		"nosig.example.org. 3600 IN A 127.0.0.5",
+	)
+	insecure := newTestZone(t, "insecure.org.", false, "www.insecure.org. 3600 IN A 127.0.0.6")
+	bogusZone := newTestZone(t, "bogus.org.", true, "www.bogus.org. 3600 IN A 127.0.0.7")
+	other := newTestZone(t, "bogus.org.", true)
+
+	root.delegate(org)
+	org.delegate(example)
+	org.delegate(insecure)
+	org.delegate(other) // the DS record points to another key
+	for _, z := range []*testZone{root, org, example, bogusZone} {
+		z.sign(t, incep, expir)
+	}
+
+	expired := []dns.RR{test.A("expired.example.org. 3600 IN A 127.0.0.3")}
+	example.replace("expired.example.org.", dns.TypeA, example.rrsig(t, expired, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+	example.replace("nosig.example.org.", dns.TypeA, nil)
+	for _, rr := range example.rrs {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "tampered.example.org." {
+			a.A = []byte{127, 0, 0, 44}
+		}
+	}
+
+	zones := map[string]file.File{}
+	for _, z := range []*testZone{root, org, example, insecure, bogusZone} {
+		zones[z.origin] = z.file(t)
+	}
+
+	h := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		qname := strings.ToLower(r.Question[0].Name)
+		// The DS records of a zone are in the zone above it.
+		if r.Question[0].Qtype == dns.TypeDS && qname != "." {
+			if _, ok := zones[qname]; ok {
+				qname = parent(qname)
+			}
+		}
+		for name := qname; ; name = parent(name) {
+			if f, ok := zones[name]; ok {
+				return f.ServeDNS(ctx, w, r)
+			}
+		}
+	})
+	return h, root.key.ToDS(dns.SHA256)
+}
+
+func newTestValidator(t *testing.T) *Validator {
+	t.Helper()
+	h, anchor := hierarchy(t)
+	v := New([]string{"."})
+	v.Next = h
+	v.anchors = map[string][]*dns.DS{".": {anchor}}
+	return v
+}
+
+func TestValidator(t *testing.T) {
+	v := newTestValidator(t)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+		ad    bool
+		ede   uint16
+	}{
+		{"www.example.org.", dns.TypeA, dns.RcodeSuccess, true, 0},
+		{"www.example.org.", dns.TypeMX, dns.RcodeSuccess, true, 0},     // NODATA
+		{"nx.example.org.", dns.TypeA, dns.RcodeNameError, true, 0},     // NXDOMAIN
+		{"a.b.wild.example.org.", dns.TypeA, dns.RcodeSuccess, true, 0}, // wildcard
+		{"a.wild.example.org.", dns.TypeMX, dns.RcodeSuccess, true, 0},  // wildcard NODATA
+		{"cname.example.org.", dns.TypeA, dns.RcodeSuccess, true, 0},    // CNAME
+		{"example.org.", dns.TypeDS, dns.RcodeSuccess, true, 0},         // the DS records in org.
+		{"insecure.org.", dns.TypeDS, dns.RcodeSuccess, true, 0},        // there are no DS records
+		{"www.insecure.org.", dns.TypeA, dns.RcodeSuccess, false, 0},    // insecure zone
+		{"nx.insecure.org.", dns.TypeA, dns.RcodeNameError, false, 0},   // insecure zone
+		{"www.bogus.org.", dns.TypeA, dns.RcodeServerFailure, false, dns.ExtendedErrorCodeDNSKEYMissing},
+		{"expired.example.org.", dns.TypeA, dns.RcodeServerFailure, false, dns.ExtendedErrorCodeSignatureExpired},
+		{"tampered.example.org.", dns.TypeA, dns.RcodeServerFailure, false, dns.ExtendedErrorCodeDNSBogus},
+		{"nosig.example.org.", dns.TypeA, dns.RcodeServerFailure, false, dns.ExtendedErrorCodeRRSIGsMissing},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := v.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		resp := rec.Msg
+		if resp.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[resp.Rcode])
+		}
+		if resp.AuthenticatedData != tc.ad {
+			t.Errorf("Test %d: expected AD to be %t, got %t", i, tc.ad, resp.AuthenticatedData)
+		}
+		if ede := extendedError(resp); ede != tc.ede {
+			t.Errorf("Test %d: expected extended error %d, got %d", i, tc.ede, ede)
+		}
+	}
+}
+
+func TestValidatorDO(t *testing.T) {
+	v := newTestValidator(t)
+
+	// Without DO, there are no DNSSEC records in the response, and no AD bit unless the client set it.
+	for _, ad := range []bool{false, true} {
+		m := new(dns.Msg)
+		m.SetQuestion("nx.example.org.", dns.TypeA)
+		m.AuthenticatedData = ad
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		v.ServeDNS(context.TODO(), rec, m)
+
+		resp := rec.Msg
+		if resp.AuthenticatedData != ad {
+			t.Errorf("Expected AD to be %t, got %t", ad, resp.AuthenticatedData)
+		}
+		if resp.IsEdns0() != nil {
+			t.Errorf("Expected no OPT record")
+		}
+		for _, rr := range append(append(resp.Answer, resp.Ns...), resp.Extra...) {
+			switch rr.Header().Rrtype {
+			case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+				t.Errorf("Expected no DNSSEC records, got %s", rr)
+			}
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+	if len(rec.Msg.Answer) != 2 {
+		t.Errorf("Expected the A record and its signature, got %v", rec.Msg.Answer)
+	}
+}
+
+func TestValidatorWithDenial(t *testing.T) {
+	v := newTestValidator(t)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		cd     bool
+		handed bool
+	}{
+		{"nx.example.org.", dns.TypeA, false, true},
+		{"www.example.org.", dns.TypeMX, false, true},
+		{"www.example.org.", dns.TypeA, false, false}, // not a negative response
+		{"nx.insecure.org.", dns.TypeA, false, false}, // not secure
+		{"nx.example.org.", dns.TypeA, true, false},   // not validated
+	}
+	for i, tc := range tests {
+		var handed *dns.Msg
+		ctx := WithDenial(context.TODO(), func(m *dns.Msg) { handed = m })
+
+		// The client doesn't set the DO bit.
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.CheckingDisabled = tc.cd
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		v.ServeDNS(ctx, rec, m)
+
+		if !tc.handed {
+			if handed != nil {
+				t.Errorf("Test %d: expected no denial to be handed over, got %s", i, handed)
+			}
+			continue
+		}
+		if handed == nil {
+			t.Fatalf("Test %d: expected the denial to be handed over", i)
+		}
+		if !handed.AuthenticatedData {
+			t.Errorf("Test %d: expected the AD bit to be set", i)
+		}
+		if nsecs, nsec3s := denial(handed.Ns); len(nsecs)+len(nsec3s) == 0 {
+			t.Errorf("Test %d: expected the NSEC records, got %v", i, handed.Ns)
+		}
+		if len(rec.Msg.Ns) != 1 {
+			t.Errorf("Test %d: expected only the SOA record for the client, got %v", i, rec.Msg.Ns)
+		}
+	}
+}
+
+func TestValidatorPassThrough(t *testing.T) {
+	v := newTestValidator(t)
+	v.nta = []string{"bogus.org."}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.bogus.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeSuccess || rec.Msg.AuthenticatedData {
+		t.Errorf("Expected an insecure answer below a negative trust anchor, got %s", rec.Msg)
+	}
+
+	// With CD, the client validates itself.
+	v.nta = nil
+	m.CheckingDisabled = true
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	v.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected the answer with CD set, got %s", rec.Msg)
+	}
+}
+
+func extendedError(m *dns.Msg) uint16 {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return 0
+	}
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok {
+			return ede.InfoCode
+		}
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -160,6 +161,79 @@ func TestAutoAXFR(t *testing.T) {
 	}
 }
 
+func TestAutoWatch(t *testing.T) {
+	t.Parallel()
+	tmpdir := t.TempDir()
+
+	corefile := `org:0 {
+		auto {
+			directory ` + tmpdir + ` db\.(.*) {1}
+			reload 1h
+			sidecar
+		}
+		transfer {
+			to *
+		}
+	}`
+
+	i, udp, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// Zones in new directories are picked up right away, not after the reload interval.
+	dir := filepath.Join(tmpdir, "customer1", "eu")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond) // wait for the directories to be watched
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org.conf"), []byte("transfer to 10.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org"), []byte(zoneContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1 * time.Second) // wait for it to be picked up
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	resp, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatal("Expected to receive reply, but didn't")
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 RR in the answer section, got %d", len(resp.Answer))
+	}
+
+	// The sidecar file only allows transfers to 10.0.0.1.
+	m.SetAxfr("example.org.")
+	c := &dns.Client{Net: "tcp"}
+	resp, _, err = c.Exchange(m, tcp)
+	if err != nil {
+		t.Fatal("Expected to receive reply, but didn't")
+	}
+	if resp.Rcode != dns.RcodeRefused {
+		t.Fatalf("Expected reply to be REFUSED, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Changes to the zone are picked up right away too.
+	changed := strings.Replace(strings.Replace(zoneContent, "2016082534", "2016082535", 1), "127.0.0.1", "127.0.0.2", 1)
+	if err := os.WriteFile(filepath.Join(dir, "db.example.org"), []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1 * time.Second) // wait for it to be picked up
+
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	resp, err = dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatal("Expected to receive reply, but didn't")
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "127.0.0.2" {
+		t.Fatalf("Expected the changed A record, got %v", resp.Answer)
+	}
+}
+
 const zoneContent = `; testzone
 @   IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082534 7200 3600 1209600 3600
     IN NS  a.iana-servers.net.
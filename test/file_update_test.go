@@ -0,0 +1,80 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneUpdate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.example.org")
+	if err := os.WriteFile(name, []byte(exampleOrg), 0644); err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+
+	corefile := `example.org:0 {
+		tsig {
+			secret ` + tsigKey + ` ` + tsigSecret + `
+		}
+		file ` + name + ` {
+			update ` + tsigKey + `
+		}
+	}`
+
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	a, _ := dns.NewRR("dhcp.example.org. 300 IN A 10.0.0.1")
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.RRsetNotUsed([]dns.RR{a})
+	m.Insert([]dns.RR{a})
+
+	// Without TSIG the update is refused.
+	resp, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an unsigned update, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	m.SetTsig(tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+	client := dns.Client{Net: "udp", TsigSecret: map[string]string{tsigKey: tsigSecret}}
+	resp, _, err = client.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR for the update, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	q := new(dns.Msg)
+	q.SetQuestion("dhcp.example.org.", dns.TypeA)
+	resp, err = dns.Exchange(q, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 RR in the answer section, got %d", len(resp.Answer))
+	}
+
+	q.SetQuestion("example.org.", dns.TypeSOA)
+	resp, err = dns.Exchange(q, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.SOA).Serial != 2015082542 {
+		t.Errorf("Expected SOA with serial 2015082542, got %v", resp.Answer)
+	}
+
+	if _, err := os.Stat(name + ".jnl"); err != nil {
+		t.Errorf("Expected a journal: %s", err)
+	}
+}
@@ -84,6 +84,58 @@ func TestSecondaryZoneTransfer(t *testing.T) {
 	}
 }
 
+func TestSecondaryCatalogZone(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `.:0 {
+		file ` + name + ` example.org {
+			catalog catalog.invalid
+		}
+		transfer {
+			to *
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	corefile = `.:0 {
+		secondary catalog.invalid {
+			transfer from ` + tcp + `
+			catalog
+		}
+	}`
+
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+
+	var r *dns.Msg
+	// The catalog zone and then the member zone are transferred in the background.
+	for i := 0; i < 50; i++ {
+		r, _ = dns.Exchange(m, udp)
+		if r != nil && len(r.Answer) != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if r == nil || len(r.Answer) == 0 {
+		t.Fatalf("Expected the member zone example.org. to be served")
+	}
+}
+
 func TestIxfrResponse(t *testing.T) {
 	// ixfr query with current soa should return single packet with that soa (no transfer needed).
 	name, rm, err := test.TempFile(".", exampleOrg)